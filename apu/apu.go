@@ -1,9 +1,5 @@
 package apu
 
-import (
-	"vsasakiv/nesemulator/mappers"
-)
-
 // the max samples per frame is actually 89341 / cyclePerSample which is approximately
 // 734 samples, so we use 1024 for safety
 const samplesPerFrame uint = 1024
@@ -35,7 +31,7 @@ func BuildMixerLookupTable() []float64 {
 
 type Apu struct {
 	clockCounter  uint
-	apuCycle      uint
+	frameCounter  FrameCounter
 	currentSample []byte
 	Pulse1        Pulse
 	Pulse2        Pulse
@@ -62,7 +58,7 @@ func NewApu() *Apu {
 
 func (apu *Apu) Reset() {
 	apu.clockCounter = 0
-	apu.apuCycle = 0
+	apu.frameCounter.reset()
 }
 
 var apu Apu = *NewApu()
@@ -73,36 +69,18 @@ func Clock() {
 		// triangle clocks at cpu speed
 		apu.Triangle.clockTimer()
 		apu.Noise.clockTimer()
+		apu.frameCounter.clock()
 	}
 	if apu.clockCounter == 6 {
-		apu.apuCycle++
 		apu.Pulse1.clockTimer()
 		apu.Pulse2.clockTimer()
 
 		apu.Triangle.clockTimer()
 		apu.Noise.clockTimer()
 		apu.Dmc.clockTimer()
+		apu.frameCounter.clock()
 		apu.clockCounter = 0
 	}
-
-	if apu.apuCycle == 3728 && apu.clockCounter == 0 {
-		clockQuarterFrame()
-	}
-	// half frame
-	if apu.apuCycle == 7456 && apu.clockCounter == 0 {
-		clockHalfFrame()
-	}
-	if apu.apuCycle == 11185 && apu.clockCounter == 0 {
-		clockQuarterFrame()
-	}
-	// half frame
-	if apu.apuCycle == 18640 && apu.clockCounter == 0 {
-		clockHalfFrame()
-	}
-	if apu.apuCycle == 18641 {
-		apu.apuCycle = 0
-	}
-
 }
 
 func clockHalfFrame() {
@@ -137,15 +115,53 @@ func GetApu() *Apu {
 	return &apu
 }
 
-func (apu *Apu) SetMapper(mapper mappers.Mapper) {
-	apu.Dmc.mapper = mapper
-}
-
-// Write to status 0x4015 register
+// Write to status 0x4015 register, also acknowledges the dmc irq
 func (apu *Apu) WriteToStatusRegister(val uint8) {
+	apu.Dmc.irq = false
 	apu.Pulse1.setChannelEnabled(val&0b1 == 1)
 	apu.Pulse2.setChannelEnabled((val>>1)&0b1 == 1)
 	apu.Triangle.setChannelEnabled((val>>2)&0b1 == 1)
 	apu.Noise.setChannelEnabled((val>>3)&0b1 == 1)
 	apu.Dmc.setChannelEnabled((val>>4)&0b1 == 1)
 }
+
+// Read the status 0x4015 register, the channels with their length counter
+// running and the irq flags, reading acknowledges the frame irq
+func (apu *Apu) ReadStatusRegister() uint8 {
+	var status uint8
+	if apu.Pulse1.lengthCounter.value > 0 {
+		status |= 0x01
+	}
+	if apu.Pulse2.lengthCounter.value > 0 {
+		status |= 0x02
+	}
+	if apu.Triangle.lengthCounter.value > 0 {
+		status |= 0x04
+	}
+	if apu.Noise.lengthCounter.value > 0 {
+		status |= 0x08
+	}
+	if apu.Dmc.currentLength > 0 {
+		status |= 0x10
+	}
+	if apu.frameCounter.irq {
+		status |= 0x40
+	}
+	if apu.Dmc.irq {
+		status |= 0x80
+	}
+	apu.frameCounter.irq = false
+	return status
+}
+
+// Write to the frame counter 0x4017 register
+func (apu *Apu) WriteToFrameCounter(val uint8) {
+	// the sequencer restarts 3 or 4 cpu cycles later, as the write is in the
+	// first or the second cpu cycle of an apu cycle
+	apu.frameCounter.write(val, apu.clockCounter < 3)
+}
+
+// returns whether the frame counter or the dmc hold the irq line
+func (apu *Apu) Irq() bool {
+	return apu.frameCounter.irq || apu.Dmc.irq
+}
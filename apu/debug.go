@@ -0,0 +1,22 @@
+package apu
+
+import "vsasakiv/nesemulator/hooks"
+
+// ----- Debugger hooks -----
+
+// Hook is called when the dmc fetches a byte of its sample
+type Hook func(addr uint16, val uint8)
+
+// hooks of the attached tools, as the code/data logger
+var debugHooks hooks.List[Hook]
+
+// AddHook attaches the hook to the dmc, the returned function detaches it
+func AddHook(hook Hook) (remove func()) {
+	return debugHooks.Add(hook)
+}
+
+func callHooks(addr uint16, val uint8) {
+	for hook := range debugHooks.All() {
+		hook(addr, val)
+	}
+}
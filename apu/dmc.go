@@ -1,9 +1,5 @@
 package apu
 
-import (
-	"vsasakiv/nesemulator/mappers"
-)
-
 // ==================================================================== //
 // ||                                                                   ||
 // ||                             APU DMC                               ||
@@ -25,13 +21,22 @@ type DMC struct {
 	currentLength  uint16
 	shiftRegister  uint8
 	bitCount       uint8
-	mapper         mappers.Mapper
 
-	cpuStall bool
-	timer    RawTimer
+	// the byte fetched by the dma, waiting for the shift register to empty
+	sampleBuffer uint8
+	bufferFull   bool
+	silence      bool
+	timer        RawTimer
+	// the irq is set when a sample without loop ends
+	irqEnabled bool
+	irq        bool
 }
 
 func (dmc *DMC) WriteToControl(val uint8) {
+	dmc.irqEnabled = (val>>7)&0b1 == 1
+	if !dmc.irqEnabled {
+		dmc.irq = false
+	}
 	dmc.loop = (val>>6)&0b1 == 1
 	dmc.timer.period = dmcTable[val&0x0F]
 }
@@ -57,38 +62,26 @@ func (dmc *DMC) clockTimer() {
 	if !dmc.channelEnable {
 		return
 	}
-	dmc.clockReader()
 	dmc.timer.Clock(dmc.clockShifter)
 }
 
-func (dmc *DMC) clockReader() {
-	if dmc.currentLength > 0 && dmc.bitCount == 0 {
-		dmc.cpuStall = true
-		dmc.shiftRegister = dmc.mapper.Read(dmc.currentAddress)
-		dmc.bitCount = 8
-		dmc.currentAddress++
-		// wraps around back
-		if dmc.currentAddress == 0 {
-			dmc.currentAddress = 0x8000
-		}
-		dmc.currentLength--
-		if dmc.currentLength == 0 && dmc.loop {
-			dmc.restart()
-		}
-	}
-}
-
 func (dmc *DMC) clockShifter() {
+	// an output cycle of 8 bits starts, silent when there was no sample byte
 	if dmc.bitCount == 0 {
-		return
+		dmc.bitCount = 8
+		dmc.silence = !dmc.bufferFull
+		dmc.shiftRegister = dmc.sampleBuffer
+		dmc.bufferFull = false
 	}
-	if dmc.shiftRegister&0b1 == 1 {
-		if dmc.value <= 125 {
-			dmc.value += 2
-		}
-	} else {
-		if dmc.value >= 2 {
-			dmc.value -= 2
+	if !dmc.silence {
+		if dmc.shiftRegister&0b1 == 1 {
+			if dmc.value <= 125 {
+				dmc.value += 2
+			}
+		} else {
+			if dmc.value >= 2 {
+				dmc.value -= 2
+			}
 		}
 	}
 	dmc.shiftRegister >>= 1
@@ -106,12 +99,36 @@ func (dmc *DMC) setChannelEnabled(enabled bool) {
 	dmc.channelEnable = enabled
 }
 
-func (dmc *DMC) PollReadInterrupt() bool {
-	if dmc.cpuStall {
-		dmc.cpuStall = false
-		return true
+// ----- Sample DMA -----
+
+// the sample buffer is filled by a dma that halts the cpu, requested while
+// the buffer is empty and the sample has bytes left
+func (dmc *DMC) DmaRequested() bool {
+	return !dmc.bufferFull && dmc.currentLength > 0
+}
+
+func (dmc *DMC) DmaAddress() uint16 {
+	return dmc.currentAddress
+}
+
+// receives the byte read by the dma
+func (dmc *DMC) FillSampleBuffer(val uint8) {
+	if debugHooks.Len() > 0 {
+		callHooks(dmc.currentAddress, val)
+	}
+	dmc.sampleBuffer = val
+	dmc.bufferFull = true
+	dmc.currentAddress++
+	// wraps around back
+	if dmc.currentAddress == 0 {
+		dmc.currentAddress = 0x8000
+	}
+	dmc.currentLength--
+	if dmc.currentLength == 0 && dmc.loop {
+		dmc.restart()
+	} else if dmc.currentLength == 0 && dmc.irqEnabled {
+		dmc.irq = true
 	}
-	return false
 }
 
 func (dmc *DMC) getSample() uint {
@@ -0,0 +1,100 @@
+package apu
+
+// ==================================================================== //
+// ||                                                                   ||
+// ||                          FRAME COUNTER                            ||
+// ||                                                                   ||
+// ==================================================================== //
+//
+
+// cpu cycles of the steps of the sequencer, the 4 step sequence sets the irq
+// flag on its last 3 cycles
+const (
+	frameQuarter1   = 7457
+	frameHalf1      = 14913
+	frameQuarter3   = 22371
+	frameIrqStart   = 29828
+	frameHalf2      = 29829
+	frameEnd        = 29830
+	frameFiveHalf2  = 37281
+	frameFiveEnd    = 37282
+	frameResetDelay = 3
+)
+
+type FrameCounter struct {
+	// cpu cycles since the start of the sequence
+	cycle      uint
+	fiveStep   bool
+	irqInhibit bool
+	irq        bool
+	// cpu cycles until a write restarts the sequence, 0 when there is none
+	resetDelay uint
+}
+
+func (frameCounter *FrameCounter) reset() {
+	frameCounter.cycle = 0
+	frameCounter.irq = false
+	frameCounter.resetDelay = 0
+}
+
+func (frameCounter *FrameCounter) write(val uint8, firstHalf bool) {
+	frameCounter.fiveStep = val&0x80 != 0
+	frameCounter.irqInhibit = val&0x40 != 0
+	if frameCounter.irqInhibit {
+		frameCounter.irq = false
+	}
+	frameCounter.resetDelay = frameResetDelay
+	if !firstHalf {
+		frameCounter.resetDelay++
+	}
+}
+
+// clocked every cpu cycle
+func (frameCounter *FrameCounter) clock() {
+	if frameCounter.resetDelay > 0 {
+		frameCounter.resetDelay--
+		if frameCounter.resetDelay == 0 {
+			frameCounter.cycle = 0
+			// the 5 step sequence clocks the units as it starts
+			if frameCounter.fiveStep {
+				clockQuarterFrame()
+				clockHalfFrame()
+			}
+			return
+		}
+	}
+
+	frameCounter.cycle++
+	switch frameCounter.cycle {
+	case frameQuarter1, frameQuarter3:
+		clockQuarterFrame()
+	case frameHalf1:
+		clockQuarterFrame()
+		clockHalfFrame()
+	case frameIrqStart:
+		frameCounter.setIrq()
+	case frameHalf2:
+		if !frameCounter.fiveStep {
+			clockQuarterFrame()
+			clockHalfFrame()
+			frameCounter.setIrq()
+		}
+	case frameEnd:
+		if !frameCounter.fiveStep {
+			frameCounter.setIrq()
+			frameCounter.cycle = 0
+		}
+	case frameFiveHalf2:
+		clockQuarterFrame()
+		clockHalfFrame()
+	case frameFiveEnd:
+		frameCounter.cycle = 0
+	}
+}
+
+// only the 4 step sequence sets the irq flag
+func (frameCounter *FrameCounter) setIrq() {
+	if !frameCounter.fiveStep && !frameCounter.irqInhibit {
+		frameCounter.irq = true
+	}
+}
@@ -0,0 +1,111 @@
+package apu
+
+import "vsasakiv/nesemulator/savestate"
+
+// saves or loads the frame counter, every channel and the output filters
+func Serialize(stream *savestate.Stream) {
+	stream.Uint(&apu.clockCounter)
+	apu.frameCounter.serialize(stream)
+	stream.Slice(&apu.currentSample)
+	apu.Pulse1.serialize(stream)
+	apu.Pulse2.serialize(stream)
+	apu.Triangle.serialize(stream)
+	apu.Noise.serialize(stream)
+	apu.Dmc.serialize(stream)
+	for _, filter := range apu.filterchain {
+		if firstOrder, ok := filter.(*FirstOrderFilter); ok {
+			stream.Float32(&firstOrder.prevX)
+			stream.Float32(&firstOrder.prevY)
+		}
+	}
+}
+
+// puts the apu in the same state as when the console is turned on
+func PowerOn() {
+	apu = *NewApu()
+}
+
+func (pulse *Pulse) serialize(stream *savestate.Stream) {
+	stream.Bool(&pulse.channelEnable)
+	stream.Uint(&pulse.channel)
+	stream.Uint(&pulse.dutyCycle)
+	stream.Uint(&pulse.sequencerStep)
+	stream.Bool(&pulse.sweepEnabled)
+	stream.Uint(&pulse.sweepDividerPeriod)
+	stream.Bool(&pulse.sweepNegate)
+	stream.Uint(&pulse.sweepShiftCount)
+	stream.Bool(&pulse.sweepReload)
+	stream.Uint(&pulse.sweepValue)
+	stream.Bool(&pulse.sweepSilence)
+	pulse.envelope.serialize(stream)
+	pulse.lengthCounter.serialize(stream)
+	pulse.timer.serialize(stream)
+}
+
+func (triangle *TrianglePulse) serialize(stream *savestate.Stream) {
+	stream.Bool(&triangle.channelEnable)
+	stream.Uint(&triangle.linearCounterValue)
+	stream.Uint(&triangle.linearCounterPeriod)
+	stream.Bool(&triangle.linearCounterReload)
+	stream.Bool(&triangle.linearCounterControl)
+	stream.Uint(&triangle.sequencerStep)
+	triangle.lengthCounter.serialize(stream)
+	triangle.timer.serialize(stream)
+}
+
+func (noise *NoiseChannel) serialize(stream *savestate.Stream) {
+	stream.Bool(&noise.channelEnable)
+	stream.Uint(&noise.mode)
+	stream.Uint(&noise.timerPeriod)
+	stream.Uint(&noise.timerValue)
+	stream.Uint(&noise.shiftRegister)
+	noise.envelope.serialize(stream)
+	noise.lengthCounter.serialize(stream)
+	noise.timer.serialize(stream)
+}
+
+func (dmc *DMC) serialize(stream *savestate.Stream) {
+	stream.Bool(&dmc.channelEnable)
+	stream.Bool(&dmc.loop)
+	stream.Uint8(&dmc.value)
+	stream.Uint16(&dmc.sampleAddress)
+	stream.Uint16(&dmc.sampleLength)
+	stream.Uint16(&dmc.currentAddress)
+	stream.Uint16(&dmc.currentLength)
+	stream.Uint8(&dmc.shiftRegister)
+	stream.Uint8(&dmc.bitCount)
+	stream.Uint8(&dmc.sampleBuffer)
+	stream.Bool(&dmc.bufferFull)
+	stream.Bool(&dmc.silence)
+	stream.Bool(&dmc.irqEnabled)
+	stream.Bool(&dmc.irq)
+	dmc.timer.serialize(stream)
+}
+
+func (frameCounter *FrameCounter) serialize(stream *savestate.Stream) {
+	stream.Uint(&frameCounter.cycle)
+	stream.Bool(&frameCounter.fiveStep)
+	stream.Bool(&frameCounter.irqInhibit)
+	stream.Bool(&frameCounter.irq)
+	stream.Uint(&frameCounter.resetDelay)
+}
+
+func (envelope *Envelope) serialize(stream *savestate.Stream) {
+	stream.Bool(&envelope.reload)
+	stream.Uint(&envelope.period)
+	stream.Uint(&envelope.constVolume)
+	stream.Bool(&envelope.loop)
+	stream.Bool(&envelope.isConstant)
+	stream.Uint(&envelope.decayCounter)
+	stream.Uint(&envelope.value)
+}
+
+func (lengthCounter *LengthCounter) serialize(stream *savestate.Stream) {
+	stream.Uint(&lengthCounter.value)
+	stream.Bool(&lengthCounter.halted)
+}
+
+func (timer *RawTimer) serialize(stream *savestate.Stream) {
+	stream.Uint(&timer.value)
+	stream.Uint(&timer.period)
+}
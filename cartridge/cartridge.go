@@ -2,9 +2,13 @@ package cartridge
 
 import (
 	"bufio"
+	"crypto/md5"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"vsasakiv/nesemulator/savestate"
 )
 
 type Cartridge struct {
@@ -27,65 +31,69 @@ const VerticalMirroring = "V"
 const HorizontalMirroring = "H"
 const FourScreenMirroring = "4"
 
+var ErrNotInes = errors.New("cartridge: not an iNES file")
+var ErrNes2 = errors.New("cartridge: iNES 2.0 is not supported")
+var ErrNoPrg = errors.New("cartridge: the rom has no PRG ROM")
+
 func ReadFromFile(path string) Cartridge {
-	var cartridge Cartridge
 	file, err := os.Open(path)
 	if err != nil {
 		fmt.Println("Error opening file", err)
 		panic("Error reading from file")
 	}
-
 	defer file.Close()
-	reader := bufio.NewReader(file)
 
-	header := make([]byte, 16)
-	_, err = io.ReadFull(reader, header)
+	cartridge, err := Read(bufio.NewReader(file))
 	if err != nil {
-		fmt.Println("Error reading header", err)
+		fmt.Println("Error reading", path, err)
 		panic("Error reading from file")
 	}
-	cartridge.readHeader(header)
+	return cartridge
+}
+
+// Read reads an iNES 1.0 rom, the header, the trainer and the prg and chr roms
+func Read(reader io.Reader) (Cartridge, error) {
+	var cartridge Cartridge
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return cartridge, fmt.Errorf("cartridge: reading the header: %w", err)
+	}
+	if err := cartridge.readHeader(header); err != nil {
+		return cartridge, err
+	}
 
 	if cartridge.HasTrainer {
-		trainer := make([]byte, 512)
-		_, err = io.ReadFull(reader, trainer)
-		if err != nil {
-			fmt.Println("Error reading trainer", err)
-			panic("Error reading from file")
+		cartridge.Trainer = make([]byte, 512)
+		if _, err := io.ReadFull(reader, cartridge.Trainer); err != nil {
+			return cartridge, fmt.Errorf("cartridge: reading the trainer: %w", err)
 		}
-		cartridge.Trainer = trainer
 	}
 
-	prgRom := make([]byte, cartridge.PrgRomSize)
-	_, err = io.ReadFull(reader, prgRom)
-	if err != nil {
-		fmt.Println("Error reading PRG ROM", err)
-		panic("Error reading from file")
+	cartridge.PrgRom = make([]byte, cartridge.PrgRomSize)
+	if _, err := io.ReadFull(reader, cartridge.PrgRom); err != nil {
+		return cartridge, fmt.Errorf("cartridge: reading the PRG ROM: %w", err)
 	}
-	cartridge.PrgRom = prgRom
 
-	chrRom := make([]byte, cartridge.ChrRomSize)
-	_, err = io.ReadFull(reader, chrRom)
-	if err != nil {
-		fmt.Println("Error reading CHR ROM", err)
-		panic("Error reading from file")
+	cartridge.ChrRom = make([]byte, cartridge.ChrRomSize)
+	if _, err := io.ReadFull(reader, cartridge.ChrRom); err != nil {
+		return cartridge, fmt.Errorf("cartridge: reading the CHR ROM: %w", err)
 	}
-	cartridge.ChrRom = chrRom
 
 	cartridge.ChrRam = make([]byte, cartridge.ChrRamSize)
-
-	return cartridge
+	return cartridge, nil
 }
 
-func (cartridge *Cartridge) readHeader(header []uint8) {
+func (cartridge *Cartridge) readHeader(header []uint8) error {
 
 	if header[0] != 0x4E || header[1] != 0x45 || header[2] != 0x53 || header[3] != 0x1A {
-		fmt.Println("File is not and iNES file!")
-		return
+		return ErrNotInes
 	}
 
 	cartridge.PrgRomSize = uint(header[4]) * 0x4000
 	cartridge.ChrRomSize = uint(header[5]) * 0x2000
+	if cartridge.PrgRomSize == 0 {
+		return ErrNoPrg
+	}
 
 	// chr ram
 	if cartridge.ChrRomSize == 0 {
@@ -96,8 +104,7 @@ func (cartridge *Cartridge) readHeader(header []uint8) {
 	control2 := header[7]
 
 	if control2&0b1 == 1 || (control2>>1)&0b1 == 1 || (control2>>2)&0b11 == 0b10 {
-		fmt.Println("File is not and iNES 1.0 file! iNES 2.0 is not supported")
-		return
+		return ErrNes2
 	}
 
 	if (control1>>3)&0b1 == 1 {
@@ -109,8 +116,10 @@ func (cartridge *Cartridge) readHeader(header []uint8) {
 	}
 	cartridge.MapperType = (control1 >> 4) | (control2 & 0b1111_0000)
 
-	// has SRAM
-	if (control1>>1)&0b1 == 1 || cartridge.MapperType == 4 || cartridge.MapperType == 2 {
+	// iNES 1.0 only tells whether the prg ram has a battery, the UxROM, MMC1
+	// and MMC3 boards get it without one too, as the test roms built on them
+	// write their results at $6000
+	if (control1>>1)&0b1 == 1 || cartridge.MapperType == 1 || cartridge.MapperType == 2 || cartridge.MapperType == 4 {
 		cartridge.SRam = make([]uint8, 0x2000)
 	}
 
@@ -119,4 +128,30 @@ func (cartridge *Cartridge) readHeader(header []uint8) {
 	} else {
 		cartridge.HasTrainer = false
 	}
+	return nil
+}
+
+// saves or loads the writable memory of the cartridge
+func (cartridge *Cartridge) Serialize(stream *savestate.Stream) {
+	stream.Slice(&cartridge.SRam)
+	stream.Slice(&cartridge.ChrRam)
+}
+
+// md5 of the prg and chr roms, the same checksum fceux uses to identify a rom
+func (cartridge *Cartridge) Checksum() [16]uint8 {
+	hash := md5.New()
+	hash.Write(cartridge.PrgRom)
+	hash.Write(cartridge.ChrRom)
+	var checksum [16]uint8
+	copy(checksum[:], hash.Sum(nil))
+	return checksum
+}
+
+// returns the crc32 of the rom without its header, as the cheat and rom
+// databases identify the games
+func (cartridge *Cartridge) Crc32() uint32 {
+	hash := crc32.NewIEEE()
+	hash.Write(cartridge.PrgRom)
+	hash.Write(cartridge.ChrRom)
+	return hash.Sum32()
 }
@@ -0,0 +1,104 @@
+package cartridge
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// an nrom with the banks, the flags and the rest of the file
+func rom(prgBanks uint8, chrBanks uint8, control1 uint8, control2 uint8, rest int) []uint8 {
+	header := []uint8{'N', 'E', 'S', 0x1A, prgBanks, chrBanks, control1, control2, 0, 0, 0, 0, 0, 0, 0, 0}
+	return append(header, make([]uint8, rest)...)
+}
+
+func TestRead(t *testing.T) {
+	// mapper 1 with vertical mirroring, a trainer and chr ram
+	cartridge, err := Read(bytes.NewReader(rom(2, 0, 0x15, 0x00, 512+0x8000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.MapperType != 1 || cartridge.MirroringType != VerticalMirroring || !cartridge.HasTrainer {
+		t.Errorf("header read as mapper %d, mirroring %s, trainer %v", cartridge.MapperType, cartridge.MirroringType, cartridge.HasTrainer)
+	}
+	if len(cartridge.PrgRom) != 0x8000 || len(cartridge.ChrRom) != 0 || len(cartridge.ChrRam) != 0x2000 {
+		t.Errorf("read %d bytes of prg rom, %d of chr rom and %d of chr ram", len(cartridge.PrgRom), len(cartridge.ChrRom), len(cartridge.ChrRam))
+	}
+}
+
+func TestPrgRam(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint8
+		size int
+	}{
+		{"nrom", rom(1, 1, 0x00, 0, 0x6000), 0},
+		{"nrom with battery", rom(1, 1, 0x02, 0, 0x6000), 0x2000},
+		{"mmc1", rom(1, 1, 0x10, 0, 0x6000), 0x2000},
+		{"mmc3", rom(1, 1, 0x40, 0, 0x6000), 0x2000},
+	}
+	for _, test := range tests {
+		cartridge, err := Read(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cartridge.SRam) != test.size {
+			t.Errorf("%s has %d bytes of prg ram, want %d", test.name, len(cartridge.SRam), test.size)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint8
+		err  error
+	}{
+		{"empty", nil, io.EOF},
+		{"short header", rom(1, 1, 0, 0, 0)[:10], io.ErrUnexpectedEOF},
+		{"not ines", append([]uint8("NES\x00"), rom(1, 1, 0, 0, 0x6000)[4:]...), ErrNotInes},
+		{"no prg", rom(0, 1, 0, 0, 0x2000), ErrNoPrg},
+		{"nes 2.0", rom(1, 1, 0, 0x08, 0x6000), ErrNes2},
+		{"short trainer", rom(1, 1, 0x04, 0, 100), io.ErrUnexpectedEOF},
+		{"short prg", rom(2, 1, 0, 0, 0x4000), io.ErrUnexpectedEOF},
+		{"short chr", rom(1, 2, 0, 0, 0x6000), io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, err := Read(bytes.NewReader(test.data))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s gave %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+// any file is read without panicking, and a rom read without error has the
+// memories of the sizes in its header
+func FuzzRead(f *testing.F) {
+	// headers with short tails keep the fuzzer fast, TestRead has whole roms
+	f.Add(rom(1, 1, 0, 0, 0))
+	f.Add(rom(1, 0, 0x04, 0, 16))
+	f.Add(rom(2, 0, 0x15, 0, 64))
+	f.Add(rom(8, 16, 0x40, 0, 64))
+	f.Add(rom(1, 1, 0, 0x08, 0))
+	if nestest, err := os.ReadFile("../testFiles/nestest.nes"); err == nil {
+		f.Add(nestest[:16+64])
+	}
+	f.Fuzz(func(t *testing.T, data []uint8) {
+		cartridge, err := Read(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if uint(len(cartridge.PrgRom)) != cartridge.PrgRomSize || cartridge.PrgRomSize == 0 {
+			t.Errorf("%d bytes of prg rom for a size of %d", len(cartridge.PrgRom), cartridge.PrgRomSize)
+		}
+		if uint(len(cartridge.ChrRom)) != cartridge.ChrRomSize || uint(len(cartridge.ChrRam)) != cartridge.ChrRamSize {
+			t.Errorf("%d bytes of chr rom and %d of chr ram for sizes of %d and %d",
+				len(cartridge.ChrRom), len(cartridge.ChrRam), cartridge.ChrRomSize, cartridge.ChrRamSize)
+		}
+		if cartridge.HasTrainer != (len(cartridge.Trainer) == 512) {
+			t.Errorf("%d bytes of trainer", len(cartridge.Trainer))
+		}
+	})
+}
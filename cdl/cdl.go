@@ -0,0 +1,223 @@
+package cdl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"vsasakiv/nesemulator/apu"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/disasm"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// flags of the prg rom bytes, as in the .cdl files of FCEUX
+const (
+	PrgCode = 0x01
+	PrgData = 0x02
+	// bits 2 and 3 keep the 8KB window of the cpu address space the byte was
+	// last accessed from, 0 for $8000, 1 for $A000, 2 for $C000 and 3 for $E000
+	PrgWindowMask = 0x0C
+	// the code was jumped to through a pointer, by JMP ($nnnn)
+	PrgIndirectCode = 0x10
+	// the data was read through a pointer, by the ($nn,X) and ($nn),Y modes
+	PrgIndirectData = 0x20
+	// the data was played as a sample by the dmc
+	PrgPcm = 0x40
+)
+
+// flags of the chr rom bytes
+const (
+	ChrRendered = 0x01
+	// read by the cpu through PPUDATA
+	ChrRead = 0x02
+)
+
+const opcodeJmpIndirect = 0x6C
+
+var ErrSize = errors.New("the cdl file does not match the rom size")
+
+// Logger marks the bytes of the rom as code or data while the game runs, the
+// result is a .cdl file, the prg flags followed by the chr flags
+type Logger struct {
+	prg []uint8
+	chr []uint8
+
+	// bytes of the instruction being executed, the reads of its operand are code
+	instructionPc   uint16
+	instructionSize uint16
+	// the instruction being executed reads its data through a pointer
+	indirect bool
+	// the last instruction was JMP ($nnnn), its target is indirect code
+	indirectJump bool
+
+	// removes the hooks, nil while the logger is stopped
+	stop func()
+}
+
+func New(rom *cartridge.Cartridge) *Logger {
+	return &Logger{prg: make([]uint8, len(rom.PrgRom)), chr: make([]uint8, len(rom.ChrRom))}
+}
+
+// Start attaches the logger to the cpu, ppu and apu of the console running the rom
+func (logger *Logger) Start() {
+	if logger.stop != nil {
+		return
+	}
+	removeCpuHook := cpu.AddHook(logger.cpuAccess)
+	removePpuHook := ppu.AddHook(logger.ppuAccess)
+	removeApuHook := apu.AddHook(logger.sampleFetch)
+	logger.stop = func() {
+		removeCpuHook()
+		removePpuHook()
+		removeApuHook()
+	}
+}
+
+func (logger *Logger) Stop() {
+	if logger.stop != nil {
+		logger.stop()
+		logger.stop = nil
+	}
+}
+
+func (logger *Logger) Reset() {
+	clear(logger.prg)
+	clear(logger.chr)
+}
+
+// ----- Files -----
+
+// returns the log in the .cdl format
+func (logger *Logger) Bytes() []byte {
+	return append(append([]byte{}, logger.prg...), logger.chr...)
+}
+
+// Merge adds the bytes marked by another session, in the .cdl format
+func (logger *Logger) Merge(data []byte) error {
+	if len(data) != len(logger.prg)+len(logger.chr) {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrSize, len(data), len(logger.prg)+len(logger.chr))
+	}
+	for i, flags := range data[:len(logger.prg)] {
+		logger.prg[i] |= flags
+	}
+	for i, flags := range data[len(logger.prg):] {
+		logger.chr[i] |= flags
+	}
+	return nil
+}
+
+// merges the file of a previous session, a missing file is an empty log
+func (logger *Logger) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return logger.Merge(data)
+}
+
+func (logger *Logger) Save(path string) error {
+	return os.WriteFile(path, logger.Bytes(), 0644)
+}
+
+// Stats counts the prg bytes marked as code, as data and not accessed, and the chr bytes accessed
+type Stats struct {
+	Code, Data, Unused int
+	Chr, ChrUnused     int
+}
+
+func (logger *Logger) Stats() Stats {
+	var stats Stats
+	for _, flags := range logger.prg {
+		if flags&PrgCode != 0 {
+			stats.Code++
+		}
+		if flags&PrgData != 0 {
+			stats.Data++
+		}
+		if flags&(PrgCode|PrgData) == 0 {
+			stats.Unused++
+		}
+	}
+	for _, flags := range logger.chr {
+		if flags != 0 {
+			stats.Chr++
+		} else {
+			stats.ChrUnused++
+		}
+	}
+	return stats
+}
+
+func (stats Stats) String() string {
+	return fmt.Sprintf("prg: %d code, %d data, %d unused bytes; chr: %d accessed, %d unused bytes",
+		stats.Code, stats.Data, stats.Unused, stats.Chr, stats.ChrUnused)
+}
+
+// ----- Hooks -----
+
+// marks the prg byte mapped at the cpu address with the flags
+func (logger *Logger) markPrg(addr uint16, flags uint8) {
+	offset := cpu.MainMemory.Mapper.PrgOffset(addr)
+	if offset < 0 || offset >= len(logger.prg) {
+		return
+	}
+	window := uint8((addr>>13)&0b11) << 2
+	logger.prg[offset] = logger.prg[offset]&^PrgWindowMask | window | flags
+}
+
+func (logger *Logger) cpuAccess(kind int, addr uint16, val uint8) {
+	switch kind {
+	case cpu.AccessExecute:
+		size := uint16(cpu.InstructionSize(val))
+		logger.instructionPc = addr
+		logger.instructionSize = size
+		mode := disasm.ModeOf(val)
+		logger.indirect = mode == disasm.IndirectX || mode == disasm.IndirectY
+
+		flags := uint8(PrgCode)
+		if logger.indirectJump {
+			flags |= PrgIndirectCode
+		}
+		logger.indirectJump = val == opcodeJmpIndirect
+		for i := range size {
+			logger.markPrg(addr+i, flags)
+		}
+	case cpu.AccessRead:
+		if addr < 0x8000 || addr-logger.instructionPc < logger.instructionSize {
+			// not rom, or the instruction bytes, already marked as code
+			return
+		}
+		flags := uint8(PrgData)
+		if logger.indirect {
+			flags |= PrgIndirectData
+		}
+		logger.markPrg(addr, flags)
+	}
+}
+
+func (logger *Logger) sampleFetch(addr uint16, val uint8) {
+	logger.markPrg(addr, PrgData|PrgPcm)
+}
+
+func (logger *Logger) ppuAccess(kind int, addr uint16, val uint8) {
+	if addr > 0x1FFF || len(logger.chr) == 0 {
+		return
+	}
+	var flags uint8
+	switch kind {
+	case ppu.AccessRender:
+		flags = ChrRendered
+	case ppu.AccessRead:
+		flags = ChrRead
+	default:
+		return
+	}
+	offset := cpu.MainMemory.Mapper.ChrOffset(addr)
+	if offset >= 0 && offset < len(logger.chr) {
+		logger.chr[offset] |= flags
+	}
+}
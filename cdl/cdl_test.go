@@ -0,0 +1,89 @@
+package cdl
+
+import (
+	"errors"
+	"testing"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+func TestLogsCodeDataAndChr(t *testing.T) {
+	console.LoadRom(testRom)
+	logger := New(console.Cartridge)
+	logger.Start()
+	defer logger.Stop()
+	for range 10 {
+		console.RunFrame(nil)
+	}
+
+	// nestest is a 16KB rom mapped at $C000, the third 8KB window
+	const window = 2 << 2
+	// the reset handler at $C004 starts with SEI, CLD, LDX #$FF
+	for offset, want := range map[int]uint8{0x0004: PrgCode, 0x0007: PrgCode} {
+		if flags := logger.prg[offset]; flags != want|window {
+			t.Errorf("prg $%04X flags are %02X, want %02X", offset, flags, want|window)
+		}
+	}
+	// the nmi handler is read from the vector at $FFFA
+	if flags := logger.prg[0x3FFA]; flags&PrgData == 0 {
+		t.Errorf("the nmi vector flags are %02X, want data", flags)
+	}
+
+	stats := logger.Stats()
+	if stats.Code == 0 || stats.Chr == 0 {
+		t.Fatalf("nothing logged: %s", stats)
+	}
+}
+
+func TestDummyReadsAreNotData(t *testing.T) {
+	console.LoadRom(testRom)
+	logger := New(console.Cartridge)
+	logger.Start()
+	defer logger.Stop()
+	// the implied instructions read the next opcode and throw it away
+	executed := map[uint16]uint16{}
+	remove := cpu.AddHook(func(kind int, addr uint16, val uint8) {
+		if kind == cpu.AccessExecute {
+			executed[addr] = uint16(cpu.InstructionSize(val))
+		}
+	})
+	defer remove()
+	for range 5 {
+		console.RunFrame(nil)
+	}
+
+	for pc, size := range executed {
+		for addr := pc; addr < pc+size; addr++ {
+			offset := cpu.MainMemory.Mapper.PrgOffset(addr)
+			if flags := logger.prg[offset] & (PrgCode | PrgData); flags != PrgCode {
+				t.Errorf("prg $%04X of the instruction at $%04X flags are %02X, want code only", addr, pc, flags)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	console.LoadRom(testRom)
+	logger := New(console.Cartridge)
+	logger.prg[0] = PrgCode
+	logger.chr[0] = ChrRendered
+	session := logger.Bytes()
+
+	other := New(console.Cartridge)
+	other.prg[0] = PrgData
+	other.prg[1] = PrgCode
+	if err := other.Merge(session); err != nil {
+		t.Fatal(err)
+	}
+	if other.prg[0] != PrgCode|PrgData || other.prg[1] != PrgCode || other.chr[0] != ChrRendered {
+		t.Errorf("merged flags are %02X %02X %02X", other.prg[0], other.prg[1], other.chr[0])
+	}
+	if len(session) != 0x4000+0x2000 {
+		t.Errorf("cdl has %d bytes, want the prg and chr sizes", len(session))
+	}
+	if err := other.Merge(session[1:]); !errors.Is(err, ErrSize) {
+		t.Errorf("merging a file of another rom returned %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package cheats
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// Cheat is a code of the cheat list, with the name shown to the user
+type Cheat struct {
+	Code    string
+	Name    string
+	Enabled bool
+	decoded Code
+}
+
+// List is the cheat list of a rom, saved in a text file with a cheat per line,
+// the code followed by its name, the disabled ones start with -
+//
+//	SXIOPO Infinite lives
+//	-075A:09 Nine lives
+type List struct {
+	Cheats []*Cheat
+	path   string
+}
+
+// returns the path of the cheat file of the rom in the directory, named by
+// the crc32 of the rom
+func Path(dir string, rom *cartridge.Cartridge) string {
+	return filepath.Join(dir, fmt.Sprintf("%08X.cht", rom.Crc32()))
+}
+
+// Load reads the cheat list of the file, a missing file is an empty list
+func Load(path string) (*List, error) {
+	list := &List{path: path}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		enabled := !strings.HasPrefix(text, "-")
+		code, name, _ := strings.Cut(strings.TrimPrefix(text, "-"), " ")
+		cheat, err := newCheat(code, strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		cheat.Enabled = enabled
+		list.Cheats = append(list.Cheats, cheat)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func newCheat(text string, name string) (*Cheat, error) {
+	code, err := Decode(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Cheat{Code: strings.ToUpper(text), Name: name, Enabled: true, decoded: code}, nil
+}
+
+func (list *List) Save() error {
+	if err := os.MkdirAll(filepath.Dir(list.path), 0755); err != nil {
+		return err
+	}
+	var builder strings.Builder
+	for _, cheat := range list.Cheats {
+		if !cheat.Enabled {
+			builder.WriteByte('-')
+		}
+		builder.WriteString(cheat.Code)
+		if cheat.Name != "" {
+			builder.WriteString(" " + cheat.Name)
+		}
+		builder.WriteByte('\n')
+	}
+	return os.WriteFile(list.path, []byte(builder.String()), 0644)
+}
+
+// Add adds an enabled cheat to the list
+func (list *List) Add(code string, name string) error {
+	cheat, err := newCheat(code, name)
+	if err != nil {
+		return err
+	}
+	list.Cheats = append(list.Cheats, cheat)
+	list.Install()
+	return nil
+}
+
+// Toggle enables or disables the cheat at the index
+func (list *List) Toggle(i int) {
+	if i < 0 || i >= len(list.Cheats) {
+		return
+	}
+	list.Cheats[i].Enabled = !list.Cheats[i].Enabled
+	list.Install()
+}
+
+// Install patches the rom with the enabled codes, it must be called after
+// the list is loaded and the cartridge is inserted
+func (list *List) Install() {
+	var patches []cpu.RomPatch
+	for _, cheat := range list.Cheats {
+		if cheat.Enabled && cheat.decoded.IsRom() {
+			patches = append(patches, cheat.decoded.romPatch())
+		}
+	}
+	cpu.SetRomPatches(patches)
+}
+
+// Apply writes the enabled ram codes, it must be called before every frame,
+// the codes with a compare value are only written over that value
+func (list *List) Apply() {
+	for _, cheat := range list.Cheats {
+		code := cheat.decoded
+		if !cheat.Enabled || code.IsRom() {
+			continue
+		}
+		if code.HasCompare && cpu.PeekMemory(code.Address) != code.Compare {
+			continue
+		}
+		cpu.PokeMemory(code.Address, code.Value)
+	}
+}
@@ -0,0 +1,148 @@
+package cheats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+func TestDecodeGenie(t *testing.T) {
+	// infinite lives of Super Mario Bros.
+	code, err := Decode("sxiopo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Address != 0x91D9 || code.Value != 0xAD || code.HasCompare {
+		t.Fatalf("SXIOPO decoded as %+v", code)
+	}
+	if EncodeGenie(code) != "SXIOPO" {
+		t.Fatalf("encoded back as %s", EncodeGenie(code))
+	}
+
+	// every address and value survives encoding and decoding
+	for _, want := range []Code{
+		{Address: 0x8000, Value: 0xFF},
+		{Address: 0xFFFF, Value: 0x00, Compare: 0xFF, HasCompare: true},
+		{Address: 0xC0A3, Value: 0xEA, Compare: 0xA5, HasCompare: true},
+		{Address: 0xABCD, Value: 0x5A},
+	} {
+		text := EncodeGenie(want)
+		got, err := DecodeGenie(text)
+		if err != nil || got != want {
+			t.Errorf("%+v encoded as %s decodes to %+v, %v", want, text, got, err)
+		}
+	}
+
+	for _, invalid := range []string{"SXIOP", "SXIOPOA", "SXIOPB"} {
+		if _, err := Decode(invalid); err == nil {
+			t.Errorf("%s decoded", invalid)
+		}
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	code, err := Decode("075a:09")
+	if err != nil || code != (Code{Address: 0x075A, Value: 0x09}) || code.IsRom() {
+		t.Fatalf("075A:09 decoded as %+v, %v", code, err)
+	}
+	code, err = Decode("C0A3?A5:EA")
+	if err != nil || code != (Code{Address: 0xC0A3, Value: 0xEA, Compare: 0xA5, HasCompare: true}) || !code.IsRom() {
+		t.Fatalf("C0A3?A5:EA decoded as %+v, %v", code, err)
+	}
+	for _, invalid := range []string{"G075A:09", "075A:100", "C0A3?:EA"} {
+		if _, err := Decode(invalid); err == nil {
+			t.Errorf("%s decoded", invalid)
+		}
+	}
+}
+
+func TestRomPatches(t *testing.T) {
+	console.LoadRom(testRom)
+	defer cpu.SetRomPatches(nil)
+	// the reset handler starts with SEI at $C004, followed by CLD
+	list := &List{}
+	if err := list.Add(EncodeGenie(Code{Address: 0xC004, Value: 0xEA}), "nop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Add("C005?00:EA", "wrong compare"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cpu.PeekMemory(0xC004); got != 0xEA {
+		t.Errorf("patched $C004 reads %02X, want EA", got)
+	}
+	if got := cpu.PeekMemory(0xC005); got != 0xD8 {
+		t.Errorf("$C005 with another value than the compare one reads %02X, want D8", got)
+	}
+
+	// the cpu runs the patched code
+	console.RunFrame(nil)
+	cpu.SetRomPatches(nil)
+	if got := cpu.PeekMemory(0xC004); got != 0x78 {
+		t.Errorf("unpatched $C004 reads %02X, want 78", got)
+	}
+
+	list.Toggle(0)
+	if got := cpu.PeekMemory(0xC004); got != 0x78 {
+		t.Errorf("disabled patch still reads %02X", got)
+	}
+}
+
+func TestRamCodes(t *testing.T) {
+	console.LoadRom(testRom)
+	list := &List{}
+	list.Add("0010:63", "")
+	list.Add("0011?05:09", "")
+	cpu.PokeMemory(0x11, 0x04)
+	list.Apply()
+	if cpu.PeekMemory(0x10) != 0x63 || cpu.PeekMemory(0x11) != 0x04 {
+		t.Fatalf("ram is %02X %02X, want 63 04", cpu.PeekMemory(0x10), cpu.PeekMemory(0x11))
+	}
+	cpu.PokeMemory(0x11, 0x05)
+	list.Apply()
+	if cpu.PeekMemory(0x11) != 0x09 {
+		t.Fatalf("the code over its compare value was not written")
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	console.LoadRom(testRom)
+	defer cpu.SetRomPatches(nil)
+	dir := t.TempDir()
+	path := Path(filepath.Join(dir, "cheats"), console.Cartridge)
+	if !strings.HasSuffix(path, ".cht") || len(filepath.Base(path)) != len("00000000.cht") {
+		t.Fatalf("cheat file of the rom is %s", path)
+	}
+
+	list, err := Load(path)
+	if err != nil || len(list.Cheats) != 0 {
+		t.Fatalf("missing file loaded %v, %v", list, err)
+	}
+	list.Add("SXIOPO", "Infinite lives")
+	list.Add("075A:09", "Nine lives")
+	list.Toggle(1)
+	if err := list.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "SXIOPO Infinite lives\n-075A:09 Nine lives\n" {
+		t.Fatalf("saved file is\n%s", data)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Cheats) != 2 || !loaded.Cheats[0].Enabled || loaded.Cheats[1].Enabled || loaded.Cheats[1].Name != "Nine lives" {
+		t.Fatalf("loaded %+v %+v", *loaded.Cheats[0], *loaded.Cheats[1])
+	}
+
+	os.WriteFile(path, []byte("# comment\n\nSXIOPQ broken\n"), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("invalid code loaded, %v", err)
+	}
+}
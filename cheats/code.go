@@ -0,0 +1,125 @@
+package cheats
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+)
+
+var ErrCode = errors.New("invalid cheat code")
+
+// the letters of the Game Genie codes, each one is a nibble
+const genieLetters = "APZLGITYEOXUKSVN"
+
+// Code is a decoded cheat, the codes of the rom patch the reads of the cpu
+// and the others are written to the ram every frame
+type Code struct {
+	Address    uint16
+	Value      uint8
+	Compare    uint8
+	HasCompare bool
+}
+
+// returns whether the code patches the rom instead of writing the ram
+func (code Code) IsRom() bool {
+	return code.Address >= 0x8000
+}
+
+func (code Code) romPatch() cpu.RomPatch {
+	return cpu.RomPatch{Address: code.Address, Value: code.Value, Compare: code.Compare, HasCompare: code.HasCompare}
+}
+
+// Decode decodes a Game Genie code of 6 or 8 letters or a raw code, as
+// 075A:09 for the ram or C0A3?A5:EA for the rom with a compare value
+func Decode(text string) (Code, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	if strings.Contains(text, ":") {
+		return decodeRaw(text)
+	}
+	return DecodeGenie(text)
+}
+
+// DecodeGenie decodes the letters of a Game Genie code, the 8 letter codes
+// have a compare value
+func DecodeGenie(text string) (Code, error) {
+	if len(text) != 6 && len(text) != 8 {
+		return Code{}, fmt.Errorf("%w: %q has %d letters, want 6 or 8", ErrCode, text, len(text))
+	}
+	var n [8]uint16
+	for i := range len(text) {
+		nibble := strings.IndexByte(genieLetters, text[i])
+		if nibble < 0 {
+			return Code{}, fmt.Errorf("%w: %q is not a Game Genie letter", ErrCode, text[i])
+		}
+		n[i] = uint16(nibble)
+	}
+
+	// the bits of the address and the values are shuffled among the letters
+	code := Code{
+		Address: 0x8000 | (n[3]&7)<<12 | (n[5]&7)<<8 | (n[4]&8)<<8 | (n[2]&7)<<4 | (n[1]&8)<<4 | n[4]&7 | n[3]&8,
+	}
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | n[0]&7
+	if len(text) == 6 {
+		code.Value = uint8(value | n[5]&8)
+		return code, nil
+	}
+	code.Value = uint8(value | n[7]&8)
+	code.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | n[6]&7 | n[5]&8)
+	code.HasCompare = true
+	return code, nil
+}
+
+// EncodeGenie returns the Game Genie letters of a rom code
+func EncodeGenie(code Code) string {
+	address := code.Address
+	value := uint16(code.Value)
+	compare := uint16(code.Compare)
+	var n [8]uint16
+	n[0] = value>>4&8 | value&7
+	n[1] = address>>4&8 | value>>4&7
+	n[2] = address >> 4 & 7
+	n[3] = address&8 | address>>12&7
+	n[4] = address>>8&8 | address&7
+	n[5] = address >> 8 & 7
+	size := 6
+	if code.HasCompare {
+		n[5] |= compare & 8
+		n[6] = compare>>4&8 | compare&7
+		n[7] = value&8 | compare>>4&7
+		// the third letter of the 8 letter codes tells the genie to read all of them
+		n[2] |= 8
+		size = 8
+	} else {
+		n[5] |= value & 8
+	}
+	letters := make([]byte, size)
+	for i := range size {
+		letters[i] = genieLetters[n[i]]
+	}
+	return string(letters)
+}
+
+func decodeRaw(text string) (Code, error) {
+	addressText, valueText, _ := strings.Cut(text, ":")
+	addressText, compareText, hasCompare := strings.Cut(addressText, "?")
+	address, err := strconv.ParseUint(addressText, 16, 16)
+	if err != nil {
+		return Code{}, fmt.Errorf("%w: invalid address in %q", ErrCode, text)
+	}
+	value, err := strconv.ParseUint(valueText, 16, 8)
+	if err != nil {
+		return Code{}, fmt.Errorf("%w: invalid value in %q", ErrCode, text)
+	}
+	code := Code{Address: uint16(address), Value: uint8(value)}
+	if hasCompare {
+		compare, err := strconv.ParseUint(compareText, 16, 8)
+		if err != nil {
+			return Code{}, fmt.Errorf("%w: invalid compare value in %q", ErrCode, text)
+		}
+		code.Compare = uint8(compare)
+		code.HasCompare = true
+	}
+	return code, nil
+}
@@ -0,0 +1,261 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"vsasakiv/nesemulator/apu"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/controller"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/mappers"
+	"vsasakiv/nesemulator/ppu"
+	"vsasakiv/nesemulator/savestate"
+)
+
+// ppu clocks between each audio sample, the ppu clock (cpu clock * 3) divided by 44.1Khz
+const CyclesPerSample = 121.7532
+
+// a frame is the emulation of 735 audio samples, 44100 / 60fps, input is read once per frame
+const SamplesPerFrame = 735
+
+var Cartridge *cartridge.Cartridge
+var Mapper mappers.Mapper
+var JoyPad1 *controller.JoyPad
+var JoyPad2 *controller.JoyPad
+
+// frames emulated since the cartridge was inserted, power cycles do not reset it
+var frame uint
+var audioRate float64
+
+// samples generated in the current frame, a stopped frame is resumed from them
+var frameSamples int
+
+// set by Stop to leave the frame being emulated
+var stopRequested bool
+
+// checksum of the loaded rom, save states are only loaded on the same rom
+var romChecksum [16]uint8
+
+// reads a rom file and turns the console on with it
+func LoadRom(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rom, err := cartridge.Read(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return LoadCartridge(&rom)
+}
+
+// inserts the cartridge and turns the console on, the console keeps the
+// cartridge it had when the mapper of the new one is not supported
+func LoadCartridge(rom *cartridge.Cartridge) error {
+	if _, err := mappers.NewMapper(rom); err != nil {
+		return err
+	}
+	Cartridge = rom
+	romChecksum = rom.Checksum()
+	if JoyPad1 == nil {
+		JoyPad1 = controller.NewJoypad()
+		JoyPad2 = controller.NewJoypad()
+	}
+	frame = 0
+	PowerOn()
+	return nil
+}
+
+// puts every component in the state it has when the console is turned on,
+// the cartridge memory is kept as it is battery backed on most boards
+func PowerOn() {
+	// the mapper was checked when the cartridge was inserted
+	Mapper, _ = mappers.NewMapper(Cartridge)
+
+	cpu.PowerOn()
+	ppu.PowerOn()
+	apu.PowerOn()
+
+	cpu.LoadCartridge(Mapper)
+	ppu.LoadCartridge(Mapper)
+
+	*JoyPad1 = *controller.NewJoypad()
+	*JoyPad2 = *controller.NewJoypad()
+	cpu.ConnectJoyPad1(JoyPad1)
+	cpu.ConnectJoyPad2(JoyPad2)
+
+	audioRate = 0
+	frameSamples = 0
+	Reset()
+}
+
+// same as pressing the reset button
+func Reset() {
+	cpu.GetCpu().Reset()
+	ppu.GetPpu().Reset()
+	apu.GetApu().Reset()
+}
+
+// Clock all of the emulator components
+func Tick() {
+	cpu.Clock()
+	apu.Clock()
+	ppu.Clock()
+	Mapper.Clock(ppu.GetPpuStatus())
+}
+
+// runs the emulation for one frame, if samples is not nil it receives the
+// SamplesPerFrame audio samples generated in the frame. Returns false if the
+// emulation was stopped before the end of the frame, the next call resumes it
+func RunFrame(samples []float32) bool {
+	stopRequested = false
+
+	// sync to audio because it is easier
+	for frameSamples < SamplesPerFrame {
+		Tick()
+		if audioRate >= CyclesPerSample {
+			audioRate -= CyclesPerSample
+			sample := apu.GenSample()
+			if samples != nil {
+				samples[frameSamples] = sample
+			}
+			frameSamples++
+		} else {
+			audioRate++
+		}
+		if stopRequested {
+			if frameSamples < SamplesPerFrame {
+				return false
+			}
+			break
+		}
+	}
+	frameSamples = 0
+	frame++
+	return true
+}
+
+// stops the emulation after the current clock, used by the debugger to
+// break in the middle of a frame
+func Stop() {
+	stopRequested = true
+}
+
+// returns why the cpu is halted by a jam opcode, empty while it runs
+func JamReason() string {
+	return cpu.GetCpu().JamReason()
+}
+
+// returns the frames emulated since the cartridge was inserted
+func Frame() uint {
+	return frame
+}
+
+// returns the rgb pixels of the last complete frame
+func PixelData() []uint8 {
+	return ppu.GetPpu().GetPixelData()
+}
+
+// returns the sha1 of the last complete frame, used to compare runs
+func FrameHash() string {
+	hash := sha1.Sum(PixelData())
+	return hex.EncodeToString(hash[:])
+}
+
+// returns a hash of the cpu, with its ram, and of the ppu, cheap enough to
+// compare two consoles that should be running in sync every few frames
+func StateHash() uint64 {
+	stream := savestate.NewWriter()
+	cpu.Serialize(stream)
+	ppu.Serialize(stream)
+	hash := fnv.New64a()
+	hash.Write(stream.Data())
+	return hash.Sum64()
+}
+
+// ----- Save states -----
+
+const stateMagic = "MNSS"
+const stateVersion = 8
+
+var ErrInvalidState = errors.New("console: not a save state")
+var ErrStateVersion = errors.New("console: save state version is not supported")
+var ErrStateRom = errors.New("console: save state is from another rom")
+
+// saves the state of every component of the console
+func SaveState() []byte {
+	stream := savestate.NewWriter()
+	header := []byte(stateMagic)
+	stream.Bytes(header)
+	version := uint8(stateVersion)
+	stream.Uint8(&version)
+	checksum := romChecksum
+	stream.Bytes(checksum[:])
+	serialize(stream)
+	return stream.Data()
+}
+
+// restores a state saved with SaveState, the state must be of the same rom
+func LoadState(data []byte) error {
+	stream := savestate.NewReader(data)
+	header := make([]byte, len(stateMagic))
+	stream.Bytes(header)
+	if stream.Err() != nil || string(header) != stateMagic {
+		return ErrInvalidState
+	}
+	var version uint8
+	stream.Uint8(&version)
+	if version != stateVersion {
+		return ErrStateVersion
+	}
+	var checksum [16]uint8
+	stream.Bytes(checksum[:])
+	if !bytes.Equal(checksum[:], romChecksum[:]) {
+		return ErrStateRom
+	}
+
+	// a truncated state would leave the console half loaded, so the previous state is restored
+	previous := SaveState()
+	serialize(stream)
+	if err := stream.Err(); err != nil {
+		LoadState(previous)
+		return err
+	}
+	return nil
+}
+
+// Snapshot saves the console into buf, reusing its memory, it is faster than
+// SaveState and meant for in-memory states taken every frame, as the rollback ones
+func Snapshot(buf []byte) []byte {
+	stream := savestate.NewWriterBuffer(buf)
+	serialize(stream)
+	return stream.Data()
+}
+
+// Restore loads a snapshot taken with Snapshot, unlike LoadState it does not
+// validate the data, which must come from this same console
+func Restore(snapshot []byte) error {
+	stream := savestate.NewReader(snapshot)
+	serialize(stream)
+	return stream.Err()
+}
+
+func serialize(stream *savestate.Stream) {
+	stream.Uint(&frame)
+	stream.Float64(&audioRate)
+	stream.Int(&frameSamples)
+	cpu.Serialize(stream)
+	ppu.Serialize(stream)
+	apu.Serialize(stream)
+	Mapper.Serialize(stream)
+	Cartridge.Serialize(stream)
+	JoyPad1.Serialize(stream)
+	JoyPad2.Serialize(stream)
+}
@@ -0,0 +1,14 @@
+package console
+
+import "testing"
+
+const testRom = "../testFiles/nestest.nes"
+
+// emulates frames of nestest with their audio samples, as the frontend does
+func BenchmarkRunFrame(b *testing.B) {
+	LoadRom(testRom)
+	samples := make([]float32, SamplesPerFrame)
+	for b.Loop() {
+		RunFrame(samples)
+	}
+}
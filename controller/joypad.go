@@ -1,5 +1,7 @@
 package controller
 
+import "vsasakiv/nesemulator/savestate"
+
 const A = 0
 const B = 1
 const SELECT = 2
@@ -43,3 +45,43 @@ func (joyPad *JoyPad) ReceiveRead() uint8 {
 func (joyPad *JoyPad) SetButtonStatus(button uint, val uint) {
 	joyPad.buttonStatus[button] = val
 }
+
+func (joyPad *JoyPad) GetButtonStatus(button uint) uint {
+	return joyPad.buttonStatus[button]
+}
+
+// returns the status of all buttons, indexed by the button constants
+func (joyPad *JoyPad) GetButtons() [8]uint {
+	return joyPad.buttonStatus
+}
+
+// sets the status of all buttons, indexed by the button constants
+func (joyPad *JoyPad) SetButtons(buttons [8]uint) {
+	joyPad.buttonStatus = buttons
+}
+
+// returns the status of all buttons as a mask, bit n is the button n
+func (joyPad *JoyPad) GetButtonMask() uint8 {
+	var mask uint8
+	for i, status := range joyPad.buttonStatus {
+		if status != 0 {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// sets the status of all buttons from a mask, bit n is the button n
+func (joyPad *JoyPad) SetButtonMask(mask uint8) {
+	for i := range joyPad.buttonStatus {
+		joyPad.buttonStatus[i] = uint(mask>>i) & 0b1
+	}
+}
+
+func (joyPad *JoyPad) Serialize(stream *savestate.Stream) {
+	stream.Bool(&joyPad.strobe)
+	stream.Uint(&joyPad.buttonShift)
+	for i := range joyPad.buttonStatus {
+		stream.Uint(&joyPad.buttonStatus[i])
+	}
+}
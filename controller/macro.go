@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// MacroStep holds the button status of the controller for a number of frames
+type MacroStep struct {
+	Buttons [8]uint `json:"buttons"`
+	Frames  uint    `json:"frames"`
+}
+
+// Macro is a timed sequence of controller states, such as the Konami code
+type Macro struct {
+	Name  string      `json:"name"`
+	Steps []MacroStep `json:"steps"`
+	// a looping macro starts again after its last step until it is stopped
+	Loop bool `json:"loop,omitempty"`
+}
+
+// total of frames the macro takes to play
+func (macro *Macro) Length() uint {
+	var length uint
+	for _, step := range macro.Steps {
+		length += step.Frames
+	}
+	return length
+}
+
+func LoadMacro(path string) (*Macro, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var macro Macro
+	if err := json.Unmarshal(content, &macro); err != nil {
+		return nil, fmt.Errorf("controller: invalid macro file %s: %w", path, err)
+	}
+	return &macro, nil
+}
+
+func (macro *Macro) Save(path string) error {
+	content, err := json.MarshalIndent(macro, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// ----- Playback -----
+
+// MacroPlayer returns the controller state of each frame of a macro
+type MacroPlayer struct {
+	macro *Macro
+	step  int
+	frame uint
+}
+
+func NewMacroPlayer(macro *Macro) *MacroPlayer {
+	return &MacroPlayer{macro: macro}
+}
+
+// returns the buttons of the current frame and advances the macro, the
+// second value is false once the macro is over
+func (player *MacroPlayer) Next() ([8]uint, bool) {
+	for player.step < len(player.macro.Steps) {
+		step := player.macro.Steps[player.step]
+		if player.frame < step.Frames {
+			player.frame++
+			return step.Buttons, true
+		}
+		player.step++
+		player.frame = 0
+		// a macro without frames would loop forever
+		if player.step == len(player.macro.Steps) && player.macro.Loop && player.macro.Length() > 0 {
+			player.step = 0
+		}
+	}
+	return [8]uint{}, false
+}
+
+// stops the macro, the next frame has no buttons and Next returns false
+func (player *MacroPlayer) Stop() {
+	player.step = len(player.macro.Steps)
+}
+
+// ----- Recording -----
+
+// MacroRecorder builds a macro from the controller state of each frame,
+// consecutive frames with the same buttons are merged in a single step
+type MacroRecorder struct {
+	macro Macro
+}
+
+func NewMacroRecorder(name string) *MacroRecorder {
+	return &MacroRecorder{macro: Macro{Name: name}}
+}
+
+func (recorder *MacroRecorder) Record(buttons [8]uint) {
+	steps := recorder.macro.Steps
+	if len(steps) > 0 && steps[len(steps)-1].Buttons == buttons {
+		steps[len(steps)-1].Frames++
+		return
+	}
+	recorder.macro.Steps = append(steps, MacroStep{Buttons: buttons, Frames: 1})
+}
+
+// returns the recorded macro, trailing frames with no buttons pressed are dropped
+func (recorder *MacroRecorder) Macro() *Macro {
+	macro := recorder.macro
+	steps := macro.Steps
+	for len(steps) > 0 && steps[len(steps)-1].Buttons == [8]uint{} {
+		steps = steps[:len(steps)-1]
+	}
+	macro.Steps = append([]MacroStep(nil), steps...)
+	return &macro
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+var (
+	none  = [8]uint{}
+	up    = [8]uint{UP: 1}
+	down  = [8]uint{DOWN: 1}
+	start = [8]uint{START: 1}
+)
+
+// plays the macro for the frames, stopping it before the frame stopAt, and
+// returns the buttons of each frame until it ends
+func play(macro *Macro, frames int, stopAt int) [][8]uint {
+	player := NewMacroPlayer(macro)
+	var played [][8]uint
+	for frame := range frames {
+		if frame == stopAt {
+			player.Stop()
+		}
+		buttons, ok := player.Next()
+		if !ok {
+			break
+		}
+		played = append(played, buttons)
+	}
+	return played
+}
+
+func TestMacroPlayer(t *testing.T) {
+	steps := []MacroStep{{up, 2}, {none, 1}, {down, 0}, {start, 1}}
+	tests := []struct {
+		name   string
+		macro  Macro
+		stopAt int
+		want   [][8]uint
+	}{
+		// the steps without frames are skipped
+		{"sequence", Macro{Steps: steps}, -1, [][8]uint{up, up, none, start}},
+		{"loop", Macro{Steps: steps, Loop: true}, -1, [][8]uint{up, up, none, start, up, up, none, start, up, up}},
+		{"stopped in a step", Macro{Steps: steps}, 1, [][8]uint{up}},
+		{"stopped loop", Macro{Steps: steps, Loop: true}, 6, [][8]uint{up, up, none, start, up, up}},
+		{"empty", Macro{}, -1, nil},
+		{"loop without frames", Macro{Steps: []MacroStep{{up, 0}}, Loop: true}, -1, nil},
+	}
+	for _, test := range tests {
+		if played := play(&test.macro, 10, test.stopAt); !slices.Equal(played, test.want) {
+			t.Errorf("%s played %v, want %v", test.name, played, test.want)
+		}
+	}
+}
+
+func TestMacroRecorder(t *testing.T) {
+	recorder := NewMacroRecorder("konami")
+	for _, buttons := range [][8]uint{none, up, up, none, down, down, down, none, none} {
+		recorder.Record(buttons)
+	}
+	macro := recorder.Macro()
+	// the frames merge in steps and the released buttons at the end are dropped
+	want := &Macro{Name: "konami", Steps: []MacroStep{{none, 1}, {up, 2}, {none, 1}, {down, 3}}}
+	if !reflect.DeepEqual(macro, want) || macro.Length() != 7 {
+		t.Errorf("recorded %+v of %d frames, want %+v", macro, macro.Length(), want)
+	}
+
+	// recording goes on after the macro is taken
+	recorder.Record(start)
+	if len(macro.Steps) != 4 || len(recorder.Macro().Steps) != 6 {
+		t.Error("the macro taken changed with the recording")
+	}
+}
+
+func TestMacroFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macro.json")
+	macro := &Macro{Name: "skip", Steps: []MacroStep{{start, 1}, {none, 30}}, Loop: true}
+	if err := macro.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMacro(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, macro) {
+		t.Errorf("loaded %+v, want %+v", loaded, macro)
+	}
+}
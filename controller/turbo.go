@@ -0,0 +1,44 @@
+package controller
+
+import "math"
+
+// emulated frames per second, turbo rates are derived from it
+const FrameRate = 60.0
+
+// Turbo toggles a held button on and off at a fixed rate, synced to the
+// emulated frames instead of the wall clock
+type Turbo struct {
+	period uint
+}
+
+// creates a turbo that presses the button rate times per second, rates that
+// do not divide the frame rate are rounded to the closest period
+func NewTurbo(rate float64) Turbo {
+	var turbo Turbo
+	turbo.SetRate(rate)
+	return turbo
+}
+
+func (turbo *Turbo) SetRate(rate float64) {
+	if rate <= 0 {
+		rate = FrameRate / 2
+	}
+	// a button needs at least one frame pressed and one released
+	turbo.period = max(2, uint(math.Round(FrameRate/rate)))
+}
+
+func (turbo *Turbo) Rate() float64 {
+	return FrameRate / float64(turbo.period)
+}
+
+// returns the button status for the given frame, pressed during the first
+// half of each period while the turbo button is held
+func (turbo *Turbo) Apply(held bool, frame uint) uint {
+	if !held {
+		return 0
+	}
+	if frame%turbo.period < turbo.period/2 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package controller
+
+import "testing"
+
+func TestTurbo(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		wantRate float64
+		// the first frame held, and the status of the button on each frame
+		// from it, as 1 and 0
+		start uint
+		want  string
+	}{
+		{"15Hz", 15, 15, 0, "110011001100"},
+		{"30Hz", 30, 30, 0, "101010101010"},
+		// a period of 3 frames is pressed on 1 of them
+		{"20Hz", 20, 20, 0, "100100100100"},
+		{"7Hz rounds to a period of 9 frames", 7, 60.0 / 9, 0, "111100000111100000"},
+		{"60Hz keeps a frame released", 60, 30, 0, "101010"},
+		{"no rate is 30Hz", 0, 30, 0, "101010"},
+		// the phase follows the emulated frames, not the frame the button was held
+		{"15Hz held from frame 1", 15, 15, 1, "100110011001"},
+		{"15Hz held from frame 1002", 15, 15, 1002, "001100110011"},
+	}
+	for _, test := range tests {
+		turbo := NewTurbo(test.rate)
+		if rate := turbo.Rate(); rate != test.wantRate {
+			t.Errorf("%s has the rate %v, want %v", test.name, rate, test.wantRate)
+		}
+		got := make([]byte, len(test.want))
+		for i := range got {
+			got[i] = '0' + byte(turbo.Apply(true, test.start+uint(i)))
+		}
+		if string(got) != test.want {
+			t.Errorf("%s pressed %s, want %s", test.name, got, test.want)
+		}
+		for frame := range uint(8) {
+			if turbo.Apply(false, test.start+frame) != 0 {
+				t.Errorf("%s pressed the button on frame %d while it was released", test.name, test.start+frame)
+			}
+		}
+	}
+}
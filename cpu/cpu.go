@@ -1,664 +1,213 @@
 package cpu
 
 import (
+	"fmt"
+	"vsasakiv/nesemulator/apu"
 	"vsasakiv/nesemulator/ppu"
 )
 
-const Carry = "C"
-const Zero = "Z"
-const InterruptDisable = "I"
-const Decimal = "D"
-const Overflow = "O"
-const Negative = "N"
+// status flags, as the bits of Psts
+const (
+	Carry uint8 = 1 << iota
+	Zero
+	InterruptDisable
+	Decimal
+	// only exists in the copies of the status pushed to the stack
+	Break
+	Unused
+	Overflow
+	Negative
+)
 
 type Cpu struct {
 	Pc                          uint16
 	Acc, Xidx, Yidx, Sptr, Psts uint8
-	opcodeTable                 []string
 	cycles                      uint
-	cpuCycle                    uint
 	clockCounter                uint
-	hasNmiInterrupt             bool
-	hasOamDmaInterrupt          bool
-	hasIrqInterrupt             bool
-	hasApuInterrupt             bool
 
-	instructionExecuting bool
-	instructionCycles    uint
+	// the sequence being run and its next step, see sequenceFetch
+	sequence uint8
+	step     uint
+	// the instruction being executed and the address it accesses, base is the
+	// address before the index register was added
+	opcode uint8
+	addr   uint16
+	base   uint16
+	// the zero page pointer of the indirect modes, the value being modified
+	// and the vector of the interrupt being taken
+	pointer uint8
+	value   uint8
+	vector  uint16
+
+	// level of the nmi line in the last cycle, for detecting its edge
+	nmiLine bool
+	// an nmi edge was detected and the nmi was not taken yet
+	nmiPending bool
+	// the irq line is active and the interrupts are enabled
+	irqPending bool
+	// the pending interrupts at the end of the previous cycle, the instructions
+	// take the ones pending at the end of their second to last cycle
+	nmiSignal bool
+	irqSignal bool
+	// the signals are kept for a cycle, the interrupts arriving meanwhile wait
+	// for the next instruction
+	delayInterrupts bool
+
+	// a dma halts the cpu on its next read, the halted read is at dmaAddr
+	dmaHalt   bool
+	dmaHalted bool
+	dmaAddr   uint16
+	// the dmc dma waits for its halt and dummy cycles
+	dmcDma   bool
+	dmcDummy bool
+	// the oam dma page, its reads and writes done and the value being copied
+	oamDma   bool
+	oamPage  uint8
+	oamCount uint16
+	oamValue uint8
 }
 
-// Initialize cpu with corret parameters, also initialize instructionTable
+// Initialize cpu with corret parameters, the reset sets the stack pointer
 func NewCpu() *Cpu {
 	var cpu Cpu
-	cpu.Psts = 0b00100100
-	cpu.Sptr = 0xFD
-	cpu.opcodeTable = Generate()
-	cpu.cycles = 7
+	cpu.Psts = InterruptDisable | Unused
 	return &cpu
 }
 
+// starts the reset sequence, the registers other than the pc, the stack
+// pointer and the interrupt flag keep their values
 func (cpu *Cpu) Reset() {
-	cpu.Acc = 0
-	cpu.Xidx = 0
-	cpu.Yidx = 0
-	cpu.Psts = 0b00100100
-	cpu.Sptr = 0xFD
-	cpu.cpuCycle = 0
 	cpu.clockCounter = 0
-	cpu.hasNmiInterrupt = false
-	cpu.hasOamDmaInterrupt = false
-	cpu.hasIrqInterrupt = false
-	cpu.hasApuInterrupt = false
-	cpu.Pc = MemRead16(0xFFFC)
+	cpu.nmiPending = false
+	cpu.dmaHalt = false
+	cpu.dmaHalted = false
+	cpu.dmcDma = false
+	cpu.oamDma = false
+	cpu.startSequence(sequenceReset, 0xFFFC)
 }
 
 func GetCpu() *Cpu {
 	return &cpu
 }
 
+// returns the cycles run since power on, counting the 7 of the reset
+func (cpu *Cpu) Cycles() uint {
+	return cpu.cycles
+}
+
+// returns why the cpu stopped when a jam opcode halted it until the reset,
+// empty while it runs
+func (cpu *Cpu) JamReason() string {
+	if cpu.sequence != sequenceInstruction || opcodes[cpu.opcode].mnemonic != JAM || cpu.step == 0 {
+		return ""
+	}
+	return fmt.Sprintf("jam opcode $%02X at $%04X", cpu.opcode, cpu.Pc-1)
+}
+
 var cpu Cpu = *NewCpu()
 
+// runs a cpu cycle every 3 ppu clocks
 func Clock() {
 	cpu.clockCounter++
-	if cpu.clockCounter == 3 {
-		cpu.cpuCycle++
-		cpu.clockCounter = 0
-	}
-
-	switch {
-	case cpu.hasNmiInterrupt:
-		if cpu.cpuCycle == 7 {
-			cpu.treatNmiInterrupt()
-			cpu.hasNmiInterrupt = false
-			cpu.cpuCycle = 0
-		}
-		return
-	case cpu.hasOamDmaInterrupt:
-		if cpu.cpuCycle == 514 {
-			cpu.OamDmaWrite(MainMemory.OamDmaPage)
-			cpu.hasOamDmaInterrupt = false
-			cpu.cpuCycle = 0
-		}
-		return
-	case cpu.hasIrqInterrupt:
-		if cpu.cpuCycle == 7 {
-			cpu.treatIrqInterrupt()
-			cpu.hasIrqInterrupt = false
-			cpu.cpuCycle = 0
-		}
+	if cpu.clockCounter < 3 {
 		return
 	}
+	cpu.clockCounter = 0
+	cpu.cycles++
 
-	if ppu.GetPpu().PollForNmiInterrupt() {
-		cpu.hasNmiInterrupt = true
+	cpu.pollDmcDma()
+	if cpu.dmaHalted {
+		cpu.runDma()
+		cpu.pollInterrupts()
 		return
 	}
 
-	if PoolOamDmaInterrupt() {
-		cpu.hasOamDmaInterrupt = true
-		return
+	// the cycle is run from a copy, restored when a dma halts it on a read
+	halt := cpu.dmaHalt
+	var halted Cpu
+	if halt {
+		halted = cpu
 	}
-
-	if MainMemory.Mapper.PollInterrupt() && cpu.getFlag(InterruptDisable) == 0 {
-		cpu.hasIrqInterrupt = true
-		return
+	MainMemory.busWrite = false
+	done := cpu.runCycle()
+	if halt && !MainMemory.busWrite {
+		cpu = halted
+		cpu.dmaHalt = false
+		cpu.dmaHalted = true
+		cpu.dmaAddr = MainMemory.busAddr
+		done = false
 	}
-
-	if !cpu.instructionExecuting {
-		instruction := MemRead(cpu.Pc)
-		opcode := cpu.opcodeTable[instruction]
-		addresingMode := (instruction >> 2) & 0b00000111
-		cpu.instructionExecuting = true
-		cpu.instructionCycles = cpu.calcCycles(instruction, opcode, addresingMode)
+	cpu.pollInterrupts()
+	if done {
+		cpu.endSequence()
 	}
-	// execute next
-	if cpu.instructionCycles == cpu.cpuCycle {
-		instruction := MemRead(cpu.Pc)
-		opcode := cpu.opcodeTable[instruction]
-		addresingMode := (instruction >> 2) & 0b00000111
-		cpu.instructionExecuting = false
-		cpu.cpuCycle = 0
-		// cpu.LastInstructionCycles = cpu.calcCycles(instruction, opcode, addresingMode)
-		// cpu.cycles += cpu.LastInstructionCycles
-		switch opcode {
-		// Accumulator instructions
-		case ADC:
-			op, size := cpu.getAluOperand(addresingMode)
-			var result uint16 = uint16(cpu.Acc) + uint16(op) + uint16(cpu.getFlag(Carry))
-			cpu.calcAndSetFlags([]string{Carry, Zero, Overflow, Negative}, result, cpu.Acc, op)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case ORA:
-			op, size := cpu.getAluOperand(addresingMode)
-			var result uint8 = cpu.Acc | op
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case AND:
-			op, size := cpu.getAluOperand(addresingMode)
-			var result uint8 = cpu.Acc & op
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case EOR:
-			op, size := cpu.getAluOperand(addresingMode)
-			var result uint8 = cpu.Acc ^ op
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case STA:
-			address, size := cpu.getAluAddress(addresingMode)
-			MemWrite(address, cpu.Acc)
-			cpu.Pc += uint16(size)
-		case LDA:
-			address, size := cpu.getAluAddress(addresingMode)
-			var result uint8 = MemRead(address)
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case CMP:
-			op, size := cpu.getAluOperand(addresingMode)
-			cpu.setCompareFlags(op, cpu.Acc)
-			cpu.Pc += uint16(size)
-		case SBC:
-			op, size := cpu.getAluOperand(addresingMode)
-			var result uint16 = uint16(cpu.Acc) + uint16(^op) + uint16(cpu.getFlag(Carry))
-			cpu.calcAndSetFlags([]string{Carry, Zero, Overflow, Negative}, uint16(result), cpu.Acc, ^op)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case ASL:
-			// has accumulator addressing
-			if instruction == 0x0A {
-				cpu.setFlag(Carry, cpu.Acc>>7)
-				result := cpu.Acc << 1
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				cpu.Acc = result
-				cpu.Pc += 1
-			} else {
-				address, size := cpu.getAluAddress(addresingMode)
-				op := MemRead(address)
-				result := op << 1
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-				cpu.setFlag(Carry, op>>7)
-
-				MemWrite(address, result)
-				cpu.Pc += uint16(size)
-			}
-		case ROL:
-			// has accumulator addressing
-			if instruction == 0x2A {
-				carry := (cpu.Acc & 0b10000000) >> 7
-				result := (cpu.Acc << 1) + cpu.getFlag(Carry)
-				cpu.setFlag(Carry, carry)
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				cpu.Acc = result
-				cpu.Pc += 1
-			} else {
-				address, size := cpu.getAluAddress(addresingMode)
-				op := MemRead(address)
-				carry := (op & 0b10000000) >> 7
-				result := (op << 1) + cpu.getFlag(Carry)
-				cpu.setFlag(Carry, carry)
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				MemWrite(address, result)
-				cpu.Pc += uint16(size)
-			}
-		case LSR:
-			// has accumulator addressing
-			if instruction == 0x4A {
-				cpu.setFlag(Carry, cpu.Acc&0b1)
-				result := cpu.Acc >> 1
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				cpu.Acc = result
-				cpu.Pc += 1
-			} else {
-				address, size := cpu.getAluAddress(addresingMode)
-				op := MemRead(address)
-				result := op >> 1
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-				cpu.setFlag(Carry, op&0b1)
-
-				MemWrite(address, result)
-				cpu.Pc += uint16(size)
-			}
-		case ROR:
-			// has accumulator addressing
-			if instruction == 0x6A {
-				carry := cpu.Acc & 0b1
-				result := (cpu.Acc >> 1) + (cpu.getFlag(Carry) << 7)
-				cpu.setFlag(Carry, carry)
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				cpu.Acc = result
-				cpu.Pc += 1
-			} else {
-				address, size := cpu.getAluAddress(addresingMode)
-				op := MemRead(address)
-				carry := op & 0b1
-				result := (op >> 1) + (cpu.getFlag(Carry) << 7)
-				cpu.setFlag(Carry, carry)
-				cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-				MemWrite(address, result)
-				cpu.Pc += uint16(size)
-			}
-		case DEC:
-			address, size := cpu.getAluAddress(addresingMode)
-			result := MemRead(address) - 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			MemWrite(address, result)
-			cpu.Pc += uint16(size)
-		case INC:
-			address, size := cpu.getAluAddress(addresingMode)
-			result := MemRead(address) + 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			MemWrite(address, result)
-			cpu.Pc += uint16(size)
-		case SLO:
-			address, size := cpu.getAluAddress(addresingMode)
-			op := MemRead(address)
-			cpu.setFlag(Carry, op>>7)
-			result := (op<<1 | cpu.Acc)
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-			MemWrite(address, op<<1)
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case RLA:
-			address, size := cpu.getAluAddress(addresingMode)
-			op := MemRead(address)
-			carry := (op & 0b10000000) >> 7
-			mem := (op << 1) + cpu.getFlag(Carry)
-			result := mem & cpu.Acc
-			cpu.setFlag(Carry, carry)
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-			MemWrite(address, mem)
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case SRE:
-			address, size := cpu.getAluAddress(addresingMode)
-			op := MemRead(address)
-			cpu.setFlag(Carry, op&0b1)
-			result := (op >> 1) ^ cpu.Acc
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-
-			MemWrite(address, op>>1)
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case RRA:
-			address, size := cpu.getAluAddress(addresingMode)
-			op := MemRead(address)
-			carry := op & 0b1
-			mem := (op >> 1) + (cpu.getFlag(Carry) << 7)
-			cpu.setFlag(Carry, carry)
-
-			var result uint16 = uint16(cpu.Acc) + uint16(mem) + uint16(cpu.getFlag(Carry))
-			cpu.calcAndSetFlags([]string{Carry, Zero, Overflow, Negative}, result, cpu.Acc, mem)
-			MemWrite(address, mem)
-			cpu.Acc = uint8(result)
-			cpu.Pc += uint16(size)
-		case SAX:
-			const zeroPageY uint8 = 0b101
-			var aluAddress uint16
-			var size uint8
-			if addresingMode == zeroPageY {
-				aluAddress, size = cpu.getAluAddressZeroPageY()
-			} else {
-				aluAddress, size = cpu.getAluAddress(addresingMode)
-			}
-			result := cpu.Xidx & cpu.Acc
-			MemWrite(aluAddress, result)
-			cpu.Pc += uint16(size)
-		case LAX:
-			const zeroPageY uint8 = 0b101
-			var op uint8
-			var size uint8
-			if addresingMode == zeroPageY {
-				op, size = cpu.getAluOperandZeroPageY()
-			} else if instruction == 0xBF {
-				// absolute Y
-				op, size = cpu.getAluOperand(absoluteY)
-			} else {
-				op, size = cpu.getAluOperand(addresingMode)
-			}
-			cpu.Acc = op
-			cpu.Xidx = op
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(op), 0, 0)
-			cpu.Pc += uint16(size)
-		case DCP:
-			address, size := cpu.getAluAddress(addresingMode)
-			result := MemRead(address) - 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			MemWrite(address, result)
-			cpu.setCompareFlags(result, cpu.Acc)
-			cpu.Pc += uint16(size)
-		case ISB:
-			address, size := cpu.getAluAddress(addresingMode)
-			result := MemRead(address) + 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			MemWrite(address, result)
-
-			var subResult uint16 = uint16(cpu.Acc) + uint16(^result) + uint16(cpu.getFlag(Carry))
-			cpu.calcAndSetFlags([]string{Carry, Zero, Overflow, Negative}, uint16(subResult), cpu.Acc, ^result)
-			cpu.Acc = uint8(subResult)
-			cpu.Pc += uint16(size)
-		case ANC:
-			op, size := cpu.getAluOperand(addresingMode)
-			result := cpu.Acc & op
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.setFlag(Carry, cpu.getFlag(Negative))
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case ALR:
-			op, size := cpu.getAluOperand(addresingMode)
-			andResult := op & cpu.Acc
-			result := andResult >> 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.setFlag(Carry, andResult&0b1)
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case ARR:
-			op, size := cpu.getAluOperand(addresingMode)
-			andResult := op & cpu.Acc
-			result := (andResult >> 1) + (andResult << 7)
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			bit6 := (result >> 6) & 1
-			bit5 := (result >> 5) & 1
-			if bit6 == 1 && bit5 == 1 {
-				cpu.setFlag(Carry, 1)
-				cpu.setFlag(Overflow, 0)
-			} else if bit6 == 0 && bit5 == 0 {
-				cpu.setFlag(Carry, 0)
-				cpu.setFlag(Overflow, 0)
-			} else if bit6 == 0 && bit5 == 1 {
-				cpu.setFlag(Carry, 0)
-				cpu.setFlag(Overflow, 1)
-			} else {
-				cpu.setFlag(Carry, 1)
-				cpu.setFlag(Overflow, 1)
-			}
-			cpu.Acc = result
-			cpu.Pc += uint16(size)
-		case LXA:
-			op, size := cpu.getAluOperand(addresingMode)
-			result := op & cpu.Acc
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = result
-			cpu.Xidx = result
-			cpu.Pc += uint16(size)
-		case AXS:
-			op, size := cpu.getAluOperand(addresingMode)
-			andResult := cpu.Acc & cpu.Xidx
-			cpu.setCompareFlags(op, andResult)
-			cpu.Xidx = andResult - op
-			cpu.Pc += uint16(size)
-		case SHA:
-			address, size := cpu.getAluAddress(addresingMode)
-			result := (cpu.Xidx & cpu.Acc) & (MemRead(cpu.Pc+2) + 1)
-			MemWrite(address, result)
-			cpu.Pc += uint16(size)
-		case LAS:
-			op, size := cpu.getAluOperand(addresingMode)
-			result := op & cpu.Sptr
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(result), 0, 0)
-			cpu.Acc = result
-			cpu.Xidx = result
-			cpu.Sptr = result
-			cpu.Pc += uint16(size)
-		case TAS:
-			address, size := cpu.getAluAddress(addresingMode)
-			andResult := cpu.Acc & cpu.Xidx
-			result := (cpu.Xidx & cpu.Acc) & (MemRead(cpu.Pc+2) + 1)
-			cpu.Sptr = andResult
-			MemWrite(address, result)
-			cpu.Pc += uint16(size)
-
-		// stack manipulating instructions
-		case BRK:
-			cpu.pushToStack16(cpu.Pc + 2)
-			cpu.pushToStack(cpu.Psts | 0b00110000)
-			cpu.setFlag(InterruptDisable, 1)
-			cpu.Pc = 0xFFFE
-		case PHP:
-			cpu.pushToStack(cpu.Psts | 0b00010000)
-			cpu.Pc += 1
-		case PLP:
-			// B and Unused flags
-			cpu.Psts = (cpu.pullFromStack() & 0b11101111) | 0b00100000
-			cpu.Pc += 1
-		case PHA:
-			cpu.pushToStack(cpu.Acc)
-			cpu.Pc += 1
-		case PLA:
-			cpu.Acc = cpu.pullFromStack()
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Acc), 0, 0)
-			cpu.Pc += 1
-		case RTI:
-			// B and Unused flags
-			cpu.Psts = (cpu.pullFromStack() & 0b11101111) | 0b00100000
-			cpu.Pc = cpu.pullFromStack16()
-		case RTS:
-			cpu.Pc = cpu.pullFromStack16() + 1
-
-		// branching instructions
-		case BPL:
-			cpu.branchIfFlag(Negative, 0)
-		case BMI:
-			cpu.branchIfFlag(Negative, 1)
-		case BVC:
-			cpu.branchIfFlag(Overflow, 0)
-		case BVS:
-			cpu.branchIfFlag(Overflow, 1)
-		case BCC:
-			cpu.branchIfFlag(Carry, 0)
-		case BCS:
-			cpu.branchIfFlag(Carry, 1)
-		case BNE:
-			cpu.branchIfFlag(Zero, 0)
-		case BEQ:
-			cpu.branchIfFlag(Zero, 1)
-
-		// flag manipulating instructions
-		case BIT:
-			op, size := cpu.getAluOperand(addresingMode)
-			result := cpu.Acc & op
-			cpu.calcAndSetFlags([]string{Zero}, uint16(result), 0, 0)
-			cpu.setFlag(Overflow, (op>>6)&0b1)
-			cpu.setFlag(Negative, (op>>7)&0b1)
-			cpu.Pc += uint16(size)
-		case CLC:
-			cpu.setFlag(Carry, 0)
-			cpu.Pc += 1
-		case SEC:
-			cpu.setFlag(Carry, 1)
-			cpu.Pc += 1
-		case CLI:
-			cpu.setFlag(InterruptDisable, 0)
-			cpu.Pc += 1
-		case SEI:
-			cpu.setFlag(InterruptDisable, 1)
-			cpu.Pc += 1
-		case CLV:
-			cpu.setFlag(Overflow, 0)
-			cpu.Pc += 1
-		case CLD:
-			cpu.setFlag(Decimal, 0)
-			cpu.Pc += 1
-		case SED:
-			cpu.setFlag(Decimal, 1)
-			cpu.Pc += 1
-
-		// jumping instructions
-		case JSR:
-			cpu.pushToStack16(cpu.Pc + 2)
-			cpu.Pc = MemRead16(cpu.Pc + 1)
-		case JMP:
-			aluAddress, _ := cpu.getAluAddress(addresingMode)
-			// only occourence of indirect absolute
-			if instruction == 0x6C {
-				// instruction has bug
-				if aluAddress&0x00FF == 0x00FF {
-					low := uint16(MemRead(aluAddress))
-					high := uint16(MemRead(aluAddress&0xFF00)) << 8
-					cpu.Pc = high + low
-				} else {
-					cpu.Pc = MemRead16(aluAddress)
-				}
-			} else {
-				cpu.Pc = aluAddress
-			}
+}
 
-		// index register manipulating instructions
-		case STY:
-			aluAddress, size := cpu.getAluAddress(addresingMode)
-			MemWrite(aluAddress, cpu.Yidx)
-			cpu.Pc += uint16(size)
-		case STX:
-			const zeroPageY uint8 = 0b101
-			var aluAddress uint16
-			var size uint8
-			if addresingMode == zeroPageY {
-				aluAddress, size = cpu.getAluAddressZeroPageY()
-			} else {
-				aluAddress, size = cpu.getAluAddress(addresingMode)
-			}
-			MemWrite(aluAddress, cpu.Xidx)
-			cpu.Pc += uint16(size)
-		case DEY:
-			cpu.Yidx -= 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Yidx), 0, 0)
-			cpu.Pc += 1
-		case DEX:
-			cpu.Xidx -= 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Xidx), 0, 0)
-			cpu.Pc += 1
-		case TYA:
-			cpu.Acc = cpu.Yidx
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Acc), 0, 0)
-			cpu.Pc += 1
-		case TXA:
-			cpu.Acc = cpu.Xidx
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Acc), 0, 0)
-			cpu.Pc += 1
-		case SHY:
-			address, size := cpu.getAluAddress(addresingMode)
-			MemWrite(address, cpu.Yidx&(MemRead(cpu.Pc+2)+1))
-			cpu.Pc += uint16(size)
-		case SHX:
-			address, size := cpu.getAluAddress(addresingMode)
-			MemWrite(address, cpu.Xidx&(MemRead(cpu.Pc+2)+1))
-			cpu.Pc += uint16(size)
-		case LDY:
-			var op, size uint8
-			// out of pattern operand
-			if instruction == 0xA0 {
-				op, size = cpu.getAluOperand(immediate)
-			} else {
-				op, size = cpu.getAluOperand(addresingMode)
-			}
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(op), 0, 0)
-			cpu.Yidx = op
-			cpu.Pc += uint16(size)
-		case LDX:
-			const zeroPageY uint8 = 0b101
-			var op, size uint8
-			if instruction == 0xA2 {
-				op, size = cpu.getAluOperand(immediate)
-			} else if instruction == 0xBE {
-				// absolute Y
-				op, size = cpu.getAluOperand(absoluteY)
-			} else if addresingMode == zeroPageY {
-				op, size = cpu.getAluOperandZeroPageY()
-			} else {
-				op, size = cpu.getAluOperand(addresingMode)
-			}
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(op), 0, 0)
-			cpu.Xidx = op
-			cpu.Pc += uint16(size)
-		case TAY:
-			cpu.Yidx = cpu.Acc
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Acc), 0, 0)
-			cpu.Pc += 1
-		case TAX:
-			cpu.Xidx = cpu.Acc
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Acc), 0, 0)
-			cpu.Pc += 1
-		case CPY:
-			var op, size uint8
-			// out of pattern operand
-			if instruction == 0xC0 {
-				op, size = cpu.getAluOperand(immediate)
-			} else {
-				op, size = cpu.getAluOperand(addresingMode)
-			}
-			cpu.setCompareFlags(op, cpu.Yidx)
-			cpu.Pc += uint16(size)
-		case CPX:
-			var op, size uint8
-			// out of pattern operand
-			if instruction == 0xE0 {
-				op, size = cpu.getAluOperand(immediate)
-			} else {
-				op, size = cpu.getAluOperand(addresingMode)
-			}
-			cpu.setCompareFlags(op, cpu.Xidx)
-			cpu.Pc += uint16(size)
-		case INY:
-			cpu.Yidx += 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Yidx), 0, 0)
-			cpu.Pc += 1
-		case INX:
-			cpu.Xidx += 1
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Xidx), 0, 0)
-			cpu.Pc += 1
-		case TSX:
-			cpu.Xidx = cpu.Sptr
-			cpu.calcAndSetFlags([]string{Zero, Negative}, uint16(cpu.Sptr), 0, 0)
-			cpu.Pc += 1
-		case TXS:
-			cpu.Sptr = cpu.Xidx
-			cpu.Pc += 1
-		case NOP:
-			switch instruction {
-			// implict nops size 1
-			case 0xEA, 0x1A, 0x3A, 0x5A, 0x7A, 0xDA, 0xFA:
-				cpu.Pc += 1
-			// immediate nops size 2
-			case 0x80, 0x82, 0xC2, 0xE2:
-				cpu.Pc += 2
-			// remaining nops, size dependent on addressing
-			default:
-				_, size := cpu.getAluOperand(addresingMode)
-				cpu.Pc += uint16(size)
-			}
-		}
+// runs the next cycle of the sequence, returns whether the sequence ended
+func (cpu *Cpu) runCycle() bool {
+	if cpu.sequence == sequenceFetch {
+		cpu.fetch()
+		return false
 	}
+	steps := cpu.steps()
+	step := steps[cpu.step]
+	cpu.step++
+	step(cpu)
+	return cpu.step >= uint(len(steps))
 }
 
-// treats NMI interrupt, pushes context to stack, jump to vector
-func (cpu *Cpu) treatNmiInterrupt() {
-	cpu.pushToStack16(cpu.Pc)
-	cpu.pushToStack(cpu.Psts & 0b11101111)
+// samples the interrupt lines at the end of the cycle, the nmi is taken when
+// its line becomes active and the irq while its line is active
+func (cpu *Cpu) pollInterrupts() {
+	if cpu.delayInterrupts {
+		cpu.delayInterrupts = false
+	} else {
+		cpu.nmiSignal = cpu.nmiPending
+		cpu.irqSignal = cpu.irqPending
+	}
+	line := ppu.GetPpu().NmiLine()
+	if line && !cpu.nmiLine {
+		cpu.nmiPending = true
+	}
+	cpu.nmiLine = line
+	cpu.irqPending = irqLine() && !cpu.getFlag(InterruptDisable)
+}
 
-	cpu.setFlag(InterruptDisable, 1)
-	cpu.Pc = MemRead16(0xFFFA)
+// the irq line is shared by the cartridge and the apu
+func irqLine() bool {
+	return MainMemory.Mapper.Irq() || apu.GetApu().Irq()
 }
 
-func (cpu *Cpu) OamDmaWrite(page uint8) {
-	for i := range uint16(256) {
-		val := MemRead((uint16(page) << 8) + i)
-		MemWrite(OAMDATA, val)
+func (cpu *Cpu) steps() []step {
+	switch cpu.sequence {
+	case sequenceInstruction:
+		return opcodeSteps[cpu.opcode]
+	case sequenceReset:
+		return resetSteps
 	}
+	return interruptSteps
 }
 
-func (cpu *Cpu) treatIrqInterrupt() {
-	cpu.pushToStack16(cpu.Pc)
-	cpu.pushToStack(cpu.Psts | 0b00010000)
-	cpu.setFlag(InterruptDisable, 1)
-	cpu.Pc = MemRead16(0xFFFE)
+func (cpu *Cpu) startSequence(sequence uint8, vector uint16) {
+	cpu.sequence = sequence
+	cpu.step = 0
+	cpu.vector = vector
+}
+
+// the interrupts are taken between instructions, otherwise the next cycle
+// fetches the instruction at the pc
+func (cpu *Cpu) endSequence() {
+	// the first instruction of the handlers always runs
+	handler := cpu.sequence == sequenceReset || cpu.sequence == sequenceInterrupt ||
+		cpu.sequence == sequenceInstruction && cpu.opcode == 0x00
+	switch {
+	case !handler && (cpu.nmiSignal || cpu.irqSignal):
+		// the nmi takes the irq vector over as the vector is read
+		cpu.startSequence(sequenceInterrupt, 0xFFFE)
+	default:
+		cpu.sequence = sequenceFetch
+		if debugHooks.Len() > 0 {
+			callHooks(AccessExecute, cpu.Pc, PeekMemory(cpu.Pc))
+		}
+	}
 }
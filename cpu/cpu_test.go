@@ -0,0 +1,785 @@
+package cpu
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"vsasakiv/nesemulator/apu"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/controller"
+	"vsasakiv/nesemulator/mappers"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// a 16KB rom with the nmi handler at $8000 and the irq one at $8001, both an rti
+func testCartridge() *cartridge.Cartridge {
+	prg := make([]uint8, 0x4000)
+	prg[0] = 0x40
+	prg[1] = 0x40
+	copy(prg[0x3FFA:], []uint8{0x00, 0x80, 0x00, 0x80, 0x01, 0x80})
+	return &cartridge.Cartridge{
+		PrgRom:        prg,
+		PrgRomSize:    uint(len(prg)),
+		ChrRom:        make([]uint8, 0x2000),
+		ChrRomSize:    0x2000,
+		SRam:          make([]uint8, 0x2000),
+		MirroringType: cartridge.HorizontalMirroring,
+	}
+}
+
+// a cartridge whose irq line is set by the test
+type irqMapper struct {
+	mappers.Mapper
+	irq bool
+}
+
+func (mapper *irqMapper) Irq() bool {
+	return mapper.irq
+}
+
+var testMapper irqMapper
+
+// powers the cpu on, runs the reset and puts the program in the ram at $0300
+func loadProgram(program ...uint8) {
+	testMapper = irqMapper{Mapper: mappers.NewMapper2(testCartridge())}
+	LoadCartridge(&testMapper)
+	PowerOn()
+	cpu.Reset()
+	runInstruction()
+	copy(MainMemory.ram[0x0300:], program)
+	cpu.Pc = 0x0300
+}
+
+// runs cpu cycles until the next instruction is fetched, returns how many ran,
+// including the cycles of a dma halting the fetch
+func runInstruction() int {
+	cycles := 0
+	for {
+		for range 3 {
+			Clock()
+		}
+		cycles++
+		if cpu.sequence == sequenceFetch && !cpu.dmaHalted {
+			return cycles
+		}
+	}
+}
+
+func runCycles(cycles int) {
+	for range cycles * 3 {
+		Clock()
+	}
+}
+
+// records the addresses of the instructions executed
+func recordExecution(t *testing.T) *[]uint16 {
+	var executed []uint16
+	remove := AddHook(func(access int, addr uint16, val uint8) {
+		if access == AccessExecute {
+			executed = append(executed, addr)
+		}
+	})
+	t.Cleanup(remove)
+	return &executed
+}
+
+// records the bus accesses as "r $addr" and "w $addr=val", the dummy ones too
+func recordBus(t *testing.T) *[]string {
+	var accesses []string
+	remove := AddHook(func(access int, addr uint16, val uint8) {
+		switch access {
+		case AccessRead, AccessDummyRead:
+			accesses = append(accesses, fmt.Sprintf("r $%04X", addr))
+		case AccessWrite, AccessDummyWrite:
+			accesses = append(accesses, fmt.Sprintf("w $%04X=%02X", addr, val))
+		}
+	})
+	t.Cleanup(remove)
+	return &accesses
+}
+
+// documented cycles of each opcode without page crossings or taken branches,
+// the opcodes that jam the cpu never end
+var documentedCycles = [256]int{
+	7, 6, 0, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6, // 00
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 10
+	6, 6, 0, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6, // 20
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 30
+	6, 6, 0, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6, // 40
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 50
+	6, 6, 0, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6, // 60
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // 70
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // 80
+	2, 6, 0, 6, 4, 4, 4, 4, 2, 5, 2, 5, 5, 5, 5, 5, // 90
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, // A0
+	2, 5, 0, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4, // B0
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // C0
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // D0
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, // E0
+	2, 5, 0, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7, // F0
+}
+
+// the read instructions take one more cycle when the indexed address crosses a page
+var pageCrossingOpcodes = []uint8{
+	0x11, 0x19, 0x1C, 0x1D, 0x31, 0x39, 0x3C, 0x3D, 0x51, 0x59, 0x5C, 0x5D, 0x71, 0x79, 0x7C, 0x7D, 0xB1, 0xB3, 0xB9, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF, 0xD1, 0xD9, 0xDC, 0xDD, 0xF1, 0xF9, 0xFC, 0xFD,
+}
+
+func TestOpcodeCycles(t *testing.T) {
+	for i := range opcodes {
+		op := &opcodes[i]
+		if op.mnemonic == JAM {
+			continue
+		}
+		// the operands are zero and the index registers too, nothing crosses a page
+		loadProgram(uint8(i), 0x00, 0x00)
+		cpu.opcode = uint8(i)
+		want := documentedCycles[i]
+		if op.mode == relative && cpu.branchTaken() {
+			want++
+		}
+		if cycles := runInstruction(); cycles != want {
+			t.Errorf("opcode $%02X %s took %d cycles, want %d", i, op.mnemonic, cycles, want)
+		}
+
+		// $00FF indexed by 1 and the pointer at $FF, the address is $0100
+		if op.mode == relative {
+			continue
+		}
+		loadProgram(uint8(i), 0xFF, 0x00)
+		MainMemory.ram[0xFF] = 0xFF
+		cpu.Xidx, cpu.Yidx = 1, 1
+		want = documentedCycles[i]
+		if slices.Contains(pageCrossingOpcodes, uint8(i)) {
+			want++
+		}
+		if cycles := runInstruction(); cycles != want {
+			t.Errorf("opcode $%02X %s took %d cycles crossing a page, want %d", i, op.mnemonic, cycles, want)
+		}
+	}
+}
+
+func TestBusAccesses(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		x, y    uint8
+		want    []string
+	}{
+		{
+			name:    "LDA abs,X without page crossing",
+			program: []uint8{0xBD, 0x10, 0x04},
+			x:       0x01,
+			want:    []string{"r $0300", "r $0301", "r $0302", "r $0411"},
+		},
+		{
+			name:    "LDA abs,X crossing a page",
+			program: []uint8{0xBD, 0xFF, 0x04},
+			x:       0x01,
+			want:    []string{"r $0300", "r $0301", "r $0302", "r $0400", "r $0500"},
+		},
+		{
+			name:    "STA abs,X always reads first",
+			program: []uint8{0x9D, 0x10, 0x04},
+			x:       0x01,
+			want:    []string{"r $0300", "r $0301", "r $0302", "r $0411", "w $0411=00"},
+		},
+		{
+			name:    "INC zp writes the value read back",
+			program: []uint8{0xE6, 0x10},
+			want:    []string{"r $0300", "r $0301", "r $0010", "w $0010=00", "w $0010=01"},
+		},
+		{
+			name:    "LDA zp,X reads the address before indexing",
+			program: []uint8{0xB5, 0xFF},
+			x:       0x02,
+			want:    []string{"r $0300", "r $0301", "r $00FF", "r $0001"},
+		},
+		{
+			name:    "STA (zp),Y reads the uncorrected address",
+			program: []uint8{0x91, 0x20},
+			y:       0x01,
+			want:    []string{"r $0300", "r $0301", "r $0020", "r $0021", "r $0001", "w $0001=00"},
+		},
+		{
+			name:    "PHA reads the next opcode",
+			program: []uint8{0x48},
+			want:    []string{"r $0300", "r $0301", "w $01FD=00"},
+		},
+		{
+			name:    "JSR reads the stack before pushing",
+			program: []uint8{0x20, 0x00, 0x05},
+			want:    []string{"r $0300", "r $0301", "r $01FD", "w $01FD=03", "w $01FC=02", "r $0302"},
+		},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.Xidx = test.x
+		cpu.Yidx = test.y
+		accesses := recordBus(t)
+		runInstruction()
+		if !slices.Equal(*accesses, test.want) {
+			t.Errorf("%s accessed %v, want %v", test.name, *accesses, test.want)
+		}
+	}
+}
+
+func TestBranchCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		want    int
+	}{
+		{"not taken", []uint8{0xD0, 0x10}, 2},
+		{"taken", []uint8{0xF0, 0x10}, 3},
+		{"taken crossing a page", []uint8{0xF0, 0x80}, 4},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.setFlag(Zero, true)
+		if cycles := runInstruction(); cycles != test.want {
+			t.Errorf("branch %s took %d cycles, want %d", test.name, cycles, test.want)
+		}
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		// the interrupt flag before the program and the cycle the irq line is
+		// set, counted from the start of the program
+		interruptDisable bool
+		irqCycle         int
+		// the bytes pulled from the stack by the program
+		stack []uint8
+		want  []uint16
+	}{
+		{
+			name:             "the irq line is held while the interrupts are disabled",
+			program:          []uint8{0xEA, 0x58, 0xEA, 0xEA},
+			interruptDisable: true,
+			want:             []uint16{0x0300, 0x0301, 0x0302, 0x8001, 0x0303},
+		},
+		{
+			name:    "an irq arriving in sei is taken after it",
+			program: []uint8{0x78, 0xEA},
+			want:    []uint16{0x0300, 0x8001, 0x0301},
+		},
+		{
+			name:    "an irq arriving in the last cycle waits for the next instruction",
+			program: []uint8{0xEA, 0xEA, 0xEA},
+			// the second cycle of the first nop
+			irqCycle: 1,
+			want:     []uint16{0x0300, 0x0301, 0x8001, 0x0302},
+		},
+		{
+			name:             "an irq held during cli is taken after the next instruction",
+			program:          []uint8{0x58, 0xEA, 0xEA},
+			interruptDisable: true,
+			want:             []uint16{0x0300, 0x0301, 0x8001, 0x0302},
+		},
+		{
+			name:             "an irq held during plp clearing the flag is taken after the next instruction",
+			program:          []uint8{0x28, 0xEA, 0xEA},
+			interruptDisable: true,
+			stack:            []uint8{0x20},
+			want:             []uint16{0x0300, 0x0301, 0x8001, 0x0302},
+		},
+		{
+			name:    "an irq arriving in plp setting the flag is taken after it",
+			program: []uint8{0x28, 0xEA},
+			stack:   []uint8{0x24},
+			want:    []uint16{0x0300, 0x8001, 0x0301},
+		},
+		{
+			name: "an irq held during rti clearing the flag is taken right after it",
+			// returns to the nop at $0301
+			program:          []uint8{0x40, 0xEA, 0xEA},
+			interruptDisable: true,
+			stack:            []uint8{0x20, 0x01, 0x03},
+			want:             []uint16{0x0300, 0x8001, 0x0301},
+		},
+		{
+			name:    "an irq held during rti setting the flag is not taken",
+			program: []uint8{0x40, 0xEA, 0xEA},
+			stack:   []uint8{0x24, 0x01, 0x03},
+			want:    []uint16{0x0300, 0x0301, 0x0302},
+		},
+		{
+			name: "a taken branch delays the irq arriving in its second cycle",
+			// beq to the next instruction
+			program:  []uint8{0xF0, 0x00, 0xEA, 0xEA},
+			irqCycle: 1,
+			want:     []uint16{0x0300, 0x0302, 0x8001, 0x0303},
+		},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.setFlag(InterruptDisable, test.interruptDisable)
+		cpu.setFlag(Zero, true)
+		for i, val := range test.stack {
+			MainMemory.ram[0x0100|uint16(cpu.Sptr+1+uint8(i))] = val
+		}
+		executed := recordExecution(t)
+		*executed = append(*executed, cpu.Pc)
+		runCycles(test.irqCycle)
+		testMapper.irq = true
+		// the line is released once the handler runs, as a handler
+		// acknowledging the irq would
+		for len(*executed) < len(test.want) {
+			runInstruction()
+			if (*executed)[len(*executed)-1] == 0x8001 {
+				testMapper.irq = false
+			}
+		}
+		if !slices.Equal(*executed, test.want) {
+			t.Errorf("%s executed %04X, want %04X", test.name, *executed, test.want)
+		}
+	}
+}
+
+func TestNmiEdge(t *testing.T) {
+	loadProgram(0xEA, 0xEA, 0xEA, 0xEA)
+	t.Cleanup(ppu.PowerOn)
+	ppu.PowerOn()
+	ppu.GetPpu().WriteToPpuControl(0x80)
+	for !ppu.GetPpu().NmiLine() {
+		ppu.Clock()
+	}
+	executed := recordExecution(t)
+	for range 4 {
+		runInstruction()
+	}
+	// the nop at $0300 runs first, then the nmi is taken once while the line
+	// stays active
+	want := []uint16{0x8000, 0x0301, 0x0302, 0x0303}
+	if !slices.Equal(*executed, want) {
+		t.Errorf("executed %04X, want %04X", *executed, want)
+	}
+}
+
+func TestNmiBranchDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cycle of the taken branch the nmi edge is detected at the end of
+		cycle int
+		want  []uint16
+	}{
+		{"an nmi arriving in the first cycle is taken after the branch", 1, []uint16{0x0300, 0x8000, 0x0302}},
+		{"an nmi arriving in the second cycle waits for the next instruction", 2, []uint16{0x0300, 0x0302, 0x8000, 0x0303}},
+	}
+	for _, test := range tests {
+		// beq to the next instruction
+		loadProgram(0xF0, 0x00, 0xEA, 0xEA)
+		cpu.setFlag(Zero, true)
+		executed := recordExecution(t)
+		*executed = append(*executed, cpu.Pc)
+		runCycles(test.cycle)
+		cpu.nmiPending = true
+		for len(*executed) < len(test.want) {
+			runInstruction()
+		}
+		if !slices.Equal(*executed, test.want) {
+			t.Errorf("%s executed %04X, want %04X", test.name, *executed, test.want)
+		}
+	}
+}
+
+func TestInterruptHijack(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		// whether the irq line is held from the start, and the cycle the nmi
+		// is pending at, counted from the start of the program
+		irq      bool
+		nmiCycle int
+		// whether the first status pushed has the break flag
+		brk  bool
+		want []uint16
+	}{
+		{
+			name:     "an nmi arriving while brk pushes the pc takes its vector",
+			program:  []uint8{0x00, 0x00, 0xEA},
+			nmiCycle: 4,
+			brk:      true,
+			want:     []uint16{0x8000, 0x0302},
+		},
+		{
+			name:    "an nmi arriving while the irq pushes the pc takes its vector",
+			program: []uint8{0xEA, 0xEA, 0xEA},
+			irq:     true,
+			// the nop and the first 4 cycles of the irq
+			nmiCycle: 6,
+			want:     []uint16{0x8000, 0x0301},
+		},
+		{
+			name:     "an nmi arriving after brk reads the vector waits for the first instruction of the handler",
+			program:  []uint8{0x00, 0x00, 0xEA},
+			nmiCycle: 6,
+			brk:      true,
+			want:     []uint16{0x8001, 0x8000, 0x0302},
+		},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.setFlag(InterruptDisable, !test.irq)
+		testMapper.irq = test.irq
+		executed := recordExecution(t)
+		var pushed []uint8
+		remove := AddHook(func(access int, addr uint16, val uint8) {
+			if access == AccessWrite && addr == 0x01FB {
+				pushed = append(pushed, val)
+			}
+		})
+		t.Cleanup(remove)
+		runCycles(test.nmiCycle)
+		cpu.nmiPending = true
+		// the irq line is released once the interrupt is taken
+		for len(*executed) < len(test.want) {
+			runInstruction()
+			testMapper.irq = false
+		}
+		if !slices.Equal(*executed, test.want) {
+			t.Errorf("%s executed %04X, want %04X", test.name, *executed, test.want)
+		}
+		if len(pushed) == 0 || pushed[0]&Break != 0 != test.brk {
+			t.Errorf("%s pushed the status %02X, want the break flag %v", test.name, pushed, test.brk)
+		}
+	}
+}
+
+func TestOpenBus(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		want    uint8
+	}{
+		// the last value on the bus is the high byte of the address
+		{"unmapped address", []uint8{0xAD, 0x00, 0x50}, 0x50},
+		{"apu register", []uint8{0xAD, 0x00, 0x40}, 0x40},
+		{"ram mirror", []uint8{0xAD, 0x10, 0x18}, 0x5A},
+		{"write-only ppu register", []uint8{0x8D, 0x05, 0x20, 0xAD, 0x03, 0x20}, 0x5A},
+		{"ppu status low bits", []uint8{0x8D, 0x05, 0x20, 0xAD, 0x02, 0x20}, 0x1A},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		t.Cleanup(ppu.PowerOn)
+		ppu.PowerOn()
+		MainMemory.ram[0x0010] = 0x5A
+		cpu.Acc = 0x5A
+		for cpu.Pc < 0x0300+uint16(len(test.program)) {
+			runInstruction()
+		}
+		if cpu.Acc != test.want {
+			t.Errorf("%s read %02X, want %02X", test.name, cpu.Acc, test.want)
+		}
+	}
+}
+
+func TestRamMirrors(t *testing.T) {
+	// stores at the mirror at $1800 and reads at the one at $0800
+	loadProgram(0xA9, 0x42, 0x8D, 0x20, 0x18, 0xAD, 0x20, 0x08)
+	for range 3 {
+		runInstruction()
+	}
+	if MainMemory.ram[0x0020] != 0x42 || cpu.Acc != 0x42 {
+		t.Errorf("ram is %02X and the mirror read %02X, want 42", MainMemory.ram[0x0020], cpu.Acc)
+	}
+}
+
+func TestWriteHooks(t *testing.T) {
+	// sta $20, then the same store poked without the cpu
+	loadProgram(0xA9, 0x42, 0x85, 0x20)
+	var written []uint8
+	remove := AddHook(func(access int, addr uint16, val uint8) {
+		if access == AccessWrite {
+			// the hooks run once the value is written
+			written = append(written, PeekMemory(addr))
+		}
+	})
+	t.Cleanup(remove)
+	runInstruction()
+	runInstruction()
+	PokeBus(0x0020, 0x43)
+	PokeBus(OAMDMA, 0x02)
+	if !slices.Equal(written, []uint8{0x42}) || MainMemory.ram[0x20] != 0x43 {
+		t.Errorf("the hooks read %02X back and ram is %02X, want 42 read and 43 poked", written, MainMemory.ram[0x20])
+	}
+	if cpu.oamDma || MainMemory.dataBus != 0x42 {
+		t.Errorf("poking changed the bus, the dma is %v and the data bus %02X", cpu.oamDma, MainMemory.dataBus)
+	}
+}
+
+func TestOamDmaCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+	}{
+		{"sta $4014", []uint8{0x8D, 0x14, 0x40, 0xEA}},
+		// the lda takes an odd number of cycles
+		{"lda zp and sta $4014", []uint8{0xA5, 0x00, 0x8D, 0x14, 0x40, 0xEA}},
+	}
+	var dmaCycles []int
+	for _, test := range tests {
+		loadProgram(test.program...)
+		accesses := recordBus(t)
+		for cpu.Pc != 0x0300+uint16(len(test.program))-1 {
+			runInstruction()
+		}
+		*accesses = nil
+		// the halt of the nop fetch and the dma
+		cycles := runInstruction()
+		writes := 0
+		for _, access := range *accesses {
+			if access[:7] == "w $2004" {
+				writes++
+			}
+		}
+		if writes != 256 {
+			t.Errorf("%s wrote %d bytes to the oam, want 256", test.name, writes)
+		}
+		dmaCycles = append(dmaCycles, cycles)
+	}
+	slices.Sort(dmaCycles)
+	if !slices.Equal(dmaCycles, []int{513, 514}) {
+		t.Errorf("the oam dma took %d cycles, want 513 and 514 depending on the alignment", dmaCycles)
+	}
+}
+
+func TestDmcDmaDoubleRead(t *testing.T) {
+	for _, dmc := range []bool{false, true} {
+		// lda $4016 with only the A button pressed
+		loadProgram(0xAD, 0x16, 0x40)
+		joyPad := controller.NewJoypad()
+		joyPad.SetButtonStatus(controller.A, 1)
+		ConnectJoyPad1(joyPad)
+		runCycles(3)
+		if dmc {
+			// the dma halts the read of $4016
+			startDmcDma(t)
+		}
+		cycles := 3 + runInstruction()
+		// the halted read shifts the controller, so the cpu sees the B button
+		want, wantCycles := uint8(0x41), 4
+		if dmc {
+			want, wantCycles = 0x40, 7
+		}
+		if cpu.Acc != want || cycles < wantCycles || cycles > wantCycles+1 {
+			t.Errorf("with dmc dma %v read %02X in %d cycles, want %02X in %d", dmc, cpu.Acc, cycles, want, wantCycles)
+		}
+	}
+}
+
+// starts the dmc of a powered on apu playing a one byte sample from $C000,
+// its dma halts the cpu on the next read
+func startDmcDma(t *testing.T) {
+	t.Cleanup(apu.PowerOn)
+	apu.PowerOn()
+	apu.GetApu().Dmc.WriteAddress(0)
+	apu.GetApu().Dmc.WriteLength(0)
+	apu.GetApu().WriteToStatusRegister(0x10)
+}
+
+func TestDmcDmaPpuDataRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		// the cycles before the read of $2007
+		readCycle int
+		// the value read, the reads of $2007 and the cycles of the program
+		want       uint8
+		wantReads  int
+		wantCycles int
+	}{
+		// the halt, dummy and alignment cycles repeat the read
+		{"lda $2007", []uint8{0xAD, 0x07, 0x20}, 3, 0x13, 4, 8},
+		// the lda takes an odd number of cycles, so the dma needs no alignment
+		{"lda zp and lda $2007", []uint8{0xA5, 0x00, 0xAD, 0x07, 0x20}, 6, 0x12, 3, 10},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		ppu.LoadCartridge(&testMapper)
+		t.Cleanup(ppu.PowerOn)
+		ppu.PowerOn()
+		// the nametable from $2100 holds $10, $11..., the first read fills
+		// the buffer with $10
+		ppu.GetPpu().WriteToAddrRegister(0x21)
+		ppu.GetPpu().WriteToAddrRegister(0x00)
+		for i := range 8 {
+			ppu.GetPpu().WriteToPpuDataRegister(0x10 + uint8(i))
+		}
+		ppu.GetPpu().WriteToAddrRegister(0x21)
+		ppu.GetPpu().WriteToAddrRegister(0x00)
+		ppu.GetPpu().ReadPpuDataRegister()
+		accesses := recordBus(t)
+		runCycles(test.readCycle)
+		startDmcDma(t)
+		cycles := test.readCycle + runInstruction()
+		reads := 0
+		for _, access := range *accesses {
+			if access == "r $2007" {
+				reads++
+			}
+		}
+		if cpu.Acc != test.want || reads != test.wantReads || cycles != test.wantCycles {
+			t.Errorf("%s read %02X with %d reads of $2007 in %d cycles, want %02X with %d in %d",
+				test.name, cpu.Acc, reads, cycles, test.want, test.wantReads, test.wantCycles)
+		}
+	}
+}
+
+func TestOamDmaWithDmcDma(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cycles of the oam dma before the dmc starts
+		dmcCycle   int
+		wantCycles int
+	}{
+		{"the dmc dma at the start of the oam dma", 0, 516},
+		{"the dmc dma in the middle of the oam dma", 101, 516},
+		{"the dmc dma in the last write of the oam dma", 511, 515},
+		{"the dmc dma after the oam dma", 513, 517},
+	}
+	for _, test := range tests {
+		// sta $4014 copying the zero page, which holds 0, 1...
+		loadProgram(0x8D, 0x14, 0x40, 0xEA)
+		t.Cleanup(ppu.PowerOn)
+		ppu.PowerOn()
+		for i := range 0x100 {
+			MainMemory.ram[i] = uint8(i)
+		}
+		accesses := recordBus(t)
+		runInstruction()
+		*accesses = nil
+		runCycles(test.dmcCycle)
+		startDmcDma(t)
+		// the halt of the nop fetch and both dmas
+		cycles := test.dmcCycle + runInstruction()
+		writes, samples := 0, 0
+		for _, access := range *accesses {
+			switch {
+			case access[:7] == "w $2004":
+				writes++
+			case access == "r $C000":
+				samples++
+			}
+		}
+		if writes != 256 || samples != 1 || cycles != test.wantCycles {
+			t.Errorf("%s wrote %d bytes to the oam and read %d samples in %d cycles, want 256 and 1 in %d",
+				test.name, writes, samples, cycles, test.wantCycles)
+		}
+		for i := range 0x100 {
+			if val := ppu.PpuOamRead(uint8(i)); val != uint8(i) {
+				t.Errorf("%s copied %02X to the oam at %02X", test.name, val, i)
+				break
+			}
+		}
+	}
+}
+
+func TestUnofficialOpcodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		// the registers, the carry and the byte at $0410 before the program
+		a, x, y uint8
+		carry   bool
+		mem     uint8
+		// the registers, the byte at $0410 and the N, V, Z and C flags after it
+		wantA, wantX, wantMem uint8
+		wantFlags             uint8
+	}{
+		{name: "SLO", program: []uint8{0x0F, 0x10, 0x04}, a: 0x01, mem: 0x81, wantA: 0x03, wantMem: 0x02, wantFlags: Carry},
+		{name: "RLA", program: []uint8{0x2F, 0x10, 0x04}, a: 0xFF, carry: true, mem: 0x81, wantA: 0x03, wantMem: 0x03, wantFlags: Carry},
+		{name: "SRE", program: []uint8{0x4F, 0x10, 0x04}, a: 0x01, mem: 0x03, wantA: 0x00, wantMem: 0x01, wantFlags: Zero | Carry},
+		{name: "RRA", program: []uint8{0x6F, 0x10, 0x04}, a: 0x10, mem: 0x03, wantA: 0x12, wantMem: 0x01},
+		{name: "SAX", program: []uint8{0x8F, 0x10, 0x04}, a: 0xF0, x: 0x3C, wantA: 0xF0, wantX: 0x3C, wantMem: 0x30},
+		{name: "LAX", program: []uint8{0xAF, 0x10, 0x04}, mem: 0x80, wantA: 0x80, wantX: 0x80, wantMem: 0x80, wantFlags: Negative},
+		{name: "DCP", program: []uint8{0xCF, 0x10, 0x04}, a: 0x10, mem: 0x11, wantA: 0x10, wantMem: 0x10, wantFlags: Zero | Carry},
+		{name: "ISC", program: []uint8{0xEF, 0x10, 0x04}, a: 0x20, carry: true, mem: 0x0F, wantA: 0x10, wantMem: 0x10, wantFlags: Carry},
+		// the stack pointer after the reset is $FD
+		{name: "LAS", program: []uint8{0xBB, 0x0F, 0x04}, y: 0x01, mem: 0x7F, wantA: 0x7D, wantX: 0x7D, wantMem: 0x7F},
+		{name: "ANC", program: []uint8{0x0B, 0x80}, a: 0xFF, wantA: 0x80, wantFlags: Negative | Carry},
+		{name: "ALR", program: []uint8{0x4B, 0x03}, a: 0xFF, wantA: 0x01, wantFlags: Carry},
+		// the carry is bit 6 of the result and the overflow bit 6 xor bit 5
+		{name: "ARR", program: []uint8{0x6B, 0xFF}, a: 0x80, wantA: 0x40, wantFlags: Overflow | Carry},
+		{name: "AXS", program: []uint8{0xCB, 0x02}, a: 0x0F, x: 0xF3, wantA: 0x0F, wantX: 0x01, wantFlags: Carry},
+		{name: "SBC $EB", program: []uint8{0xEB, 0x10}, a: 0x20, carry: true, wantA: 0x10, wantFlags: Carry},
+		{name: "NOP implied", program: []uint8{0x1A}, a: 0x42, wantA: 0x42},
+		{name: "NOP immediate", program: []uint8{0x80, 0xFF}, a: 0x42, wantA: 0x42},
+		{name: "NOP zero page", program: []uint8{0x04, 0x10}, a: 0x42, wantA: 0x42},
+		{name: "NOP absolute,X", program: []uint8{0x1C, 0x10, 0x04}, a: 0x42, mem: 0x80, wantA: 0x42, wantMem: 0x80},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.Acc, cpu.Xidx, cpu.Yidx = test.a, test.x, test.y
+		cpu.Psts = InterruptDisable | Unused
+		cpu.setFlag(Carry, test.carry)
+		MainMemory.ram[0x0410] = test.mem
+		runInstruction()
+		flags := cpu.Psts & (Negative | Overflow | Zero | Carry)
+		if cpu.Acc != test.wantA || cpu.Xidx != test.wantX || MainMemory.ram[0x0410] != test.wantMem || flags != test.wantFlags {
+			t.Errorf("%s gave A=%02X X=%02X $0410=%02X flags %02X, want A=%02X X=%02X $0410=%02X flags %02X", test.name,
+				cpu.Acc, cpu.Xidx, MainMemory.ram[0x0410], flags, test.wantA, test.wantX, test.wantMem, test.wantFlags)
+		}
+		if cpu.Pc != 0x0300+uint16(len(test.program)) {
+			t.Errorf("%s left the pc at $%04X", test.name, cpu.Pc)
+		}
+	}
+}
+
+func TestUnstableOpcodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		a, x, y uint8
+		// the address written and its value, or the accumulator when addr is 0
+		addr uint16
+		want uint8
+	}{
+		{name: "ANE", program: []uint8{0x8B, 0x5F}, a: 0x01, x: 0x3C, want: 0x0C},
+		{name: "LXA", program: []uint8{0xAB, 0x5F}, a: 0x01, want: 0x5F},
+		{name: "SHX", program: []uint8{0x9E, 0x10, 0x04}, x: 0xFF, y: 0x01, addr: 0x0411, want: 0x05},
+		// the value replaces the high byte of the address crossing the page
+		{name: "SHX crossing a page", program: []uint8{0x9E, 0xFF, 0x04}, x: 0x06, y: 0x01, addr: 0x0400, want: 0x04},
+		{name: "SHY", program: []uint8{0x9C, 0x10, 0x04}, y: 0xFF, x: 0x01, addr: 0x0411, want: 0x05},
+		{name: "SHA", program: []uint8{0x9F, 0x10, 0x04}, a: 0xF3, x: 0x3F, y: 0x01, addr: 0x0411, want: 0x01},
+		{name: "TAS", program: []uint8{0x9B, 0x10, 0x04}, a: 0xF3, x: 0x3F, y: 0x01, addr: 0x0411, want: 0x01},
+	}
+	for _, test := range tests {
+		loadProgram(test.program...)
+		cpu.Acc, cpu.Xidx, cpu.Yidx = test.a, test.x, test.y
+		runInstruction()
+		got := cpu.Acc
+		if test.addr != 0 {
+			got = MainMemory.ram[test.addr]
+		}
+		if got != test.want {
+			t.Errorf("%s gave %02X, want %02X", test.name, got, test.want)
+		}
+	}
+}
+
+func TestJam(t *testing.T) {
+	loadProgram(0xEA, 0x02, 0xEA)
+	var jams []string
+	remove := AddHook(func(access int, addr uint16, val uint8) {
+		if access == AccessJam {
+			jams = append(jams, fmt.Sprintf("$%02X at $%04X", val, addr))
+		}
+	})
+	t.Cleanup(remove)
+	executed := recordExecution(t)
+	runCycles(100)
+	if !slices.Equal(*executed, []uint16{0x0301}) || !slices.Equal(jams, []string{"$02 at $0301"}) {
+		t.Errorf("executed %04X and jammed by %v, want the jam at $0301 reported once", *executed, jams)
+	}
+	if reason := cpu.JamReason(); reason != "jam opcode $02 at $0301" {
+		t.Errorf("the jam reason is %q", reason)
+	}
+	cpu.Reset()
+	runInstruction()
+	if cpu.JamReason() != "" || cpu.Pc != 0x8000 {
+		t.Errorf("the reset left the cpu at $%04X jammed by %q", cpu.Pc, cpu.JamReason())
+	}
+}
@@ -0,0 +1,93 @@
+package cpu
+
+import "vsasakiv/nesemulator/hooks"
+
+// ----- Debugger hooks -----
+
+// kinds of the events seen by the debug hook
+const (
+	AccessRead = iota
+	AccessWrite
+	// an instruction is about to be executed, the value is its opcode
+	AccessExecute
+	// the cpu jumped to the interrupt vector, the address is the handler
+	AccessNmi
+	AccessIrq
+	// the cpu was halted by the opcode at the address, the value is the opcode
+	AccessJam
+	// the accesses of the cycles that throw the value away, as the read of
+	// the next byte by the implied instructions or the write back of the
+	// read-modify-write ones, they reach the bus but are not operands
+	AccessDummyRead
+	AccessDummyWrite
+)
+
+// Hook is called on every cpu bus read and write, before each instruction,
+// when an interrupt is serviced and when the cpu jams
+type Hook func(access int, addr uint16, val uint8)
+
+// hooks of the attached tools, as the debugger and the code/data logger
+var debugHooks hooks.List[Hook]
+
+// AddHook attaches the hook to the cpu, the returned function detaches it
+func AddHook(hook Hook) (remove func()) {
+	return debugHooks.Add(hook)
+}
+
+func callHooks(access int, addr uint16, val uint8) {
+	for hook := range debugHooks.All() {
+		hook(access, addr, val)
+	}
+}
+
+// reads the cpu bus without side effects, for debuggers and memory viewers,
+// registers that change when read are not accessed and read as 0
+func PeekMemory(addr uint16) uint8 {
+	switch {
+	case addr <= 0x1FFF:
+		return MainMemory.ram[addr%0x0800]
+	case addr >= 0x6000:
+		return mapperRead(addr)
+	}
+	return 0
+}
+
+// returns a copy of the 2KB of ram
+func RamSnapshot() [0x0800]uint8 {
+	return MainMemory.ram
+}
+
+// writes the ram or the cartridge ram without calling the hooks, for memory
+// editors, the registers are not written, nor the mapper ones above $8000
+func PokeMemory(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1FFF:
+		MainMemory.ram[addr%0x0800] = val
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		MainMemory.Mapper.Write(addr, val)
+	}
+}
+
+// writes the ram, the registers and the cartridge as the cpu would, without
+// calling the hooks or driving the data bus, for scripts. A write to $4014
+// doesn't start the oam dma, as it would halt the cpu in the middle of a cycle
+func PokeBus(addr uint16, val uint8) {
+	if addr != OAMDMA {
+		memWrite(addr, val)
+	}
+}
+
+// returns the mnemonic of the opcode
+func Mnemonic(opcode uint8) string {
+	return opcodes[opcode].mnemonic
+}
+
+// returns whether the opcode is not part of the official instruction set
+func IsIllegalOpcode(opcode uint8) bool {
+	return isIllegal(opcode)
+}
+
+// returns the size in bytes of the instruction, including the opcode
+func InstructionSize(opcode uint8) uint8 {
+	return getInstructionSize(opcode)
+}
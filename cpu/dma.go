@@ -0,0 +1,69 @@
+package cpu
+
+import "vsasakiv/nesemulator/apu"
+
+// ----- DMA -----
+
+// the oam dma copies a page to the sprite memory and the dmc dma fetches the
+// next sample byte, both halt the cpu on its next read cycle. The halted read
+// is done and thrown away, so reading $4016 or $2007 there has the side
+// effects of two reads, and the cycle runs again once the dma ends. The dma
+// reads on even cycles and writes on odd ones, with an extra cycle to align,
+// so the oam dma takes 513 or 514 cycles and the dmc one 3 or 4
+
+func (cpu *Cpu) startOamDma(page uint8) {
+	cpu.oamDma = true
+	cpu.oamPage = page
+	cpu.oamCount = 0
+	cpu.dmaHalt = true
+}
+
+// the dmc is checked every cycle for an empty sample buffer
+func (cpu *Cpu) pollDmcDma() {
+	if !cpu.dmcDma && apu.GetApu().Dmc.DmaRequested() {
+		cpu.dmcDma = true
+		cpu.dmaHalt = true
+		cpu.dmcDummy = true
+	}
+}
+
+// runs a cycle of the dma while the cpu is halted
+func (cpu *Cpu) runDma() {
+	getCycle := cpu.cycles%2 == 0
+	switch {
+	case getCycle && cpu.dmcDma && !cpu.dmaHalt && !cpu.dmcDummy:
+		// the dmc dma is aborted when the channel was disabled meanwhile
+		if apu.GetApu().Dmc.DmaRequested() {
+			apu.GetApu().Dmc.FillSampleBuffer(MemRead(apu.GetApu().Dmc.DmaAddress()))
+		}
+		cpu.dmcDma = false
+	case getCycle && cpu.oamDma:
+		cpu.dmaCycle()
+		cpu.oamValue = MemRead(uint16(cpu.oamPage)<<8 | cpu.oamCount/2)
+		cpu.oamCount++
+	case !getCycle && cpu.oamDma && cpu.oamCount%2 == 1:
+		cpu.dmaCycle()
+		MemWrite(OAMDATA, cpu.oamValue)
+		cpu.oamCount++
+		if cpu.oamCount == 512 {
+			cpu.oamDma = false
+		}
+	default:
+		// the dmc halt and dummy cycles and the alignment repeat the halted
+		// read, except for the controllers that only see consecutive reads once
+		cpu.dmaCycle()
+		if cpu.dmaAddr != CONTROLLER1 && cpu.dmaAddr != CONTROLLER2 {
+			dummyRead(cpu.dmaAddr)
+		}
+	}
+	cpu.dmaHalted = cpu.oamDma || cpu.dmcDma
+}
+
+// every dma cycle counts as the halt or the dummy cycle of the dmc dma
+func (cpu *Cpu) dmaCycle() {
+	if cpu.dmaHalt {
+		cpu.dmaHalt = false
+	} else {
+		cpu.dmcDummy = false
+	}
+}
@@ -0,0 +1,406 @@
+package cpu
+
+// ----- Instruction handlers -----
+
+// the handlers of the read instructions receive the operand, the write ones
+// return the value stored and the read-modify-write ones both, see accessRead,
+// accessWrite and accessModify
+
+// sets the zero and negative flags from the value
+func (cpu *Cpu) setZN(val uint8) {
+	cpu.setFlag(Zero, val == 0)
+	cpu.setFlag(Negative, val&0x80 != 0)
+}
+
+// adds the value and the carry to the accumulator, subtraction adds the complement
+func (cpu *Cpu) add(val uint8) {
+	sum := uint16(cpu.Acc) + uint16(val) + uint16(cpu.Psts&Carry)
+	result := uint8(sum)
+	cpu.setFlag(Carry, sum > 0xFF)
+	cpu.setFlag(Overflow, (result^cpu.Acc)&(result^val)&0x80 != 0)
+	cpu.Acc = result
+	cpu.setZN(result)
+}
+
+// sets the flags as the register minus the value
+func (cpu *Cpu) compare(reg uint8, val uint8) {
+	cpu.setFlag(Carry, reg >= val)
+	cpu.setZN(reg - val)
+}
+
+// accumulator instructions
+
+func (cpu *Cpu) adc(val uint8) uint8 {
+	cpu.add(val)
+	return 0
+}
+
+func (cpu *Cpu) sbc(val uint8) uint8 {
+	cpu.add(^val)
+	return 0
+}
+
+func (cpu *Cpu) and(val uint8) uint8 {
+	cpu.Acc &= val
+	cpu.setZN(cpu.Acc)
+	return 0
+}
+
+func (cpu *Cpu) ora(val uint8) uint8 {
+	cpu.Acc |= val
+	cpu.setZN(cpu.Acc)
+	return 0
+}
+
+func (cpu *Cpu) eor(val uint8) uint8 {
+	cpu.Acc ^= val
+	cpu.setZN(cpu.Acc)
+	return 0
+}
+
+func (cpu *Cpu) cmp(val uint8) uint8 {
+	cpu.compare(cpu.Acc, val)
+	return 0
+}
+
+func (cpu *Cpu) cpx(val uint8) uint8 {
+	cpu.compare(cpu.Xidx, val)
+	return 0
+}
+
+func (cpu *Cpu) cpy(val uint8) uint8 {
+	cpu.compare(cpu.Yidx, val)
+	return 0
+}
+
+func (cpu *Cpu) bit(val uint8) uint8 {
+	cpu.setFlag(Zero, cpu.Acc&val == 0)
+	cpu.setFlag(Overflow, val&0x40 != 0)
+	cpu.setFlag(Negative, val&0x80 != 0)
+	return 0
+}
+
+func (cpu *Cpu) lda(val uint8) uint8 {
+	cpu.Acc = val
+	cpu.setZN(val)
+	return 0
+}
+
+func (cpu *Cpu) ldx(val uint8) uint8 {
+	cpu.Xidx = val
+	cpu.setZN(val)
+	return 0
+}
+
+func (cpu *Cpu) ldy(val uint8) uint8 {
+	cpu.Yidx = val
+	cpu.setZN(val)
+	return 0
+}
+
+func (cpu *Cpu) sta(uint8) uint8 {
+	return cpu.Acc
+}
+
+func (cpu *Cpu) stx(uint8) uint8 {
+	return cpu.Xidx
+}
+
+func (cpu *Cpu) sty(uint8) uint8 {
+	return cpu.Yidx
+}
+
+// the nops with an operand read it
+func (cpu *Cpu) nop(uint8) uint8 {
+	return 0
+}
+
+// read-modify-write instructions
+
+func (cpu *Cpu) asl(val uint8) uint8 {
+	cpu.setFlag(Carry, val&0x80 != 0)
+	val <<= 1
+	cpu.setZN(val)
+	return val
+}
+
+func (cpu *Cpu) lsr(val uint8) uint8 {
+	cpu.setFlag(Carry, val&0x01 != 0)
+	val >>= 1
+	cpu.setZN(val)
+	return val
+}
+
+func (cpu *Cpu) rol(val uint8) uint8 {
+	result := val<<1 | cpu.Psts&Carry
+	cpu.setFlag(Carry, val&0x80 != 0)
+	cpu.setZN(result)
+	return result
+}
+
+func (cpu *Cpu) ror(val uint8) uint8 {
+	result := val>>1 | (cpu.Psts&Carry)<<7
+	cpu.setFlag(Carry, val&0x01 != 0)
+	cpu.setZN(result)
+	return result
+}
+
+func (cpu *Cpu) inc(val uint8) uint8 {
+	val++
+	cpu.setZN(val)
+	return val
+}
+
+func (cpu *Cpu) dec(val uint8) uint8 {
+	val--
+	cpu.setZN(val)
+	return val
+}
+
+// unofficial instructions, most combine two official ones
+
+func (cpu *Cpu) slo(val uint8) uint8 {
+	val = cpu.asl(val)
+	cpu.ora(val)
+	return val
+}
+
+func (cpu *Cpu) rla(val uint8) uint8 {
+	val = cpu.rol(val)
+	cpu.and(val)
+	return val
+}
+
+func (cpu *Cpu) sre(val uint8) uint8 {
+	val = cpu.lsr(val)
+	cpu.eor(val)
+	return val
+}
+
+func (cpu *Cpu) rra(val uint8) uint8 {
+	val = cpu.ror(val)
+	cpu.add(val)
+	return val
+}
+
+func (cpu *Cpu) dcp(val uint8) uint8 {
+	val--
+	cpu.compare(cpu.Acc, val)
+	return val
+}
+
+func (cpu *Cpu) isb(val uint8) uint8 {
+	val++
+	cpu.add(^val)
+	return val
+}
+
+func (cpu *Cpu) sax(uint8) uint8 {
+	return cpu.Acc & cpu.Xidx
+}
+
+func (cpu *Cpu) lax(val uint8) uint8 {
+	cpu.Acc = val
+	cpu.Xidx = val
+	cpu.setZN(val)
+	return 0
+}
+
+func (cpu *Cpu) anc(val uint8) uint8 {
+	cpu.and(val)
+	cpu.setFlag(Carry, cpu.Acc&0x80 != 0)
+	return 0
+}
+
+func (cpu *Cpu) alr(val uint8) uint8 {
+	cpu.and(val)
+	cpu.Acc = cpu.lsr(cpu.Acc)
+	return 0
+}
+
+// and then rotate right, the carry and the overflow come from the bits 6 and 5 of the result
+func (cpu *Cpu) arr(val uint8) uint8 {
+	cpu.Acc = (cpu.Acc&val)>>1 | (cpu.Psts&Carry)<<7
+	cpu.setZN(cpu.Acc)
+	cpu.setFlag(Carry, cpu.Acc&0x40 != 0)
+	cpu.setFlag(Overflow, (cpu.Acc>>6^cpu.Acc>>5)&1 != 0)
+	return 0
+}
+
+// the unstable immediates mix the accumulator with a value that depends on the
+// chip and its temperature, these are the ones most seen on the 2A03
+const (
+	lxaMagic = 0xFF
+	aneMagic = 0xEE
+)
+
+func (cpu *Cpu) lxa(val uint8) uint8 {
+	cpu.Acc = (cpu.Acc | lxaMagic) & val
+	cpu.Xidx = cpu.Acc
+	cpu.setZN(cpu.Acc)
+	return 0
+}
+
+func (cpu *Cpu) ane(val uint8) uint8 {
+	cpu.Acc = (cpu.Acc | aneMagic) & cpu.Xidx & val
+	cpu.setZN(cpu.Acc)
+	return 0
+}
+
+// x = a & x - value, setting the flags as a compare
+func (cpu *Cpu) axs(val uint8) uint8 {
+	andResult := cpu.Acc & cpu.Xidx
+	cpu.compare(andResult, val)
+	cpu.Xidx = andResult - val
+	return 0
+}
+
+func (cpu *Cpu) las(val uint8) uint8 {
+	result := val & cpu.Sptr
+	cpu.Acc = result
+	cpu.Xidx = result
+	cpu.Sptr = result
+	cpu.setZN(result)
+	return 0
+}
+
+// the unstable stores and the value with the high byte of the base address
+// plus one, when the index crosses a page the value also replaces the high
+// byte of the address written
+func (cpu *Cpu) unstableStore(val uint8) uint8 {
+	val &= uint8(cpu.base>>8) + 1
+	if cpu.addr&0xFF00 != cpu.base&0xFF00 {
+		cpu.addr = uint16(val)<<8 | cpu.addr&0x00FF
+	}
+	return val
+}
+
+func (cpu *Cpu) sha(uint8) uint8 {
+	return cpu.unstableStore(cpu.Acc & cpu.Xidx)
+}
+
+func (cpu *Cpu) shx(uint8) uint8 {
+	return cpu.unstableStore(cpu.Xidx)
+}
+
+func (cpu *Cpu) shy(uint8) uint8 {
+	return cpu.unstableStore(cpu.Yidx)
+}
+
+func (cpu *Cpu) tas(uint8) uint8 {
+	cpu.Sptr = cpu.Acc & cpu.Xidx
+	return cpu.unstableStore(cpu.Sptr)
+}
+
+// implied instructions
+
+func (cpu *Cpu) clc(uint8) uint8 {
+	cpu.setFlag(Carry, false)
+	return 0
+}
+
+func (cpu *Cpu) sec(uint8) uint8 {
+	cpu.setFlag(Carry, true)
+	return 0
+}
+
+func (cpu *Cpu) cli(uint8) uint8 {
+	cpu.setFlag(InterruptDisable, false)
+	return 0
+}
+
+func (cpu *Cpu) sei(uint8) uint8 {
+	cpu.setFlag(InterruptDisable, true)
+	return 0
+}
+
+func (cpu *Cpu) clv(uint8) uint8 {
+	cpu.setFlag(Overflow, false)
+	return 0
+}
+
+func (cpu *Cpu) cld(uint8) uint8 {
+	cpu.setFlag(Decimal, false)
+	return 0
+}
+
+func (cpu *Cpu) sed(uint8) uint8 {
+	cpu.setFlag(Decimal, true)
+	return 0
+}
+
+func (cpu *Cpu) tax(uint8) uint8 {
+	return cpu.ldx(cpu.Acc)
+}
+
+func (cpu *Cpu) tay(uint8) uint8 {
+	return cpu.ldy(cpu.Acc)
+}
+
+func (cpu *Cpu) txa(uint8) uint8 {
+	return cpu.lda(cpu.Xidx)
+}
+
+func (cpu *Cpu) tya(uint8) uint8 {
+	return cpu.lda(cpu.Yidx)
+}
+
+func (cpu *Cpu) tsx(uint8) uint8 {
+	return cpu.ldx(cpu.Sptr)
+}
+
+// the only transfer that sets no flags
+func (cpu *Cpu) txs(uint8) uint8 {
+	cpu.Sptr = cpu.Xidx
+	return 0
+}
+
+func (cpu *Cpu) inx(uint8) uint8 {
+	cpu.Xidx = cpu.inc(cpu.Xidx)
+	return 0
+}
+
+func (cpu *Cpu) iny(uint8) uint8 {
+	cpu.Yidx = cpu.inc(cpu.Yidx)
+	return 0
+}
+
+func (cpu *Cpu) dex(uint8) uint8 {
+	cpu.Xidx = cpu.dec(cpu.Xidx)
+	return 0
+}
+
+func (cpu *Cpu) dey(uint8) uint8 {
+	cpu.Yidx = cpu.dec(cpu.Yidx)
+	return 0
+}
+
+// stack instructions, the pushes return the value pushed and the pulls
+// receive the value pulled
+
+func (cpu *Cpu) pha(uint8) uint8 {
+	return cpu.Acc
+}
+
+// the status is pushed with the break flag set
+func (cpu *Cpu) php(uint8) uint8 {
+	return cpu.Psts | Break | Unused
+}
+
+func (cpu *Cpu) pla(val uint8) uint8 {
+	return cpu.lda(val)
+}
+
+func (cpu *Cpu) plp(val uint8) uint8 {
+	cpu.Psts = val&^Break | Unused
+	return 0
+}
+
+// flag tested by the branches, by the two high bits of the opcode
+var branchFlags = [4]uint8{Negative, Overflow, Carry, Zero}
+
+// returns whether the branch being executed is taken, the bit 5 of its
+// opcode is the value of the flag it branches on
+func (cpu *Cpu) branchTaken() bool {
+	return cpu.getFlag(branchFlags[cpu.opcode>>6]) == (cpu.opcode&0x20 != 0)
+}
@@ -1,8 +1,6 @@
 package cpu
 
 import (
-	"fmt"
-	"os"
 	"vsasakiv/nesemulator/apu"
 	"vsasakiv/nesemulator/controller"
 	"vsasakiv/nesemulator/mappers"
@@ -43,24 +41,25 @@ const APU_DMC_SAMPLE_ADDRESS = 0x4012
 const APU_DMC_SAMPLE_LENGTH = 0x4013
 
 const APU_STATUS = 0x4015
+const APU_FRAME_COUNTER = 0x4017
 
 const CONTROLLER1 = 0x4016
+const CONTROLLER2 = 0x4017
 
 type Memory struct {
-	ram             [0x0800]uint8
-	Mapper          mappers.Mapper
-	OamDmaInterrupt bool
-	OamDmaPage      uint8
+	ram    [0x0800]uint8
+	Mapper mappers.Mapper
+	// the last value on the data bus, read back from the unmapped addresses
+	dataBus uint8
+	// the last access of the cpu, to know whether a dma can halt its cycle
+	busAddr  uint16
+	busWrite bool
 }
 
 var joyPad1 *controller.JoyPad
+var joyPad2 *controller.JoyPad
 var MainMemory Memory
 
-// copy of memory, where we have a 1 where the memory was touched in some point, only for debug
-// and dumping purposes
-var modified Memory
-var debug bool = true
-
 func LoadCartridge(mapper mappers.Mapper) {
 	MainMemory.Mapper = mapper
 }
@@ -69,10 +68,38 @@ func ConnectJoyPad1(joyPad *controller.JoyPad) {
 	joyPad1 = joyPad
 }
 
+func ConnectJoyPad2(joyPad *controller.JoyPad) {
+	joyPad2 = joyPad
+}
+
 func MemRead(addr uint16) uint8 {
+	return busRead(addr, AccessRead)
+}
+
+// a read whose value the cpu throws away, seen by the hooks as a dummy read
+func dummyRead(addr uint16) {
+	busRead(addr, AccessDummyRead)
+}
+
+func busRead(addr uint16, access int) uint8 {
+	val := memRead(addr)
+	MainMemory.busAddr = addr
+	// the apu status is read inside the cpu and doesn't reach the data bus
+	if addr != APU_STATUS {
+		MainMemory.dataBus = val
+	}
+	if debugHooks.Len() > 0 {
+		callHooks(access, addr, val)
+	}
+	return val
+}
+
+// the unmapped addresses and the bits no device drives read as the open bus
+func memRead(addr uint16) uint8 {
 	switch {
-	case addr <= 0x07FF:
-		return MainMemory.ram[addr]
+	// the 2KB of ram are mirrored up to $1FFF
+	case addr <= 0x1FFF:
+		return MainMemory.ram[addr%0x0800]
 	// ppu registers mapped to cpu memory
 	case addr >= 0x2000 && addr <= 0x3FFF:
 		addr = ((addr - 0x2000) % 0x0008) + 0x2000
@@ -84,49 +111,54 @@ func MemRead(addr uint16) uint8 {
 		case PPUDATA:
 			return ppu.GetPpu().ReadPpuDataRegister()
 		}
-	// OAMDMA returns placeholder 0x40
-	case addr == OAMDMA:
-		return 0x40
+		return ppu.GetPpu().ReadIoLatch()
+	case addr == APU_STATUS:
+		return apu.GetApu().ReadStatusRegister() | MainMemory.dataBus&0x20
+	// the controllers drive the low 5 bits
 	case addr == CONTROLLER1:
-		return joyPad1.ReceiveRead()
+		return joyPad1.ReceiveRead() | MainMemory.dataBus&0xE0
+	case addr == CONTROLLER2:
+		// no controller plugged on the second port reads as 0
+		if joyPad2 == nil {
+			return MainMemory.dataBus & 0xE0
+		}
+		return joyPad2.ReceiveRead() | MainMemory.dataBus&0xE0
 	case addr >= 0x6000:
-		return MainMemory.Mapper.Read(addr)
+		return mapperRead(addr)
 	}
-	return 0
+	return MainMemory.dataBus
 }
 
-func MemRead16(addr uint16) uint16 {
-	switch {
-	case addr <= 0x07FF:
-		// zero page reading, should wrap
-		var low, high uint16
-		if addr == 0x00FF {
-			low = uint16(MemRead(addr))
-			high = uint16(MemRead(0)) << 8
-		} else {
-			low = uint16(MemRead(addr))
-			high = uint16(MemRead(addr+1)) << 8
-		}
-		return high + low
-	case addr >= 0x6000:
-		low := uint16(MemRead(addr))
-		high := uint16(MemRead(addr+1)) << 8
-		return high + low
+func MemWrite(addr uint16, val uint8) {
+	busWrite(addr, val, AccessWrite)
+}
+
+// a write of the value being modified, seen by the hooks as a dummy write
+func dummyWrite(addr uint16, val uint8) {
+	busWrite(addr, val, AccessDummyWrite)
+}
+
+// the hooks are called once the value is written, as a hook reading the
+// address back sees it
+func busWrite(addr uint16, val uint8, access int) {
+	MainMemory.dataBus = val
+	MainMemory.busAddr = addr
+	MainMemory.busWrite = true
+	memWrite(addr, val)
+	if debugHooks.Len() > 0 {
+		callHooks(access, addr, val)
 	}
-	return 0
 }
 
-func MemWrite(addr uint16, val uint8) {
+func memWrite(addr uint16, val uint8) {
 	switch {
-	// cpu RAM
-	case addr <= 0x07FF:
-		if debug {
-			modified.ram[addr] = 1
-		}
-		MainMemory.ram[addr] = val
+	// cpu RAM and its mirrors
+	case addr <= 0x1FFF:
+		MainMemory.ram[addr%0x0800] = val
 	// ppu registers mapped to cpu memory
 	case addr >= 0x2000 && addr <= 0x3FFF:
 		addr = ((addr - 0x2000) % 0x0008) + 0x2000
+		ppu.GetPpu().WriteIoLatch(val)
 		switch addr {
 		case PPUCTRL:
 			ppu.GetPpu().WriteToPpuControl(val)
@@ -187,66 +219,18 @@ func MemWrite(addr uint16, val uint8) {
 
 	case addr == APU_STATUS:
 		apu.GetApu().WriteToStatusRegister(val)
-	// OAMDMA, using interrupt
+	case addr == APU_FRAME_COUNTER:
+		apu.GetApu().WriteToFrameCounter(val)
 	case addr == OAMDMA:
-		MainMemory.OamDmaInterrupt = true
-		MainMemory.OamDmaPage = val
+		cpu.startOamDma(val)
+	// strobe is shared by both controller ports
 	case addr == CONTROLLER1:
 		joyPad1.ReceiveWrite(val)
+		if joyPad2 != nil {
+			joyPad2.ReceiveWrite(val)
+		}
 	// cartridge
 	case addr >= 0x6000:
 		MainMemory.Mapper.Write(addr, val)
 	}
 }
-
-func MemWrite16(addr uint16, val uint16) {
-	switch {
-	case addr <= 0x07FF:
-		if debug {
-			modified.ram[addr] = 1
-			modified.ram[addr+1] = 1
-		}
-		MemWrite(addr, uint8(val&0xff))
-		MemWrite(addr+1, uint8((val>>8)&0xff))
-	case addr >= 0x6000:
-		fmt.Println("Warning: cant write to ROM")
-		return
-	}
-}
-
-func PoolOamDmaInterrupt() bool {
-	if MainMemory.OamDmaInterrupt {
-		MainMemory.OamDmaInterrupt = false
-		return true
-	}
-	return false
-}
-
-func HexDump(filename string) {
-
-	content := ""
-
-	for i := range 0xffff {
-		if modified.ram[i] == 1 {
-			content += fmt.Sprintf("%4x : %2x\n", i, MemRead(uint16(i)))
-		}
-	}
-
-	file, err := os.Create(filename)
-
-	if err != nil {
-		fmt.Println("Error creating the file", err)
-		return
-	}
-
-	defer file.Close()
-
-	_, err = file.WriteString(content)
-	if err != nil {
-		fmt.Println("Error writing to file", err)
-		return
-	}
-
-	fmt.Println("Successfully dumped memory to ", filename)
-
-}
@@ -0,0 +1,408 @@
+package cpu
+
+// ----- Cycles of the instructions -----
+
+// a cycle of an instruction, every step does at most one bus access, as the
+// real cpu does one read or write per cycle even when it throws the value away
+type step func(cpu *Cpu)
+
+// the sequences of cycles the cpu runs, the instructions start with the
+// fetch of their opcode and continue with its steps
+const (
+	sequenceFetch = iota
+	sequenceInstruction
+	sequenceReset
+	sequenceInterrupt
+)
+
+// step index that ends the sequence, for the instructions that skip cycles
+const sequenceEnd = 0xFF
+
+// steps of each opcode after the fetch, built from its addressing mode and access
+var opcodeSteps [256][]step
+
+func init() {
+	for i := range opcodes {
+		opcodeSteps[i] = buildSteps(&opcodes[i])
+	}
+}
+
+// the reset runs as an interrupt whose pushes are turned into reads
+var resetSteps = []step{
+	(*Cpu).readPc, (*Cpu).readPc,
+	(*Cpu).readStackDown, (*Cpu).readStackDown, (*Cpu).readStackDown,
+	(*Cpu).readVectorLow, (*Cpu).readVectorHigh,
+}
+
+// the nmi and the irq throw away the opcode fetched and push the pc of the
+// instruction that didn't run, which of them is taken is decided as the
+// vector is read
+var interruptSteps = []step{
+	(*Cpu).readPc, (*Cpu).readPc,
+	(*Cpu).pushPcHigh, (*Cpu).pushPcLow, (*Cpu).pushStatus,
+	(*Cpu).readVectorLow, (*Cpu).readVectorHigh,
+}
+
+func buildSteps(op *opcode) []step {
+	switch op.mnemonic {
+	case JAM:
+		return []step{(*Cpu).halt, (*Cpu).jam}
+	case BRK:
+		return []step{
+			(*Cpu).readBreakPadding,
+			(*Cpu).pushPcHigh, (*Cpu).pushPcLow, (*Cpu).pushStatus,
+			(*Cpu).readVectorLow, (*Cpu).readVectorHigh,
+		}
+	case RTI:
+		return []step{(*Cpu).readPc, (*Cpu).readStack, (*Cpu).pullStatus, (*Cpu).pullPcLow, (*Cpu).pullPcHigh}
+	case RTS:
+		return []step{(*Cpu).readPc, (*Cpu).readStack, (*Cpu).pullPcLow, (*Cpu).pullPcHigh, (*Cpu).incrementPc}
+	case JSR:
+		return []step{(*Cpu).readAddrLow, (*Cpu).readStack, (*Cpu).pushPcHigh, (*Cpu).pushPcLow, (*Cpu).jumpAbsolute}
+	case JMP:
+		if op.mode == indirect {
+			return []step{(*Cpu).readAddrLow, (*Cpu).readAddrHigh, (*Cpu).readIndirectLow, (*Cpu).jumpIndirect}
+		}
+		return []step{(*Cpu).readAddrLow, (*Cpu).jumpAbsolute}
+	}
+
+	switch op.access {
+	case accessPush:
+		return []step{(*Cpu).readPc, (*Cpu).push}
+	case accessPull:
+		return []step{(*Cpu).readPc, (*Cpu).readStack, (*Cpu).pull}
+	}
+
+	switch op.mode {
+	case implied:
+		return []step{(*Cpu).implied}
+	case accumulator:
+		return []step{(*Cpu).modifyAccumulator}
+	case immediate:
+		return []step{(*Cpu).readImmediate}
+	case relative:
+		return []step{(*Cpu).readBranch, (*Cpu).takeBranch, (*Cpu).fixBranchPage}
+	case zeroPage:
+		return append([]step{(*Cpu).readAddrLow}, accessSteps(op.access)...)
+	case zeroPageX:
+		return append([]step{(*Cpu).readAddrLow, (*Cpu).indexZeroPageX}, accessSteps(op.access)...)
+	case zeroPageY:
+		return append([]step{(*Cpu).readAddrLow, (*Cpu).indexZeroPageY}, accessSteps(op.access)...)
+	case absolute:
+		return append([]step{(*Cpu).readAddrLow, (*Cpu).readAddrHigh}, accessSteps(op.access)...)
+	case absoluteX:
+		return append([]step{(*Cpu).readAddrLow, (*Cpu).readAddrHighX}, indexedSteps(op.access)...)
+	case absoluteY:
+		return append([]step{(*Cpu).readAddrLow, (*Cpu).readAddrHighY}, indexedSteps(op.access)...)
+	case indirectX:
+		return append([]step{(*Cpu).readPointer, (*Cpu).indexPointer, (*Cpu).readPointerLow, (*Cpu).readPointerHigh},
+			accessSteps(op.access)...)
+	case indirectY:
+		return append([]step{(*Cpu).readPointer, (*Cpu).readPointerLow, (*Cpu).readPointerHighY}, indexedSteps(op.access)...)
+	}
+	return nil
+}
+
+// the cycles accessing the resolved address, the read-modify-write
+// instructions write the value read back before writing the modified one
+func accessSteps(access uint8) []step {
+	switch access {
+	case accessRead:
+		return []step{(*Cpu).readOperand}
+	case accessWrite:
+		return []step{(*Cpu).writeOperand}
+	}
+	return []step{(*Cpu).readModify, (*Cpu).modify, (*Cpu).writeModified}
+}
+
+// the indexed addresses are first read before the carry reaches the high
+// byte, the reads stop there when no page was crossed
+func indexedSteps(access uint8) []step {
+	if access == accessRead {
+		return []step{(*Cpu).readUncorrected, (*Cpu).readOperand}
+	}
+	return append([]step{(*Cpu).readUncorrectedDummy}, accessSteps(access)...)
+}
+
+// ends the sequence after this step
+func (cpu *Cpu) finish() {
+	cpu.step = sequenceEnd
+}
+
+// ----- Fetch and dummy reads -----
+
+func (cpu *Cpu) fetch() {
+	cpu.opcode = MemRead(cpu.Pc)
+	cpu.Pc++
+	cpu.sequence = sequenceInstruction
+	cpu.step = 0
+}
+
+func (cpu *Cpu) readPc() {
+	dummyRead(cpu.Pc)
+}
+
+func (cpu *Cpu) incrementPc() {
+	dummyRead(cpu.Pc)
+	cpu.Pc++
+}
+
+func (cpu *Cpu) readStack() {
+	dummyRead(0x0100 | uint16(cpu.Sptr))
+}
+
+func (cpu *Cpu) readStackDown() {
+	cpu.readStack()
+	cpu.Sptr--
+}
+
+// the opcodes that jam the cpu read the next byte and stop, ignoring the
+// interrupts until the reset
+func (cpu *Cpu) halt() {
+	dummyRead(cpu.Pc)
+	if debugHooks.Len() > 0 {
+		callHooks(AccessJam, cpu.Pc-1, cpu.opcode)
+	}
+}
+
+// stays in this step without accessing the bus
+func (cpu *Cpu) jam() {
+	cpu.step--
+}
+
+// ----- Addressing -----
+
+func (cpu *Cpu) readAddrLow() {
+	cpu.addr = uint16(MemRead(cpu.Pc))
+	cpu.Pc++
+}
+
+func (cpu *Cpu) readAddrHigh() {
+	cpu.addr |= uint16(MemRead(cpu.Pc)) << 8
+	cpu.Pc++
+}
+
+func (cpu *Cpu) readAddrHighX() {
+	cpu.readAddrHigh()
+	cpu.indexAddress(cpu.Xidx)
+}
+
+func (cpu *Cpu) readAddrHighY() {
+	cpu.readAddrHigh()
+	cpu.indexAddress(cpu.Yidx)
+}
+
+func (cpu *Cpu) indexAddress(index uint8) {
+	cpu.base = cpu.addr
+	cpu.addr += uint16(index)
+}
+
+// the zero page address is read while the index is added, wrapping in the page
+func (cpu *Cpu) indexZeroPageX() {
+	dummyRead(cpu.addr)
+	cpu.addr = uint16(uint8(cpu.addr) + cpu.Xidx)
+}
+
+func (cpu *Cpu) indexZeroPageY() {
+	dummyRead(cpu.addr)
+	cpu.addr = uint16(uint8(cpu.addr) + cpu.Yidx)
+}
+
+func (cpu *Cpu) readPointer() {
+	cpu.pointer = MemRead(cpu.Pc)
+	cpu.Pc++
+}
+
+func (cpu *Cpu) indexPointer() {
+	dummyRead(uint16(cpu.pointer))
+	cpu.pointer += cpu.Xidx
+}
+
+func (cpu *Cpu) readPointerLow() {
+	cpu.addr = uint16(MemRead(uint16(cpu.pointer)))
+}
+
+// the pointer wraps in the zero page
+func (cpu *Cpu) readPointerHigh() {
+	cpu.addr |= uint16(MemRead(uint16(cpu.pointer+1))) << 8
+}
+
+func (cpu *Cpu) readPointerHighY() {
+	cpu.readPointerHigh()
+	cpu.indexAddress(cpu.Yidx)
+}
+
+// the indexed address without the carry to the high byte
+func (cpu *Cpu) uncorrectedAddress() uint16 {
+	return cpu.base&0xFF00 | cpu.addr&0x00FF
+}
+
+// the value read is the operand when no page was crossed
+func (cpu *Cpu) readUncorrected() {
+	if cpu.addr != cpu.uncorrectedAddress() {
+		dummyRead(cpu.uncorrectedAddress())
+		return
+	}
+	opcodes[cpu.opcode].execute(cpu, MemRead(cpu.addr))
+	cpu.finish()
+}
+
+func (cpu *Cpu) readUncorrectedDummy() {
+	dummyRead(cpu.uncorrectedAddress())
+}
+
+// ----- Access -----
+
+func (cpu *Cpu) implied() {
+	dummyRead(cpu.Pc)
+	opcodes[cpu.opcode].execute(cpu, 0)
+}
+
+func (cpu *Cpu) modifyAccumulator() {
+	dummyRead(cpu.Pc)
+	cpu.Acc = opcodes[cpu.opcode].execute(cpu, cpu.Acc)
+}
+
+func (cpu *Cpu) readImmediate() {
+	val := MemRead(cpu.Pc)
+	cpu.Pc++
+	opcodes[cpu.opcode].execute(cpu, val)
+}
+
+func (cpu *Cpu) readOperand() {
+	opcodes[cpu.opcode].execute(cpu, MemRead(cpu.addr))
+}
+
+// the unstable stores may change the address as they compute the value
+func (cpu *Cpu) writeOperand() {
+	val := opcodes[cpu.opcode].execute(cpu, 0)
+	MemWrite(cpu.addr, val)
+}
+
+func (cpu *Cpu) readModify() {
+	cpu.value = MemRead(cpu.addr)
+}
+
+// the value read is written back while it is modified
+func (cpu *Cpu) modify() {
+	dummyWrite(cpu.addr, cpu.value)
+	cpu.value = opcodes[cpu.opcode].execute(cpu, cpu.value)
+}
+
+func (cpu *Cpu) writeModified() {
+	MemWrite(cpu.addr, cpu.value)
+}
+
+func (cpu *Cpu) push() {
+	cpu.pushToStack(opcodes[cpu.opcode].execute(cpu, 0))
+}
+
+func (cpu *Cpu) pull() {
+	opcodes[cpu.opcode].execute(cpu, cpu.pullFromStack())
+}
+
+// ----- Jumps and branches -----
+
+func (cpu *Cpu) jumpAbsolute() {
+	cpu.Pc = cpu.addr | uint16(MemRead(cpu.Pc))<<8
+}
+
+func (cpu *Cpu) readIndirectLow() {
+	cpu.value = MemRead(cpu.addr)
+}
+
+// the high byte is read from the start of the page when the pointer is at its end
+func (cpu *Cpu) jumpIndirect() {
+	high := MemRead(cpu.addr&0xFF00 | uint16(uint8(cpu.addr)+1))
+	cpu.Pc = uint16(cpu.value) | uint16(high)<<8
+}
+
+func (cpu *Cpu) readBranch() {
+	offset := MemRead(cpu.Pc)
+	cpu.Pc++
+	if !cpu.branchTaken() {
+		cpu.finish()
+		return
+	}
+	cpu.addr = cpu.Pc + uint16(int8(offset))
+}
+
+// the low byte of the target is added first, one more cycle fixes the high
+// byte when the branch crosses a page
+func (cpu *Cpu) takeBranch() {
+	dummyRead(cpu.Pc)
+	if cpu.addr&0xFF00 == cpu.Pc&0xFF00 {
+		// the nmi or irq that arrives in the second cycle of a taken branch
+		// without page crossing waits for the next instruction
+		cpu.delayInterrupts = true
+		cpu.Pc = cpu.addr
+		cpu.finish()
+		return
+	}
+	cpu.Pc = cpu.Pc&0xFF00 | cpu.addr&0x00FF
+}
+
+func (cpu *Cpu) fixBranchPage() {
+	dummyRead(cpu.Pc)
+	cpu.Pc = cpu.addr
+}
+
+// ----- Stack and interrupts -----
+
+// the byte after the brk opcode is skipped
+func (cpu *Cpu) readBreakPadding() {
+	cpu.incrementPc()
+	cpu.vector = 0xFFFE
+}
+
+func (cpu *Cpu) pushPcHigh() {
+	cpu.pushToStack(uint8(cpu.Pc >> 8))
+}
+
+func (cpu *Cpu) pushPcLow() {
+	cpu.pushToStack(uint8(cpu.Pc))
+}
+
+// the break flag is only set in the status pushed by brk
+func (cpu *Cpu) pushStatus() {
+	status := cpu.Psts&^Break | Unused
+	if cpu.sequence == sequenceInstruction {
+		status |= Break
+	}
+	cpu.pushToStack(status)
+}
+
+func (cpu *Cpu) pullStatus() {
+	cpu.Psts = cpu.pullFromStack()&^Break | Unused
+}
+
+func (cpu *Cpu) pullPcLow() {
+	cpu.addr = uint16(cpu.pullFromStack())
+}
+
+func (cpu *Cpu) pullPcHigh() {
+	cpu.Pc = cpu.addr | uint16(cpu.pullFromStack())<<8
+}
+
+// a pending nmi hijacks brk and irq, which then jump to the nmi handler
+func (cpu *Cpu) readVectorLow() {
+	if cpu.vector == 0xFFFE && cpu.nmiPending {
+		cpu.nmiPending = false
+		cpu.vector = 0xFFFA
+	}
+	cpu.addr = uint16(MemRead(cpu.vector))
+	cpu.setFlag(InterruptDisable, true)
+}
+
+func (cpu *Cpu) readVectorHigh() {
+	cpu.Pc = cpu.addr | uint16(MemRead(cpu.vector+1))<<8
+	if debugHooks.Len() == 0 {
+		return
+	}
+	switch {
+	case cpu.vector == 0xFFFA:
+		callHooks(AccessNmi, cpu.Pc, 0)
+	case cpu.sequence == sequenceInterrupt:
+		callHooks(AccessIrq, cpu.Pc, 0)
+	}
+}
@@ -32,6 +32,8 @@ const AXS = "AXS"
 const SHA = "SHA"
 const TAS = "TAS"
 const LAS = "LAS"
+const ANE = "ANE"
+const JAM = "JAM"
 
 const BRK = "BRK"
 
@@ -82,282 +84,324 @@ const TXS = "TXS"
 
 const NOP = "NOP"
 
-func Generate() []string {
-	opcodeTable := []string{
-		0x61: ADC,
-		0x65: ADC,
-		0x69: ADC,
-		0x6D: ADC,
-		0x71: ADC,
-		0x75: ADC,
-		0x79: ADC,
-		0x7D: ADC,
-
-		0x09: ORA,
-		0x05: ORA,
-		0x15: ORA,
-		0x0D: ORA,
-		0x1D: ORA,
-		0x19: ORA,
-		0x01: ORA,
-		0x11: ORA,
-
-		0x29: AND,
-		0x25: AND,
-		0x35: AND,
-		0x2D: AND,
-		0x3D: AND,
-		0x39: AND,
-		0x21: AND,
-		0x31: AND,
-
-		0x49: EOR,
-		0x45: EOR,
-		0x55: EOR,
-		0x4D: EOR,
-		0x5D: EOR,
-		0x59: EOR,
-		0x41: EOR,
-		0x51: EOR,
-
-		0x85: STA,
-		0x95: STA,
-		0x8D: STA,
-		0x9D: STA,
-		0x99: STA,
-		0x81: STA,
-		0x91: STA,
-
-		0xA9: LDA,
-		0xA5: LDA,
-		0xB5: LDA,
-		0xAD: LDA,
-		0xBD: LDA,
-		0xB9: LDA,
-		0xA1: LDA,
-		0xB1: LDA,
-
-		0xC9: CMP,
-		0xC5: CMP,
-		0xD5: CMP,
-		0xCD: CMP,
-		0xDD: CMP,
-		0xD9: CMP,
-		0xC1: CMP,
-		0xD1: CMP,
-
-		0xE9: SBC,
-		0xEB: SBC,
-		0xE5: SBC,
-		0xF5: SBC,
-		0xED: SBC,
-		0xFD: SBC,
-		0xF9: SBC,
-		0xE1: SBC,
-		0xF1: SBC,
-
-		0x24: BIT,
-		0x2C: BIT,
-
-		0x0A: ASL,
-		0x06: ASL,
-		0x16: ASL,
-		0x0E: ASL,
-		0x1E: ASL,
-
-		0x2A: ROL,
-		0x26: ROL,
-		0x36: ROL,
-		0x2E: ROL,
-		0x3E: ROL,
-
-		0x4A: LSR,
-		0x46: LSR,
-		0x56: LSR,
-		0x4E: LSR,
-		0x5E: LSR,
-
-		0x6A: ROR,
-		0x66: ROR,
-		0x76: ROR,
-		0x6E: ROR,
-		0x7E: ROR,
-
-		0x07: SLO,
-		0x17: SLO,
-		0x0F: SLO,
-		0x1F: SLO,
-		0x03: SLO,
-		0x13: SLO,
-		0x1B: SLO,
-
-		0x27: RLA,
-		0x37: RLA,
-		0x2F: RLA,
-		0x3F: RLA,
-		0x23: RLA,
-		0x33: RLA,
-		0x3B: RLA,
-
-		0x47: SRE,
-		0x57: SRE,
-		0x4F: SRE,
-		0x5F: SRE,
-		0x43: SRE,
-		0x53: SRE,
-		0x5B: SRE,
-
-		0x67: RRA,
-		0x77: RRA,
-		0x6F: RRA,
-		0x7F: RRA,
-		0x63: RRA,
-		0x73: RRA,
-		0x7B: RRA,
-
-		0x87: SAX,
-		0x97: SAX,
-		0x83: SAX,
-		0x8F: SAX,
-
-		0xA7: LAX,
-		0xB7: LAX,
-		0xAF: LAX,
-		0xBF: LAX,
-		0xA3: LAX,
-		0xB3: LAX,
-
-		0xC6: DEC,
-		0xD6: DEC,
-		0xCE: DEC,
-		0xDE: DEC,
-
-		0xC7: DCP,
-		0xD7: DCP,
-		0xCF: DCP,
-		0xDF: DCP,
-		0xDB: DCP,
-		0xC3: DCP,
-		0xD3: DCP,
-
-		0xE7: ISB,
-		0xF7: ISB,
-		0xEF: ISB,
-		0xFF: ISB,
-		0xFB: ISB,
-		0xE3: ISB,
-		0xF3: ISB,
-
-		0x0B: ANC,
-		0x2B: ANC,
-
-		0x4B: ALR,
-		0x6B: ARR,
-		0xAB: LXA,
-		0xCB: AXS,
-		0x9F: SHA,
-		0x93: SHA,
-		0x9B: TAS,
-		0xBB: LAS,
-
-		0xE6: INC,
-		0xF6: INC,
-		0xEE: INC,
-		0xFE: INC,
-
-		0x00: BRK,
-
-		0x08: PHP,
-		0x28: PLP,
-		0x40: RTI,
-		0x48: PHA,
-		0x68: PLA,
-		0x60: RTS,
-
-		0x10: BPL,
-		0x30: BMI,
-		0x20: JSR,
-		0x4C: JMP,
-		0x6C: JMP,
-		0x50: BVC,
-		0x70: BVS,
-		0x90: BCC,
-		0xB0: BCS,
-		0xD0: BNE,
-		0xF0: BEQ,
-
-		0x18: CLC,
-		0x38: SEC,
-		0x58: CLI,
-		0x78: SEI,
-		0xB8: CLV,
-		0xD8: CLD,
-		0xF8: SED,
-
-		0x84: STY,
-		0x94: STY,
-		0x8C: STY,
-		0x88: DEY,
-		0x98: TYA,
-		0xA8: TAY,
-		0x9C: SHY,
-		0xA0: LDY,
-		0xA4: LDY,
-		0xB4: LDY,
-		0xBC: LDY,
-		0xAC: LDY,
-		0xC0: CPY,
-		0xC4: CPY,
-		0xCC: CPY,
-		0xC8: INY,
+// addressing modes of the instructions
+const (
+	implied = iota
+	accumulator
+	immediate
+	zeroPage
+	zeroPageX
+	zeroPageY
+	absolute
+	absoluteX
+	absoluteY
+	indirect
+	indirectX
+	indirectY
+	relative
+)
+
+// size in bytes of the instructions of each addressing mode, with the opcode
+var modeSizes = [...]uint8{
+	implied:     1,
+	accumulator: 1,
+	immediate:   2,
+	zeroPage:    2,
+	zeroPageX:   2,
+	zeroPageY:   2,
+	absolute:    3,
+	absoluteX:   3,
+	absoluteY:   3,
+	indirect:    3,
+	indirectX:   2,
+	indirectY:   2,
+	relative:    2,
+}
 
-		0x86: STX,
-		0x96: STX,
-		0x8E: STX,
-		0xCA: DEX,
-		0x8A: TXA,
-		0xAA: TAX,
-		0x9E: SHX,
-		0xA2: LDX,
-		0xA6: LDX,
-		0xB6: LDX,
-		0xBE: LDX,
-		0xAE: LDX,
-		0xE0: CPX,
-		0xE4: CPX,
-		0xEC: CPX,
-		0xE8: INX,
-		0xBA: TSX,
-		0x9A: TXS,
+// how the instruction accesses the memory at its address
+const (
+	// the handler runs without an operand, as the implied instructions, the
+	// jumps, branches and interrupts have their own cycles and no handler
+	accessNone = iota
+	// the handler receives the value read from the address
+	accessRead
+	// the handler returns the value written to the address
+	accessWrite
+	// read, modify and write, the handler receives the value read and returns
+	// the one written back, in accumulator mode the accumulator is modified
+	accessModify
+	// the handler returns the value pushed to the stack
+	accessPush
+	// the handler receives the value pulled from the stack
+	accessPull
+)
+
+// handler of an instruction, what it receives and returns depends on its access
+type handler func(cpu *Cpu, val uint8) uint8
+
+type opcode struct {
+	mnemonic string
+	mode     uint8
+	access   uint8
+	execute  handler
+}
 
-		0x89: NOP,
-		0x04: NOP,
-		0x0c: NOP,
-		0x14: NOP,
-		0x1C: NOP,
-		0x34: NOP,
-		0x3C: NOP,
-		0x44: NOP,
-		0xEA: NOP,
-		0x54: NOP,
-		0x5C: NOP,
-		0x64: NOP,
-		0x74: NOP,
-		0x7C: NOP,
-		0x80: NOP,
-		0xD4: NOP,
-		0xDC: NOP,
-		0xF4: NOP,
-		0xFC: NOP,
-		0x1A: NOP,
-		0x3A: NOP,
-		0x5A: NOP,
-		0x7A: NOP,
-		0xDA: NOP,
-		0xFA: NOP,
-		0x82: NOP,
-		0xC2: NOP,
-		0xE2: NOP,
-	}
-	return opcodeTable
+// instructions by opcode, their cycles are the steps built from the mode and access
+var opcodes = [256]opcode{
+	0x00: {BRK, implied, accessNone, nil},
+	0x01: {ORA, indirectX, accessRead, (*Cpu).ora},
+	0x02: {JAM, implied, accessNone, nil},
+	0x03: {SLO, indirectX, accessModify, (*Cpu).slo},
+	0x04: {NOP, zeroPage, accessRead, (*Cpu).nop},
+	0x05: {ORA, zeroPage, accessRead, (*Cpu).ora},
+	0x06: {ASL, zeroPage, accessModify, (*Cpu).asl},
+	0x07: {SLO, zeroPage, accessModify, (*Cpu).slo},
+	0x08: {PHP, implied, accessPush, (*Cpu).php},
+	0x09: {ORA, immediate, accessRead, (*Cpu).ora},
+	0x0A: {ASL, accumulator, accessModify, (*Cpu).asl},
+	0x0B: {ANC, immediate, accessRead, (*Cpu).anc},
+	0x0C: {NOP, absolute, accessRead, (*Cpu).nop},
+	0x0D: {ORA, absolute, accessRead, (*Cpu).ora},
+	0x0E: {ASL, absolute, accessModify, (*Cpu).asl},
+	0x0F: {SLO, absolute, accessModify, (*Cpu).slo},
+	0x10: {BPL, relative, accessNone, nil},
+	0x11: {ORA, indirectY, accessRead, (*Cpu).ora},
+	0x12: {JAM, implied, accessNone, nil},
+	0x13: {SLO, indirectY, accessModify, (*Cpu).slo},
+	0x14: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0x15: {ORA, zeroPageX, accessRead, (*Cpu).ora},
+	0x16: {ASL, zeroPageX, accessModify, (*Cpu).asl},
+	0x17: {SLO, zeroPageX, accessModify, (*Cpu).slo},
+	0x18: {CLC, implied, accessNone, (*Cpu).clc},
+	0x19: {ORA, absoluteY, accessRead, (*Cpu).ora},
+	0x1A: {NOP, implied, accessNone, (*Cpu).nop},
+	0x1B: {SLO, absoluteY, accessModify, (*Cpu).slo},
+	0x1C: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0x1D: {ORA, absoluteX, accessRead, (*Cpu).ora},
+	0x1E: {ASL, absoluteX, accessModify, (*Cpu).asl},
+	0x1F: {SLO, absoluteX, accessModify, (*Cpu).slo},
+	0x20: {JSR, absolute, accessNone, nil},
+	0x21: {AND, indirectX, accessRead, (*Cpu).and},
+	0x22: {JAM, implied, accessNone, nil},
+	0x23: {RLA, indirectX, accessModify, (*Cpu).rla},
+	0x24: {BIT, zeroPage, accessRead, (*Cpu).bit},
+	0x25: {AND, zeroPage, accessRead, (*Cpu).and},
+	0x26: {ROL, zeroPage, accessModify, (*Cpu).rol},
+	0x27: {RLA, zeroPage, accessModify, (*Cpu).rla},
+	0x28: {PLP, implied, accessPull, (*Cpu).plp},
+	0x29: {AND, immediate, accessRead, (*Cpu).and},
+	0x2A: {ROL, accumulator, accessModify, (*Cpu).rol},
+	0x2B: {ANC, immediate, accessRead, (*Cpu).anc},
+	0x2C: {BIT, absolute, accessRead, (*Cpu).bit},
+	0x2D: {AND, absolute, accessRead, (*Cpu).and},
+	0x2E: {ROL, absolute, accessModify, (*Cpu).rol},
+	0x2F: {RLA, absolute, accessModify, (*Cpu).rla},
+	0x30: {BMI, relative, accessNone, nil},
+	0x31: {AND, indirectY, accessRead, (*Cpu).and},
+	0x32: {JAM, implied, accessNone, nil},
+	0x33: {RLA, indirectY, accessModify, (*Cpu).rla},
+	0x34: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0x35: {AND, zeroPageX, accessRead, (*Cpu).and},
+	0x36: {ROL, zeroPageX, accessModify, (*Cpu).rol},
+	0x37: {RLA, zeroPageX, accessModify, (*Cpu).rla},
+	0x38: {SEC, implied, accessNone, (*Cpu).sec},
+	0x39: {AND, absoluteY, accessRead, (*Cpu).and},
+	0x3A: {NOP, implied, accessNone, (*Cpu).nop},
+	0x3B: {RLA, absoluteY, accessModify, (*Cpu).rla},
+	0x3C: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0x3D: {AND, absoluteX, accessRead, (*Cpu).and},
+	0x3E: {ROL, absoluteX, accessModify, (*Cpu).rol},
+	0x3F: {RLA, absoluteX, accessModify, (*Cpu).rla},
+	0x40: {RTI, implied, accessNone, nil},
+	0x41: {EOR, indirectX, accessRead, (*Cpu).eor},
+	0x42: {JAM, implied, accessNone, nil},
+	0x43: {SRE, indirectX, accessModify, (*Cpu).sre},
+	0x44: {NOP, zeroPage, accessRead, (*Cpu).nop},
+	0x45: {EOR, zeroPage, accessRead, (*Cpu).eor},
+	0x46: {LSR, zeroPage, accessModify, (*Cpu).lsr},
+	0x47: {SRE, zeroPage, accessModify, (*Cpu).sre},
+	0x48: {PHA, implied, accessPush, (*Cpu).pha},
+	0x49: {EOR, immediate, accessRead, (*Cpu).eor},
+	0x4A: {LSR, accumulator, accessModify, (*Cpu).lsr},
+	0x4B: {ALR, immediate, accessRead, (*Cpu).alr},
+	0x4C: {JMP, absolute, accessNone, nil},
+	0x4D: {EOR, absolute, accessRead, (*Cpu).eor},
+	0x4E: {LSR, absolute, accessModify, (*Cpu).lsr},
+	0x4F: {SRE, absolute, accessModify, (*Cpu).sre},
+	0x50: {BVC, relative, accessNone, nil},
+	0x51: {EOR, indirectY, accessRead, (*Cpu).eor},
+	0x52: {JAM, implied, accessNone, nil},
+	0x53: {SRE, indirectY, accessModify, (*Cpu).sre},
+	0x54: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0x55: {EOR, zeroPageX, accessRead, (*Cpu).eor},
+	0x56: {LSR, zeroPageX, accessModify, (*Cpu).lsr},
+	0x57: {SRE, zeroPageX, accessModify, (*Cpu).sre},
+	0x58: {CLI, implied, accessNone, (*Cpu).cli},
+	0x59: {EOR, absoluteY, accessRead, (*Cpu).eor},
+	0x5A: {NOP, implied, accessNone, (*Cpu).nop},
+	0x5B: {SRE, absoluteY, accessModify, (*Cpu).sre},
+	0x5C: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0x5D: {EOR, absoluteX, accessRead, (*Cpu).eor},
+	0x5E: {LSR, absoluteX, accessModify, (*Cpu).lsr},
+	0x5F: {SRE, absoluteX, accessModify, (*Cpu).sre},
+	0x60: {RTS, implied, accessNone, nil},
+	0x61: {ADC, indirectX, accessRead, (*Cpu).adc},
+	0x62: {JAM, implied, accessNone, nil},
+	0x63: {RRA, indirectX, accessModify, (*Cpu).rra},
+	0x64: {NOP, zeroPage, accessRead, (*Cpu).nop},
+	0x65: {ADC, zeroPage, accessRead, (*Cpu).adc},
+	0x66: {ROR, zeroPage, accessModify, (*Cpu).ror},
+	0x67: {RRA, zeroPage, accessModify, (*Cpu).rra},
+	0x68: {PLA, implied, accessPull, (*Cpu).pla},
+	0x69: {ADC, immediate, accessRead, (*Cpu).adc},
+	0x6A: {ROR, accumulator, accessModify, (*Cpu).ror},
+	0x6B: {ARR, immediate, accessRead, (*Cpu).arr},
+	0x6C: {JMP, indirect, accessNone, nil},
+	0x6D: {ADC, absolute, accessRead, (*Cpu).adc},
+	0x6E: {ROR, absolute, accessModify, (*Cpu).ror},
+	0x6F: {RRA, absolute, accessModify, (*Cpu).rra},
+	0x70: {BVS, relative, accessNone, nil},
+	0x71: {ADC, indirectY, accessRead, (*Cpu).adc},
+	0x72: {JAM, implied, accessNone, nil},
+	0x73: {RRA, indirectY, accessModify, (*Cpu).rra},
+	0x74: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0x75: {ADC, zeroPageX, accessRead, (*Cpu).adc},
+	0x76: {ROR, zeroPageX, accessModify, (*Cpu).ror},
+	0x77: {RRA, zeroPageX, accessModify, (*Cpu).rra},
+	0x78: {SEI, implied, accessNone, (*Cpu).sei},
+	0x79: {ADC, absoluteY, accessRead, (*Cpu).adc},
+	0x7A: {NOP, implied, accessNone, (*Cpu).nop},
+	0x7B: {RRA, absoluteY, accessModify, (*Cpu).rra},
+	0x7C: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0x7D: {ADC, absoluteX, accessRead, (*Cpu).adc},
+	0x7E: {ROR, absoluteX, accessModify, (*Cpu).ror},
+	0x7F: {RRA, absoluteX, accessModify, (*Cpu).rra},
+	0x80: {NOP, immediate, accessRead, (*Cpu).nop},
+	0x81: {STA, indirectX, accessWrite, (*Cpu).sta},
+	0x82: {NOP, immediate, accessRead, (*Cpu).nop},
+	0x83: {SAX, indirectX, accessWrite, (*Cpu).sax},
+	0x84: {STY, zeroPage, accessWrite, (*Cpu).sty},
+	0x85: {STA, zeroPage, accessWrite, (*Cpu).sta},
+	0x86: {STX, zeroPage, accessWrite, (*Cpu).stx},
+	0x87: {SAX, zeroPage, accessWrite, (*Cpu).sax},
+	0x88: {DEY, implied, accessNone, (*Cpu).dey},
+	0x89: {NOP, immediate, accessRead, (*Cpu).nop},
+	0x8A: {TXA, implied, accessNone, (*Cpu).txa},
+	0x8B: {ANE, immediate, accessRead, (*Cpu).ane},
+	0x8C: {STY, absolute, accessWrite, (*Cpu).sty},
+	0x8D: {STA, absolute, accessWrite, (*Cpu).sta},
+	0x8E: {STX, absolute, accessWrite, (*Cpu).stx},
+	0x8F: {SAX, absolute, accessWrite, (*Cpu).sax},
+	0x90: {BCC, relative, accessNone, nil},
+	0x91: {STA, indirectY, accessWrite, (*Cpu).sta},
+	0x92: {JAM, implied, accessNone, nil},
+	0x93: {SHA, indirectY, accessWrite, (*Cpu).sha},
+	0x94: {STY, zeroPageX, accessWrite, (*Cpu).sty},
+	0x95: {STA, zeroPageX, accessWrite, (*Cpu).sta},
+	0x96: {STX, zeroPageY, accessWrite, (*Cpu).stx},
+	0x97: {SAX, zeroPageY, accessWrite, (*Cpu).sax},
+	0x98: {TYA, implied, accessNone, (*Cpu).tya},
+	0x99: {STA, absoluteY, accessWrite, (*Cpu).sta},
+	0x9A: {TXS, implied, accessNone, (*Cpu).txs},
+	0x9B: {TAS, absoluteY, accessWrite, (*Cpu).tas},
+	0x9C: {SHY, absoluteX, accessWrite, (*Cpu).shy},
+	0x9D: {STA, absoluteX, accessWrite, (*Cpu).sta},
+	0x9E: {SHX, absoluteY, accessWrite, (*Cpu).shx},
+	0x9F: {SHA, absoluteY, accessWrite, (*Cpu).sha},
+	0xA0: {LDY, immediate, accessRead, (*Cpu).ldy},
+	0xA1: {LDA, indirectX, accessRead, (*Cpu).lda},
+	0xA2: {LDX, immediate, accessRead, (*Cpu).ldx},
+	0xA3: {LAX, indirectX, accessRead, (*Cpu).lax},
+	0xA4: {LDY, zeroPage, accessRead, (*Cpu).ldy},
+	0xA5: {LDA, zeroPage, accessRead, (*Cpu).lda},
+	0xA6: {LDX, zeroPage, accessRead, (*Cpu).ldx},
+	0xA7: {LAX, zeroPage, accessRead, (*Cpu).lax},
+	0xA8: {TAY, implied, accessNone, (*Cpu).tay},
+	0xA9: {LDA, immediate, accessRead, (*Cpu).lda},
+	0xAA: {TAX, implied, accessNone, (*Cpu).tax},
+	0xAB: {LXA, immediate, accessRead, (*Cpu).lxa},
+	0xAC: {LDY, absolute, accessRead, (*Cpu).ldy},
+	0xAD: {LDA, absolute, accessRead, (*Cpu).lda},
+	0xAE: {LDX, absolute, accessRead, (*Cpu).ldx},
+	0xAF: {LAX, absolute, accessRead, (*Cpu).lax},
+	0xB0: {BCS, relative, accessNone, nil},
+	0xB1: {LDA, indirectY, accessRead, (*Cpu).lda},
+	0xB2: {JAM, implied, accessNone, nil},
+	0xB3: {LAX, indirectY, accessRead, (*Cpu).lax},
+	0xB4: {LDY, zeroPageX, accessRead, (*Cpu).ldy},
+	0xB5: {LDA, zeroPageX, accessRead, (*Cpu).lda},
+	0xB6: {LDX, zeroPageY, accessRead, (*Cpu).ldx},
+	0xB7: {LAX, zeroPageY, accessRead, (*Cpu).lax},
+	0xB8: {CLV, implied, accessNone, (*Cpu).clv},
+	0xB9: {LDA, absoluteY, accessRead, (*Cpu).lda},
+	0xBA: {TSX, implied, accessNone, (*Cpu).tsx},
+	0xBB: {LAS, absoluteY, accessRead, (*Cpu).las},
+	0xBC: {LDY, absoluteX, accessRead, (*Cpu).ldy},
+	0xBD: {LDA, absoluteX, accessRead, (*Cpu).lda},
+	0xBE: {LDX, absoluteY, accessRead, (*Cpu).ldx},
+	0xBF: {LAX, absoluteY, accessRead, (*Cpu).lax},
+	0xC0: {CPY, immediate, accessRead, (*Cpu).cpy},
+	0xC1: {CMP, indirectX, accessRead, (*Cpu).cmp},
+	0xC2: {NOP, immediate, accessRead, (*Cpu).nop},
+	0xC3: {DCP, indirectX, accessModify, (*Cpu).dcp},
+	0xC4: {CPY, zeroPage, accessRead, (*Cpu).cpy},
+	0xC5: {CMP, zeroPage, accessRead, (*Cpu).cmp},
+	0xC6: {DEC, zeroPage, accessModify, (*Cpu).dec},
+	0xC7: {DCP, zeroPage, accessModify, (*Cpu).dcp},
+	0xC8: {INY, implied, accessNone, (*Cpu).iny},
+	0xC9: {CMP, immediate, accessRead, (*Cpu).cmp},
+	0xCA: {DEX, implied, accessNone, (*Cpu).dex},
+	0xCB: {AXS, immediate, accessRead, (*Cpu).axs},
+	0xCC: {CPY, absolute, accessRead, (*Cpu).cpy},
+	0xCD: {CMP, absolute, accessRead, (*Cpu).cmp},
+	0xCE: {DEC, absolute, accessModify, (*Cpu).dec},
+	0xCF: {DCP, absolute, accessModify, (*Cpu).dcp},
+	0xD0: {BNE, relative, accessNone, nil},
+	0xD1: {CMP, indirectY, accessRead, (*Cpu).cmp},
+	0xD2: {JAM, implied, accessNone, nil},
+	0xD3: {DCP, indirectY, accessModify, (*Cpu).dcp},
+	0xD4: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0xD5: {CMP, zeroPageX, accessRead, (*Cpu).cmp},
+	0xD6: {DEC, zeroPageX, accessModify, (*Cpu).dec},
+	0xD7: {DCP, zeroPageX, accessModify, (*Cpu).dcp},
+	0xD8: {CLD, implied, accessNone, (*Cpu).cld},
+	0xD9: {CMP, absoluteY, accessRead, (*Cpu).cmp},
+	0xDA: {NOP, implied, accessNone, (*Cpu).nop},
+	0xDB: {DCP, absoluteY, accessModify, (*Cpu).dcp},
+	0xDC: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0xDD: {CMP, absoluteX, accessRead, (*Cpu).cmp},
+	0xDE: {DEC, absoluteX, accessModify, (*Cpu).dec},
+	0xDF: {DCP, absoluteX, accessModify, (*Cpu).dcp},
+	0xE0: {CPX, immediate, accessRead, (*Cpu).cpx},
+	0xE1: {SBC, indirectX, accessRead, (*Cpu).sbc},
+	0xE2: {NOP, immediate, accessRead, (*Cpu).nop},
+	0xE3: {ISB, indirectX, accessModify, (*Cpu).isb},
+	0xE4: {CPX, zeroPage, accessRead, (*Cpu).cpx},
+	0xE5: {SBC, zeroPage, accessRead, (*Cpu).sbc},
+	0xE6: {INC, zeroPage, accessModify, (*Cpu).inc},
+	0xE7: {ISB, zeroPage, accessModify, (*Cpu).isb},
+	0xE8: {INX, implied, accessNone, (*Cpu).inx},
+	0xE9: {SBC, immediate, accessRead, (*Cpu).sbc},
+	0xEA: {NOP, implied, accessNone, (*Cpu).nop},
+	0xEB: {SBC, immediate, accessRead, (*Cpu).sbc},
+	0xEC: {CPX, absolute, accessRead, (*Cpu).cpx},
+	0xED: {SBC, absolute, accessRead, (*Cpu).sbc},
+	0xEE: {INC, absolute, accessModify, (*Cpu).inc},
+	0xEF: {ISB, absolute, accessModify, (*Cpu).isb},
+	0xF0: {BEQ, relative, accessNone, nil},
+	0xF1: {SBC, indirectY, accessRead, (*Cpu).sbc},
+	0xF2: {JAM, implied, accessNone, nil},
+	0xF3: {ISB, indirectY, accessModify, (*Cpu).isb},
+	0xF4: {NOP, zeroPageX, accessRead, (*Cpu).nop},
+	0xF5: {SBC, zeroPageX, accessRead, (*Cpu).sbc},
+	0xF6: {INC, zeroPageX, accessModify, (*Cpu).inc},
+	0xF7: {ISB, zeroPageX, accessModify, (*Cpu).isb},
+	0xF8: {SED, implied, accessNone, (*Cpu).sed},
+	0xF9: {SBC, absoluteY, accessRead, (*Cpu).sbc},
+	0xFA: {NOP, implied, accessNone, (*Cpu).nop},
+	0xFB: {ISB, absoluteY, accessModify, (*Cpu).isb},
+	0xFC: {NOP, absoluteX, accessRead, (*Cpu).nop},
+	0xFD: {SBC, absoluteX, accessRead, (*Cpu).sbc},
+	0xFE: {INC, absoluteX, accessModify, (*Cpu).inc},
+	0xFF: {ISB, absoluteX, accessModify, (*Cpu).isb},
 }
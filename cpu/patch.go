@@ -0,0 +1,40 @@
+package cpu
+
+// ----- Rom patches -----
+
+// RomPatch replaces a byte the cpu reads from the rom, as a Game Genie
+// between the console and the cartridge does, when it has a compare value
+// the byte is only replaced while the rom has that value, so the patch does
+// not hit the other banks switched in at the address
+type RomPatch struct {
+	Address    uint16
+	Value      uint8
+	Compare    uint8
+	HasCompare bool
+}
+
+// patches by address, nil when there are none so the reads stay fast
+var romPatches map[uint16]RomPatch
+
+// SetRomPatches replaces the patches of the rom, nil removes all of them
+func SetRomPatches(patches []RomPatch) {
+	if len(patches) == 0 {
+		romPatches = nil
+		return
+	}
+	romPatches = make(map[uint16]RomPatch, len(patches))
+	for _, patch := range patches {
+		romPatches[patch.Address] = patch
+	}
+}
+
+// reads the cartridge through the patches of the rom
+func mapperRead(addr uint16) uint8 {
+	val := MainMemory.Mapper.Read(addr)
+	if romPatches != nil && addr >= 0x8000 {
+		if patch, ok := romPatches[addr]; ok && (!patch.HasCompare || patch.Compare == val) {
+			return patch.Value
+		}
+	}
+	return val
+}
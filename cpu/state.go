@@ -0,0 +1,49 @@
+package cpu
+
+import "vsasakiv/nesemulator/savestate"
+
+// saves or loads the cpu registers, its internal state and the cpu ram
+func Serialize(stream *savestate.Stream) {
+	stream.Uint16(&cpu.Pc)
+	stream.Uint8(&cpu.Acc)
+	stream.Uint8(&cpu.Xidx)
+	stream.Uint8(&cpu.Yidx)
+	stream.Uint8(&cpu.Sptr)
+	stream.Uint8(&cpu.Psts)
+	stream.Uint(&cpu.cycles)
+	stream.Uint(&cpu.clockCounter)
+	stream.Uint8(&cpu.sequence)
+	stream.Uint(&cpu.step)
+	stream.Uint8(&cpu.opcode)
+	stream.Uint16(&cpu.addr)
+	stream.Uint16(&cpu.base)
+	stream.Uint8(&cpu.pointer)
+	stream.Uint8(&cpu.value)
+	stream.Uint16(&cpu.vector)
+	stream.Bool(&cpu.nmiLine)
+	stream.Bool(&cpu.nmiPending)
+	stream.Bool(&cpu.irqPending)
+	stream.Bool(&cpu.nmiSignal)
+	stream.Bool(&cpu.irqSignal)
+	stream.Bool(&cpu.delayInterrupts)
+	stream.Bool(&cpu.dmaHalt)
+	stream.Bool(&cpu.dmaHalted)
+	stream.Uint16(&cpu.dmaAddr)
+	stream.Bool(&cpu.dmcDma)
+	stream.Bool(&cpu.dmcDummy)
+	stream.Bool(&cpu.oamDma)
+	stream.Uint8(&cpu.oamPage)
+	stream.Uint16(&cpu.oamCount)
+	stream.Uint8(&cpu.oamValue)
+
+	stream.Bytes(MainMemory.ram[:])
+	stream.Uint8(&MainMemory.dataBus)
+}
+
+// puts the cpu and its ram in the same state as when the console is turned on,
+// the loaded cartridge is kept
+func PowerOn() {
+	cpu = *NewCpu()
+	MainMemory.ram = [0x0800]uint8{}
+	MainMemory.dataBus = 0
+}
@@ -0,0 +1,88 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kinds of access a breakpoint stops on
+const (
+	BreakRead = 1 << iota
+	BreakWrite
+	BreakExecute
+)
+
+// address spaces of the breakpoints
+const (
+	SpaceCpu = "CPU"
+	// ppu memory, as accessed by the cpu through PPUDATA
+	SpacePpu = "PPU"
+)
+
+type Breakpoint struct {
+	Id      int
+	Kind    int
+	Space   string
+	Start   uint16
+	End     uint16
+	Enabled bool
+	// nil when the breakpoint always stops
+	Condition *Condition
+}
+
+func (breakpoint *Breakpoint) matches(space string, kind int, access access) bool {
+	if !breakpoint.Enabled || breakpoint.Space != space || breakpoint.Kind&kind == 0 {
+		return false
+	}
+	if access.addr < breakpoint.Start || access.addr > breakpoint.End {
+		return false
+	}
+	return breakpoint.Condition == nil || breakpoint.Condition.evaluate(access)
+}
+
+func (breakpoint *Breakpoint) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "#%d %s ", breakpoint.Id, breakpoint.Space)
+	kinds := []struct {
+		kind   int
+		symbol string
+	}{{BreakRead, "R"}, {BreakWrite, "W"}, {BreakExecute, "X"}}
+	for _, kind := range kinds {
+		if breakpoint.Kind&kind.kind != 0 {
+			builder.WriteString(kind.symbol)
+		} else {
+			builder.WriteString("-")
+		}
+	}
+	fmt.Fprintf(&builder, " $%04X", breakpoint.Start)
+	if breakpoint.End != breakpoint.Start {
+		fmt.Fprintf(&builder, "-$%04X", breakpoint.End)
+	}
+	if breakpoint.Condition != nil {
+		fmt.Fprintf(&builder, " if %s", breakpoint.Condition)
+	}
+	if !breakpoint.Enabled {
+		builder.WriteString(" (disabled)")
+	}
+	return builder.String()
+}
+
+// parses an address or a range of addresses, as in C000 or $0300-$03FF
+func parseRange(text string) (uint16, uint16, error) {
+	startText, endText, isRange := strings.Cut(text, "-")
+	start, err := parseAddress(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return start, start, nil
+	}
+	end, err := parseAddress(endText)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("range %q ends before it starts", text)
+	}
+	return start, end, nil
+}
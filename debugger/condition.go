@@ -0,0 +1,171 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// Conditions compare registers, memory and the accessed value, as in
+//
+//	A==#$10 && X!=#0 || $0300>=#$80
+//
+// && binds tighter than ||. Operands are the registers A, X, Y, P, SP and PC,
+// "value" and "addr" of the access that hit the breakpoint, numbers written
+// as #$10 (hex) or #16 (decimal), and $0300, the byte at a cpu address
+
+// values of the access being checked, used by the value and addr operands
+type access struct {
+	addr uint16
+	val  uint8
+}
+
+type operand func(access access) int
+
+type comparison struct {
+	left, right operand
+	compare     func(left int, right int) bool
+}
+
+// Condition is a parsed condition, a list of alternatives (||) of comparisons (&&)
+type Condition struct {
+	source       string
+	alternatives [][]comparison
+}
+
+var comparators = []struct {
+	symbol  string
+	compare func(left int, right int) bool
+}{
+	// two character operators first, so <= is not read as <
+	{"==", func(left, right int) bool { return left == right }},
+	{"!=", func(left, right int) bool { return left != right }},
+	{"<=", func(left, right int) bool { return left <= right }},
+	{">=", func(left, right int) bool { return left >= right }},
+	{"<", func(left, right int) bool { return left < right }},
+	{">", func(left, right int) bool { return left > right }},
+}
+
+func ParseCondition(source string) (*Condition, error) {
+	condition := &Condition{source: strings.TrimSpace(source)}
+	for _, alternative := range strings.Split(source, "||") {
+		var comparisons []comparison
+		for _, term := range strings.Split(alternative, "&&") {
+			comparison, err := parseComparison(strings.TrimSpace(term))
+			if err != nil {
+				return nil, err
+			}
+			comparisons = append(comparisons, comparison)
+		}
+		condition.alternatives = append(condition.alternatives, comparisons)
+	}
+	return condition, nil
+}
+
+func parseComparison(term string) (comparison, error) {
+	for _, comparator := range comparators {
+		left, right, found := strings.Cut(term, comparator.symbol)
+		if !found {
+			continue
+		}
+		leftOperand, err := parseOperand(strings.TrimSpace(left))
+		if err != nil {
+			return comparison{}, err
+		}
+		rightOperand, err := parseOperand(strings.TrimSpace(right))
+		if err != nil {
+			return comparison{}, err
+		}
+		return comparison{left: leftOperand, right: rightOperand, compare: comparator.compare}, nil
+	}
+	return comparison{}, fmt.Errorf("condition %q has no comparison", term)
+}
+
+func parseOperand(text string) (operand, error) {
+	registers := cpu.GetCpu()
+	switch strings.ToUpper(text) {
+	case "A":
+		return func(access) int { return int(registers.Acc) }, nil
+	case "X":
+		return func(access) int { return int(registers.Xidx) }, nil
+	case "Y":
+		return func(access) int { return int(registers.Yidx) }, nil
+	case "P":
+		return func(access) int { return int(registers.Psts) }, nil
+	case "SP", "S":
+		return func(access) int { return int(registers.Sptr) }, nil
+	case "PC":
+		return func(access) int { return int(registers.Pc) }, nil
+	case "VALUE":
+		return func(access access) int { return int(access.val) }, nil
+	case "ADDR":
+		return func(access access) int { return int(access.addr) }, nil
+	}
+
+	switch {
+	case strings.HasPrefix(text, "#"):
+		number, err := parseNumber(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		return func(access) int { return number }, nil
+	case strings.HasPrefix(text, "$"):
+		address, err := parseAddress(text)
+		if err != nil {
+			return nil, err
+		}
+		return func(access) int { return int(cpu.PeekMemory(address)) }, nil
+	}
+	return nil, fmt.Errorf("invalid operand %q", text)
+}
+
+// parses $hex, 0xhex or decimal numbers
+func parseNumber(text string) (int, error) {
+	var number int64
+	var err error
+	switch {
+	case strings.HasPrefix(text, "$"):
+		number, err = strconv.ParseInt(text[1:], 16, 32)
+	case strings.HasPrefix(text, "0x"):
+		number, err = strconv.ParseInt(text[2:], 16, 32)
+	default:
+		number, err = strconv.ParseInt(text, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return int(number), nil
+}
+
+// parses an address, a number that fits in 16 bits, hex by default
+func parseAddress(text string) (uint16, error) {
+	if !strings.HasPrefix(text, "$") && !strings.HasPrefix(text, "0x") {
+		text = "$" + text
+	}
+	number, err := parseNumber(text)
+	if err != nil || number < 0 || number > 0xFFFF {
+		return 0, fmt.Errorf("invalid address %q", text)
+	}
+	return uint16(number), nil
+}
+
+func (condition *Condition) evaluate(access access) bool {
+	for _, alternative := range condition.alternatives {
+		matches := true
+		for _, comparison := range alternative {
+			if !comparison.compare(comparison.left(access), comparison.right(access)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (condition *Condition) String() string {
+	return condition.source
+}
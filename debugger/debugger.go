@@ -0,0 +1,291 @@
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/disasm"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// how the emulation runs until the next break
+const (
+	modeRun = iota
+	// breaks before the next instruction
+	modeStepInto
+	// as step into, for a pause requested by the user
+	modePause
+	// breaks when the subroutine called by the current instruction returns
+	modeStepOver
+	// breaks when the current subroutine returns
+	modeStepOut
+	// breaks on the first instruction of the next nmi handler
+	modeRunToNmi
+)
+
+// reasons of the breaks that are not breakpoints
+const (
+	ReasonStep  = "Step"
+	ReasonPause = "Pause"
+)
+
+// opcodes the stepping commands look for
+const (
+	opcodeBrk = 0x00
+	opcodeJsr = 0x20
+	opcodeRti = 0x40
+	opcodeRts = 0x60
+)
+
+// Break tells why the emulation stopped
+type Break struct {
+	Reason string
+	// the breakpoint hit, nil for the steps and pauses
+	Breakpoint *Breakpoint
+	// the access that hit a watchpoint, BreakExecute for the breakpoints
+	Kind int
+	Addr uint16
+}
+
+// Debugger stops the emulation on breakpoints and steps through the
+// instructions, it is attached to the hooks of the cpu and ppu and must be
+// driven from the goroutine that runs the emulation
+type Debugger struct {
+	breakpoints []*Breakpoint
+	nextId      int
+
+	BreakOnBrk     bool
+	BreakOnIllegal bool
+
+	paused bool
+	mode   int
+	// stack pointer and return address the step over and step out wait for
+	stepSp     uint8
+	stepReturn uint16
+	// the last instruction executed, the step out breaks after a return
+	lastOpcode uint8
+	// address of the instruction being executed, reported on watchpoints
+	instructionPc uint16
+	lastBreak     Break
+
+	// receives the break messages
+	output io.Writer
+	// removes the hooks, nil when the debugger is not attached
+	detach func()
+}
+
+func New(output io.Writer) *Debugger {
+	return &Debugger{nextId: 1, output: output}
+}
+
+// attaches the debugger to the cpu and ppu hooks
+func (debugger *Debugger) Attach() {
+	if debugger.detach != nil {
+		return
+	}
+	removeCpuHook := cpu.AddHook(debugger.cpuAccess)
+	removePpuHook := ppu.AddHook(debugger.ppuAccess)
+	debugger.detach = func() {
+		removeCpuHook()
+		removePpuHook()
+	}
+}
+
+func (debugger *Debugger) Detach() {
+	if debugger.detach != nil {
+		debugger.detach()
+		debugger.detach = nil
+	}
+}
+
+// returns whether the emulation is stopped, the frontend must not run frames while it is
+func (debugger *Debugger) Paused() bool {
+	return debugger.paused
+}
+
+// returns why the emulation stopped the last time
+func (debugger *Debugger) LastBreak() Break {
+	return debugger.lastBreak
+}
+
+// ----- Breakpoints -----
+
+func (debugger *Debugger) AddBreakpoint(breakpoint Breakpoint) *Breakpoint {
+	breakpoint.Id = debugger.nextId
+	breakpoint.Enabled = true
+	debugger.nextId++
+	debugger.breakpoints = append(debugger.breakpoints, &breakpoint)
+	return &breakpoint
+}
+
+func (debugger *Debugger) RemoveBreakpoint(id int) bool {
+	for i, breakpoint := range debugger.breakpoints {
+		if breakpoint.Id == id {
+			debugger.breakpoints = append(debugger.breakpoints[:i], debugger.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (debugger *Debugger) Breakpoint(id int) *Breakpoint {
+	for _, breakpoint := range debugger.breakpoints {
+		if breakpoint.Id == id {
+			return breakpoint
+		}
+	}
+	return nil
+}
+
+func (debugger *Debugger) Breakpoints() []*Breakpoint {
+	return debugger.breakpoints
+}
+
+// ----- Execution control -----
+
+// stops the emulation before the next instruction
+func (debugger *Debugger) Pause() {
+	debugger.run(modePause)
+}
+
+func (debugger *Debugger) Continue() {
+	debugger.run(modeRun)
+}
+
+func (debugger *Debugger) StepInto() {
+	debugger.run(modeStepInto)
+}
+
+// runs the current instruction, subroutine calls run until they return
+func (debugger *Debugger) StepOver() {
+	registers := cpu.GetCpu()
+	if cpu.PeekMemory(registers.Pc) != opcodeJsr {
+		debugger.run(modeStepInto)
+		return
+	}
+	debugger.stepSp = registers.Sptr
+	debugger.stepReturn = registers.Pc + 3
+	debugger.run(modeStepOver)
+}
+
+// runs until the current subroutine, or interrupt handler, returns
+func (debugger *Debugger) StepOut() {
+	debugger.stepSp = cpu.GetCpu().Sptr
+	debugger.run(modeStepOut)
+}
+
+func (debugger *Debugger) RunToNmi() {
+	debugger.run(modeRunToNmi)
+}
+
+func (debugger *Debugger) run(mode int) {
+	debugger.mode = mode
+	debugger.paused = false
+}
+
+// stops the emulation, in the middle of the frame if it is running
+func (debugger *Debugger) breakWith(reason string) {
+	debugger.paused = true
+	debugger.mode = modeRun
+	debugger.lastBreak = Break{Reason: reason}
+	console.Stop()
+	fmt.Fprintf(debugger.output, "\n%s\n%s\n", reason, Status())
+}
+
+// ----- Hooks -----
+
+func (debugger *Debugger) cpuAccess(kind int, addr uint16, val uint8) {
+	if debugger.paused {
+		return
+	}
+	registers := cpu.GetCpu()
+
+	switch kind {
+	case cpu.AccessExecute:
+		debugger.instructionPc = addr
+		returned := debugger.lastOpcode == opcodeRts || debugger.lastOpcode == opcodeRti
+		debugger.lastOpcode = val
+		switch {
+		case debugger.mode == modeStepInto:
+			debugger.breakWith(ReasonStep)
+			return
+		case debugger.mode == modePause:
+			debugger.breakWith(ReasonPause)
+			return
+		case debugger.mode == modeStepOver && addr == debugger.stepReturn && registers.Sptr >= debugger.stepSp:
+			debugger.breakWith("Step over")
+			return
+		case debugger.mode == modeStepOut && returned && registers.Sptr > debugger.stepSp:
+			debugger.breakWith("Step out")
+			return
+		case debugger.BreakOnBrk && val == opcodeBrk:
+			debugger.breakWith("Break on BRK")
+			return
+		case debugger.BreakOnIllegal && cpu.IsIllegalOpcode(val):
+			debugger.breakWith(fmt.Sprintf("Break on illegal opcode $%02X", val))
+			return
+		}
+		debugger.checkBreakpoints(SpaceCpu, BreakExecute, access{addr: addr, val: val})
+	case cpu.AccessRead:
+		debugger.checkBreakpoints(SpaceCpu, BreakRead, access{addr: addr, val: val})
+	case cpu.AccessWrite:
+		debugger.checkBreakpoints(SpaceCpu, BreakWrite, access{addr: addr, val: val})
+	case cpu.AccessJam:
+		debugger.breakWith(fmt.Sprintf("CPU halted by the jam opcode $%02X at $%04X", val, addr))
+	case cpu.AccessNmi:
+		if debugger.mode == modeRunToNmi {
+			// the handler is entered on the next instruction
+			debugger.mode = modeStepInto
+		}
+	}
+}
+
+func (debugger *Debugger) ppuAccess(kind int, addr uint16, val uint8) {
+	// the watchpoints only see the accesses of the cpu
+	if debugger.paused || kind == ppu.AccessRender {
+		return
+	}
+	breakKind := BreakRead
+	if kind == ppu.AccessWrite {
+		breakKind = BreakWrite
+	}
+	debugger.checkBreakpoints(SpacePpu, breakKind, access{addr: addr, val: val})
+}
+
+func (debugger *Debugger) checkBreakpoints(space string, kind int, access access) {
+	for _, breakpoint := range debugger.breakpoints {
+		if !breakpoint.matches(space, kind, access) {
+			continue
+		}
+		reason := fmt.Sprintf("Breakpoint %s", breakpoint)
+		if kind != BreakExecute {
+			action := "read"
+			if kind == BreakWrite {
+				action = "write"
+			}
+			reason += fmt.Sprintf(": %s $%02X at %s $%04X by the instruction at $%04X",
+				action, access.val, space, access.addr, debugger.instructionPc)
+		}
+		debugger.breakWith(reason)
+		debugger.lastBreak.Breakpoint = breakpoint
+		debugger.lastBreak.Kind = kind
+		debugger.lastBreak.Addr = access.addr
+		return
+	}
+}
+
+// ----- Status -----
+
+// returns the registers, the ppu position and the next instruction
+func Status() string {
+	registers := cpu.GetCpu()
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X  %s  FRAME:%d\n%s",
+		registers.Acc, registers.Xidx, registers.Yidx, registers.Psts, registers.Sptr,
+		ppu.GetPpu().TracePpuStatus(), console.Frame(), Disassemble(registers.Pc))
+}
+
+// returns the instruction at the address with its bytes and operand
+func Disassemble(addr uint16) string {
+	return "$" + disasm.Decode(cpu.PeekMemory, addr).Format(nil)
+}
@@ -0,0 +1,136 @@
+package debugger
+
+import (
+	"io"
+	"testing"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// runs frames until the debugger breaks
+func runToBreak(t *testing.T, debugger *Debugger) {
+	t.Helper()
+	for range 60 {
+		console.RunFrame(nil)
+		if debugger.Paused() {
+			return
+		}
+	}
+	t.Fatal("the debugger did not break")
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	console.LoadRom("../testFiles/nestest.nes")
+	debugger := New(io.Discard)
+	debugger.Attach()
+	defer debugger.Detach()
+	terminal := &Terminal{debugger: debugger, output: io.Discard}
+	registers := cpu.GetCpu()
+
+	steps := []struct {
+		command string
+		pc      uint16
+	}{
+		// the reset handler of nestest starts with SEI, CLD, LDX #$FF, TXS
+		{"b C004", 0xC004},
+		{"s", 0xC005},
+		{"n", 0xC006},
+		{"s", 0xC008},
+	}
+	for _, step := range steps {
+		if err := terminal.Execute(step.command); err != nil {
+			t.Fatal(err)
+		}
+		runToBreak(t, debugger)
+		if registers.Pc != step.pc {
+			t.Fatalf("after %q the pc is $%04X, want $%04X", step.command, registers.Pc, step.pc)
+		}
+	}
+
+	// the reset handler clears the ppu memory through $2007
+	if err := terminal.Execute("w w ppu 2000-2FFF if value==#0"); err != nil {
+		t.Fatal(err)
+	}
+	terminal.Execute("c")
+	runToBreak(t, debugger)
+	if mnemonic := cpu.Mnemonic(cpu.PeekMemory(debugger.instructionPc)); mnemonic != cpu.STA {
+		t.Fatalf("watchpoint hit by %s, want the STA to $2007", mnemonic)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	registers := cpu.GetCpu()
+	registers.Acc = 0x10
+	registers.Xidx = 0
+
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"A==#$10", true},
+		{"A==#16", true},
+		{"A!=#$10", false},
+		{"A==#$10 && X!=#0", false},
+		{"A==#$10 && X!=#0 || X==#0", true},
+		{"value>=#$80", true},
+		{"addr<#$0300", false},
+	}
+	for _, test := range tests {
+		condition, err := ParseCondition(test.condition)
+		if err != nil {
+			t.Fatalf("%q: %v", test.condition, err)
+		}
+		if got := condition.evaluate(access{addr: 0x0300, val: 0x80}); got != test.want {
+			t.Errorf("%q is %v, want %v", test.condition, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"A", "A==", "Q==#1", "A==#$GG"} {
+		if _, err := ParseCondition(invalid); err == nil {
+			t.Errorf("%q should not parse", invalid)
+		}
+	}
+}
+
+// a 16KB rom at $C000 that calls a subroutine pulling from the stack
+//
+//	C000  JSR $C010
+//	C003  JMP $C003
+//	C010  PLA
+//	C011  PHA
+//	C012  RTS
+func stepOutRom() *cartridge.Cartridge {
+	prg := make([]uint8, 0x4000)
+	copy(prg, []uint8{0x20, 0x10, 0xC0, 0x4C, 0x03, 0xC0})
+	copy(prg[0x10:], []uint8{0x68, 0x48, 0x60})
+	copy(prg[0x3FFA:], []uint8{0x03, 0xC0, 0x00, 0xC0, 0x03, 0xC0})
+	return &cartridge.Cartridge{
+		PrgRom:     prg,
+		PrgRomSize: uint(len(prg)),
+		ChrRom:     make([]uint8, 0x2000),
+		ChrRomSize: 0x2000,
+	}
+}
+
+func TestStepOut(t *testing.T) {
+	console.LoadCartridge(stepOutRom())
+	debugger := New(io.Discard)
+	debugger.Attach()
+	defer debugger.Detach()
+	terminal := &Terminal{debugger: debugger, output: io.Discard}
+
+	if err := terminal.Execute("b C010"); err != nil {
+		t.Fatal(err)
+	}
+	runToBreak(t, debugger)
+	// the PLA pops past the stack pointer of the subroutine, only its RTS
+	// returns from it
+	if err := terminal.Execute("o"); err != nil {
+		t.Fatal(err)
+	}
+	runToBreak(t, debugger)
+	if pc := cpu.GetCpu().Pc; pc != 0xC003 {
+		t.Errorf("stepped out to $%04X, want the return address $C003", pc)
+	}
+}
@@ -0,0 +1,240 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/ppu"
+)
+
+const terminalHelp = `commands:
+  c, continue              runs until the next break
+  p, pause                 breaks before the next instruction
+  s, step                  runs one instruction
+  n, next                  runs one instruction, subroutines run until they return
+  o, out                   runs until the current subroutine returns
+  nmi                      runs until the next nmi handler
+  b, break ADDR[-END] [if COND]
+                           breaks when the instructions are executed
+  w, watch r|w|rw [ppu] ADDR[-END] [if COND]
+                           breaks when the cpu, or the ppu memory through $2007, is accessed
+  d, delete ID             removes a breakpoint
+  enable ID, disable ID    turns a breakpoint on or off
+  l, list                  lists the breakpoints
+  brk on|off               breaks on BRK instructions
+  illegal on|off           breaks on illegal opcodes
+  r, regs                  shows the registers and the next instruction
+  m, mem [ppu] ADDR [LEN]  dumps the memory
+conditions compare A X Y P SP PC, value and addr of the access, #$10 or #16 numbers
+and $0300 memory with == != < > <= >=, joined by && and ||, as in A==#$10 && $0300!=#0`
+
+// Terminal reads debugger commands from a text console, as the standard
+// input, while the emulator window keeps showing the frozen frame
+type Terminal struct {
+	debugger *Debugger
+	commands chan string
+	output   io.Writer
+}
+
+// starts reading the commands from input, they are executed by Update
+func NewTerminal(debugger *Debugger, input io.Reader, output io.Writer) *Terminal {
+	terminal := &Terminal{debugger: debugger, commands: make(chan string, 16), output: output}
+	go func() {
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			terminal.commands <- scanner.Text()
+		}
+	}()
+	fmt.Fprintln(output, "Debugger attached, type help for the commands")
+	return terminal
+}
+
+// Update executes the commands typed since the last call, it must be called
+// every frame from the goroutine that runs the emulation
+func (terminal *Terminal) Update() {
+	for {
+		select {
+		case line := <-terminal.commands:
+			if err := terminal.Execute(line); err != nil {
+				fmt.Fprintln(terminal.output, "Error:", err)
+			}
+			if terminal.debugger.Paused() {
+				fmt.Fprint(terminal.output, "> ")
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (terminal *Terminal) Execute(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	debugger := terminal.debugger
+	args := fields[1:]
+
+	switch strings.ToLower(fields[0]) {
+	case "h", "help":
+		fmt.Fprintln(terminal.output, terminalHelp)
+	case "c", "continue":
+		debugger.Continue()
+	case "p", "pause":
+		debugger.Pause()
+	case "s", "step":
+		debugger.StepInto()
+	case "n", "next":
+		debugger.StepOver()
+	case "o", "out":
+		debugger.StepOut()
+	case "nmi":
+		debugger.RunToNmi()
+	case "b", "break":
+		return terminal.addBreakpoint(BreakExecute, SpaceCpu, args)
+	case "w", "watch":
+		return terminal.addWatchpoint(args)
+	case "d", "delete":
+		id, err := parseId(args)
+		if err != nil {
+			return err
+		}
+		if !debugger.RemoveBreakpoint(id) {
+			return fmt.Errorf("breakpoint #%d does not exist", id)
+		}
+	case "enable", "disable":
+		id, err := parseId(args)
+		if err != nil {
+			return err
+		}
+		breakpoint := debugger.Breakpoint(id)
+		if breakpoint == nil {
+			return fmt.Errorf("breakpoint #%d does not exist", id)
+		}
+		breakpoint.Enabled = strings.ToLower(fields[0]) == "enable"
+	case "l", "list":
+		for _, breakpoint := range debugger.Breakpoints() {
+			fmt.Fprintln(terminal.output, breakpoint)
+		}
+		fmt.Fprintf(terminal.output, "break on BRK: %v, break on illegal opcodes: %v\n", debugger.BreakOnBrk, debugger.BreakOnIllegal)
+	case "brk":
+		return parseSwitch(args, &debugger.BreakOnBrk)
+	case "illegal":
+		return parseSwitch(args, &debugger.BreakOnIllegal)
+	case "r", "regs":
+		fmt.Fprintln(terminal.output, Status())
+	case "m", "mem":
+		return terminal.dumpMemory(args)
+	default:
+		return fmt.Errorf("unknown command %q, type help for the commands", fields[0])
+	}
+	return nil
+}
+
+func (terminal *Terminal) addWatchpoint(args []string) error {
+	if len(args) == 0 {
+		return errors.New("watch needs r, w or rw")
+	}
+	var kind int
+	switch strings.ToLower(args[0]) {
+	case "r":
+		kind = BreakRead
+	case "w":
+		kind = BreakWrite
+	case "rw":
+		kind = BreakRead | BreakWrite
+	default:
+		return fmt.Errorf("invalid access %q, use r, w or rw", args[0])
+	}
+	args = args[1:]
+	space := SpaceCpu
+	if len(args) > 0 && strings.ToLower(args[0]) == "ppu" {
+		space = SpacePpu
+		args = args[1:]
+	}
+	return terminal.addBreakpoint(kind, space, args)
+}
+
+// parses ADDR[-END] [if COND] and adds the breakpoint
+func (terminal *Terminal) addBreakpoint(kind int, space string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing address")
+	}
+	start, end, err := parseRange(args[0])
+	if err != nil {
+		return err
+	}
+	breakpoint := Breakpoint{Kind: kind, Space: space, Start: start, End: end}
+	if len(args) > 1 {
+		if strings.ToLower(args[1]) != "if" || len(args) == 2 {
+			return errors.New("expected if CONDITION after the address")
+		}
+		breakpoint.Condition, err = ParseCondition(strings.Join(args[2:], " "))
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(terminal.output, "Added", terminal.debugger.AddBreakpoint(breakpoint))
+	return nil
+}
+
+// dumps the memory in lines of 16 bytes, the reads have no side effects
+func (terminal *Terminal) dumpMemory(args []string) error {
+	read := cpu.PeekMemory
+	if len(args) > 0 && strings.ToLower(args[0]) == "ppu" {
+		read = ppu.PeekMemory
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("missing address")
+	}
+	start, err := parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	length := 0x40
+	if len(args) > 1 {
+		if length, err = parseNumber(args[1]); err != nil {
+			return err
+		}
+	}
+
+	for line := 0; line < length; line += 16 {
+		fmt.Fprintf(terminal.output, "$%04X:", start+uint16(line))
+		for i := line; i < min(line+16, length); i++ {
+			fmt.Fprintf(terminal.output, " %02X", read(start+uint16(i)))
+		}
+		fmt.Fprintln(terminal.output)
+	}
+	return nil
+}
+
+func parseId(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("missing breakpoint id")
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid breakpoint id %q", args[0])
+	}
+	return id, nil
+}
+
+func parseSwitch(args []string, value *bool) error {
+	if len(args) == 0 {
+		return errors.New("expected on or off")
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		*value = true
+	case "off":
+		*value = false
+	default:
+		return fmt.Errorf("expected on or off, got %q", args[0])
+	}
+	return nil
+}
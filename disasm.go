@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/disasm"
+)
+
+// runs the disasm subcommand, as in
+//
+//	nesemulator disasm -labels game.nes.0.nl,game.nes.ram.nl -o game.asm game.nes
+func runDisasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	labels := flags.String("labels", "", "comma separated ca65 .dbg, FCEUX .nl or Mesen .mlb symbol files")
+	bankSize := flags.Int("bank-size", disasm.DefaultBankSize, "size of the prg banks, 16384 or 8192")
+	outputPath := flags.String("o", "", "output file, the standard output by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: disasm [flags] rom.nes")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	symbols := disasm.NewSymbols()
+	if *labels != "" {
+		for _, path := range strings.Split(*labels, ",") {
+			if err := symbols.Load(path); err != nil {
+				log.Fatal("Error loading labels: ", err)
+			}
+		}
+	}
+
+	rom := cartridge.ReadFromFile(flags.Arg(0))
+	var output io.Writer = os.Stdout
+	if *outputPath != "" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		output = file
+	}
+	if err := disasm.DumpRom(output, &rom, disasm.Options{BankSize: *bankSize, Symbols: symbols}); err != nil {
+		log.Fatal("Error disassembling: ", err)
+	}
+}
@@ -0,0 +1,185 @@
+package disasm
+
+import (
+	"fmt"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// addressing modes of the instructions, as written in the assembly
+const (
+	Implied = iota
+	Accumulator
+	Immediate
+	ZeroPage
+	ZeroPageX
+	ZeroPageY
+	Absolute
+	AbsoluteX
+	AbsoluteY
+	Indirect
+	IndirectX
+	IndirectY
+	Relative
+)
+
+// Instruction is a decoded instruction, it keeps no reference to the memory it was read from
+type Instruction struct {
+	Address  uint16
+	Opcode   uint8
+	Bytes    []uint8
+	Mnemonic string
+	Mode     int
+	Illegal  bool
+	// the operand byte or word, branches have their target address instead
+	Operand uint16
+}
+
+// Decode reads the instruction at the address, the read function gives the
+// bytes of the memory, live as cpu.PeekMemory or offline over a rom bank
+func Decode(read func(addr uint16) uint8, addr uint16) Instruction {
+	opcode := read(addr)
+	instruction := Instruction{
+		Address:  addr,
+		Opcode:   opcode,
+		Mnemonic: cpu.Mnemonic(opcode),
+		Mode:     ModeOf(opcode),
+		Illegal:  cpu.IsIllegalOpcode(opcode),
+	}
+	size := uint16(cpu.InstructionSize(opcode))
+	for i := range size {
+		instruction.Bytes = append(instruction.Bytes, read(addr+i))
+	}
+
+	switch {
+	case instruction.Mode == Relative:
+		instruction.Operand = addr + 2 + uint16(int8(instruction.Bytes[1]))
+	case size == 2:
+		instruction.Operand = uint16(instruction.Bytes[1])
+	case size == 3:
+		instruction.Operand = uint16(instruction.Bytes[1]) | uint16(instruction.Bytes[2])<<8
+	}
+	return instruction
+}
+
+// ModeOf returns the addressing mode of the opcode, the bits 2-4 of the
+// opcode give it except for the same exceptions the cpu has
+func ModeOf(opcode uint8) int {
+	switch cpu.Mnemonic(opcode) {
+	case cpu.JAM:
+		return Implied
+	case cpu.BPL, cpu.BMI, cpu.BVC, cpu.BVS, cpu.BCC, cpu.BCS, cpu.BNE, cpu.BEQ:
+		return Relative
+	case cpu.BRK, cpu.RTI, cpu.RTS, cpu.PHP, cpu.PLP, cpu.PHA, cpu.PLA, cpu.DEY, cpu.TAY, cpu.INY, cpu.INX,
+		cpu.CLC, cpu.SEC, cpu.CLI, cpu.SEI, cpu.TYA, cpu.CLV, cpu.CLD, cpu.SED, cpu.TXA, cpu.TAX, cpu.DEX,
+		cpu.TXS, cpu.TSX:
+		return Implied
+	}
+	switch opcode {
+	//   JMP
+	case 0x6C:
+		return Indirect
+	//   LDY   CPY   CPX   LDX
+	case 0xA0, 0xC0, 0xE0, 0xA2:
+		return Immediate
+	//   JSR   JMP
+	case 0x20, 0x4C:
+		return Absolute
+	//   ASL   ROL   LSR   ROR
+	case 0x0A, 0x2A, 0x4A, 0x6A:
+		return Accumulator
+	//   STX   LDX   SAX   LAX
+	case 0x96, 0xB6, 0x97, 0xB7:
+		return ZeroPageY
+	//   LDX   SHX   SHA   LAX
+	case 0xBE, 0x9E, 0x9F, 0xBF:
+		return AbsoluteY
+	//   size 1 nops
+	case 0xEA, 0x1A, 0x3A, 0x5A, 0x7A, 0xDA, 0xFA:
+		return Implied
+	//   size 2 immediate nops
+	case 0x80, 0x82, 0xC2, 0xE2:
+		return Immediate
+	}
+
+	switch (opcode >> 2) & 0b00000111 {
+	case 0:
+		return IndirectX
+	case 1:
+		return ZeroPage
+	case 2:
+		return Immediate
+	case 3:
+		return Absolute
+	case 4:
+		return IndirectY
+	case 5:
+		return ZeroPageX
+	case 6:
+		return AbsoluteY
+	}
+	return AbsoluteX
+}
+
+// returns whether the operand of the instruction is an address of the memory
+func (instruction Instruction) HasAddress() bool {
+	switch instruction.Mode {
+	case Implied, Accumulator, Immediate:
+		return false
+	}
+	return true
+}
+
+// returns the operand as written in the assembly, the label function may give
+// a name to the address of the operand, an empty name keeps the number
+func (instruction Instruction) FormatOperand(label func(addr uint16) string) string {
+	var address string
+	if instruction.HasAddress() && label != nil {
+		address = label(instruction.Operand)
+	}
+	if address == "" {
+		switch instruction.Mode {
+		case ZeroPage, ZeroPageX, ZeroPageY, IndirectX, IndirectY:
+			address = fmt.Sprintf("$%02X", instruction.Operand)
+		default:
+			address = fmt.Sprintf("$%04X", instruction.Operand)
+		}
+	}
+
+	switch instruction.Mode {
+	case Accumulator:
+		return "A"
+	case Immediate:
+		return fmt.Sprintf("#$%02X", instruction.Operand)
+	case ZeroPageX, AbsoluteX:
+		return address + ",X"
+	case ZeroPageY, AbsoluteY:
+		return address + ",Y"
+	case Indirect:
+		return "(" + address + ")"
+	case IndirectX:
+		return "(" + address + ",X)"
+	case IndirectY:
+		return "(" + address + "),Y"
+	case ZeroPage, Absolute, Relative:
+		return address
+	}
+	return ""
+}
+
+// returns the instruction as a line of the disassembly, with its address and
+// bytes, illegal opcodes are marked with a *
+func (instruction Instruction) Format(label func(addr uint16) string) string {
+	bytes := ""
+	for _, b := range instruction.Bytes {
+		bytes += fmt.Sprintf("%02X ", b)
+	}
+	marker := " "
+	if instruction.Illegal {
+		marker = "*"
+	}
+	text := fmt.Sprintf("%04X  %-9s%s%s", instruction.Address, bytes, marker, instruction.Mnemonic)
+	if operand := instruction.FormatOperand(label); operand != "" {
+		text += " " + operand
+	}
+	return text
+}
@@ -0,0 +1,128 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/cartridge"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+func memory(bytes ...uint8) func(addr uint16) uint8 {
+	return func(addr uint16) uint8 {
+		if int(addr-0x8000) < len(bytes) {
+			return bytes[addr-0x8000]
+		}
+		return 0
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		bytes []uint8
+		want  string
+	}{
+		{[]uint8{0x78}, "8000  78        SEI"},
+		{[]uint8{0xA2, 0xFF}, "8000  A2 FF     LDX #$FF"},
+		{[]uint8{0x0A}, "8000  0A        ASL A"},
+		{[]uint8{0xAD, 0x02, 0x20}, "8000  AD 02 20  LDA $2002"},
+		{[]uint8{0xB6, 0x10}, "8000  B6 10     LDX $10,Y"},
+		{[]uint8{0xBE, 0x00, 0x03}, "8000  BE 00 03  LDX $0300,Y"},
+		{[]uint8{0x6C, 0xFE, 0x02}, "8000  6C FE 02  JMP ($02FE)"},
+		{[]uint8{0xA1, 0x80}, "8000  A1 80     LDA ($80,X)"},
+		{[]uint8{0xB1, 0x80}, "8000  B1 80     LDA ($80),Y"},
+		{[]uint8{0x10, 0xFB}, "8000  10 FB     BPL $7FFD"},
+		{[]uint8{0xA7, 0x10}, "8000  A7 10    *LAX $10"},
+		{[]uint8{0x6B, 0x10}, "8000  6B 10    *ARR #$10"},
+		{[]uint8{0x1A}, "8000  1A       *NOP"},
+		{[]uint8{0x02}, "8000  02       *JAM"},
+	}
+	for _, test := range tests {
+		if got := Decode(memory(test.bytes...), 0x8000).Format(nil); got != test.want {
+			t.Errorf("decoding % X got %q, want %q", test.bytes, got, test.want)
+		}
+	}
+}
+
+func TestLoadNl(t *testing.T) {
+	symbols := NewSymbols()
+	if err := symbols.LoadNl(strings.NewReader("$C004#Reset#entry point\n$8010#Bank1Code#\n"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := symbols.LoadNl(strings.NewReader("$0300/10#Buffer#\n"), nlBank("game.nes.ram.nl")); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbol(t, symbols, 0xC004, 0x4004, "Reset", "entry point")
+	expectSymbol(t, symbols, 0x8010, 0x4010, "Bank1Code", "")
+	expectSymbol(t, symbols, 0x0300, -1, "Buffer", "")
+	if bank := nlBank("game.nes.A.nl"); bank != 10 {
+		t.Errorf("bank of game.nes.A.nl is %d, want 10", bank)
+	}
+}
+
+func TestLoadMlb(t *testing.T) {
+	symbols := NewSymbols()
+	mlb := "P:0004:Reset:entry\nR:0010-001F:Pointers\nS:0000:SaveData\nG:2002:PPUSTATUS\nNesPrgRom:4000:Bank1\n"
+	if err := symbols.LoadMlb(strings.NewReader(mlb)); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbol(t, symbols, 0xC004, 0x0004, "Reset", "entry")
+	expectSymbol(t, symbols, 0x0010, -1, "Pointers", "")
+	expectSymbol(t, symbols, 0x6000, -1, "SaveData", "")
+	expectSymbol(t, symbols, 0x2002, -1, "PPUSTATUS", "")
+	expectSymbol(t, symbols, 0x8000, 0x4000, "Bank1", "")
+}
+
+func TestLoadDbg(t *testing.T) {
+	dbg := `version	major=2,minor=0
+seg	id=0,name="CODE",start=0x00C000,size=0x4000,addrsize=absolute,type=ro,oname="game.nes",ooffs=16
+seg	id=1,name="ZEROPAGE",start=0x000000,size=0x0010,addrsize=zeropage,type=rw
+sym	id=0,name="reset",addrsize=absolute,scope=0,def=1,ref=2,val=0xC004,seg=0,type=lab
+sym	id=1,name="pointer",addrsize=zeropage,scope=0,def=3,val=0x2,seg=1,type=lab
+sym	id=2,name="PPUSTATUS",addrsize=absolute,scope=0,def=4,val=0x2002,type=equ
+sym	id=3,name="other",addrsize=absolute,scope=0,def=5,type=imp
+`
+	symbols := NewSymbols()
+	if err := symbols.LoadDbg(strings.NewReader(dbg)); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbol(t, symbols, 0xC004, 0x0004, "reset", "")
+	expectSymbol(t, symbols, 0x0002, -1, "pointer", "")
+	expectSymbol(t, symbols, 0x2002, -1, "PPUSTATUS", "")
+	if symbols.Len() != 3 {
+		t.Errorf("loaded %d symbols, want 3", symbols.Len())
+	}
+}
+
+func expectSymbol(t *testing.T, symbols *Symbols, addr uint16, romOffset int, name string, comment string) {
+	t.Helper()
+	symbol, found := symbols.Lookup(addr, romOffset)
+	if !found || symbol.Name != name || symbol.Comment != comment {
+		t.Errorf("symbol at $%04X (rom offset %d) is %+v, want %s ; %s", addr, romOffset, symbol, name, comment)
+	}
+}
+
+func TestDumpRom(t *testing.T) {
+	rom := cartridge.ReadFromFile(testRom)
+	symbols := NewSymbols()
+	symbols.AddRom(0x0004, Symbol{Name: "Reset"})
+	symbols.AddRom(0x0009, Symbol{Name: "WaitVblank", Comment: "first vblank"})
+	symbols.AddCpu(0x2002, Symbol{Name: "PPUSTATUS"})
+
+	var output strings.Builder
+	if err := DumpRom(&output, &rom, Options{Symbols: symbols}); err != nil {
+		t.Fatal(err)
+	}
+	dump := output.String()
+	for _, want := range []string{
+		"; ----- bank 0 at $C000, rom offset $00000 -----",
+		"Reset:\nC004  78        SEI             ; RESET handler\n",
+		"WaitVblank:\nC009  AD 02 20  LDA PPUSTATUS   ; first vblank\n",
+		"C00C  10 FB     BPL WaitVblank\n",
+		"FFFC  04 C0     .word Reset     ; RESET vector\n",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("the disassembly has no %q", want)
+		}
+	}
+}
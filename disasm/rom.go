@@ -0,0 +1,188 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"vsasakiv/nesemulator/cartridge"
+)
+
+const DefaultBankSize = 0x4000
+
+// the interrupt vectors at the end of the last bank
+var vectors = []struct {
+	addr uint16
+	name string
+}{{0xFFFA, "NMI"}, {0xFFFC, "RESET"}, {0xFFFE, "IRQ"}}
+
+type Options struct {
+	// size of the switchable prg banks, 0x4000 or 0x2000
+	BankSize int
+	// labels and comments of the rom, may be nil
+	Symbols *Symbols
+}
+
+// a prg bank and where it is mapped in the cpu address space
+type bank struct {
+	number int
+	data   []uint8
+	offset int
+	start  uint16
+}
+
+func (bank bank) contains(addr uint16) bool {
+	return addr >= bank.start && int(addr-bank.start) < len(bank.data)
+}
+
+// a disassembly of the prg rom, bank by bank
+type dumper struct {
+	writer  *bufio.Writer
+	symbols *Symbols
+	// the last bank, that mappers usually keep fixed at the end of the address space
+	fixed bank
+	// vector targets in the fixed bank
+	entries map[uint16]string
+}
+
+// DumpRom disassembles every prg bank of the cartridge as annotated text. The
+// banks are read linearly, so data between the code shows as instructions.
+// The last bank is placed at the end of the cpu address space, where the
+// interrupt vectors are, and the others at $8000
+func DumpRom(output io.Writer, rom *cartridge.Cartridge, options Options) error {
+	bankSize := options.BankSize
+	if bankSize == 0 {
+		bankSize = DefaultBankSize
+	}
+	if bankSize != 0x2000 && bankSize != 0x4000 {
+		return fmt.Errorf("invalid bank size $%X, use $2000 or $4000", bankSize)
+	}
+	symbols := options.Symbols
+	if symbols == nil {
+		symbols = NewSymbols()
+	}
+	// roms smaller than a bank are mirrored up to the end of the address space
+	bankSize = min(bankSize, len(rom.PrgRom))
+	if bankSize == 0 {
+		return fmt.Errorf("the rom has no prg")
+	}
+
+	var banks []bank
+	for offset := 0; offset < len(rom.PrgRom); offset += bankSize {
+		banks = append(banks, bank{
+			number: len(banks),
+			data:   rom.PrgRom[offset:min(offset+bankSize, len(rom.PrgRom))],
+			offset: offset,
+			start:  0x8000,
+		})
+	}
+	banks[len(banks)-1].start = uint16(0x10000 - bankSize)
+	dumper := &dumper{writer: bufio.NewWriter(output), symbols: symbols, fixed: banks[len(banks)-1]}
+
+	dumper.entries = make(map[uint16]string)
+	for _, vector := range vectors {
+		if dumper.fixed.contains(vector.addr) && dumper.fixed.contains(vector.addr+1) {
+			target := uint16(dumper.read(dumper.fixed, vector.addr)) | uint16(dumper.read(dumper.fixed, vector.addr+1))<<8
+			dumper.entries[target] = vector.name
+		}
+	}
+
+	fmt.Fprintf(dumper.writer, "; %d prg banks of %dKB, mapper %d, %d symbols\n",
+		len(banks), bankSize/1024, rom.MapperType, symbols.Len())
+	for _, bank := range banks {
+		dumper.dumpBank(bank)
+	}
+	return dumper.writer.Flush()
+}
+
+func (dumper *dumper) read(bank bank, addr uint16) uint8 {
+	if !bank.contains(addr) {
+		return 0
+	}
+	return bank.data[addr-bank.start]
+}
+
+// returns the prg offset mapped at the address while the bank is selected, -1 when it is unknown
+func (dumper *dumper) romOffset(bank bank, addr uint16) int {
+	switch {
+	case bank.contains(addr):
+		return bank.offset + int(addr-bank.start)
+	case dumper.fixed.contains(addr):
+		return dumper.fixed.offset + int(addr-dumper.fixed.start)
+	}
+	return -1
+}
+
+func (dumper *dumper) dumpBank(bank bank) {
+	writer := dumper.writer
+	fmt.Fprintf(writer, "\n; ----- bank %d at $%04X, rom offset $%05X -----\n", bank.number, bank.start, bank.offset)
+
+	label := func(addr uint16) string {
+		symbol, _ := dumper.symbols.Lookup(addr, dumper.romOffset(bank, addr))
+		return symbol.Name
+	}
+	read := func(addr uint16) uint8 {
+		return dumper.read(bank, addr)
+	}
+	// symbol line of the address and its comment
+	annotate := func(addr uint16) string {
+		symbol, _ := dumper.symbols.Lookup(addr, dumper.romOffset(bank, addr))
+		if symbol.Name != "" {
+			fmt.Fprintf(writer, "%s:\n", symbol.Name)
+		}
+		return symbol.Comment
+	}
+
+	end := int(bank.start) + len(bank.data)
+	isFixed := bank.number == dumper.fixed.number
+	codeEnd := end
+	if isFixed && bank.contains(vectors[0].addr) {
+		codeEnd = int(vectors[0].addr)
+	}
+
+	for addr := int(bank.start); addr < codeEnd; {
+		comment := annotate(uint16(addr))
+		if entry, found := dumper.entries[uint16(addr)]; found && isFixed {
+			comment = joinComments(entry+" handler", comment)
+		}
+
+		instruction := Decode(read, uint16(addr))
+		if addr+len(instruction.Bytes) > codeEnd {
+			// the instruction would continue in the next bank or over the vectors
+			writeLine(writer, fmt.Sprintf("%04X  %02X        .byte $%02X", addr, instruction.Opcode, instruction.Opcode), comment)
+			addr++
+			continue
+		}
+		writeLine(writer, instruction.Format(label), comment)
+		addr += len(instruction.Bytes)
+	}
+
+	if codeEnd == end {
+		return
+	}
+	for _, vector := range vectors {
+		comment := annotate(vector.addr)
+		low, high := read(vector.addr), read(vector.addr+1)
+		target := uint16(low) | uint16(high)<<8
+		operand := label(target)
+		if operand == "" {
+			operand = fmt.Sprintf("$%04X", target)
+		}
+		writeLine(writer, fmt.Sprintf("%04X  %02X %02X     .word %s", vector.addr, low, high, operand),
+			joinComments(vector.name+" vector", comment))
+	}
+}
+
+func joinComments(first string, second string) string {
+	if first == "" || second == "" {
+		return first + second
+	}
+	return first + ", " + second
+}
+
+func writeLine(writer io.Writer, text string, comment string) {
+	if comment == "" {
+		fmt.Fprintln(writer, text)
+		return
+	}
+	fmt.Fprintf(writer, "%-32s; %s\n", text, comment)
+}
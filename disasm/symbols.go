@@ -0,0 +1,287 @@
+package disasm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// size of the prg banks in the FCEUX .nl file names
+const nlBankSize = 0x4000
+
+// start of the save ram in the cpu address space, Mesen labels offsets from it
+const saveRamStart = 0x6000
+
+var ErrFormat = errors.New("unknown symbol file format")
+
+type Symbol struct {
+	Name    string
+	Comment string
+}
+
+// Symbols are the labels of a rom, the ones in the prg rom are kept by their
+// offset in it, as the same address is a different code in each bank, and
+// the ones of the ram, registers and save ram by their cpu address
+type Symbols struct {
+	rom map[int]Symbol
+	cpu map[uint16]Symbol
+}
+
+func NewSymbols() *Symbols {
+	return &Symbols{rom: make(map[int]Symbol), cpu: make(map[uint16]Symbol)}
+}
+
+// the first symbol added to an address is kept
+func (symbols *Symbols) AddRom(offset int, symbol Symbol) {
+	if _, found := symbols.rom[offset]; !found {
+		symbols.rom[offset] = symbol
+	}
+}
+
+func (symbols *Symbols) AddCpu(addr uint16, symbol Symbol) {
+	if _, found := symbols.cpu[addr]; !found {
+		symbols.cpu[addr] = symbol
+	}
+}
+
+// Lookup returns the symbol of a cpu address, romOffset is the prg rom offset
+// mapped at the address or -1 when it is not in the rom or its bank is unknown
+func (symbols *Symbols) Lookup(addr uint16, romOffset int) (Symbol, bool) {
+	if romOffset >= 0 {
+		if symbol, found := symbols.rom[romOffset]; found {
+			return symbol, true
+		}
+	}
+	symbol, found := symbols.cpu[addr]
+	return symbol, found
+}
+
+func (symbols *Symbols) Len() int {
+	return len(symbols.rom) + len(symbols.cpu)
+}
+
+// Load adds the symbols of a ca65 .dbg, FCEUX .nl or Mesen .mlb file, chosen by its extension
+func (symbols *Symbols) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dbg":
+		err = symbols.LoadDbg(file)
+	case ".nl":
+		err = symbols.LoadNl(file, nlBank(path))
+	case ".mlb":
+		err = symbols.LoadMlb(file)
+	default:
+		return fmt.Errorf("%w: %s", ErrFormat, path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// returns the bank of a FCEUX .nl file, named as game.nes.1.nl for the bank 1
+// and game.nes.ram.nl for the ram, -1 when the name has no bank
+func nlBank(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	bank, err := strconv.ParseUint(strings.TrimPrefix(filepath.Ext(name), "."), 16, 16)
+	if err != nil {
+		return -1
+	}
+	return int(bank)
+}
+
+// LoadNl reads a FCEUX .nl file, with lines as $C000#Name#Comment. The bank
+// is the 16KB prg bank of the labels at $8000 and above, or -1 to keep them
+// by cpu address, as for the .ram.nl file
+func (symbols *Symbols) LoadNl(reader io.Reader, bank int) error {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, "#", 3)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "$") {
+			return fmt.Errorf("line %d: expected $ADDR#Name#Comment", line)
+		}
+		// arrays are written as $0300/10, only their start is labeled
+		addressText, _, _ := strings.Cut(fields[0][1:], "/")
+		addr, err := strconv.ParseUint(addressText, 16, 16)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid address %q", line, fields[0])
+		}
+		symbol := Symbol{Name: fields[1]}
+		if len(fields) == 3 {
+			symbol.Comment = fields[2]
+		}
+		if bank >= 0 && addr >= 0x8000 {
+			symbols.AddRom(bank*nlBankSize+int(addr%nlBankSize), symbol)
+		} else {
+			symbols.AddCpu(uint16(addr), symbol)
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadMlb reads a Mesen .mlb file, with lines as P:1F0A:Name:Comment, where
+// the type gives the memory of the address, P for the prg rom, R for the
+// internal ram, S and W for the save ram and G for the registers, or the
+// NesPrgRom, NesInternalRam, NesSaveRam, NesWorkRam and NesMemory of Mesen 2
+func (symbols *Symbols) LoadMlb(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, ":", 4)
+		if len(fields) < 3 {
+			return fmt.Errorf("line %d: expected TYPE:ADDR:Name[:Comment]", line)
+		}
+		// ranges as 0300-03FF label their start
+		addressText, _, _ := strings.Cut(fields[1], "-")
+		addr, err := strconv.ParseUint(addressText, 16, 32)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid address %q", line, fields[1])
+		}
+		symbol := Symbol{Name: fields[2]}
+		if len(fields) == 4 {
+			// multiline comments are stored with escaped line breaks
+			symbol.Comment = strings.ReplaceAll(fields[3], `\n`, " ")
+		}
+
+		switch fields[0] {
+		case "P", "NesPrgRom":
+			symbols.AddRom(int(addr), symbol)
+		case "R", "NesInternalRam":
+			symbols.AddCpu(uint16(addr%0x0800), symbol)
+		case "S", "W", "NesSaveRam", "NesWorkRam":
+			symbols.AddCpu(uint16(saveRamStart+addr%0x2000), symbol)
+		case "G", "NesMemory":
+			symbols.AddCpu(uint16(addr), symbol)
+		}
+		// labels of other memories, as the chr, are not shown in the disassembly
+	}
+	return scanner.Err()
+}
+
+// a segment of the ca65 debug info, the ones in the rom have their offset in the output file
+type dbgSegment struct {
+	start  int
+	offset int
+	inRom  bool
+}
+
+// LoadDbg reads the debug info written by ld65 --dbgfile, the labels of the
+// segments stored in the rom are kept by their prg offset and the others,
+// as the zeropage and bss, and the equates by their address
+func (symbols *Symbols) LoadDbg(reader io.Reader) error {
+	segments := make(map[string]dbgSegment)
+	type dbgSymbol struct {
+		Symbol
+		value   int
+		segment string
+	}
+	var labels []dbgSymbol
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		kind, rest, _ := strings.Cut(scanner.Text(), "\t")
+		if kind != "seg" && kind != "sym" {
+			continue
+		}
+		attributes := parseDbgAttributes(rest)
+
+		switch kind {
+		case "seg":
+			start, err := parseDbgNumber(attributes["start"])
+			if err != nil {
+				return fmt.Errorf("line %d: invalid segment start", line)
+			}
+			segment := dbgSegment{start: start}
+			if offsetText, found := attributes["ooffs"]; found {
+				offset, err := parseDbgNumber(offsetText)
+				if err != nil {
+					return fmt.Errorf("line %d: invalid segment offset", line)
+				}
+				// the output file offset includes the ines header
+				segment.offset = offset - 16
+				segment.inRom = attributes["type"] == "ro"
+			}
+			segments[attributes["id"]] = segment
+		case "sym":
+			if attributes["type"] == "imp" {
+				// imports repeat the symbols exported by other modules
+				continue
+			}
+			value, err := parseDbgNumber(attributes["val"])
+			if err != nil {
+				// symbols without a value, as the scopes, are not labels
+				continue
+			}
+			labels = append(labels, dbgSymbol{
+				Symbol:  Symbol{Name: attributes["name"]},
+				value:   value,
+				segment: attributes["seg"],
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// segments may come after the symbols that use them
+	for _, label := range labels {
+		if label.value < 0 || label.value > 0xFFFF {
+			continue
+		}
+		segment, found := segments[label.segment]
+		if found && segment.inRom && label.value >= segment.start {
+			symbols.AddRom(segment.offset+label.value-segment.start, label.Symbol)
+		} else {
+			symbols.AddCpu(uint16(label.value), label.Symbol)
+		}
+	}
+	return nil
+}
+
+// parses the key=value attributes of a .dbg line, the values may be quoted
+func parseDbgAttributes(text string) map[string]string {
+	attributes := make(map[string]string)
+	for len(text) > 0 {
+		key, rest, found := strings.Cut(text, "=")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value = rest[1 : end+1]
+			rest = strings.TrimPrefix(rest[min(end+2, len(rest)):], ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attributes[key] = value
+		text = rest
+	}
+	return attributes
+}
+
+// parses the decimal and 0x prefixed hex numbers of the .dbg files
+func parseDbgNumber(text string) (int, error) {
+	number, err := strconv.ParseInt(text, 0, 32)
+	return int(number), err
+}
@@ -0,0 +1,89 @@
+package gdbstub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// bytes of the remote serial protocol outside of the packets
+const (
+	packetStart = '$'
+	packetEnd   = '#'
+	ack         = '+'
+	nack        = '-'
+	// sent by the client to stop the running target, as a Ctrl-C
+	interrupt = 0x03
+)
+
+var ErrPacket = errors.New("malformed rsp packet")
+
+// returns the checksum of a packet, the sum of its bytes modulo 256
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := range len(data) {
+		sum += data[i]
+	}
+	return sum
+}
+
+// writes the data as a packet, $data#checksum
+func writePacket(writer io.Writer, data string) error {
+	_, err := fmt.Fprintf(writer, "%c%s%c%02x", packetStart, data, packetEnd, checksum(data))
+	return err
+}
+
+// readPacket returns the data of the next packet, or a single byte string
+// for the interrupt, the acknowledgements before it are skipped
+func readPacket(reader *bufio.Reader) (string, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case ack, nack:
+			continue
+		case interrupt:
+			return string(rune(interrupt)), nil
+		case packetStart:
+		default:
+			return "", fmt.Errorf("%w: unexpected byte %02x", ErrPacket, b)
+		}
+
+		data, err := reader.ReadString(packetEnd)
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+		sum := make([]byte, 2)
+		if _, err := io.ReadFull(reader, sum); err != nil {
+			return "", err
+		}
+		expected, err := strconv.ParseUint(string(sum), 16, 8)
+		if err != nil || uint8(expected) != checksum(data) {
+			return "", fmt.Errorf("%w: wrong checksum of %q", ErrPacket, data)
+		}
+		return unescape(data), nil
+	}
+}
+
+// removes the escapes of the binary data, } followed by the byte xor 0x20
+func unescape(data string) string {
+	escaped := false
+	result := make([]byte, 0, len(data))
+	for i := range len(data) {
+		switch {
+		case escaped:
+			result = append(result, data[i]^0x20)
+			escaped = false
+		case data[i] == '}':
+			escaped = true
+		default:
+			result = append(result, data[i])
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,467 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/debugger"
+)
+
+// Stub serves the GDB remote serial protocol over TCP, so gdb and other
+// tools that speak it can drive the emulator. One client is served at a
+// time, it can read and write the registers and the memory, add breakpoints
+// and watchpoints, continue and step. The registers are numbered in the order
+//
+//	0 A, 1 X, 2 Y, 3 P, 4 SP, 5 PC
+//
+// and the g packet has them as 7 bytes, with the 16 bits PC little endian
+type Stub struct {
+	debugger *debugger.Debugger
+	listener net.Listener
+	Addr     net.Addr
+
+	connections chan net.Conn
+	// client being served, nil when there is none
+	client *client
+	// the client waits for a stop reply, sent when the debugger breaks
+	waitingStop bool
+	// the client stopped the emulation with an interrupt
+	interrupted bool
+}
+
+type client struct {
+	conn    net.Conn
+	packets chan string
+	// packets received while the emulation was running
+	pending []string
+	// the reader stopped, the connection is closed
+	closed chan struct{}
+	noAck  bool
+	// breakpoints added by the client, by their Z packet
+	breakpoints map[string]int
+}
+
+// register numbers of the p and P packets
+const (
+	registerA = iota
+	registerX
+	registerY
+	registerP
+	registerSp
+	registerPc
+	registerCount
+)
+
+// signals of the stop replies
+const (
+	signalInterrupt = 2
+	signalTrap      = 5
+)
+
+// Listen starts accepting clients on the address, as :2345. The commands
+// run on the debugger from Update
+func Listen(addr string, debugger *debugger.Debugger) (*Stub, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	stub := &Stub{
+		debugger:    debugger,
+		listener:    listener,
+		Addr:        listener.Addr(),
+		connections: make(chan net.Conn),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stub.connections <- conn
+		}
+	}()
+	return stub, nil
+}
+
+func (stub *Stub) Close() error {
+	stub.disconnect()
+	return stub.listener.Close()
+}
+
+// Update serves the client, it must be called every frame from the goroutine
+// that runs the emulation. The packets are answered while the emulation is
+// stopped, as gdb only sends them after a stop
+func (stub *Stub) Update() {
+	if stub.client == nil {
+		select {
+		case conn := <-stub.connections:
+			stub.connect(conn)
+		default:
+			return
+		}
+	}
+	client := stub.client
+
+	select {
+	case <-client.closed:
+		stub.disconnect()
+		return
+	default:
+	}
+
+	for drained := false; !drained; {
+		select {
+		case packet := <-client.packets:
+			if packet != string(rune(interrupt)) {
+				client.pending = append(client.pending, packet)
+			} else if !stub.debugger.Paused() {
+				stub.debugger.Pause()
+				stub.interrupted = true
+			}
+		default:
+			drained = true
+		}
+	}
+
+	if stub.waitingStop && stub.debugger.Paused() {
+		stub.waitingStop = false
+		stub.send(stub.stopReply())
+	}
+	// gdb only sends the other packets while the target is stopped
+	for stub.client != nil && stub.debugger.Paused() && len(client.pending) > 0 {
+		packet := client.pending[0]
+		client.pending = client.pending[1:]
+		if reply, send := stub.handle(packet); send {
+			stub.send(reply)
+		}
+	}
+}
+
+// the emulation stops at the next instruction when a client connects
+func (stub *Stub) connect(conn net.Conn) {
+	log.Println("GDB client connected from", conn.RemoteAddr())
+	client := &client{
+		conn:        conn,
+		packets:     make(chan string, 16),
+		closed:      make(chan struct{}),
+		breakpoints: make(map[string]int),
+	}
+	stub.client = client
+	stub.debugger.Pause()
+
+	go func() {
+		defer close(client.closed)
+		reader := bufio.NewReader(conn)
+		for {
+			packet, err := readPacket(reader)
+			if errors.Is(err, ErrPacket) {
+				conn.Write([]byte{nack})
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if packet != string(rune(interrupt)) && !client.noAck {
+				conn.Write([]byte{ack})
+			}
+			client.packets <- packet
+		}
+	}()
+}
+
+// removes the breakpoints of the client and resumes the emulation
+func (stub *Stub) disconnect() {
+	if stub.client == nil {
+		return
+	}
+	stub.client.conn.Close()
+	for _, id := range stub.client.breakpoints {
+		stub.debugger.RemoveBreakpoint(id)
+	}
+	stub.client = nil
+	stub.waitingStop = false
+	stub.debugger.Continue()
+	log.Println("GDB client disconnected")
+}
+
+func (stub *Stub) send(data string) {
+	if err := writePacket(stub.client.conn, data); err != nil {
+		stub.client.conn.Close()
+	}
+}
+
+// returns the reply to the packet, and false when the reply is sent later, as for continue
+func (stub *Stub) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", true
+	}
+	registers := cpu.GetCpu()
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return stub.stopReply(), true
+	case 'g':
+		return fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x", registers.Acc, registers.Xidx, registers.Yidx,
+			registers.Psts, registers.Sptr, uint8(registers.Pc), uint8(registers.Pc>>8)), true
+	case 'G':
+		values, err := hex.DecodeString(args)
+		if err != nil || len(values) != 7 {
+			return errorReply(1), true
+		}
+		registers.Acc, registers.Xidx, registers.Yidx = values[0], values[1], values[2]
+		registers.Psts, registers.Sptr = values[3], values[4]
+		registers.Pc = uint16(values[5]) | uint16(values[6])<<8
+		return "OK", true
+	case 'p':
+		number, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || number >= registerCount {
+			return errorReply(1), true
+		}
+		return readRegister(int(number)), true
+	case 'P':
+		numberText, valueText, _ := strings.Cut(args, "=")
+		number, err := strconv.ParseUint(numberText, 16, 8)
+		if err != nil || number >= registerCount {
+			return errorReply(1), true
+		}
+		value, err := hex.DecodeString(valueText)
+		if err != nil || len(value) == 0 {
+			return errorReply(1), true
+		}
+		writeRegister(int(number), value)
+		return "OK", true
+	case 'm':
+		addr, length, err := parseAddressLength(args)
+		if err != nil {
+			return errorReply(1), true
+		}
+		values := make([]byte, length)
+		for i := range values {
+			values[i] = cpu.PeekMemory(addr + uint16(i))
+		}
+		return hex.EncodeToString(values), true
+	case 'M':
+		location, data, _ := strings.Cut(args, ":")
+		addr, length, err := parseAddressLength(location)
+		if err != nil {
+			return errorReply(1), true
+		}
+		values, err := hex.DecodeString(data)
+		if err != nil || len(values) != length {
+			return errorReply(1), true
+		}
+		// only the ram and the cartridge ram are written, a write to the
+		// registers or the mapper would change the state of the console
+		for i, value := range values {
+			cpu.PokeMemory(addr+uint16(i), value)
+		}
+		return "OK", true
+	case 'Z', 'z':
+		return stub.setBreakpoint(packet[0] == 'Z', args), true
+	case 'c':
+		if args != "" {
+			if !setPc(args) {
+				return errorReply(1), true
+			}
+		}
+		stub.resume(stub.debugger.Continue)
+		return "", false
+	case 's':
+		if args != "" {
+			if !setPc(args) {
+				return errorReply(1), true
+			}
+		}
+		stub.resume(stub.debugger.StepInto)
+		return "", false
+	case 'D':
+		stub.send("OK")
+		stub.disconnect()
+		return "", false
+	case 'k':
+		stub.disconnect()
+		return "", false
+	case 'H', 'T':
+		// there is a single thread
+		return "OK", true
+	case 'q':
+		return stub.query(args), true
+	case 'Q':
+		if args == "StartNoAckMode" {
+			stub.send("OK")
+			stub.client.noAck = true
+			return "", false
+		}
+	}
+	// the empty reply tells the packet is not supported
+	return "", true
+}
+
+// runs the emulation, the stop reply is sent when it breaks
+func (stub *Stub) resume(run func()) {
+	run()
+	stub.waitingStop = true
+	stub.interrupted = false
+}
+
+func (stub *Stub) query(query string) string {
+	switch {
+	case strings.HasPrefix(query, "Supported"):
+		return "PacketSize=4000;QStartNoAckMode+;swbreak+;hwbreak+"
+	case query == "Attached":
+		return "1"
+	case query == "C":
+		return "QC1"
+	case query == "fThreadInfo":
+		return "m1"
+	case query == "sThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// adds or removes a breakpoint or watchpoint, as in Z0,c004,1
+func (stub *Stub) setBreakpoint(add bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 {
+		return errorReply(1)
+	}
+	var kind int
+	switch fields[0] {
+	case "0", "1":
+		kind = debugger.BreakExecute
+	case "2":
+		kind = debugger.BreakWrite
+	case "3":
+		kind = debugger.BreakRead
+	case "4":
+		kind = debugger.BreakRead | debugger.BreakWrite
+	default:
+		return ""
+	}
+	addr, length, err := parseAddressLength(fields[1] + "," + fields[2])
+	if err != nil {
+		return errorReply(1)
+	}
+	if kind == debugger.BreakExecute {
+		// the length of a software breakpoint is the size of the instruction
+		length = 1
+	}
+
+	key := strings.Join(fields[:3], ",")
+	if !add {
+		if id, found := stub.client.breakpoints[key]; found {
+			stub.debugger.RemoveBreakpoint(id)
+			delete(stub.client.breakpoints, key)
+		}
+		return "OK"
+	}
+	if _, found := stub.client.breakpoints[key]; found {
+		return "OK"
+	}
+	breakpoint := stub.debugger.AddBreakpoint(debugger.Breakpoint{
+		Kind:  kind,
+		Space: debugger.SpaceCpu,
+		Start: addr,
+		End:   addr + uint16(length-1),
+	})
+	stub.client.breakpoints[key] = breakpoint.Id
+	return "OK"
+}
+
+// returns the stop reply of the last break, watchpoints tell the address they stopped on
+func (stub *Stub) stopReply() string {
+	stop := stub.debugger.LastBreak()
+	if stop.Breakpoint == nil {
+		if stub.interrupted && stop.Reason == debugger.ReasonPause {
+			return fmt.Sprintf("S%02x", signalInterrupt)
+		}
+		return fmt.Sprintf("S%02x", signalTrap)
+	}
+	switch stop.Breakpoint.Kind {
+	case debugger.BreakExecute:
+		return fmt.Sprintf("T%02xswbreak:;", signalTrap)
+	case debugger.BreakWrite:
+		return fmt.Sprintf("T%02xwatch:%04x;", signalTrap, stop.Addr)
+	case debugger.BreakRead:
+		return fmt.Sprintf("T%02xrwatch:%04x;", signalTrap, stop.Addr)
+	}
+	return fmt.Sprintf("T%02xawatch:%04x;", signalTrap, stop.Addr)
+}
+
+func readRegister(number int) string {
+	registers := cpu.GetCpu()
+	switch number {
+	case registerA:
+		return fmt.Sprintf("%02x", registers.Acc)
+	case registerX:
+		return fmt.Sprintf("%02x", registers.Xidx)
+	case registerY:
+		return fmt.Sprintf("%02x", registers.Yidx)
+	case registerP:
+		return fmt.Sprintf("%02x", registers.Psts)
+	case registerSp:
+		return fmt.Sprintf("%02x", registers.Sptr)
+	}
+	return fmt.Sprintf("%02x%02x", uint8(registers.Pc), uint8(registers.Pc>>8))
+}
+
+// writes the register with the little endian value
+func writeRegister(number int, value []byte) {
+	registers := cpu.GetCpu()
+	switch number {
+	case registerA:
+		registers.Acc = value[0]
+	case registerX:
+		registers.Xidx = value[0]
+	case registerY:
+		registers.Yidx = value[0]
+	case registerP:
+		registers.Psts = value[0]
+	case registerSp:
+		registers.Sptr = value[0]
+	case registerPc:
+		registers.Pc = uint16(value[0])
+		if len(value) > 1 {
+			registers.Pc |= uint16(value[1]) << 8
+		}
+	}
+}
+
+// moves the pc to the hex address of a continue or step packet
+func setPc(text string) bool {
+	addr, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return false
+	}
+	cpu.GetCpu().Pc = uint16(addr)
+	return true
+}
+
+// parses the addr,length of the memory packets
+func parseAddressLength(text string) (uint16, int, error) {
+	addrText, lengthText, found := strings.Cut(text, ",")
+	if !found {
+		return 0, 0, ErrPacket
+	}
+	addr, err := strconv.ParseUint(addrText, 16, 16)
+	if err != nil {
+		return 0, 0, ErrPacket
+	}
+	length, err := strconv.ParseUint(lengthText, 16, 16)
+	if err != nil || length == 0 {
+		return 0, 0, ErrPacket
+	}
+	return uint16(addr), int(length), nil
+}
+
+func errorReply(code int) string {
+	return fmt.Sprintf("E%02x", code)
+}
@@ -0,0 +1,189 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/debugger"
+)
+
+// a 16KB rom at $C000 that counts X up and stores it at $10
+//
+//	C000  LDX #$00
+//	C002  INX
+//	C003  STX $10
+//	C005  JMP $C002
+func testRom() *cartridge.Cartridge {
+	prg := make([]uint8, 0x4000)
+	copy(prg, []uint8{0xA2, 0x00, 0xE8, 0x86, 0x10, 0x4C, 0x02, 0xC0, 0x40})
+	// the nmi and irq handlers are the RTI at $C008, the reset starts at $C000
+	copy(prg[0x3FFA:], []uint8{0x08, 0xC0, 0x00, 0xC0, 0x08, 0xC0})
+	return &cartridge.Cartridge{
+		PrgRom:        prg,
+		PrgRomSize:    uint(len(prg)),
+		ChrRom:        make([]uint8, 0x2000),
+		ChrRomSize:    0x2000,
+		SRam:          make([]uint8, 0x2000),
+		MirroringType: cartridge.HorizontalMirroring,
+	}
+}
+
+// a minimal rsp client, as gdb would drive the stub
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// sends the packet and returns the reply
+func (client *testClient) exchange(packet string) string {
+	client.t.Helper()
+	if err := writePacket(client.conn, packet); err != nil {
+		client.t.Fatal(err)
+	}
+	return client.reply()
+}
+
+func (client *testClient) reply() string {
+	client.t.Helper()
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readPacket(client.reader)
+	if err != nil {
+		client.t.Fatal("reading the reply:", err)
+	}
+	client.conn.Write([]byte{ack})
+	return reply
+}
+
+func (client *testClient) expect(packet string, want string) {
+	client.t.Helper()
+	if reply := client.exchange(packet); reply != want {
+		client.t.Fatalf("%s replied %q, want %q", packet, reply, want)
+	}
+}
+
+func TestStepThroughRom(t *testing.T) {
+	console.LoadCartridge(testRom())
+	debugger := debugger.New(io.Discard)
+	debugger.Attach()
+	defer debugger.Detach()
+	stub, err := Listen("127.0.0.1:0", debugger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stub.Close()
+
+	// the emulation runs on this goroutine, as in the frontend
+	done := make(chan struct{})
+	emulatorStopped := make(chan struct{})
+	go func() {
+		defer close(emulatorStopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			stub.Update()
+			if debugger.Paused() {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			console.RunFrame(nil)
+		}
+	}()
+	defer func() {
+		close(done)
+		<-emulatorStopped
+	}()
+
+	conn, err := net.Dial("tcp", stub.Addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+	if reply := client.exchange("qSupported:swbreak+"); !strings.Contains(reply, "PacketSize") {
+		t.Fatalf("qSupported replied %q", reply)
+	}
+	client.expect("?", "S05")
+
+	// runs to the STX of the loop
+	client.expect("Z0,c003,1", "OK")
+	client.expect("c", "T05swbreak:;")
+	registers := client.exchange("g")
+	if len(registers) != 14 || registers[10:] != "03c0" {
+		t.Fatalf("registers are %q, want the pc at $C003", registers)
+	}
+	x := registers[2:4]
+	client.expect("z0,c003,1", "OK")
+
+	// steps through the loop
+	client.expect("s", "S05")
+	client.expect("p5", "05c0")
+	client.expect("m10,1", x)
+	client.expect("s", "S05")
+	client.expect("p5", "02c0")
+	client.expect("s", "S05")
+	client.expect("p1", fmt.Sprintf("%02x", hexByte(t, x)+1))
+
+	// writes the registers and the memory
+	client.expect("P0=42", "OK")
+	client.expect("p0", "42")
+	client.expect("M0300,2:beef", "OK")
+	client.expect("m0300,2", "beef")
+
+	// the write of $10 hits the watchpoint
+	client.expect("Z2,10,1", "OK")
+	client.expect("c", "T05watch:0010;")
+	client.expect("z2,10,1", "OK")
+
+	// an interrupt stops the running emulation
+	if err := writePacket(conn, "c"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	conn.Write([]byte{interrupt})
+	if reply := client.reply(); reply != "S02" {
+		t.Fatalf("the interrupt replied %q, want S02", reply)
+	}
+
+	client.expect("D", "OK")
+}
+
+func TestMemoryWriteKeepsMapperBanks(t *testing.T) {
+	// two 16KB banks on UxROM, a write to $8000 would switch to the second
+	rom := testRom()
+	rom.PrgRom = append(make([]uint8, 0x4000), rom.PrgRom...)
+	rom.PrgRomSize = uint(len(rom.PrgRom))
+	rom.MapperType = 2
+	console.LoadCartridge(rom)
+	stub := &Stub{}
+
+	bank := cpu.MainMemory.Mapper.PrgOffset(0x8000)
+	if reply, _ := stub.handle("M8000,1:01"); reply != "OK" {
+		t.Fatalf("M8000,1:01 replied %q", reply)
+	}
+	if offset := cpu.MainMemory.Mapper.PrgOffset(0x8000); offset != bank {
+		t.Errorf("$8000 maps prg $%05X after the write, want $%05X", offset, bank)
+	}
+	if reply, _ := stub.handle("M6000,1:42"); reply != "OK" || rom.SRam[0] != 0x42 {
+		t.Errorf("M6000,1:42 replied %q and wrote %02X, want the cartridge ram written", reply, rom.SRam[0])
+	}
+}
+
+func hexByte(t *testing.T, text string) uint8 {
+	var value uint8
+	if _, err := fmt.Sscanf(text, "%02x", &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
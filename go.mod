@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/ebitengine/oto/v3 v3.3.3
 	github.com/hajimehoshi/ebiten/v2 v2.8.8
+	github.com/yuin/gopher-lua v1.1.1
 )
 
 require (
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"vsasakiv/nesemulator/golden"
+)
+
+// runs the golden subcommand, as in
+//
+//	nesemulator golden -rom game.nes -play run.fm2 -frames 600,1200 -dir goldens
+//	nesemulator golden -suite testFiles/golden/golden.txt
+func runGolden(args []string) {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	romPath := flags.String("rom", "", "path of the .nes rom")
+	playPath := flags.String("play", "", "fm2 movie played, none keeps the controllers released")
+	frames := flags.String("frames", "", "comma separated frames compared with the golden pngs")
+	dir := flags.String("dir", ".", "directory of the golden pngs")
+	suitePath := flags.String("suite", "", "suite file with a rom, movie and frames per line, instead of -rom")
+	diffDir := flags.String("diff", "", "directory the frames and the diffs of the mismatches are written to, -dir by default")
+	update := flags.Bool("update", false, "writes the frames as the new golden pngs")
+	flags.Parse(args)
+
+	var suite []golden.Options
+	switch {
+	case *suitePath != "":
+		var err error
+		if suite, err = golden.ReadSuite(*suitePath); err != nil {
+			log.Fatal("Error reading the suite: ", err)
+		}
+	case *romPath != "":
+		checkpoints, err := golden.ParseCheckpoints(*frames)
+		if err != nil {
+			log.Fatal("Error in -frames: ", err)
+		}
+		suite = []golden.Options{{Rom: *romPath, Movie: *playPath, Checkpoints: checkpoints, Dir: *dir}}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	mismatches := 0
+	for _, options := range suite {
+		options.DiffDir = *diffDir
+		options.Update = *update
+		results, err := golden.Run(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, result := range results {
+			fmt.Printf("%-8s %s %s\n", result.Outcome, result.Golden, result.Hash)
+			switch result.Outcome {
+			case golden.Mismatch:
+				fmt.Printf("         %d pixels differ, diff in %s\n", result.Pixels, result.Diff)
+				mismatches++
+			case golden.Missing:
+				fmt.Println("         no golden png, -update writes it")
+				mismatches++
+			}
+		}
+	}
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,209 @@
+package golden
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/movie"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// outcome of a checkpoint
+const (
+	Match    = "match"
+	Mismatch = "MISMATCH"
+	// Update was set and the golden frame was written
+	Written = "written"
+	// the golden frame doesn't exist, it is only written with Update
+	Missing = "MISSING"
+)
+
+var ErrNoCheckpoints = errors.New("golden: no checkpoints")
+
+type Options struct {
+	Rom string
+	// fm2 movie played from power on or from its save state, without a movie
+	// the controllers stay released
+	Movie string
+	// frames where the screen is compared, counted from the start of the movie
+	Checkpoints []uint
+	// directory of the golden pngs, named after the movie, or the rom when
+	// there is none, and the frame
+	Dir string
+	// directory the frames and the diffs of the mismatches are written to, Dir
+	// when empty
+	DiffDir string
+	// writes the frames as the new golden ones instead of comparing them
+	Update bool
+}
+
+// Result of a checkpoint
+type Result struct {
+	Frame   uint
+	Outcome string
+	// sha1 of the rgb pixels of the frame, as console.FrameHash
+	Hash   string
+	Golden string
+	// pixels that differ from the golden frame, and the pngs written for them
+	Pixels int
+	Got    string
+	Diff   string
+}
+
+// Run plays the movie on the rom up to the last checkpoint and compares the
+// frame at each checkpoint with its golden png
+func Run(options Options) ([]Result, error) {
+	if len(options.Checkpoints) == 0 {
+		return nil, ErrNoCheckpoints
+	}
+	checkpoints := slices.Clone(options.Checkpoints)
+	slices.Sort(checkpoints)
+	diffDir := options.DiffDir
+	if diffDir == "" {
+		diffDir = options.Dir
+	}
+
+	if err := console.LoadRom(options.Rom); err != nil {
+		return nil, err
+	}
+	var session *movie.Session
+	if options.Movie != "" {
+		fm2, err := movie.Load(options.Movie)
+		if err != nil {
+			return nil, err
+		}
+		if session, err = movie.StartPlayback(fm2, true); err != nil {
+			return nil, err
+		}
+	}
+	start := console.Frame()
+	prefix := baseName(options.Rom)
+	if options.Movie != "" {
+		prefix = baseName(options.Movie)
+	}
+
+	var results []Result
+	for _, checkpoint := range checkpoints {
+		for console.Frame()-start < checkpoint {
+			if session != nil {
+				session.Update()
+			}
+			console.RunFrame(nil)
+		}
+		name := fmt.Sprintf("%s-%d", prefix, checkpoint)
+		result, err := check(console.PixelData(), name, options.Dir, diffDir, options.Update)
+		if err != nil {
+			return results, err
+		}
+		result.Frame = checkpoint
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// the file name without its directory and extension
+func baseName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// compares the pixels with the golden png of the name, writing it when it
+// is being updated
+func check(pixels []uint8, name string, dir string, diffDir string, update bool) (Result, error) {
+	hash := sha1.Sum(pixels)
+	result := Result{Hash: hex.EncodeToString(hash[:]), Golden: filepath.Join(dir, name+".png")}
+	if update {
+		result.Outcome = Written
+		return result, writePng(result.Golden, toImage(pixels))
+	}
+	golden, err := readPng(result.Golden)
+	if errors.Is(err, os.ErrNotExist) {
+		result.Outcome = Missing
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	diff, count := compare(golden, pixels)
+	if count == 0 {
+		result.Outcome = Match
+		return result, nil
+	}
+	result.Outcome = Mismatch
+	result.Pixels = count
+	result.Got = filepath.Join(diffDir, name+".got.png")
+	result.Diff = filepath.Join(diffDir, name+".diff.png")
+	if err := writePng(result.Got, toImage(pixels)); err != nil {
+		return result, err
+	}
+	return result, writePng(result.Diff, diff)
+}
+
+// ----- Images -----
+
+// the diff shows the golden frame dimmed, with the differing pixels in red
+func compare(golden image.Image, pixels []uint8) (*image.RGBA, int) {
+	got := toImage(pixels)
+	diff := image.NewRGBA(got.Rect)
+	count := 0
+	for y := range ppu.YSIZE {
+		for x := range ppu.XSIZE {
+			want := color.RGBAModel.Convert(golden.At(x, y)).(color.RGBA)
+			if want != got.RGBAAt(x, y) {
+				diff.SetRGBA(x, y, color.RGBA{0xFF, 0x00, 0x00, 0xFF})
+				count++
+				continue
+			}
+			gray := uint8((uint(want.R) + uint(want.G) + uint(want.B)) / 12)
+			diff.SetRGBA(x, y, color.RGBA{gray, gray, gray, 0xFF})
+		}
+	}
+	return diff, count
+}
+
+// the rgb pixels of a frame as an image
+func toImage(pixels []uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ppu.XSIZE, ppu.YSIZE))
+	for i := range ppu.XSIZE * ppu.YSIZE {
+		copy(img.Pix[i*4:], pixels[i*3:i*3+3])
+		img.Pix[i*4+3] = 0xFF
+	}
+	return img
+}
+
+func readPng(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("golden: %s: %w", path, err)
+	}
+	return img, nil
+}
+
+func writePng(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,111 @@
+package golden
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test ./golden -update writes the frames of the suite as the new golden ones
+var update = flag.Bool("update", false, "write the golden frames")
+
+const (
+	suitePath = "../testFiles/golden/golden.txt"
+	testRom   = "../testFiles/nestest.nes"
+)
+
+// runs the suite, the frames of the mismatches and their diffs are written
+// to a temporary directory kept when the test fails
+func TestSuite(t *testing.T) {
+	suite, err := ReadSuite(suitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffDir, err := os.MkdirTemp("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	for _, options := range suite {
+		options.DiffDir = diffDir
+		options.Update = *update
+		results, err := Run(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			switch result.Outcome {
+			case Mismatch:
+				failed = true
+				t.Errorf("%s: %d pixels differ, see %s and %s", result.Golden, result.Pixels, result.Got, result.Diff)
+			case Missing:
+				failed = true
+				t.Errorf("%s doesn't exist, go test ./golden -update writes it", result.Golden)
+			case Written:
+				t.Logf("wrote %s", result.Golden)
+			}
+		}
+	}
+	if !failed {
+		os.RemoveAll(diffDir)
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	dir := t.TempDir()
+	options := Options{Rom: testRom, Checkpoints: []uint{20, 5}, Dir: dir}
+	results, err := Run(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Frame != 5 || results[0].Outcome != Missing || results[1].Outcome != Missing {
+		t.Fatalf("the first run gave %+v, want the frames 5 and 20 missing", results)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nestest-5.png")); !os.IsNotExist(err) {
+		t.Fatalf("a missing golden frame was written without Update: %v", err)
+	}
+
+	options.Update = true
+	if results, err = Run(options); err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Outcome != Written || results[1].Outcome != Written {
+		t.Fatalf("the update gave %+v, want the frames 5 and 20 written", results)
+	}
+	options.Update = false
+
+	// a pixel of the golden frame 20 is changed
+	golden := filepath.Join(dir, "nestest-20.png")
+	img, err := readPng(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := image.NewRGBA(img.Bounds())
+	draw.Draw(changed, changed.Rect, img, image.Point{}, draw.Src)
+	changed.SetRGBA(10, 10, color.RGBA{0x12, 0x34, 0x56, 0xFF})
+	if err := writePng(golden, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = Run(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Outcome != Match || results[1].Outcome != Mismatch || results[1].Pixels != 1 {
+		t.Fatalf("the second run gave %+v, want the frame 20 with a pixel differing", results)
+	}
+	diff, err := readPng(results[1].Diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if red := color.RGBAModel.Convert(diff.At(10, 10)); red != (color.RGBA{0xFF, 0x00, 0x00, 0xFF}) {
+		t.Errorf("the differing pixel is %v in the diff, want red", red)
+	}
+	if _, err := os.Stat(results[1].Got); err != nil {
+		t.Errorf("the frame was not written: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package golden
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadSuite reads the runs of a suite file, a line for each run with the rom,
+// the movie or - for none and the checkpoints separated by commas, as in
+//
+//	../zelda2.nes zelda2-palace.fm2 600,1200,1800
+//
+// the paths are relative to the file, the golden pngs are in its directory
+// and the lines starting with # are comments
+func ReadSuite(path string) ([]Options, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dir := filepath.Dir(path)
+
+	var suite []Options
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want the rom, the movie and the checkpoints", path, line)
+		}
+		options := Options{Rom: filepath.Join(dir, fields[0]), Dir: dir}
+		if fields[1] != "-" {
+			options.Movie = filepath.Join(dir, fields[1])
+		}
+		if options.Checkpoints, err = ParseCheckpoints(fields[2]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		suite = append(suite, options)
+	}
+	return suite, scanner.Err()
+}
+
+// ParseCheckpoints reads frame numbers separated by commas
+func ParseCheckpoints(text string) ([]uint, error) {
+	var checkpoints []uint
+	for _, field := range strings.Split(text, ",") {
+		frame, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint %q", field)
+		}
+		checkpoints = append(checkpoints, uint(frame))
+	}
+	return checkpoints, nil
+}
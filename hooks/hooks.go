@@ -0,0 +1,61 @@
+package hooks
+
+import "iter"
+
+// no hook is called while suspended, as when the netplay rollback emulates
+// again frames the tools already saw
+var suspended bool
+
+// Suspend stops calling the hooks of every list until resume is called
+func Suspend() (resume func()) {
+	suspended = true
+	return func() {
+		suspended = false
+	}
+}
+
+// List keeps the hooks attached by the tools, as the debugger and the
+// code/data logger, to the events of a component
+type List[T any] struct {
+	// pointers, so the same function attached twice is detached once
+	entries []*T
+}
+
+// Add attaches the hook, the returned function detaches it
+func (list *List[T]) Add(hook T) (remove func()) {
+	entry := &hook
+	list.entries = append(list.entries, entry)
+	return func() {
+		for i, attached := range list.entries {
+			if attached == entry {
+				// copied, so a hook may detach while the hooks are being called
+				list.entries = append(list.entries[:i:i], list.entries[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of attached hooks, the components skip building
+// the events when there are none
+func (list *List[T]) Len() int {
+	if suspended {
+		return 0
+	}
+	return len(list.entries)
+}
+
+// All yields the hooks attached when it is called
+func (list *List[T]) All() iter.Seq[T] {
+	entries := list.entries
+	if suspended {
+		entries = nil
+	}
+	return func(yield func(T) bool) {
+		for _, entry := range entries {
+			if !yield(*entry) {
+				return
+			}
+		}
+	}
+}
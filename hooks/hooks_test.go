@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddAndRemove(t *testing.T) {
+	var list List[func() int]
+	removeFirst := list.Add(func() int { return 1 })
+	list.Add(func() int { return 2 })
+	removeThird := list.Add(func() int { return 3 })
+
+	var called []int
+	for hook := range list.All() {
+		called = append(called, hook())
+		// a hook detached while the hooks are called is still called this time
+		removeThird()
+	}
+	if !slices.Equal(called, []int{1, 2, 3}) {
+		t.Errorf("called %v, want 1, 2 and 3", called)
+	}
+
+	removeFirst()
+	removeFirst()
+	called = nil
+	for hook := range list.All() {
+		called = append(called, hook())
+	}
+	if !slices.Equal(called, []int{2}) || list.Len() != 1 {
+		t.Errorf("called %v after the removals, want 2", called)
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	var list List[func() int]
+	list.Add(func() int { return 1 })
+	resume := Suspend()
+	for range list.All() {
+		t.Error("a hook was called while suspended")
+	}
+	if list.Len() != 0 {
+		t.Errorf("%d hooks while suspended, want none", list.Len())
+	}
+	resume()
+	if list.Len() != 1 {
+		t.Errorf("%d hooks after resuming, want 1", list.Len())
+	}
+}
@@ -0,0 +1,244 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/controller"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// total of controller ports in the console
+const TotalPorts = 2
+
+// default value a stick needs to pass to be considered a dpad press
+const DefaultAxisThreshold = 0.5
+
+// default presses per second of the turbo buttons
+const DefaultTurboRate = 15.0
+
+// names used for the nes buttons in the bindings file, indexed by the controller constants
+var ButtonNames = [8]string{
+	controller.A:      "A",
+	controller.B:      "B",
+	controller.SELECT: "SELECT",
+	controller.START:  "START",
+	controller.UP:     "UP",
+	controller.DOWN:   "DOWN",
+	controller.LEFT:   "LEFT",
+	controller.RIGHT:  "RIGHT",
+}
+
+// names used for the turbo buttons in the bindings file, a held turbo button
+// presses the nes button of the same index in TurboButtons at the turbo rate
+var TurboButtonNames = [2]string{"TURBO_A", "TURBO_B"}
+var TurboButtons = [2]uint{controller.A, controller.B}
+
+// names used for the standard layout gamepad buttons in the bindings file
+var standardButtonNames = map[ebiten.StandardGamepadButton]string{
+	ebiten.StandardGamepadButtonRightBottom:      "RightBottom",
+	ebiten.StandardGamepadButtonRightRight:       "RightRight",
+	ebiten.StandardGamepadButtonRightLeft:        "RightLeft",
+	ebiten.StandardGamepadButtonRightTop:         "RightTop",
+	ebiten.StandardGamepadButtonFrontTopLeft:     "FrontTopLeft",
+	ebiten.StandardGamepadButtonFrontTopRight:    "FrontTopRight",
+	ebiten.StandardGamepadButtonFrontBottomLeft:  "FrontBottomLeft",
+	ebiten.StandardGamepadButtonFrontBottomRight: "FrontBottomRight",
+	ebiten.StandardGamepadButtonCenterLeft:       "CenterLeft",
+	ebiten.StandardGamepadButtonCenterRight:      "CenterRight",
+	ebiten.StandardGamepadButtonLeftStick:        "LeftStick",
+	ebiten.StandardGamepadButtonRightStick:       "RightStick",
+	ebiten.StandardGamepadButtonLeftTop:          "LeftTop",
+	ebiten.StandardGamepadButtonLeftBottom:       "LeftBottom",
+	ebiten.StandardGamepadButtonLeftLeft:         "LeftLeft",
+	ebiten.StandardGamepadButtonLeftRight:        "LeftRight",
+	ebiten.StandardGamepadButtonCenterCenter:     "CenterCenter",
+}
+
+// prefix used for buttons of gamepads without a standard layout, as in "Button3"
+const rawButtonPrefix = "Button"
+
+// GamepadButton is a button of a gamepad, either from the standard layout or,
+// for gamepads the standard layout does not know, a raw button index
+type GamepadButton struct {
+	Standard ebiten.StandardGamepadButton
+	Raw      ebiten.GamepadButton
+	IsRaw    bool
+}
+
+func (button GamepadButton) String() string {
+	if button.IsRaw {
+		return rawButtonPrefix + strconv.Itoa(int(button.Raw))
+	}
+	return standardButtonNames[button.Standard]
+}
+
+func (button GamepadButton) MarshalText() ([]byte, error) {
+	return []byte(button.String()), nil
+}
+
+func (button *GamepadButton) UnmarshalText(text []byte) error {
+	name := string(text)
+	if strings.HasPrefix(name, rawButtonPrefix) {
+		idx, err := strconv.Atoi(strings.TrimPrefix(name, rawButtonPrefix))
+		if err != nil || idx < 0 {
+			return fmt.Errorf("input: invalid raw gamepad button: %s", name)
+		}
+		*button = GamepadButton{Raw: ebiten.GamepadButton(idx), IsRaw: true}
+		return nil
+	}
+	for standard, standardName := range standardButtonNames {
+		if standardName == name {
+			*button = GamepadButton{Standard: standard}
+			return nil
+		}
+	}
+	return fmt.Errorf("input: unknown gamepad button: %s", name)
+}
+
+// PortBindings holds how the keyboard and the gamepad map to a controller port,
+// keyed by the nes button names
+type PortBindings struct {
+	Keyboard map[string]ebiten.Key    `json:"keyboard"`
+	Gamepad  map[string]GamepadButton `json:"gamepad"`
+	// stick deflection, from 0 to 1, needed to press the dpad
+	AxisThreshold float64 `json:"axisThreshold"`
+	// presses per second of the turbo buttons
+	TurboRate float64 `json:"turboRate"`
+}
+
+// MacroBinding plays the macro saved in Path on a controller port when Key is
+// pressed, holding shift while pressing Key records the macro instead
+type MacroBinding struct {
+	Key ebiten.Key `json:"key"`
+	// controller port, starting at 1
+	Port int    `json:"port"`
+	Path string `json:"path"`
+}
+
+type Bindings struct {
+	Ports  [TotalPorts]PortBindings `json:"ports"`
+	Macros []MacroBinding           `json:"macros"`
+}
+
+// returns the bindings used when there is no bindings file, the keyboard
+// layout is the one the emulator always had for the first controller
+func DefaultBindings() *Bindings {
+	var bindings Bindings
+	for i := range bindings.Ports {
+		bindings.Ports[i] = PortBindings{
+			Keyboard:      map[string]ebiten.Key{},
+			Gamepad:       defaultGamepadBindings(),
+			AxisThreshold: DefaultAxisThreshold,
+			TurboRate:     DefaultTurboRate,
+		}
+	}
+	bindings.Ports[0].Keyboard = map[string]ebiten.Key{
+		ButtonNames[controller.UP]:     ebiten.KeyW,
+		ButtonNames[controller.LEFT]:   ebiten.KeyA,
+		ButtonNames[controller.DOWN]:   ebiten.KeyS,
+		ButtonNames[controller.RIGHT]:  ebiten.KeyD,
+		ButtonNames[controller.A]:      ebiten.KeyJ,
+		ButtonNames[controller.B]:      ebiten.KeyK,
+		ButtonNames[controller.START]:  ebiten.KeySpace,
+		ButtonNames[controller.SELECT]: ebiten.KeyZ,
+		TurboButtonNames[0]:            ebiten.KeyU,
+		TurboButtonNames[1]:            ebiten.KeyI,
+	}
+	return &bindings
+}
+
+// standard layout, bottom face button is A and left face button is B
+func defaultGamepadBindings() map[string]GamepadButton {
+	return map[string]GamepadButton{
+		ButtonNames[controller.UP]:     {Standard: ebiten.StandardGamepadButtonLeftTop},
+		ButtonNames[controller.DOWN]:   {Standard: ebiten.StandardGamepadButtonLeftBottom},
+		ButtonNames[controller.LEFT]:   {Standard: ebiten.StandardGamepadButtonLeftLeft},
+		ButtonNames[controller.RIGHT]:  {Standard: ebiten.StandardGamepadButtonLeftRight},
+		ButtonNames[controller.A]:      {Standard: ebiten.StandardGamepadButtonRightBottom},
+		ButtonNames[controller.B]:      {Standard: ebiten.StandardGamepadButtonRightLeft},
+		ButtonNames[controller.START]:  {Standard: ebiten.StandardGamepadButtonCenterRight},
+		ButtonNames[controller.SELECT]: {Standard: ebiten.StandardGamepadButtonCenterLeft},
+		TurboButtonNames[0]:            {Standard: ebiten.StandardGamepadButtonRightRight},
+		TurboButtonNames[1]:            {Standard: ebiten.StandardGamepadButtonRightTop},
+	}
+}
+
+// reads the bindings from a json file, buttons missing from the file are left unbound
+func LoadBindings(path string) (*Bindings, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bindings Bindings
+	if err := json.Unmarshal(content, &bindings); err != nil {
+		return nil, fmt.Errorf("input: invalid bindings file %s: %w", path, err)
+	}
+	for i := range bindings.Ports {
+		port := &bindings.Ports[i]
+		if port.Keyboard == nil {
+			port.Keyboard = map[string]ebiten.Key{}
+		}
+		if port.Gamepad == nil {
+			port.Gamepad = map[string]GamepadButton{}
+		}
+		if port.AxisThreshold <= 0 || port.AxisThreshold > 1 {
+			port.AxisThreshold = DefaultAxisThreshold
+		}
+		if port.TurboRate <= 0 {
+			port.TurboRate = DefaultTurboRate
+		}
+		for name := range port.Keyboard {
+			if !isBindable(name) {
+				return nil, fmt.Errorf("input: unknown nes button %q in %s", name, path)
+			}
+		}
+		for name := range port.Gamepad {
+			if !isBindable(name) {
+				return nil, fmt.Errorf("input: unknown nes button %q in %s", name, path)
+			}
+		}
+	}
+	for _, macro := range bindings.Macros {
+		if macro.Port < 1 || macro.Port > TotalPorts {
+			return nil, fmt.Errorf("input: invalid macro port %d in %s", macro.Port, path)
+		}
+	}
+	return &bindings, nil
+}
+
+// loads the bindings from path, falling back to the default bindings when
+// the file does not exist yet
+func LoadBindingsOrDefault(path string) (*Bindings, error) {
+	bindings, err := LoadBindings(path)
+	if os.IsNotExist(err) {
+		return DefaultBindings(), nil
+	}
+	return bindings, err
+}
+
+func (bindings *Bindings) Save(path string) error {
+	content, err := json.MarshalIndent(bindings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// verifies if name is a nes button or a turbo button
+func isBindable(name string) bool {
+	for _, buttonName := range ButtonNames {
+		if buttonName == name {
+			return true
+		}
+	}
+	for _, turboName := range TurboButtonNames {
+		if turboName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package input
+
+import (
+	"log"
+	"vsasakiv/nesemulator/controller"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Handler reads the keyboard and the connected gamepads every frame and
+// writes the bound buttons to the controllers of each port
+type Handler struct {
+	Bindings *Bindings
+	joyPads  [TotalPorts]*controller.JoyPad
+	// gamepad assigned to each port, in the order they were connected
+	gamepads  [TotalPorts]ebiten.GamepadID
+	connected [TotalPorts]bool
+
+	gamepadIDs []ebiten.GamepadID
+	// emulated frames since the emulator started, turbo buttons are synced to it
+	frame  uint
+	macros []*macroSlot
+}
+
+func NewHandler(bindings *Bindings, joyPad1 *controller.JoyPad, joyPad2 *controller.JoyPad) *Handler {
+	handler := &Handler{
+		Bindings: bindings,
+		joyPads:  [TotalPorts]*controller.JoyPad{joyPad1, joyPad2},
+	}
+	// gamepads connected before the emulator started
+	handler.gamepadIDs = ebiten.AppendGamepadIDs(handler.gamepadIDs[:0])
+	for _, id := range handler.gamepadIDs {
+		handler.assignGamepad(id)
+	}
+	handler.loadMacros()
+	return handler
+}
+
+// Update must be called once per emulated frame, before running the emulation
+func (handler *Handler) Update() {
+	handler.updateGamepads()
+	for port, joyPad := range handler.joyPads {
+		if joyPad == nil {
+			continue
+		}
+		for button := range ButtonNames {
+			joyPad.SetButtonStatus(uint(button), handler.buttonStatus(port, button))
+		}
+	}
+	handler.updateMacros()
+	handler.frame++
+}
+
+// releases every button, used while the emulation is paused
+func (handler *Handler) ReleaseAll() {
+	for _, joyPad := range handler.joyPads {
+		if joyPad == nil {
+			continue
+		}
+		for button := range ButtonNames {
+			joyPad.SetButtonStatus(uint(button), 0)
+		}
+	}
+}
+
+// returns the gamepad assigned to a port, if any
+func (handler *Handler) Gamepad(port int) (ebiten.GamepadID, bool) {
+	return handler.gamepads[port], handler.connected[port]
+}
+
+// ----- Hot plugging -----
+
+func (handler *Handler) updateGamepads() {
+	for port := range handler.gamepads {
+		if handler.connected[port] && inpututil.IsGamepadJustDisconnected(handler.gamepads[port]) {
+			log.Printf("Gamepad %q disconnected from port %d", ebiten.GamepadName(handler.gamepads[port]), port+1)
+			handler.connected[port] = false
+		}
+	}
+	handler.gamepadIDs = inpututil.AppendJustConnectedGamepadIDs(handler.gamepadIDs[:0])
+	for _, id := range handler.gamepadIDs {
+		handler.assignGamepad(id)
+	}
+}
+
+// puts a gamepad on the first free port, extra gamepads are ignored
+func (handler *Handler) assignGamepad(id ebiten.GamepadID) {
+	for port := range handler.gamepads {
+		if handler.connected[port] && handler.gamepads[port] == id {
+			return
+		}
+	}
+	for port := range handler.gamepads {
+		if !handler.connected[port] {
+			handler.gamepads[port] = id
+			handler.connected[port] = true
+			log.Printf("Gamepad %q connected to port %d", ebiten.GamepadName(id), port+1)
+			return
+		}
+	}
+}
+
+// ----- Reading buttons -----
+
+func (handler *Handler) buttonStatus(port int, button int) uint {
+	bindings := &handler.Bindings.Ports[port]
+
+	if handler.isPressed(port, ButtonNames[button]) {
+		return 1
+	}
+	if handler.connected[port] && isStickPressed(handler.gamepads[port], button, bindings.AxisThreshold) {
+		return 1
+	}
+	for i, turboButton := range TurboButtons {
+		if turboButton == uint(button) {
+			turbo := controller.NewTurbo(bindings.TurboRate)
+			return turbo.Apply(handler.isPressed(port, TurboButtonNames[i]), handler.frame)
+		}
+	}
+	return 0
+}
+
+// verifies if the key or the gamepad button bound to name is pressed
+func (handler *Handler) isPressed(port int, name string) bool {
+	bindings := &handler.Bindings.Ports[port]
+	if key, ok := bindings.Keyboard[name]; ok && ebiten.IsKeyPressed(key) {
+		return true
+	}
+	if !handler.connected[port] {
+		return false
+	}
+	gamepadButton, ok := bindings.Gamepad[name]
+	return ok && isGamepadButtonPressed(handler.gamepads[port], gamepadButton)
+}
+
+func isGamepadButtonPressed(id ebiten.GamepadID, button GamepadButton) bool {
+	if button.IsRaw {
+		return ebiten.IsGamepadButtonPressed(id, button.Raw)
+	}
+	if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+		return false
+	}
+	return ebiten.IsStandardGamepadButtonPressed(id, button.Standard)
+}
+
+// the left stick (or the first two axes of non standard gamepads) acts as the dpad
+func isStickPressed(id ebiten.GamepadID, button int, threshold float64) bool {
+	var horizontal, vertical float64
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		horizontal = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+		vertical = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	} else if ebiten.GamepadAxisCount(id) >= 2 {
+		horizontal = ebiten.GamepadAxisValue(id, 0)
+		vertical = ebiten.GamepadAxisValue(id, 1)
+	}
+
+	switch button {
+	case controller.UP:
+		return vertical <= -threshold
+	case controller.DOWN:
+		return vertical >= threshold
+	case controller.LEFT:
+		return horizontal <= -threshold
+	case controller.RIGHT:
+		return horizontal >= threshold
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package input
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"vsasakiv/nesemulator/controller"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// macroSlot holds the state of one macro hotkey
+type macroSlot struct {
+	binding  MacroBinding
+	macro    *controller.Macro
+	player   *controller.MacroPlayer
+	recorder *controller.MacroRecorder
+}
+
+func (handler *Handler) loadMacros() {
+	handler.macros = handler.macros[:0]
+	for _, binding := range handler.Bindings.Macros {
+		slot := &macroSlot{binding: binding}
+		macro, err := controller.LoadMacro(binding.Path)
+		if err == nil {
+			slot.macro = macro
+		} else if !os.IsNotExist(err) {
+			log.Println("Error loading macro:", err)
+		}
+		handler.macros = append(handler.macros, slot)
+	}
+}
+
+// plays, records or stops the macros, called after the live controller state
+// is written so that a playing macro overrides it and a recording macro saves it
+func (handler *Handler) updateMacros() {
+	shift := ebiten.IsKeyPressed(ebiten.KeyShiftLeft) || ebiten.IsKeyPressed(ebiten.KeyShiftRight)
+
+	for _, slot := range handler.macros {
+		joyPad := handler.joyPads[slot.binding.Port-1]
+		if joyPad == nil {
+			continue
+		}
+
+		if inpututil.IsKeyJustPressed(slot.binding.Key) {
+			switch {
+			case slot.recorder != nil:
+				handler.stopRecording(slot)
+			case shift:
+				log.Printf("Recording macro %s on port %d", slot.binding.Path, slot.binding.Port)
+				slot.recorder = controller.NewMacroRecorder(macroName(slot.binding.Path))
+				slot.player = nil
+			// pressing the key again stops the macro, as a looping one never ends
+			case slot.player != nil:
+				slot.player.Stop()
+			case slot.macro != nil:
+				slot.player = controller.NewMacroPlayer(slot.macro)
+			}
+		}
+
+		if slot.player != nil {
+			buttons, ok := slot.player.Next()
+			if ok {
+				joyPad.SetButtons(buttons)
+			} else {
+				slot.player = nil
+			}
+		}
+		if slot.recorder != nil {
+			slot.recorder.Record(joyPad.GetButtons())
+		}
+	}
+}
+
+func (handler *Handler) stopRecording(slot *macroSlot) {
+	macro := slot.recorder.Macro()
+	slot.recorder = nil
+	if err := macro.Save(slot.binding.Path); err != nil {
+		log.Println("Error saving macro:", err)
+		return
+	}
+	slot.macro = macro
+	log.Printf("Saved macro %s with %d frames", slot.binding.Path, macro.Length())
+}
+
+func macroName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
@@ -0,0 +1,240 @@
+package input
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"vsasakiv/nesemulator/controller"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// key that opens and closes the bindings menu
+const MenuKey = ebiten.KeyF1
+
+const (
+	menuBrowsing = iota
+	menuWaitingKey
+	menuWaitingGamepad
+)
+
+// rows of the menu, the bindable buttons followed by the port settings
+var menuRows = append(ButtonNames[:], TurboButtonNames[:]...)
+
+const (
+	stickThresholdRow = iota
+	turboRateRow
+	totalSettingRows
+)
+
+// Menu lets the user rebind the controllers while the emulator is running,
+// the bindings are saved to the bindings file when the menu is closed
+type Menu struct {
+	handler  *Handler
+	path     string
+	open     bool
+	state    int
+	port     int
+	selected int
+	changed  bool
+
+	keys     []ebiten.Key
+	standard []ebiten.StandardGamepadButton
+	raw      []ebiten.GamepadButton
+}
+
+func NewMenu(handler *Handler, path string) *Menu {
+	return &Menu{handler: handler, path: path}
+}
+
+func (menu *Menu) IsOpen() bool {
+	return menu.open
+}
+
+// Update handles the menu keys, it must be called every frame even when the menu is closed
+func (menu *Menu) Update() {
+	if menu.state == menuBrowsing && inpututil.IsKeyJustPressed(MenuKey) {
+		if menu.open {
+			menu.close()
+		} else {
+			menu.open = true
+		}
+		return
+	}
+	if !menu.open {
+		return
+	}
+
+	switch menu.state {
+	case menuBrowsing:
+		menu.browse()
+	case menuWaitingKey:
+		menu.waitKey()
+	case menuWaitingGamepad:
+		menu.waitGamepad()
+	}
+}
+
+func (menu *Menu) close() {
+	menu.open = false
+	if !menu.changed {
+		return
+	}
+	if err := menu.handler.Bindings.Save(menu.path); err != nil {
+		log.Println("Error saving bindings:", err)
+		return
+	}
+	menu.changed = false
+	log.Println("Saved bindings to", menu.path)
+}
+
+func (menu *Menu) browse() {
+	bindings := &menu.handler.Bindings.Ports[menu.port]
+	totalRows := len(menuRows) + totalSettingRows
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		menu.port = (menu.port + 1) % TotalPorts
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowUp):
+		menu.selected = (menu.selected + totalRows - 1) % totalRows
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowDown):
+		menu.selected = (menu.selected + 1) % totalRows
+	case menu.selected >= len(menuRows):
+		menu.adjustSetting(bindings, menu.selected-len(menuRows))
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		menu.state = menuWaitingKey
+	case inpututil.IsKeyJustPressed(ebiten.KeyG):
+		if _, ok := menu.handler.Gamepad(menu.port); ok {
+			menu.state = menuWaitingGamepad
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+		delete(bindings.Keyboard, menuRows[menu.selected])
+		delete(bindings.Gamepad, menuRows[menu.selected])
+		menu.changed = true
+	}
+}
+
+// left and right arrows change the value of the selected setting
+func (menu *Menu) adjustSetting(bindings *PortBindings, setting int) {
+	var direction float64
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft):
+		direction = -1
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowRight):
+		direction = 1
+	default:
+		return
+	}
+
+	switch setting {
+	case stickThresholdRow:
+		bindings.AxisThreshold = min(1, max(0.05, bindings.AxisThreshold+direction*0.05))
+	case turboRateRow:
+		// walk through the rates that divide the frame rate evenly
+		turbo := controller.NewTurbo(bindings.TurboRate)
+		period := controller.FrameRate / turbo.Rate()
+		bindings.TurboRate = controller.FrameRate / min(controller.FrameRate, max(2, period-direction))
+	}
+	menu.changed = true
+}
+
+// binds the next pressed key to the selected button, escape cancels
+func (menu *Menu) waitKey() {
+	menu.keys = inpututil.AppendJustPressedKeys(menu.keys[:0])
+	for _, key := range menu.keys {
+		if key == ebiten.KeyEscape {
+			menu.state = menuBrowsing
+			return
+		}
+		menu.handler.Bindings.Ports[menu.port].Keyboard[menuRows[menu.selected]] = key
+		menu.changed = true
+		menu.state = menuBrowsing
+		return
+	}
+}
+
+// binds the next pressed button of the port's gamepad to the selected button, escape cancels
+func (menu *Menu) waitGamepad() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		menu.state = menuBrowsing
+		return
+	}
+	id, ok := menu.handler.Gamepad(menu.port)
+	if !ok {
+		menu.state = menuBrowsing
+		return
+	}
+
+	var button GamepadButton
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		menu.standard = inpututil.AppendJustPressedStandardGamepadButtons(id, menu.standard[:0])
+		if len(menu.standard) == 0 {
+			return
+		}
+		button = GamepadButton{Standard: menu.standard[0]}
+	} else {
+		menu.raw = inpututil.AppendJustPressedGamepadButtons(id, menu.raw[:0])
+		if len(menu.raw) == 0 {
+			return
+		}
+		button = GamepadButton{Raw: menu.raw[0], IsRaw: true}
+	}
+	menu.handler.Bindings.Ports[menu.port].Gamepad[menuRows[menu.selected]] = button
+	menu.changed = true
+	menu.state = menuBrowsing
+}
+
+// Draw prints the menu over the emulator screen
+func (menu *Menu) Draw(screen *ebiten.Image) {
+	if !menu.open {
+		return
+	}
+	bindings := &menu.handler.Bindings.Ports[menu.port]
+
+	var builder strings.Builder
+	// the whole menu must fit in the 240 lines of the screen
+	fmt.Fprintf(&builder, "PORT %d (TAB) ", menu.port+1)
+	if id, ok := menu.handler.Gamepad(menu.port); ok {
+		fmt.Fprintf(&builder, "PAD: %.16s\n", ebiten.GamepadName(id))
+	} else {
+		builder.WriteString("PAD: none\n")
+	}
+	for i, name := range menuRows {
+		cursor := " "
+		if i == menu.selected {
+			cursor = ">"
+		}
+		key := "-"
+		if k, ok := bindings.Keyboard[name]; ok {
+			key = k.String()
+		}
+		pad := "-"
+		if b, ok := bindings.Gamepad[name]; ok {
+			pad = b.String()
+		}
+		fmt.Fprintf(&builder, "%s%-7s %-9.9s %s\n", cursor, name, key, pad)
+	}
+	settings := [totalSettingRows]string{
+		stickThresholdRow: fmt.Sprintf("STICK THRESHOLD %.2f", bindings.AxisThreshold),
+		turboRateRow:      fmt.Sprintf("TURBO RATE %.1fHZ", bindings.TurboRate),
+	}
+	for i, setting := range settings {
+		cursor := " "
+		if len(menuRows)+i == menu.selected {
+			cursor = ">"
+		}
+		fmt.Fprintf(&builder, "%s%s (<- ->)\n", cursor, setting)
+	}
+
+	switch menu.state {
+	case menuWaitingKey:
+		builder.WriteString("PRESS A KEY (ESC CANCELS)")
+	case menuWaitingGamepad:
+		builder.WriteString("PRESS A PAD BUTTON (ESC CANCELS)")
+	default:
+		builder.WriteString("ENTER KEY G PAD BKSP CLEAR")
+	}
+	ebitenutil.DebugPrint(screen, builder.String())
+}
@@ -2,22 +2,34 @@ package main
 
 import (
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
+	"strings"
 	"time"
-	"vsasakiv/nesemulator/apu"
-	"vsasakiv/nesemulator/cartridge"
-	"vsasakiv/nesemulator/controller"
-	"vsasakiv/nesemulator/cpu"
-	"vsasakiv/nesemulator/mappers"
+	"vsasakiv/nesemulator/cdl"
+	"vsasakiv/nesemulator/cheats"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/debugger"
+	"vsasakiv/nesemulator/gdbstub"
+	"vsasakiv/nesemulator/input"
+	"vsasakiv/nesemulator/memory"
+	"vsasakiv/nesemulator/movie"
+	"vsasakiv/nesemulator/netplay"
 	"vsasakiv/nesemulator/ppu"
+	"vsasakiv/nesemulator/script"
+	"vsasakiv/nesemulator/trace"
+	"vsasakiv/nesemulator/viewer"
 
 	"github.com/ebitengine/oto/v3"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 var running bool
@@ -26,10 +38,17 @@ const cpuClockFrequency float64 = 1789773.00              // 1.789773 Mhz
 const ppuClockFrequency float64 = cpuClockFrequency * 3.0 // ppu frequency is triple of cpu, used as base cycle
 const apuClockFrequency float64 = cpuClockFrequency / 2.0 // apu frequency is half of cpu
 const audioSampleRate float64 = 44100.00                  // standard 44.1Khz sample rate
-const cyclesPerSample = 121.7532
 
-// sampleRate 44100 / 60fps
-const samplesPerFrame = 735
+// file with the keyboard and gamepad bindings of each controller port
+const bindingsPath = "./bindings.json"
+
+// save state and movie hotkeys
+const saveStateKey = ebiten.KeyF5
+const loadStateKey = ebiten.KeyF7
+const readOnlyKey = ebiten.KeyF8
+
+// breaks into the debugger, when it is enabled
+const debugBreakKey = ebiten.KeyF12
 
 const (
 	screenWidth  = 256
@@ -39,16 +58,138 @@ const (
 
 type Game struct {
 	pixels      []byte
+	samples     []float32
 	audioBuffer []byte
 	audioChan   chan []byte
 	screen      *ebiten.Image
 	audioPipe   *io.PipeWriter
+	input       *input.Handler
+	inputMenu   *input.Menu
+	viewer      *viewer.Viewer
+	editor      *viewer.Editor
+	searcher    *viewer.Searcher
+	cheats      *cheats.List
+	cheatList   *viewer.CheatList
+	// lua script running along the game, nil if there is none
+	script  *script.Script
+	overlay *ebiten.Image
+	// movie being recorded or played, nil if there is none
+	movie     *movie.Session
+	moviePath string
+	statePath string
+	// netplay session, nil when playing alone
+	netplay *netplay.Session
+	// nil unless the debugger is enabled
+	debugger *debugger.Debugger
+	terminal *debugger.Terminal
+	gdb      *gdbstub.Stub
+	// the last frame was stopped by the debugger before its end
+	midFrame bool
+	// the cpu is halted by a jam opcode, already reported
+	jammed bool
 }
 
-var JoyPad1 *controller.JoyPad
-var Mapper mappers.Mapper
-
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		runDisasm(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "golden" {
+		runGolden(os.Args[2:])
+		return
+	}
+
+	romPath := flag.String("rom", "./testFiles/zelda2.nes", "path of the .nes rom")
+	playPath := flag.String("play", "", "plays a .fm2 movie")
+	recordPath := flag.String("record", "", "records a .fm2 movie, from power on or from -state")
+	statePath := flag.String("state", "", "save state loaded on start, also used by the save state hotkeys")
+	readWrite := flag.Bool("readwrite", false, "loading a state while playing a movie resumes recording from it")
+	headless := flag.Bool("headless", false, "plays the -play movie without a window and prints the final frame hash")
+	hostAddr := flag.String("host", "", "hosts a netplay session on the address, as in :7777")
+	joinAddr := flag.String("join", "", "joins the netplay session hosted on the address")
+	delay := flag.Uint("delay", netplay.DefaultDelay, "frames of input delay of a hosted netplay session")
+	debug := flag.Bool("debug", false, "enables the debugger, controlled from the terminal")
+	gdbAddr := flag.String("gdb", "", "serves the gdb remote protocol on the address, as in :2345")
+	rollback := flag.Bool("rollback", false, "the hosted netplay session predicts late inputs and rolls back, instead of waiting for them")
+	cdlPath := flag.String("cdl", "", "logs the code and data of the rom to the .cdl file, merged with its previous sessions")
+	tracePath := flag.String("trace", "", "logs every instruction run to the file")
+	traceFormat := flag.String("trace-format", trace.FormatNestest, "format of the trace lines: nestest, fceux or mesen")
+	tracePc := flag.String("trace-pc", "", "traces only the pc in the hex ranges, as in C000-C0FF,E000")
+	traceBanks := flag.String("trace-bank", "", "traces only the code of the 16KB prg banks, as in 0,3")
+	traceAfter := flag.Uint("trace-after", 0, "traces only from the frame on")
+	traceSize := flag.Uint("trace-size", 0, "rotates the trace file when it reaches the size in MB, 0 never rotates")
+	traceFiles := flag.Int("trace-files", trace.DefaultMaxFiles, "rotated trace files kept")
+	cheatsDir := flag.String("cheats", "./cheats", "directory of the cheat files, named by the crc32 of the roms")
+	luaPath := flag.String("lua", "", "runs the lua script along the game, with the FCEUX scripting api")
+	flag.Parse()
+
+	// setup and load cartridge
+	if err := console.LoadRom(*romPath); err != nil {
+		log.Fatal("Error loading the rom: ", err)
+	}
+
+	if *statePath == "" {
+		*statePath = strings.TrimSuffix(*romPath, filepath.Ext(*romPath)) + ".state"
+	} else if err := loadStateFile(*statePath); err != nil {
+		log.Fatal("Error loading save state: ", err)
+	}
+
+	if *cdlPath != "" {
+		logger := cdl.New(console.Cartridge)
+		if err := logger.Load(*cdlPath); err != nil {
+			log.Fatal("Error loading the code/data log: ", err)
+		}
+		logger.Start()
+		defer saveCdl(logger, *cdlPath)
+	}
+
+	if *tracePath != "" {
+		var err error
+		options := trace.Options{
+			Format:   *traceFormat,
+			Filter:   trace.Filter{AfterFrame: *traceAfter},
+			MaxSize:  int64(*traceSize) << 20,
+			MaxFiles: *traceFiles,
+		}
+		if *tracePc != "" {
+			if options.Filter.Ranges, err = trace.ParseRanges(*tracePc); err != nil {
+				log.Fatal("Error in -trace-pc: ", err)
+			}
+		}
+		if *traceBanks != "" {
+			if options.Filter.Banks, err = trace.ParseBanks(*traceBanks); err != nil {
+				log.Fatal("Error in -trace-bank: ", err)
+			}
+		}
+		logger, err := trace.Start(*tracePath, options)
+		if err != nil {
+			log.Fatal("Error starting the trace: ", err)
+		}
+		defer closeTrace(logger)
+	}
+
+	var luaScript *script.Script
+	if *luaPath != "" {
+		var err error
+		luaScript, err = script.Load(*luaPath)
+		if err != nil {
+			log.Fatal("Error loading the lua script: ", err)
+		}
+		defer luaScript.Close()
+	}
+
+	if *headless {
+		switch {
+		case *playPath != "":
+			playHeadless(*playPath, luaScript)
+		case luaScript != nil:
+			runScriptHeadless(luaScript)
+		default:
+			log.Fatal("-headless needs a movie to -play or a -lua script")
+		}
+		return
+	}
+
 	f, _ := os.Create("cpu.prof")
 	pprof.StartCPUProfile(f)
 	defer pprof.StopCPUProfile()
@@ -60,7 +201,7 @@ func main() {
 
 	otoCtx, ready, err := oto.NewContext(op)
 	if err != nil {
-		fmt.Println("Error initializing oto context\n")
+		fmt.Println("Error initializing oto context")
 		return
 	}
 	<-ready
@@ -71,10 +212,14 @@ func main() {
 
 	game := &Game{
 		pixels:      make([]byte, screenWidth*screenHeight*4),
-		audioBuffer: make([]byte, samplesPerFrame*4),
+		samples:     make([]float32, console.SamplesPerFrame),
+		audioBuffer: make([]byte, console.SamplesPerFrame*4),
 		audioChan:   make(chan []byte, 10), // buffer up to 10 frames
 		screen:      ebiten.NewImage(screenWidth, screenHeight),
 		audioPipe:   pipeWriter,
+		statePath:   *statePath,
+		script:      luaScript,
+		overlay:     ebiten.NewImage(screenWidth, screenHeight),
 	}
 
 	silence := make([]byte, 735*2*4) // two frames of 735 samples (4 bytes per sample)
@@ -100,53 +245,163 @@ func main() {
 	ebiten.SetWindowSize(screenWidth*scale, screenHeight*scale)
 	ebiten.SetWindowTitle("My Emulator (debug)")
 
-	// setup and load cartridge
-	nestest := cartridge.ReadFromFile("./testFiles/zelda2.nes")
-	Mapper = mappers.NewMapper(&nestest)
-
-	cpu.LoadCartridge(Mapper)
-	ppu.LoadCartridge(Mapper)
-	apu.GetApu().SetMapper(Mapper)
+	bindings, err := input.LoadBindingsOrDefault(bindingsPath)
+	if err != nil {
+		log.Println("Error loading bindings, using defaults:", err)
+		bindings = input.DefaultBindings()
+	}
+	game.input = input.NewHandler(bindings, console.JoyPad1, console.JoyPad2)
+	game.inputMenu = input.NewMenu(game.input, bindingsPath)
+	game.viewer = viewer.New()
+	game.editor = viewer.NewEditor(strings.TrimSuffix(*romPath, filepath.Ext(*romPath)) + ".watch")
+	game.searcher = viewer.NewSearcher(game.editor)
+	game.cheats, err = cheats.Load(cheats.Path(*cheatsDir, console.Cartridge))
+	if err != nil {
+		log.Fatal("Error loading the cheats: ", err)
+	}
+	game.cheats.Install()
+	game.cheatList = viewer.NewCheatList(game.cheats)
 
-	cpu.GetCpu().Reset()
-	ppu.GetPpu().Reset()
-	apu.GetApu().Reset()
+	if *debug || *gdbAddr != "" {
+		game.debugger = debugger.New(os.Stdout)
+		game.debugger.Attach()
+	}
+	if *debug {
+		game.terminal = debugger.NewTerminal(game.debugger, os.Stdin, os.Stdout)
+	}
+	if *gdbAddr != "" {
+		game.gdb, err = gdbstub.Listen(*gdbAddr, game.debugger)
+		if err != nil {
+			log.Fatal("Error starting the gdb stub: ", err)
+		}
+		defer game.gdb.Close()
+		log.Println("Waiting for gdb on", game.gdb.Addr)
+	}
 
-	JoyPad1 = controller.NewJoypad()
-	cpu.ConnectJoyPad1(JoyPad1)
+	switch {
+	case *hostAddr != "":
+		log.Println("Waiting for a player on", *hostAddr)
+		game.netplay, err = netplay.Host(*hostAddr, netplay.Options{Delay: *delay, Rollback: *rollback})
+		if err != nil {
+			log.Fatal("Error hosting netplay: ", err)
+		}
+	case *joinAddr != "":
+		game.netplay, err = netplay.Join(*joinAddr)
+		if err != nil {
+			log.Fatal("Error joining netplay: ", err)
+		}
+	case *playPath != "":
+		fm2, err := movie.Load(*playPath)
+		if err != nil {
+			log.Fatal("Error loading movie: ", err)
+		}
+		game.movie, err = movie.StartPlayback(fm2, !*readWrite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		game.moviePath = *playPath
+	case *recordPath != "":
+		fm2 := movie.New(filepath.Base(*romPath), console.Cartridge.Checksum())
+		// a state given on the command line was already loaded, the movie starts from it
+		startFromState := isFlagSet("state")
+		game.movie = movie.StartRecording(fm2, startFromState)
+		game.moviePath = *recordPath
+	}
+	if game.netplay != nil {
+		game.netplay.StepFrame = func() { game.stepFrame(nil, false) }
+	}
 
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
-
+	game.saveMovie()
 }
 
-var audioRate float64 = 0
+// emulates the frame with the freezes, the cheats and the lua callbacks, the
+// netplay rollback emulates its frames again through it without drawing them.
+// Returns false when the debugger stopped the frame, the next call resumes it
+func (g *Game) stepFrame(samples []float32, draw bool) bool {
+	if !g.midFrame {
+		memory.ApplyFreezes()
+		g.cheats.Apply()
+	}
+	if !console.RunFrame(samples) {
+		return false
+	}
+	switch {
+	case g.script != nil && draw:
+		g.script.AfterFrame()
+	case g.script != nil:
+		g.script.AfterHiddenFrame()
+	}
+	return true
+}
 
 func (g *Game) Update() error {
 	start := time.Now()
-	handleInput()
-
-	// Emulation step
-	sampleCount := 0
-
-	// sync to audio because it is easier
-	for {
-		tick()
-		if audioRate >= cyclesPerSample {
-			audioRate -= cyclesPerSample
-			sample := apu.GenSample()
-			bs := math.Float32bits(sample)
-			binary.LittleEndian.PutUint32(g.audioBuffer[sampleCount*4:], bs)
-			sampleCount++
-			if sampleCount == samplesPerFrame {
-				break
-			}
+	// the viewers keep following the memory while the emulation is stopped
+	g.viewer.Update()
+	g.editor.Update()
+	g.searcher.Update()
+	g.cheatList.Update()
+	// the window keeps showing the last frame while the debugger is stopped
+	if g.debugger != nil {
+		if g.terminal != nil {
+			g.terminal.Update()
+		}
+		if g.gdb != nil {
+			g.gdb.Update()
+		}
+		if inpututil.IsKeyJustPressed(debugBreakKey) {
+			g.debugger.Pause()
+		}
+		if g.debugger.Paused() {
+			return nil
+		}
+	}
+	// emulation is paused while rebinding the controllers
+	g.inputMenu.Update()
+	if g.inputMenu.IsOpen() {
+		g.input.ReleaseAll()
+		return nil
+	}
+	// the input of a frame stopped by the debugger was already read
+	if !g.midFrame {
+		// the keys type into the memory editor and the search while they are open
+		if g.editor.IsOpen() || g.searcher.IsOpen() || g.cheatList.IsOpen() {
+			g.input.ReleaseAll()
 		} else {
-			audioRate++
+			g.input.Update()
+			g.handleHotkeys()
+		}
+		// the buttons set by the script are recorded in movies, and replaced by the played ones
+		if g.script != nil {
+			g.script.BeforeFrame()
+		}
+		if g.movie != nil {
+			g.movie.Update()
+		}
+		if g.netplay != nil {
+			if err := g.netplay.Update(); err != nil {
+				log.Println("Netplay session ended:", err)
+				g.netplay = nil
+			}
 		}
 	}
 
+	// Emulation step
+	g.midFrame = !g.stepFrame(g.samples, true)
+	if reason := console.JamReason(); reason != "" && !g.jammed {
+		log.Println("CPU halted by", reason)
+	}
+	g.jammed = console.JamReason() != ""
+	if g.midFrame {
+		return nil
+	}
+	for i, sample := range g.samples {
+		binary.LittleEndian.PutUint32(g.audioBuffer[i*4:], math.Float32bits(sample))
+	}
+
 	// Copy buffer before sending (channels hold references)
 	buf := make([]byte, len(g.audioBuffer))
 	copy(buf, g.audioBuffer)
@@ -168,10 +423,44 @@ func (g *Game) Update() error {
 
 func (g *Game) Draw(screen *ebiten.Image) {
 	g.screen.WritePixels(g.pixels)
+	if g.cheatList.IsOpen() {
+		g.cheatList.Draw(screen)
+		return
+	}
+	if g.searcher.IsOpen() {
+		g.searcher.Draw(screen)
+		return
+	}
+	if g.editor.IsOpen() {
+		g.editor.Draw(screen)
+		return
+	}
+	if g.viewer.IsOpen() {
+		g.viewer.Draw(screen)
+		return
+	}
 	screen.DrawImage(g.screen, nil)
+	g.drawOverlay(screen)
+	g.inputMenu.Draw(screen)
+}
+
+// draws what the lua script drew over the frame
+func (g *Game) drawOverlay(screen *ebiten.Image) {
+	if g.script == nil || g.script.Overlay().Empty {
+		return
+	}
+	overlay := g.script.Overlay()
+	g.overlay.WritePixels(overlay.Image.Pix)
+	screen.DrawImage(g.overlay, nil)
+	for _, text := range overlay.Texts {
+		ebitenutil.DebugPrintAt(screen, text.Text, text.X, text.Y)
+	}
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	if g.viewer.IsOpen() || g.editor.IsOpen() || g.searcher.IsOpen() || g.cheatList.IsOpen() {
+		return viewer.Width, viewer.Height
+	}
 	return screenWidth, screenHeight
 }
 
@@ -184,32 +473,142 @@ func convertRGB24ToRGBA(dst []byte, src []byte) {
 	}
 }
 
-func handleInput() {
-	// Directional inputs
-	JoyPad1.SetButtonStatus(controller.LEFT, ifPressed(ebiten.KeyA))
-	JoyPad1.SetButtonStatus(controller.DOWN, ifPressed(ebiten.KeyS))
-	JoyPad1.SetButtonStatus(controller.RIGHT, ifPressed(ebiten.KeyD))
-	JoyPad1.SetButtonStatus(controller.UP, ifPressed(ebiten.KeyW))
+// ----- Save states and movies -----
 
-	// Buttons
-	JoyPad1.SetButtonStatus(controller.A, ifPressed(ebiten.KeyJ))
-	JoyPad1.SetButtonStatus(controller.B, ifPressed(ebiten.KeyK))
-	JoyPad1.SetButtonStatus(controller.START, ifPressed(ebiten.KeySpace))
-	JoyPad1.SetButtonStatus(controller.SELECT, ifPressed(ebiten.KeyZ))
+func (g *Game) handleHotkeys() {
+	switch {
+	case inpututil.IsKeyJustPressed(saveStateKey):
+		if err := os.WriteFile(g.statePath, console.SaveState(), 0644); err != nil {
+			log.Println("Error saving state:", err)
+			return
+		}
+		log.Println("Saved state to", g.statePath)
+	case inpututil.IsKeyJustPressed(loadStateKey):
+		if g.netplay != nil {
+			log.Println("States cannot be loaded during netplay")
+			return
+		}
+		if err := g.loadState(); err != nil {
+			log.Println("Error loading state:", err)
+			return
+		}
+		log.Println("Loaded state from", g.statePath)
+	case inpututil.IsKeyJustPressed(readOnlyKey) && g.movie != nil:
+		g.movie.ReadOnly = !g.movie.ReadOnly
+		log.Println("Movie read only:", g.movie.ReadOnly)
+	}
 }
 
-func ifPressed(key ebiten.Key) uint {
-	if ebiten.IsKeyPressed(key) {
-		return 1
+// loads the state file, going through the movie so it can be rerecorded
+func (g *Game) loadState() error {
+	if g.movie == nil {
+		return loadStateFile(g.statePath)
 	}
-	return 0
+	state, err := os.ReadFile(g.statePath)
+	if err != nil {
+		return err
+	}
+	return g.movie.LoadState(state)
+}
+
+// saves the movie if anything was recorded into it
+func (g *Game) saveMovie() {
+	if g.movie == nil || (g.movie.Mode != movie.Recording && g.movie.Movie.RerecordCount == 0) {
+		return
+	}
+	if err := g.movie.Movie.Save(g.moviePath); err != nil {
+		log.Println("Error saving movie:", err)
+		return
+	}
+	log.Println("Saved movie to", g.moviePath)
 }
 
-// Clock all of the emulator components
-func tick() {
-	cpu.Clock()
-	apu.Clock()
-	ppu.Clock()
-	Mapper.Clock(ppu.GetPpuStatus())
-	// fmt.Println(cpu.GetCpu().TraceStatus())
+func loadStateFile(path string) error {
+	state, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return console.LoadState(state)
+}
+
+// plays a movie as fast as possible, without window or audio, and prints the
+// hash of its last frame so runs can be compared
+func playHeadless(path string, luaScript *script.Script) {
+	fm2, err := movie.Load(path)
+	if err != nil {
+		log.Fatal("Error loading movie: ", err)
+	}
+	if fm2.RomChecksum != console.Cartridge.Checksum() {
+		log.Println("Warning: the movie was recorded with another rom")
+	}
+	session, err := movie.StartPlayback(fm2, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		if luaScript != nil {
+			luaScript.BeforeFrame()
+		}
+		session.Update()
+		if session.Mode == movie.Finished {
+			break
+		}
+		console.RunFrame(nil)
+		if luaScript != nil {
+			luaScript.AfterFrame()
+		}
+	}
+	fmt.Printf("frames: %d\n", session.FrameIndex())
+	fmt.Printf("hash: %s\n", console.FrameHash())
+	printJam()
+}
+
+// runs the lua script as fast as possible, without window or audio, until its
+// main chunk returns, as bots do, and prints the hash of the last frame
+func runScriptHeadless(luaScript *script.Script) {
+	for {
+		luaScript.BeforeFrame()
+		if luaScript.Done() {
+			break
+		}
+		console.RunFrame(nil)
+		luaScript.AfterFrame()
+	}
+	if err := luaScript.Err(); err != nil {
+		log.Fatal("Lua script stopped: ", err)
+	}
+	fmt.Printf("frames: %d\n", console.Frame())
+	fmt.Printf("hash: %s\n", console.FrameHash())
+	printJam()
+}
+
+// tells whether the headless run ended with the cpu halted by a jam opcode
+func printJam() {
+	if reason := console.JamReason(); reason != "" {
+		fmt.Printf("jammed: %s\n", reason)
+	}
+}
+
+func closeTrace(logger *trace.Logger) {
+	if err := logger.Close(); err != nil {
+		log.Println("Error writing the trace:", err)
+	}
+}
+
+func saveCdl(logger *cdl.Logger, path string) {
+	if err := logger.Save(path); err != nil {
+		log.Println("Error saving the code/data log:", err)
+		return
+	}
+	fmt.Println("Code/data log saved,", logger.Stats())
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
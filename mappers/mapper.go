@@ -1,15 +1,27 @@
 package mappers
 
 import (
+	"errors"
+	"fmt"
 	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/savestate"
 )
 
 type Mapper interface {
 	Read(address uint16) uint8
 	Write(address uint16, val uint8)
 	Clock(status Status)
-	PollInterrupt() bool
+	// returns whether the mapper holds the irq line, it stays active until the
+	// game acknowledges it
+	Irq() bool
 	Mirroring() string
+	// saves or loads the mapper registers, the cartridge memory is saved by the cartridge
+	Serialize(stream *savestate.Stream)
+	// returns the offset in the prg rom mapped at the cpu address, -1 when it is not rom
+	PrgOffset(address uint16) int
+	// returns the offset in the chr rom or ram mapped at the ppu address, -1 when
+	// the cartridge has neither
+	ChrOffset(address uint16) int
 }
 
 type Status struct {
@@ -19,16 +31,52 @@ type Status struct {
 	PpuSpriteEnabled     bool
 }
 
-func NewMapper(cartridge *cartridge.Cartridge) Mapper {
+var ErrUnsupported = errors.New("mappers: unsupported mapper")
+
+func NewMapper(cartridge *cartridge.Cartridge) (Mapper, error) {
 	switch cartridge.MapperType {
 	case 0:
-		return NewMapper2(cartridge)
+		return NewMapper2(cartridge), nil
 	case 1:
-		return NewMapper1(cartridge)
+		return NewMapper1(cartridge), nil
 	case 2:
-		return NewMapper2(cartridge)
+		return NewMapper2(cartridge), nil
 	case 4:
-		return NewMapper4(cartridge)
+		return NewMapper4(cartridge), nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnsupported, cartridge.MapperType)
+}
+
+// ----- Bounds -----
+
+// the banks past the end of a memory mirror its start, as the address lines
+// the board doesn't connect, an empty memory reads as 0 and ignores writes
+func readMemory(memory []uint8, offset uint) uint8 {
+	if len(memory) == 0 {
+		return 0
+	}
+	return memory[offset%uint(len(memory))]
+}
+
+func writeMemory(memory []uint8, offset uint, val uint8) {
+	if len(memory) == 0 {
+		return
+	}
+	memory[offset%uint(len(memory))] = val
+}
+
+// the offset in the memory the bank offset mirrors to, -1 for an empty memory
+func wrapOffset(memory []uint8, offset uint) int {
+	if len(memory) == 0 {
+		return -1
+	}
+	return int(offset % uint(len(memory)))
+}
+
+// the chr ram of the boards that have it, otherwise the chr rom
+func chrMemory(cartridge *cartridge.Cartridge) []uint8 {
+	if cartridge.ChrRamSize > 0 {
+		return cartridge.ChrRam
 	}
-	return nil
+	return cartridge.ChrRom
 }
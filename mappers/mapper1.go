@@ -3,6 +3,7 @@ package mappers
 import (
 	"fmt"
 	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/savestate"
 )
 
 const MIRRORING = "MIRRORING"
@@ -25,139 +26,84 @@ func NewMapper1(cartridge *cartridge.Cartridge) Mapper {
 	mapper := Mapper1{}
 	mapper.loadRegister = 0x10
 	mapper.cartridge = cartridge
-	mapper.totalPrgBanks = cartridge.PrgRomSize / 0x4000
+	mapper.totalPrgBanks = max(cartridge.PrgRomSize/0x4000, 1)
 	mapper.control = 0b01100
 	return &mapper
 }
 
 func (mapper *Mapper1) Read(address uint16) uint8 {
 	switch {
+	case address <= 0x1FFF:
+		return readMemory(chrMemory(mapper.cartridge), mapper.getChrAddress(address))
 
-	case address <= 0x0FFF:
-		// 8kb bank
-		if mapper.getControlRegister(CHR_ROM_MODE) == 0 {
-			bank := uint(mapper.chrBank0 & 0x1E)
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				return mapper.cartridge.ChrRam[address]
-			}
-			return mapper.cartridge.ChrRom[address]
-		} else
-		// 4kb bank each
-		if mapper.getControlRegister(CHR_ROM_MODE) == 1 {
-			bank := uint(mapper.chrBank0 & 0x1F)
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				return mapper.cartridge.ChrRam[address]
-			}
-			return mapper.cartridge.ChrRom[address]
-		}
+	case address >= 0x6000 && address <= 0x7FFF:
+		return readMemory(mapper.cartridge.SRam, uint(address-0x6000))
 
-	case address >= 0x1000 && address <= 0x1FFF:
-		// 8kb bank
-		if mapper.getControlRegister(CHR_ROM_MODE) == 0 {
-			bank := uint(mapper.chrBank0 & 0x1E)
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				return mapper.cartridge.ChrRam[address]
-			}
-			return mapper.cartridge.ChrRom[address]
-		} else
-		// 4kb bank each
-		if mapper.getControlRegister(CHR_ROM_MODE) == 1 {
-			bank := uint(mapper.chrBank1 & 0x1F)
-			address := (bank * 0x1000) + uint(address-0x1000)
-			if mapper.cartridge.ChrRamSize > 0 {
-				return mapper.cartridge.ChrRam[address]
-			}
-			return mapper.cartridge.ChrRom[address]
-		}
+	case address >= 0x8000:
+		return readMemory(mapper.cartridge.PrgRom, mapper.getPrgAddress(address))
+	}
+	return 0
+}
 
-	case address >= 0x6000 && address <= 0x7FFF:
-		return mapper.cartridge.SRam[address-0x6000]
-
-	case address >= 0x8000 && address <= 0xBFFF:
-		// fixed first 16kb bank at 0x8000
-		if mapper.getControlRegister(PRG_ROM_MODE) == 2 {
-			return mapper.cartridge.PrgRom[address-0x8000]
-		} else
-		// switchable 16kb bank
-		if mapper.getControlRegister(PRG_ROM_MODE) == 3 {
-			bank := uint(mapper.prgBank) & 0x0F
-			return mapper.cartridge.PrgRom[(bank*0x4000)+uint(address-0x8000)]
-		} else
-		// 32kb bank
-		if mapper.getControlRegister(PRG_ROM_MODE) == 0 {
-			bank := uint(mapper.prgBank) & 0x0E
-			return mapper.cartridge.PrgRom[(bank*0x4000)+uint(address-0x8000)]
-		}
-	case address >= 0xC000:
-		// switchable 16kb bank
-		if mapper.getControlRegister(PRG_ROM_MODE) == 2 {
-			bank := uint(mapper.prgBank) & 0x0F
-			return mapper.cartridge.PrgRom[(bank*0x4000)+uint(address-0xC000)]
-		} else
-		// fixed last 16kb bank at 0xC000
-		if mapper.getControlRegister(PRG_ROM_MODE) == 3 {
-			return mapper.cartridge.PrgRom[((mapper.totalPrgBanks-1)*0x4000)+uint(address-0xC000)]
-		} else
-		// 32kb bank
-		if mapper.getControlRegister(PRG_ROM_MODE) == 0 {
-			bank := uint(mapper.prgBank) & 0x0E
-			return mapper.cartridge.PrgRom[(bank*0x4000)+uint(address-0x8000)]
+func (mapper *Mapper1) getChrAddress(address uint16) uint {
+	// 8kb bank
+	if mapper.getControlRegister(CHR_ROM_MODE) == 0 {
+		bank := uint(mapper.chrBank0 & 0x1E)
+		return (bank * 0x1000) + uint(address)
+	}
+	// 4kb bank each
+	if address <= 0x0FFF {
+		bank := uint(mapper.chrBank0 & 0x1F)
+		return (bank * 0x1000) + uint(address)
+	}
+	bank := uint(mapper.chrBank1 & 0x1F)
+	return (bank * 0x1000) + uint(address-0x1000)
+}
+
+func (mapper *Mapper1) getPrgAddress(address uint16) uint {
+	switch mapper.getControlRegister(PRG_ROM_MODE) {
+	// 32kb bank, the modes 0 and 1 ignore the low bit of the bank
+	case 0, 1:
+		bank := uint(mapper.prgBank) & 0x0E
+		return (bank * 0x4000) + uint(address-0x8000)
+	// fixed first 16kb bank at 0x8000, switchable 16kb bank at 0xC000
+	case 2:
+		if address <= 0xBFFF {
+			return uint(address - 0x8000)
 		}
+		bank := uint(mapper.prgBank) & 0x0F
+		return (bank * 0x4000) + uint(address-0xC000)
 	}
-	return 0
+	// switchable 16kb bank at 0x8000, fixed last 16kb bank at 0xC000
+	if address <= 0xBFFF {
+		bank := uint(mapper.prgBank) & 0x0F
+		return (bank * 0x4000) + uint(address-0x8000)
+	}
+	return ((mapper.totalPrgBanks - 1) * 0x4000) + uint(address-0xC000)
+}
+
+func (mapper *Mapper1) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	return wrapOffset(mapper.cartridge.PrgRom, mapper.getPrgAddress(address))
+}
+
+func (mapper *Mapper1) ChrOffset(address uint16) int {
+	return wrapOffset(chrMemory(mapper.cartridge), mapper.getChrAddress(address%0x2000))
 }
 
 func (mapper *Mapper1) Write(address uint16, val uint8) {
 	switch {
-	case address <= 0x0FFF:
-		// 8kb bank
-		if mapper.getControlRegister(CHR_ROM_MODE) == 0 {
-			bank := uint(mapper.chrBank0) & 0x0E
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				mapper.cartridge.ChrRam[address] = val
-			} else {
-				fmt.Printf("Warning: cannot write to address %04x with mapper1 and no CHR-RAM\n", address)
-			}
-		} else
-		// 4kb bank each
-		if mapper.getControlRegister(CHR_ROM_MODE) == 1 {
-			bank := uint(mapper.chrBank0) & 0x0F
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				mapper.cartridge.ChrRam[address] = val
-			} else {
-				fmt.Printf("Warning: cannot write to address %04x with mapper1 and no CHR-RAM\n", address)
-			}
-		}
-
-	case address >= 0x1000 && address <= 0x1FFF:
-		// 8kb bank
-		if mapper.getControlRegister(CHR_ROM_MODE) == 0 {
-			bank := uint(mapper.chrBank0) & 0x0E
-			address := (bank * 0x1000) + uint(address)
-			if mapper.cartridge.ChrRamSize > 0 {
-				mapper.cartridge.ChrRam[address] = val
-			} else {
-				fmt.Printf("Warning: cannot write to address %04x with mapper1 and no CHR-RAM\n", address)
-			}
-		} else
-		// 4kb bank each
-		if mapper.getControlRegister(CHR_ROM_MODE) == 1 {
-			bank := uint(mapper.chrBank1) & 0x0F
-			address := (bank * 0x1000) + uint(address-0x1000)
-			if mapper.cartridge.ChrRamSize > 0 {
-				mapper.cartridge.ChrRam[address] = val
-			} else {
-				fmt.Printf("Warning: cannot write to address %04x with mapper1 and no CHR-RAM\n", address)
-			}
+	case address <= 0x1FFF:
+		if mapper.cartridge.ChrRamSize == 0 {
+			fmt.Printf("Warning: cannot write to address %04x with mapper1 and no CHR-RAM\n", address)
+			return
 		}
+		writeMemory(mapper.cartridge.ChrRam, mapper.getChrAddress(address), val)
 
 	case address >= 0x6000 && address <= 0x7FFF:
-		mapper.cartridge.SRam[address-0x6000] = val
+		writeMemory(mapper.cartridge.SRam, uint(address-0x6000), val)
 
 	case address >= 0x8000:
 		mapper.writeToLoadRegister(address, val)
@@ -182,15 +128,25 @@ func (mapper *Mapper1) Mirroring() string {
 	}
 }
 
+func (mapper *Mapper1) Serialize(stream *savestate.Stream) {
+	stream.Uint8(&mapper.loadRegister)
+	stream.Uint(&mapper.counter)
+	stream.Uint8(&mapper.control)
+	stream.Uint8(&mapper.chrBank0)
+	stream.Uint8(&mapper.chrBank1)
+	stream.Uint8(&mapper.prgBank)
+}
+
 func (mapper *Mapper1) Clock(status Status) {}
-func (mapper *Mapper1) PollInterrupt() bool { return false }
+func (mapper *Mapper1) Irq() bool { return false }
 
 func (mapper *Mapper1) writeToLoadRegister(address uint16, val uint8) {
 	// has msb as 1
 	if val&0x80 == 0x80 {
 		mapper.loadRegister = 0
 		mapper.counter = 0
-		mapper.control |= 0xC0
+		// the reset sets the prg mode 3, which fixes the last bank at $C000
+		mapper.control |= 0x0C
 	} else {
 		mapper.loadRegister = uint8(SetBitToVal(mapper.loadRegister, mapper.counter, val&0b1))
 		mapper.counter += 1
@@ -3,6 +3,7 @@ package mappers
 import (
 	"fmt"
 	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/savestate"
 )
 
 type Mapper2 struct {
@@ -14,7 +15,7 @@ type Mapper2 struct {
 
 func NewMapper2(cartridge *cartridge.Cartridge) Mapper {
 	// each prg rom bank has 16kB
-	totalBanks := int(cartridge.PrgRomSize) / 0x4000
+	totalBanks := max(int(cartridge.PrgRomSize)/0x4000, 1)
 	return &Mapper2{
 		cartridge:  cartridge,
 		totalBanks: totalBanks,
@@ -27,19 +28,11 @@ func (mapper *Mapper2) Read(address uint16) uint8 {
 	switch {
 	// chr rom unchanged in this mapper
 	case address <= 0x1FFF:
-		// is chr ram
-		if mapper.cartridge.ChrRamSize > 0 {
-			return mapper.cartridge.ChrRam[address]
-		}
-		return mapper.cartridge.ChrRom[address]
+		return readMemory(chrMemory(mapper.cartridge), uint(address))
 	case address >= 0x6000 && address <= 0x7FFF:
-		return mapper.cartridge.SRam[address-0x6000]
-	// prg rom switched bank
-	case address >= 0x8000 && address <= 0xBFFF:
-		return mapper.cartridge.PrgRom[(0x4000*mapper.bankSelect)+int(address-0x8000)]
-	// fixed prg rom bank
-	case address >= 0xC000:
-		return mapper.cartridge.PrgRom[(0x4000*mapper.fixedBank)+int(address-0xC000)]
+		return readMemory(mapper.cartridge.SRam, uint(address-0x6000))
+	case address >= 0x8000:
+		return readMemory(mapper.cartridge.PrgRom, mapper.prgAddress(address))
 	default:
 		fmt.Printf("Warning: cannot access address %04x with mapper2\n", address)
 	}
@@ -52,12 +45,12 @@ func (mapper *Mapper2) Write(address uint16, val uint8) {
 	case address <= 0x1FFF:
 		// is chr ram
 		if mapper.cartridge.ChrRamSize > 0 {
-			mapper.cartridge.ChrRam[address] = val
+			writeMemory(mapper.cartridge.ChrRam, uint(address), val)
 			return
 		}
 		fmt.Printf("Warning: cannot write to ROM address %04x with mapper2\n", address)
 	case address >= 0x6000 && address <= 0x7FFF:
-		mapper.cartridge.SRam[address-0x6000] = val
+		writeMemory(mapper.cartridge.SRam, uint(address-0x6000), val)
 	// write to bank select register
 	case address >= 0x8000:
 		mapper.bankSelect = int(val) % mapper.totalBanks
@@ -66,9 +59,34 @@ func (mapper *Mapper2) Write(address uint16, val uint8) {
 	}
 }
 
+func (mapper *Mapper2) prgAddress(address uint16) uint {
+	// prg rom switched bank
+	if address <= 0xBFFF {
+		return uint(0x4000*mapper.bankSelect) + uint(address-0x8000)
+	}
+	// fixed prg rom bank
+	return uint(0x4000*mapper.fixedBank) + uint(address-0xC000)
+}
+
+func (mapper *Mapper2) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	return wrapOffset(mapper.cartridge.PrgRom, mapper.prgAddress(address))
+}
+
+// chr rom unchanged in this mapper
+func (mapper *Mapper2) ChrOffset(address uint16) int {
+	return wrapOffset(chrMemory(mapper.cartridge), uint(address%0x2000))
+}
+
 func (mapper *Mapper2) Mirroring() string {
 	return mapper.cartridge.MirroringType
 }
 
+func (mapper *Mapper2) Serialize(stream *savestate.Stream) {
+	stream.Int(&mapper.bankSelect)
+}
+
 func (mapper *Mapper2) Clock(status Status) {}
-func (mapper *Mapper2) PollInterrupt() bool { return false }
+func (mapper *Mapper2) Irq() bool { return false }
@@ -3,6 +3,7 @@ package mappers
 import (
 	"fmt"
 	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/savestate"
 )
 
 type Mapper4 struct {
@@ -29,7 +30,8 @@ type Mapper4 struct {
 
 func NewMapper4(cartridge *cartridge.Cartridge) Mapper {
 	// each prg rom bank has 8kB
-	totalBanks := int(cartridge.PrgRomSize) / 0x2000
+	// at least the 2 fixed banks
+	totalBanks := max(int(cartridge.PrgRomSize)/0x2000, 2)
 	return &Mapper4{
 		cartridge:  cartridge,
 		totalBanks: totalBanks,
@@ -40,17 +42,12 @@ func NewMapper4(cartridge *cartridge.Cartridge) Mapper {
 func (mapper *Mapper4) Read(address uint16) uint8 {
 	switch {
 	case address <= 0x1FFF:
-		address := mapper.getChrAddress(address)
-		if mapper.cartridge.ChrRamSize > 0 {
-			return mapper.cartridge.ChrRam[address]
-		}
-		return mapper.cartridge.ChrRom[address]
+		return readMemory(chrMemory(mapper.cartridge), mapper.getChrAddress(address))
 
 	case address >= 0x6000 && address <= 0x7FFF:
-		return mapper.cartridge.SRam[address-0x6000]
+		return readMemory(mapper.cartridge.SRam, uint(address-0x6000))
 	case address >= 0x8000:
-		address := mapper.getPrgAddress(address)
-		return mapper.cartridge.PrgRom[address]
+		return readMemory(mapper.cartridge.PrgRom, mapper.getPrgAddress(address))
 	default:
 		fmt.Printf("Warning: cannot access address %04x with mapper3\n", address)
 	}
@@ -60,12 +57,11 @@ func (mapper *Mapper4) Read(address uint16) uint8 {
 func (mapper *Mapper4) Write(address uint16, val uint8) {
 	switch {
 	case address <= 0x1FFF:
-		address := mapper.getChrAddress(address)
 		if mapper.cartridge.ChrRamSize > 0 {
-			mapper.cartridge.ChrRam[address] = val
+			writeMemory(mapper.cartridge.ChrRam, mapper.getChrAddress(address), val)
 		}
 	case address >= 0x6000 && address <= 0x7FFF:
-		mapper.cartridge.SRam[address-0x6000] = val
+		writeMemory(mapper.cartridge.SRam, uint(address-0x6000), val)
 		// write to bank select register
 	case address >= 0x8000 && address <= 0x9FFF:
 		mapper.writeToMemoryMappingRegisters(address, val)
@@ -81,8 +77,10 @@ func (mapper *Mapper4) Write(address uint16, val uint8) {
 			mapper.irqLatch = 0
 		}
 	case address >= 0xE000:
+		// disabling also acknowledges the pending irq
 		if address%2 == 0 {
 			mapper.irqEnabled = false
+			mapper.irqInterrupt = false
 		} else {
 			mapper.irqEnabled = true
 		}
@@ -227,6 +225,17 @@ func (mapper *Mapper4) getPrgAddress(address uint16) uint {
 	}
 }
 
+func (mapper *Mapper4) PrgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	return wrapOffset(mapper.cartridge.PrgRom, mapper.getPrgAddress(address))
+}
+
+func (mapper *Mapper4) ChrOffset(address uint16) int {
+	return wrapOffset(chrMemory(mapper.cartridge), mapper.getChrAddress(address%0x2000))
+}
+
 func (mapper *Mapper4) getRomBankMode() uint8 {
 	return (mapper.bankSelect >> 6) & 0b1
 }
@@ -250,6 +259,23 @@ func (mapper *Mapper4) Mirroring() string {
 	return mapper.cartridge.MirroringType
 }
 
+func (mapper *Mapper4) Serialize(stream *savestate.Stream) {
+	stream.Uint8(&mapper.bankSelect)
+	stream.Uint8(&mapper.chrR0)
+	stream.Uint8(&mapper.chrR1)
+	stream.Uint8(&mapper.chrR2)
+	stream.Uint8(&mapper.chrR3)
+	stream.Uint8(&mapper.chrR4)
+	stream.Uint8(&mapper.chrR5)
+	stream.Uint8(&mapper.prgR6)
+	stream.Uint8(&mapper.prgR7)
+	stream.Uint8(&mapper.mirroring)
+	stream.Bool(&mapper.irqEnabled)
+	stream.Uint8(&mapper.irqLatch)
+	stream.Uint8(&mapper.reload)
+	stream.Bool(&mapper.irqInterrupt)
+}
+
 func (mapper *Mapper4) Clock(status Status) {
 	// tick counter only on cycle 260
 	if status.PpuCycles != 260 {
@@ -274,10 +300,6 @@ func (mapper *Mapper4) Clock(status Status) {
 	}
 }
 
-func (mapper *Mapper4) PollInterrupt() bool {
-	if mapper.irqInterrupt {
-		mapper.irqInterrupt = false
-		return true
-	}
-	return false
+func (mapper *Mapper4) Irq() bool {
+	return mapper.irqInterrupt
 }
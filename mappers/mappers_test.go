@@ -0,0 +1,275 @@
+package mappers
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+	"vsasakiv/nesemulator/cartridge"
+)
+
+// the mapper numbers NewMapper knows
+var supported = []uint8{0, 1, 2, 4}
+
+// a cartridge of the mapper with the sizes in bytes, chr ram when chrSize is 0
+func newCartridge(mapperType uint8, prgSize uint, chrSize uint) *cartridge.Cartridge {
+	chrRamSize := uint(0)
+	if chrSize == 0 {
+		chrRamSize = 0x2000
+	}
+	return &cartridge.Cartridge{
+		PrgRom:        make([]uint8, prgSize),
+		PrgRomSize:    prgSize,
+		ChrRom:        make([]uint8, chrSize),
+		ChrRomSize:    chrSize,
+		ChrRam:        make([]uint8, chrRamSize),
+		ChrRamSize:    chrRamSize,
+		SRam:          make([]uint8, 0x2000),
+		MapperType:    mapperType,
+		MirroringType: cartridge.HorizontalMirroring,
+	}
+}
+
+// plays the operations on the mapper, 3 bytes each, a kind, an address and a
+// value, checking the offsets stay in the memories
+func exercise(t *testing.T, cartridge *cartridge.Cartridge, operations []uint8) {
+	mapper, err := NewMapper(cartridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrSize := len(cartridge.ChrRom) + len(cartridge.ChrRam)
+	for i := 0; i+3 <= len(operations); i += 3 {
+		kind, val := operations[i], operations[i+2]
+		switch kind % 6 {
+		// register writes
+		case 0, 1:
+			mapper.Write(0x8000|uint16(operations[i+1])<<7|uint16(val&0x7F), val)
+		case 2:
+			mapper.Read(0x8000 | uint16(operations[i+1])<<7 | uint16(val))
+		case 3:
+			address := uint16(operations[i+1])<<5 | uint16(val)
+			mapper.Write(address%0x2000, val)
+			mapper.Read(address % 0x2000)
+		case 4:
+			address := 0x6000 | uint16(operations[i+1])<<5 | uint16(val)
+			mapper.Write(address, val)
+			mapper.Read(address)
+		case 5:
+			mapper.Clock(Status{PpuScanlines: uint(operations[i+1]), PpuCycles: 260, PpuBackgroundEnabled: true})
+			mapper.Irq()
+			mapper.Mirroring()
+		}
+		for address := 0x8000; address <= 0xFFFF; address += 0x1000 {
+			if offset := mapper.PrgOffset(uint16(address)); offset < 0 || offset >= len(cartridge.PrgRom) {
+				t.Fatalf("prg offset %X at %04X for %X bytes", offset, address, len(cartridge.PrgRom))
+			}
+		}
+		for address := 0x0000; address <= 0x1FFF; address += 0x0400 {
+			if offset := mapper.ChrOffset(uint16(address)); offset < 0 || offset >= chrSize {
+				t.Fatalf("chr offset %X at %04X for %X bytes", offset, address, chrSize)
+			}
+		}
+	}
+}
+
+// random register writes and accesses never panic, for the sizes the boards
+// have and the ones the bank registers don't fit, as mapper 1 with 8KB of chr
+func TestRandomWrites(t *testing.T) {
+	tests := []struct {
+		mapperType uint8
+		prgSize    uint
+		chrSize    uint
+	}{
+		{0, 0x4000, 0x2000},
+		{0, 0x8000, 0x2000},
+		{1, 0x8000, 0x2000},
+		{1, 0x4000, 0x2000},
+		{1, 0x40000, 0x20000},
+		{1, 0x80000, 0},
+		{1, 0x4000, 0x6000},
+		{2, 0x20000, 0},
+		{2, 0x4000, 0},
+		{2, 0xC000, 0x2000},
+		{4, 0x8000, 0x2000},
+		{4, 0x40000, 0x40000},
+		{4, 0x4000, 0},
+		{4, 0x6000, 0x6000},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		operations := make([]uint8, 3*5000)
+		random.Read(operations)
+		exercise(t, newCartridge(test.mapperType, test.prgSize, test.chrSize), operations)
+	}
+}
+
+type registerWrite struct {
+	address uint16
+	val     uint8
+}
+
+// the 5 writes of a value to a register of mapper 1, a bit at a time
+func serial(address uint16, val uint8) []registerWrite {
+	writes := make([]registerWrite, 5)
+	for i := range writes {
+		writes[i] = registerWrite{address, val >> i & 1}
+	}
+	return writes
+}
+
+func TestBankSwitching(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapperType uint8
+		prgSize    uint
+		chrSize    uint
+		writes     []registerWrite
+		// the rom offsets mapped at the cpu and ppu addresses, and the
+		// mirroring when it is not empty
+		prg       map[uint16]int
+		chr       map[uint16]int
+		mirroring string
+	}{
+		{
+			name: "nrom 16KB mirrors its bank", mapperType: 0, prgSize: 0x4000, chrSize: 0x2000,
+			prg: map[uint16]int{0x8000: 0, 0xC000: 0, 0xFFFF: 0x3FFF},
+			chr: map[uint16]int{0x0000: 0, 0x1FFF: 0x1FFF},
+		},
+		{
+			name: "nrom 32KB", mapperType: 0, prgSize: 0x8000, chrSize: 0x2000,
+			prg: map[uint16]int{0x8000: 0, 0xC000: 0x4000},
+		},
+		{
+			name: "uxrom switches $8000 and fixes the last bank", mapperType: 2, prgSize: 0x20000,
+			writes: []registerWrite{{0x8000, 3}},
+			prg:    map[uint16]int{0x8000: 0xC000, 0xBFFF: 0xFFFF, 0xC000: 0x1C000},
+		},
+		{
+			name: "mmc1 powers on with the last bank fixed", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			prg:       map[uint16]int{0x8000: 0, 0xC000: 0x3C000},
+			mirroring: cartridge.MirroringSingle0,
+		},
+		{
+			name: "mmc1 switching $8000", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes: serial(0xE000, 5),
+			prg:    map[uint16]int{0x8000: 0x14000, 0xC000: 0x3C000},
+		},
+		{
+			name: "mmc1 switching $C000", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes: append(serial(0x8000, 0x08), serial(0xE000, 5)...),
+			prg:    map[uint16]int{0x8000: 0, 0xC000: 0x14000},
+		},
+		{
+			name: "mmc1 switching 32KB ignores the low bit", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes: append(serial(0x8000, 0x00), serial(0xE000, 5)...),
+			prg:    map[uint16]int{0x8000: 0x10000, 0xC000: 0x14000},
+		},
+		{
+			name: "mmc1 reset fixes the last bank", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes: append(serial(0x8000, 0x00), registerWrite{0x8000, 0x80}),
+			prg:    map[uint16]int{0x8000: 0, 0xC000: 0x3C000},
+		},
+		{
+			name: "mmc1 4KB chr banks", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes:    slices.Concat(serial(0x8000, 0x1E), serial(0xA000, 3), serial(0xC000, 7)),
+			chr:       map[uint16]int{0x0000: 0x3000, 0x1000: 0x7000, 0x1FFF: 0x7FFF},
+			mirroring: cartridge.VerticalMirroring,
+		},
+		{
+			name: "mmc1 8KB chr banks ignore the low bit", mapperType: 1, prgSize: 0x40000, chrSize: 0x20000,
+			writes:    slices.Concat(serial(0x8000, 0x0F), serial(0xA000, 3), serial(0xC000, 7)),
+			chr:       map[uint16]int{0x0000: 0x2000, 0x1000: 0x3000},
+			mirroring: cartridge.HorizontalMirroring,
+		},
+		{
+			name: "mmc3 switching $8000 and $A000", mapperType: 4, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []registerWrite{{0x8000, 6}, {0x8001, 3}, {0x8000, 7}, {0x8001, 5}},
+			prg:    map[uint16]int{0x8000: 0x6000, 0xA000: 0xA000, 0xC000: 0x1C000, 0xE000: 0x1E000},
+		},
+		{
+			name: "mmc3 switching $C000", mapperType: 4, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []registerWrite{{0x8000, 6}, {0x8001, 3}, {0x8000, 0x47}, {0x8001, 5}},
+			prg:    map[uint16]int{0x8000: 0x1C000, 0xA000: 0xA000, 0xC000: 0x6000, 0xE000: 0x1E000},
+		},
+		{
+			name: "mmc3 2KB chr banks ignore the low bit", mapperType: 4, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []registerWrite{
+				{0x8000, 0}, {0x8001, 0x11}, {0x8000, 1}, {0x8001, 0x21}, {0x8000, 2}, {0x8001, 0x40},
+				{0x8000, 3}, {0x8001, 0x41}, {0x8000, 4}, {0x8001, 0x42}, {0x8000, 5}, {0x8001, 0x43},
+				{0xA000, 1},
+			},
+			chr: map[uint16]int{
+				0x0000: 0x4000, 0x0400: 0x4400, 0x0800: 0x8000, 0x0C00: 0x8400,
+				0x1000: 0x10000, 0x1400: 0x10400, 0x1800: 0x10800, 0x1C00: 0x10C00,
+			},
+			mirroring: cartridge.HorizontalMirroring,
+		},
+		{
+			name: "mmc3 inverting the chr banks", mapperType: 4, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []registerWrite{
+				{0x8000, 0x80}, {0x8001, 0x11}, {0x8000, 0x81}, {0x8001, 0x21}, {0x8000, 0x82}, {0x8001, 0x40},
+				{0x8000, 0x83}, {0x8001, 0x41}, {0x8000, 0x84}, {0x8001, 0x42}, {0x8000, 0x85}, {0x8001, 0x43},
+				{0xA000, 0},
+			},
+			chr: map[uint16]int{
+				0x0000: 0x10000, 0x0400: 0x10400, 0x0800: 0x10800, 0x0C00: 0x10C00,
+				0x1000: 0x4000, 0x1400: 0x4400, 0x1800: 0x8000, 0x1C00: 0x8400,
+			},
+			mirroring: cartridge.VerticalMirroring,
+		},
+	}
+	for _, test := range tests {
+		mapper, err := NewMapper(newCartridge(test.mapperType, test.prgSize, test.chrSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, write := range test.writes {
+			mapper.Write(write.address, write.val)
+		}
+		for address, want := range test.prg {
+			if offset := mapper.PrgOffset(address); offset != want {
+				t.Errorf("%s maps $%04X to the prg offset %X, want %X", test.name, address, offset, want)
+			}
+		}
+		for address, want := range test.chr {
+			if offset := mapper.ChrOffset(address); offset != want {
+				t.Errorf("%s maps $%04X to the chr offset %X, want %X", test.name, address, offset, want)
+			}
+		}
+		if mirroring := mapper.Mirroring(); test.mirroring != "" && mirroring != test.mirroring {
+			t.Errorf("%s mirrors %s, want %s", test.name, mirroring, test.mirroring)
+		}
+	}
+}
+
+func TestUnsupportedMapper(t *testing.T) {
+	mapper, err := NewMapper(newCartridge(3, 0x8000, 0x2000))
+	if mapper != nil || !errors.Is(err, ErrUnsupported) || err.Error() != "mappers: unsupported mapper 3" {
+		t.Errorf("mapper 3 gave %v and %v, want the unsupported error", mapper, err)
+	}
+}
+
+// the fuzzed bytes give the mapper, the sizes and the operations
+func FuzzMapper(f *testing.F) {
+	f.Add([]uint8{1, 2, 1, 0, 0x80, 0x00, 0, 0x00, 0x1F, 2, 0x00, 0x00})
+	f.Add([]uint8{4, 1, 3, 0, 0x00, 0x07, 1, 0x00, 0xFF, 3, 0x10, 0x00})
+	f.Add([]uint8{2, 3, 0, 0, 0x00, 0x0F, 2, 0x40, 0x00})
+	// CNROM is not supported
+	f.Add([]uint8{3, 1, 1, 0, 0x80, 0x01})
+	f.Fuzz(func(t *testing.T, data []uint8) {
+		if len(data) < 3 {
+			return
+		}
+		// 8KB banks of prg rom, at least one, and of chr rom, chr ram for 0
+		prgSize := uint(data[1]%64+1) * 0x2000
+		chrSize := uint(data[2]%64) * 0x2000
+		cartridge := newCartridge(data[0], prgSize, chrSize)
+		if _, err := NewMapper(cartridge); err != nil {
+			if !errors.Is(err, ErrUnsupported) || slices.Contains(supported, data[0]) {
+				t.Fatalf("mapper %d: %v", data[0], err)
+			}
+			return
+		}
+		exercise(t, cartridge, data[3:])
+	})
+}
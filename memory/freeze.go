@@ -0,0 +1,61 @@
+package memory
+
+// ----- Freezes -----
+
+// Freeze keeps a byte at a value, it is written again every frame
+type Freeze struct {
+	Region *Region
+	Offset int
+	Value  uint8
+}
+
+// frozen bytes, in the order they were frozen
+var freezes []Freeze
+
+// SetFreeze freezes the byte at the value, or changes the value it is frozen at
+func SetFreeze(region *Region, offset int, value uint8) {
+	for i, freeze := range freezes {
+		if freeze.Region == region && freeze.Offset == offset {
+			freezes[i].Value = value
+			region.Write(offset, value)
+			return
+		}
+	}
+	freezes = append(freezes, Freeze{Region: region, Offset: offset, Value: value})
+	region.Write(offset, value)
+}
+
+func Unfreeze(region *Region, offset int) {
+	for i, freeze := range freezes {
+		if freeze.Region == region && freeze.Offset == offset {
+			freezes = append(freezes[:i], freezes[i+1:]...)
+			return
+		}
+	}
+}
+
+// returns the value the byte is frozen at, if it is frozen
+func Frozen(region *Region, offset int) (uint8, bool) {
+	for _, freeze := range freezes {
+		if freeze.Region == region && freeze.Offset == offset {
+			return freeze.Value, true
+		}
+	}
+	return 0, false
+}
+
+func Freezes() []Freeze {
+	return freezes
+}
+
+func ClearFreezes() {
+	freezes = nil
+}
+
+// ApplyFreezes writes the frozen values over what the game wrote, it must be
+// called before every frame
+func ApplyFreezes() {
+	for _, freeze := range freezes {
+		freeze.Region.Write(freeze.Offset, freeze.Value)
+	}
+}
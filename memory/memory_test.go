@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/ppu"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+func TestRegions(t *testing.T) {
+	console.LoadRom(testRom)
+	// nestest has no sram
+	if SRam.Size() != 0 {
+		t.Fatalf("sram has %d bytes", SRam.Size())
+	}
+	SRam.Write(0x01, 0x43)
+	console.Cartridge.SRam = make([]uint8, 0x2000)
+
+	CpuRam.Write(0x10, 0x42)
+	SRam.Write(0x01, 0x43)
+	Vram.Write(0x0005, 0x44)
+	Oam.Write(0x04, 0x45)
+	Palette.Write(0x10, 0x0F)
+
+	if got := cpu.PeekMemory(0x0810); got != 0x42 {
+		t.Errorf("ram mirror reads %02X, want 42", got)
+	}
+	if got := cpu.PeekMemory(0x6001); got != 0x43 {
+		t.Errorf("sram reads %02X, want 43", got)
+	}
+	if got := ppu.PeekMemory(0x2005); got != 0x44 {
+		t.Errorf("vram reads %02X, want 44", got)
+	}
+	if got := ppu.PpuOamRead(0x04); got != 0x45 {
+		t.Errorf("oam reads %02X, want 45", got)
+	}
+	// $3F10 mirrors the backdrop color
+	if got := Palette.Read(0x00); got != 0x0F {
+		t.Errorf("palette backdrop reads %02X, want 0F", got)
+	}
+	if FindRegion("OAM") != Oam || FindRegion("ROM") != nil {
+		t.Errorf("regions found by the wrong names")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	console.LoadRom(testRom)
+	defer ClearFreezes()
+	SetFreeze(CpuRam, 0x20, 0x99)
+	SetFreeze(CpuRam, 0x20, 0x63)
+	if len(Freezes()) != 1 {
+		t.Fatalf("the byte was frozen %d times", len(Freezes()))
+	}
+	CpuRam.Write(0x20, 0x00)
+	ApplyFreezes()
+	if got := CpuRam.Read(0x20); got != 0x63 {
+		t.Errorf("frozen byte reads %02X, want 63", got)
+	}
+	if value, frozen := Frozen(CpuRam, 0x20); !frozen || value != 0x63 {
+		t.Errorf("the byte is not reported frozen at 63")
+	}
+
+	Unfreeze(CpuRam, 0x20)
+	CpuRam.Write(0x20, 0x00)
+	ApplyFreezes()
+	if got := CpuRam.Read(0x20); got != 0x00 {
+		t.Errorf("unfrozen byte was written again")
+	}
+}
+
+func TestWatchFormats(t *testing.T) {
+	console.LoadRom(testRom)
+	CpuRam.Write(0x30, 0x34)
+	CpuRam.Write(0x31, 0x92)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatU8, "52"},
+		{FormatU16, "37428"},
+		{FormatS8, "52"},
+		{FormatS16, "-28108"},
+		{FormatBcd8, "34"},
+		{FormatBcd16, "9234"},
+	}
+	for _, test := range tests {
+		watch := Watch{Region: CpuRam.Name, Offset: 0x30, Format: test.format}
+		if got := watch.Value(); got != test.want {
+			t.Errorf("%s value is %s, want %s", test.format, got, test.want)
+		}
+	}
+	if got := (Watch{Region: CpuRam.Name, Offset: 0x31, Format: FormatS8}).Value(); got != "-110" {
+		t.Errorf("s8 of 92 is %s, want -110", got)
+	}
+	if NextFormat(FormatBcd16) != FormatU8 || NextFormat(FormatU8) != FormatU16 {
+		t.Errorf("formats do not cycle")
+	}
+}
+
+func TestSaveWatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.watch")
+	Watches = []Watch{{Label: "lives", Region: CpuRam.Name, Offset: 0x75A, Format: FormatU8}}
+	if err := SaveWatches(path); err != nil {
+		t.Fatal(err)
+	}
+	Watches = nil
+	if err := LoadWatches(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(Watches) != 1 || Watches[0].Label != "lives" || FindWatch(CpuRam, 0x75A) != 0 {
+		t.Fatalf("loaded watches %+v", Watches)
+	}
+	if err := LoadWatches(filepath.Join(t.TempDir(), "missing.watch")); err != nil || Watches != nil {
+		t.Fatalf("a missing file loaded %+v, %v", Watches, err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	console.LoadRom(testRom)
+	Palette.Write(0x01, 0x2A)
+	var builder strings.Builder
+	if err := Dump(&builder, Palette); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(builder.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("dumped %d lines, want 2", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "3F00: ") || !strings.HasPrefix(lines[0][9:], "2A") || !strings.HasPrefix(lines[1], "3F10: ") {
+		t.Errorf("dump is\n%s", builder.String())
+	}
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// Region is a memory of the console that can be viewed and edited, the
+// accesses go around the hooks so the debugger does not see them
+type Region struct {
+	Name string
+	// address of the first byte, in the cpu, ppu or oam address space
+	Base uint16
+
+	size  int
+	read  func(addr uint16) uint8
+	write func(addr uint16, val uint8)
+}
+
+var (
+	CpuRam = &Region{Name: "RAM", Base: 0x0000, size: 0x0800, read: cpu.PeekMemory, write: cpu.PokeMemory}
+	// the battery or work ram of the cartridge, its size depends on the rom
+	SRam = &Region{Name: "SRAM", Base: 0x6000, read: readSRam, write: writeSRam}
+	// the four nametables, through the mirroring of the cartridge
+	Vram    = &Region{Name: "VRAM", Base: 0x2000, size: 0x1000, read: ppu.PeekMemory, write: ppu.PpuMemWrite}
+	Oam     = &Region{Name: "OAM", Base: 0x00, size: 0x100, read: readOam, write: writeOam}
+	Palette = &Region{Name: "PALETTE", Base: 0x3F00, size: ppu.PaletteRamSize, read: ppu.PeekMemory, write: ppu.PpuMemWrite}
+)
+
+var Regions = []*Region{CpuRam, SRam, Vram, Oam, Palette}
+
+// the sram is accessed directly, the mapper could have it disabled or
+// banked out of $6000
+func readSRam(addr uint16) uint8 {
+	return console.Cartridge.SRam[addr-0x6000]
+}
+
+func writeSRam(addr uint16, val uint8) {
+	console.Cartridge.SRam[addr-0x6000] = val
+}
+
+func readOam(addr uint16) uint8 {
+	return ppu.PpuOamRead(uint8(addr))
+}
+
+func writeOam(addr uint16, val uint8) {
+	ppu.PpuOamWrite(uint8(addr), val)
+}
+
+// returns the region with the name, nil if there is none
+func FindRegion(name string) *Region {
+	for _, region := range Regions {
+		if region.Name == name {
+			return region
+		}
+	}
+	return nil
+}
+
+// returns the number of bytes of the region, 0 when the cartridge does not have it
+func (region *Region) Size() int {
+	if region == SRam {
+		if console.Cartridge == nil {
+			return 0
+		}
+		return len(console.Cartridge.SRam)
+	}
+	return region.size
+}
+
+// reads the byte at the offset from the start of the region
+func (region *Region) Read(offset int) uint8 {
+	if region.Size() == 0 {
+		return 0
+	}
+	return region.read(region.Address(offset))
+}
+
+func (region *Region) Write(offset int, val uint8) {
+	if region.Size() == 0 {
+		return
+	}
+	region.write(region.Address(offset), val)
+}
+
+// returns the address of the byte at the offset, wrapping around the end of the region
+func (region *Region) Address(offset int) uint16 {
+	if size := region.Size(); size > 0 {
+		offset %= size
+	}
+	return region.Base + uint16(offset)
+}
+
+// ----- Dumps -----
+
+const dumpLineSize = 16
+
+// Dump writes the region in hex, 16 bytes a line after their address
+func Dump(writer io.Writer, region *Region) error {
+	buffered := bufio.NewWriter(writer)
+	size := region.Size()
+	for line := 0; line < size; line += dumpLineSize {
+		fmt.Fprintf(buffered, "%04X:", region.Address(line))
+		for offset := line; offset < min(line+dumpLineSize, size); offset++ {
+			fmt.Fprintf(buffered, " %02X", region.Read(offset))
+		}
+		buffered.WriteByte('\n')
+	}
+	return buffered.Flush()
+}
+
+func DumpFile(path string, region *Region) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Dump(file, region); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,122 @@
+package memory
+
+import "vsasakiv/nesemulator/cpu"
+
+// ----- Cheat search -----
+
+// comparisons of the search filters
+const (
+	Equal = iota
+	NotEqual
+	Greater
+	Less
+)
+
+// Result is an address of the ram still matching the search
+type Result struct {
+	Address uint16
+	// value at the last filter, and the current one
+	Previous, Value uint8
+}
+
+// Search finds the ram addresses of a game value by filtering the whole ram,
+// frame after frame, by how the value changed, each filter compares with the
+// ram of the filter before it
+type Search struct {
+	previous   [0x0800]uint8
+	candidates [0x0800]bool
+	count      int
+}
+
+// NewSearch starts a search with a snapshot of the ram, all addresses are candidates
+func NewSearch() *Search {
+	search := &Search{}
+	search.Reset()
+	return search
+}
+
+func (search *Search) Reset() {
+	search.previous = cpu.RamSnapshot()
+	for i := range search.candidates {
+		search.candidates[i] = true
+	}
+	search.count = len(search.candidates)
+}
+
+// keeps the candidates for which keep is true, and takes a new snapshot
+func (search *Search) filter(keep func(previous, value uint8) bool) {
+	ram := cpu.RamSnapshot()
+	search.count = 0
+	for i, candidate := range search.candidates {
+		if candidate && !keep(search.previous[i], ram[i]) {
+			search.candidates[i] = false
+		}
+		if search.candidates[i] {
+			search.count++
+		}
+	}
+	search.previous = ram
+}
+
+func compare(comparison int, a, b uint8) bool {
+	switch comparison {
+	case Equal:
+		return a == b
+	case NotEqual:
+		return a != b
+	case Greater:
+		return a > b
+	case Less:
+		return a < b
+	}
+	return false
+}
+
+// FilterPrevious keeps the addresses whose value compares to their previous
+// value, as Greater for a value that went up
+func (search *Search) FilterPrevious(comparison int) {
+	search.filter(func(previous, value uint8) bool {
+		return compare(comparison, value, previous)
+	})
+}
+
+// FilterValue keeps the addresses whose value compares to the given value
+func (search *Search) FilterValue(comparison int, operand uint8) {
+	search.filter(func(previous, value uint8) bool {
+		return compare(comparison, value, operand)
+	})
+}
+
+// FilterChangedBy keeps the addresses whose value changed by exactly delta,
+// wrapping around as the 8 bit arithmetic of the game does
+func (search *Search) FilterChangedBy(delta int) {
+	search.filter(func(previous, value uint8) bool {
+		return value-previous == uint8(delta)
+	})
+}
+
+// returns the number of addresses still matching
+func (search *Search) Count() int {
+	return search.count
+}
+
+// returns the addresses still matching, up to limit of them, all when limit is 0
+func (search *Search) Results(limit int) []Result {
+	ram := cpu.RamSnapshot()
+	var results []Result
+	for i, candidate := range search.candidates {
+		if !candidate {
+			continue
+		}
+		if limit > 0 && len(results) == limit {
+			break
+		}
+		results = append(results, Result{Address: uint16(i), Previous: search.previous[i], Value: ram[i]})
+	}
+	return results
+}
+
+// Freeze turns the result into a cheat, the address is frozen at its current value
+func (result Result) Freeze() {
+	SetFreeze(CpuRam, int(result.Address), CpuRam.Read(int(result.Address)))
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"testing"
+	"vsasakiv/nesemulator/console"
+)
+
+// clears the ram, so the tests choose every value
+func clearRam() {
+	for i := range CpuRam.Size() {
+		CpuRam.Write(i, 0)
+	}
+}
+
+func resultAddresses(search *Search) []uint16 {
+	var addresses []uint16
+	for _, result := range search.Results(0) {
+		addresses = append(addresses, result.Address)
+	}
+	return addresses
+}
+
+func TestSearchLives(t *testing.T) {
+	console.LoadRom(testRom)
+	clearRam()
+	// the lives are at $75A, $300 is a timer going down as well
+	CpuRam.Write(0x75A, 3)
+	CpuRam.Write(0x300, 9)
+	search := NewSearch()
+	if search.Count() != 0x800 {
+		t.Fatalf("a new search has %d candidates", search.Count())
+	}
+
+	// a life was lost
+	CpuRam.Write(0x75A, 2)
+	CpuRam.Write(0x300, 8)
+	search.FilterPrevious(Less)
+	if got := resultAddresses(search); len(got) != 2 {
+		t.Fatalf("results after losing a life: %X", got)
+	}
+
+	// nothing changed
+	search.FilterPrevious(Equal)
+	if search.Count() != 2 {
+		t.Fatalf("%d results after nothing changed", search.Count())
+	}
+
+	// the timer went down again, the lives did not
+	CpuRam.Write(0x300, 7)
+	search.FilterPrevious(NotEqual)
+	search.FilterValue(Equal, 7)
+	results := search.Results(0)
+	if len(results) != 1 || results[0].Address != 0x300 || results[0].Value != 7 {
+		t.Fatalf("results are %+v, want only $300", results)
+	}
+}
+
+func TestSearchChangedBy(t *testing.T) {
+	console.LoadRom(testRom)
+	clearRam()
+	CpuRam.Write(0x10, 0xFF)
+	CpuRam.Write(0x11, 0x05)
+	CpuRam.Write(0x12, 0x05)
+	search := NewSearch()
+
+	// $10 wraps to 1, $11 goes up by 2 and $12 goes down by 2
+	CpuRam.Write(0x10, 0x01)
+	CpuRam.Write(0x11, 0x07)
+	CpuRam.Write(0x12, 0x03)
+	search.FilterChangedBy(2)
+	if got := resultAddresses(search); len(got) != 2 || got[0] != 0x10 || got[1] != 0x11 {
+		t.Fatalf("changed by 2: %X", got)
+	}
+
+	search.Reset()
+	CpuRam.Write(0x12, 0x01)
+	search.FilterChangedBy(-2)
+	if got := resultAddresses(search); len(got) != 1 || got[0] != 0x12 {
+		t.Fatalf("changed by -2: %X", got)
+	}
+	// the previous value is the one at the last filter
+	CpuRam.Write(0x12, 0x00)
+	if results := search.Results(0); results[0].Previous != 0x01 || results[0].Value != 0x00 {
+		t.Fatalf("result is %+v", results[0])
+	}
+}
+
+func TestSearchGreaterValue(t *testing.T) {
+	console.LoadRom(testRom)
+	clearRam()
+	for i := range 8 {
+		CpuRam.Write(i, uint8(i))
+	}
+	search := NewSearch()
+	search.FilterValue(Greater, 5)
+	if got := resultAddresses(search); len(got) != 2 || got[0] != 6 {
+		t.Fatalf("greater than 5: %X", got)
+	}
+	search.Reset()
+	search.FilterValue(Less, 2)
+	// the rest of the ram is zero
+	if search.Count() != 0x800-6 || len(search.Results(10)) != 10 {
+		t.Fatalf("less than 2: %d results", search.Count())
+	}
+}
+
+func TestFreezeResult(t *testing.T) {
+	console.LoadRom(testRom)
+	clearRam()
+	defer ClearFreezes()
+	CpuRam.Write(0x40, 99)
+	search := NewSearch()
+	search.FilterValue(Equal, 99)
+	search.Results(0)[0].Freeze()
+	CpuRam.Write(0x40, 0)
+	ApplyFreezes()
+	if got := CpuRam.Read(0x40); got != 99 {
+		t.Fatalf("frozen result reads %d, want 99", got)
+	}
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// formats of the watched values
+const (
+	FormatU8  = "u8"
+	FormatU16 = "u16"
+	FormatS8  = "s8"
+	FormatS16 = "s16"
+	// binary coded decimal, a decimal digit in each nibble, as the scores of many games
+	FormatBcd8  = "bcd8"
+	FormatBcd16 = "bcd16"
+)
+
+// the formats in the order the editor cycles through them
+var Formats = []string{FormatU8, FormatU16, FormatS8, FormatS16, FormatBcd8, FormatBcd16}
+
+var ErrFormat = errors.New("unknown watch format")
+
+// Watch shows a value of the memory as a number, the values of two bytes
+// are little endian, as the 6502 keeps them
+type Watch struct {
+	Label  string `json:"label,omitempty"`
+	Region string `json:"region"`
+	Offset int    `json:"offset"`
+	Format string `json:"format"`
+}
+
+// returns the number of bytes of the format
+func formatSize(format string) int {
+	switch format {
+	case FormatU16, FormatS16, FormatBcd16:
+		return 2
+	}
+	return 1
+}
+
+// returns the value of the watch in its format, empty when its region does not exist
+func (watch Watch) Value() string {
+	region := FindRegion(watch.Region)
+	if region == nil {
+		return ""
+	}
+	value := uint16(region.Read(watch.Offset))
+	if formatSize(watch.Format) == 2 {
+		value |= uint16(region.Read(watch.Offset+1)) << 8
+	}
+	switch watch.Format {
+	case FormatS8:
+		return fmt.Sprint(int8(value))
+	case FormatS16:
+		return fmt.Sprint(int16(value))
+	case FormatBcd8:
+		return fmt.Sprintf("%02X", value)
+	case FormatBcd16:
+		return fmt.Sprintf("%04X", value)
+	}
+	return fmt.Sprint(value)
+}
+
+// returns the address of the watch, as the region addresses it
+func (watch Watch) Address() uint16 {
+	if region := FindRegion(watch.Region); region != nil {
+		return region.Address(watch.Offset)
+	}
+	return 0
+}
+
+// watched values, shown by the memory editor
+var Watches []Watch
+
+// returns the index of the watch of the byte, -1 when it is not watched
+func FindWatch(region *Region, offset int) int {
+	for i, watch := range Watches {
+		if watch.Region == region.Name && watch.Offset == offset {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns the format after the one given, going back to the first after the last
+func NextFormat(format string) string {
+	return Formats[(slices.Index(Formats, format)+1)%len(Formats)]
+}
+
+// loads the watches saved in the file, a missing file has no watches
+func LoadWatches(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		Watches = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var watches []Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return err
+	}
+	for _, watch := range watches {
+		if !slices.Contains(Formats, watch.Format) {
+			return fmt.Errorf("%w: %q", ErrFormat, watch.Format)
+		}
+	}
+	Watches = watches
+	return nil
+}
+
+func SaveWatches(path string) error {
+	data, err := json.MarshalIndent(Watches, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
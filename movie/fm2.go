@@ -0,0 +1,295 @@
+package movie
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FM2 is the text movie format of FCEUX, a header with one "key value" pair per
+// line followed by the input log, one line per frame as in |commands|port0|port1|port2|
+
+// commands of the input log
+const (
+	CommandReset = 1 << 0
+	CommandPower = 1 << 1
+)
+
+// input devices of port0 and port1
+const (
+	DeviceNone    = 0
+	DeviceGamepad = 1
+)
+
+// gamepad buttons in the order they are written, the first character is bit 7
+// of the button mask, which matches the controller button constants
+const gamepadButtons = "RLDUTSBA"
+
+const base64Prefix = "base64:"
+
+type Frame struct {
+	Commands uint8
+	// one button mask per port, bit n is the button n of the controller package
+	Ports [2]uint8
+}
+
+type Movie struct {
+	Version       int
+	EmuVersion    int
+	RerecordCount uint
+	PalFlag       bool
+	RomFilename   string
+	RomChecksum   [16]uint8
+	Guid          string
+	// devices of port0 and port1
+	Ports     [2]int
+	Comments  []string
+	Subtitles []string
+	// save state the movie starts from, nil if it starts from power on
+	SaveState []byte
+	Frames    []Frame
+	// header keys this emulator does not use, kept so they are written back
+	extra [][2]string
+}
+
+func New(romFilename string, romChecksum [16]uint8) *Movie {
+	return &Movie{
+		Version:     3,
+		RomFilename: romFilename,
+		RomChecksum: romChecksum,
+		Guid:        newGuid(),
+		Ports:       [2]int{DeviceGamepad, DeviceGamepad},
+	}
+}
+
+func Load(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func (movie *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := movie.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ----- Reading -----
+
+func Read(reader io.Reader) (*Movie, error) {
+	movie := &Movie{}
+	scanner := bufio.NewScanner(reader)
+	// save states are written in a single line
+	scanner.Buffer(make([]byte, 0x10000), 0x4000000)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		var err error
+		if line[0] == '|' {
+			err = movie.readFrame(line)
+		} else {
+			key, value, _ := strings.Cut(line, " ")
+			err = movie.readHeader(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("movie: line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if movie.Version != 3 {
+		return nil, fmt.Errorf("movie: fm2 version %d is not supported", movie.Version)
+	}
+	return movie, nil
+}
+
+func (movie *Movie) readHeader(key string, value string) error {
+	var err error
+	switch key {
+	case "version":
+		movie.Version, err = strconv.Atoi(value)
+	case "emuVersion":
+		movie.EmuVersion, err = strconv.Atoi(value)
+	case "rerecordCount":
+		var count uint64
+		count, err = strconv.ParseUint(value, 10, 64)
+		movie.RerecordCount = uint(count)
+	case "palFlag":
+		movie.PalFlag = value == "1"
+	case "romFilename":
+		movie.RomFilename = value
+	case "romChecksum":
+		var checksum []byte
+		checksum, err = decodeBase64(value)
+		copy(movie.RomChecksum[:], checksum)
+	case "guid":
+		movie.Guid = value
+	case "port0":
+		movie.Ports[0], err = strconv.Atoi(value)
+	case "port1":
+		movie.Ports[1], err = strconv.Atoi(value)
+	case "comment":
+		movie.Comments = append(movie.Comments, value)
+	case "subtitle":
+		movie.Subtitles = append(movie.Subtitles, value)
+	case "savestate":
+		movie.SaveState, err = decodeBase64(value)
+	case "binary":
+		if value == "1" {
+			err = fmt.Errorf("binary input logs are not supported")
+		}
+	case "length":
+		// the length is recomputed from the input log
+	default:
+		movie.extra = append(movie.extra, [2]string{key, value})
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+func (movie *Movie) readFrame(line string) error {
+	fields := strings.Split(line, "|")
+	// a leading and a trailing empty field surround commands, port0, port1 and port2
+	if len(fields) < 4 {
+		return fmt.Errorf("invalid input log line %q", line)
+	}
+	var frame Frame
+	commands, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid commands %q", fields[1])
+	}
+	frame.Commands = uint8(commands)
+	for port := range frame.Ports {
+		if movie.Ports[port] != DeviceGamepad {
+			continue
+		}
+		frame.Ports[port], err = parseGamepad(fields[2+port])
+		if err != nil {
+			return err
+		}
+	}
+	movie.Frames = append(movie.Frames, frame)
+	return nil
+}
+
+func parseGamepad(field string) (uint8, error) {
+	if len(field) != len(gamepadButtons) {
+		return 0, fmt.Errorf("invalid gamepad input %q", field)
+	}
+	var mask uint8
+	for i := range len(gamepadButtons) {
+		if field[i] != '.' && field[i] != ' ' {
+			mask |= 1 << (7 - i)
+		}
+	}
+	return mask, nil
+}
+
+// ----- Writing -----
+
+func (movie *Movie) Write(writer io.Writer) error {
+	buffered := bufio.NewWriter(writer)
+
+	fmt.Fprintf(buffered, "version %d\n", movie.Version)
+	fmt.Fprintf(buffered, "emuVersion %d\n", movie.EmuVersion)
+	fmt.Fprintf(buffered, "rerecordCount %d\n", movie.RerecordCount)
+	fmt.Fprintf(buffered, "palFlag %d\n", boolToInt(movie.PalFlag))
+	fmt.Fprintf(buffered, "romFilename %s\n", movie.RomFilename)
+	fmt.Fprintf(buffered, "romChecksum %s%s\n", base64Prefix, base64.StdEncoding.EncodeToString(movie.RomChecksum[:]))
+	fmt.Fprintf(buffered, "guid %s\n", movie.Guid)
+	fmt.Fprintf(buffered, "fourscore 0\n")
+	fmt.Fprintf(buffered, "microphone 0\n")
+	fmt.Fprintf(buffered, "port0 %d\n", movie.Ports[0])
+	fmt.Fprintf(buffered, "port1 %d\n", movie.Ports[1])
+	fmt.Fprintf(buffered, "port2 0\n")
+	fmt.Fprintf(buffered, "FDS 0\n")
+	fmt.Fprintf(buffered, "NewPPU 0\n")
+	for _, extra := range movie.extra {
+		switch extra[0] {
+		// already written above
+		case "fourscore", "microphone", "port2", "FDS", "NewPPU":
+			continue
+		}
+		fmt.Fprintf(buffered, "%s %s\n", extra[0], extra[1])
+	}
+	for _, comment := range movie.Comments {
+		fmt.Fprintf(buffered, "comment %s\n", comment)
+	}
+	for _, subtitle := range movie.Subtitles {
+		fmt.Fprintf(buffered, "subtitle %s\n", subtitle)
+	}
+	fmt.Fprintf(buffered, "length %d\n", len(movie.Frames))
+	if movie.SaveState != nil {
+		fmt.Fprintf(buffered, "savestate %s%s\n", base64Prefix, base64.StdEncoding.EncodeToString(movie.SaveState))
+	}
+
+	for _, frame := range movie.Frames {
+		fmt.Fprintf(buffered, "|%d|", frame.Commands)
+		for port := range frame.Ports {
+			if movie.Ports[port] == DeviceGamepad {
+				buffered.WriteString(formatGamepad(frame.Ports[port]))
+			}
+			buffered.WriteString("|")
+		}
+		buffered.WriteString("|\n")
+	}
+	return buffered.Flush()
+}
+
+func formatGamepad(mask uint8) string {
+	var field [len(gamepadButtons)]byte
+	for i := range len(gamepadButtons) {
+		if mask&(1<<(7-i)) != 0 {
+			field[i] = gamepadButtons[i]
+		} else {
+			field[i] = '.'
+		}
+	}
+	return string(field[:])
+}
+
+// ----- Utils -----
+
+// fm2 binary values are written in base64 with a prefix, or in hex with a 0x prefix
+func decodeBase64(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "0x") {
+		bytes := make([]byte, 0, len(value)/2)
+		for i := 2; i+1 < len(value); i += 2 {
+			b, err := strconv.ParseUint(value[i:i+2], 16, 8)
+			if err != nil {
+				return nil, err
+			}
+			bytes = append(bytes, uint8(b))
+		}
+		return bytes, nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(value, base64Prefix))
+}
+
+func boolToInt(val bool) int {
+	if val {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package movie
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/controller"
+)
+
+const testMovie = `version 3
+emuVersion 22020
+rerecordCount 7
+palFlag 0
+romFilename nestest
+romChecksum base64:AAECAwQFBgcICQoLDA0ODw==
+guid 01234567-89AB-CDEF-0123-456789ABCDEF
+fourscore 0
+port0 1
+port1 1
+port2 0
+comment author someone
+subtitle 2 hello
+length 3
+|0|R......A|........||
+|1|........|.L.U.S..||
+|2|RLDUTSBA|........||
+`
+
+func TestRead(t *testing.T) {
+	movie, err := Read(strings.NewReader(testMovie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Version != 3 || movie.EmuVersion != 22020 || movie.RerecordCount != 7 || movie.PalFlag {
+		t.Errorf("the header read is %+v", movie)
+	}
+	if movie.RomFilename != "nestest" || movie.RomChecksum != [16]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15} {
+		t.Errorf("the rom read is %s with the checksum %X", movie.RomFilename, movie.RomChecksum)
+	}
+	if movie.Guid != "01234567-89AB-CDEF-0123-456789ABCDEF" || movie.Ports != [2]int{DeviceGamepad, DeviceGamepad} {
+		t.Errorf("the guid read is %s and the ports %v", movie.Guid, movie.Ports)
+	}
+	if !reflect.DeepEqual(movie.Comments, []string{"author someone"}) || !reflect.DeepEqual(movie.Subtitles, []string{"2 hello"}) {
+		t.Errorf("the comments read are %q and the subtitles %q", movie.Comments, movie.Subtitles)
+	}
+	// the first button is bit 7 of the mask, as the controller buttons
+	want := []Frame{
+		{Ports: [2]uint8{1<<controller.RIGHT | 1<<controller.A, 0}},
+		{Commands: CommandReset, Ports: [2]uint8{0, 1<<controller.LEFT | 1<<controller.UP | 1<<controller.SELECT}},
+		{Commands: CommandPower, Ports: [2]uint8{0xFF, 0}},
+	}
+	if !reflect.DeepEqual(movie.Frames, want) {
+		t.Errorf("the frames read are %v, want %v", movie.Frames, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	movie, err := Read(strings.NewReader(testMovie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie.SaveState = []byte{0x4D, 0x4E, 0x53, 0x53}
+	var buffer bytes.Buffer
+	if err := movie.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	written := buffer.String()
+	for _, line := range []string{
+		"rerecordCount 7\n",
+		"romChecksum base64:AAECAwQFBgcICQoLDA0ODw==\n",
+		"length 3\n",
+		"savestate base64:TU5TUw==\n",
+		"|0|R......A|........||\n|1|........|.L.U.S..||\n|2|RLDUTSBA|........||\n",
+	} {
+		if !strings.Contains(written, line) {
+			t.Errorf("the movie written has no %q:\n%s", line, written)
+		}
+	}
+
+	// the movie read back is written the same
+	read, err := Read(strings.NewReader(written))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer.Reset()
+	if err := read.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != written {
+		t.Errorf("the movie read back is written as:\n%s\nwant:\n%s", buffer.String(), written)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie string
+		want  string
+	}{
+		{"version", "version 2\n", "movie: fm2 version 2 is not supported"},
+		{"binary", "version 3\nbinary 1\n", "movie: line 2: invalid binary: binary input logs are not supported"},
+		{"rerecord count", "version 3\nrerecordCount many\n", "movie: line 2: invalid rerecordCount"},
+		{"gamepad", "version 3\nport0 1\n|0|RLDU|........||\n", `movie: line 3: invalid gamepad input "RLDU"`},
+		{"commands", "version 3\n|x|........|........||\n", `movie: line 2: invalid commands "x"`},
+	}
+	for _, test := range tests {
+		_, err := Read(strings.NewReader(test.movie))
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("reading a wrong %s gave %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// the binary values can also be written in hex
+func TestHexChecksum(t *testing.T) {
+	movie, err := Read(strings.NewReader("version 3\nromChecksum 0x000102030405060708090A0B0C0D0E0F\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.RomChecksum != [16]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15} {
+		t.Errorf("the checksum read is %X", movie.RomChecksum)
+	}
+}
@@ -0,0 +1,134 @@
+package movie
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"vsasakiv/nesemulator/console"
+)
+
+const (
+	Recording = iota
+	Playing
+	Finished
+)
+
+var ErrStateAfterEnd = errors.New("movie: save state is after the end of the movie")
+
+// Session records or plays a movie on the console, it must be updated once
+// per frame, before the frame is emulated
+type Session struct {
+	Movie *Movie
+	Mode  int
+	// in read only mode, loading a state keeps playing the movie, otherwise
+	// the movie is cut at the state and recording resumes from there (a rerecord)
+	ReadOnly bool
+	// console frame where the movie starts
+	start uint
+	// commands requested while recording, written on the next frame
+	pendingCommands uint8
+}
+
+// starts recording a new movie, from power on or from the current state of the console
+func StartRecording(movie *Movie, fromSaveState bool) *Session {
+	if fromSaveState {
+		movie.SaveState = console.SaveState()
+	} else {
+		movie.SaveState = nil
+		console.PowerOn()
+	}
+	movie.Frames = movie.Frames[:0]
+	return &Session{Movie: movie, Mode: Recording, start: console.Frame()}
+}
+
+// starts playing a movie, from power on or from the state embedded in the movie
+func StartPlayback(movie *Movie, readOnly bool) (*Session, error) {
+	if movie.SaveState != nil {
+		if err := console.LoadState(movie.SaveState); err != nil {
+			return nil, fmt.Errorf("movie: cannot load the movie save state: %w", err)
+		}
+	} else {
+		console.PowerOn()
+	}
+	return &Session{Movie: movie, Mode: Playing, ReadOnly: readOnly, start: console.Frame()}, nil
+}
+
+// returns the frame of the movie that is going to be emulated next
+func (session *Session) FrameIndex() uint {
+	return console.Frame() - session.start
+}
+
+// Update plays the input of the next frame on the controllers, or records the
+// controllers input for it, it must be called after the controllers are updated
+func (session *Session) Update() {
+	index := session.FrameIndex()
+
+	switch session.Mode {
+	case Playing:
+		if index >= uint(len(session.Movie.Frames)) {
+			session.Mode = Finished
+			return
+		}
+		frame := session.Movie.Frames[index]
+		runCommands(frame.Commands)
+		console.JoyPad1.SetButtonMask(frame.Ports[0])
+		console.JoyPad2.SetButtonMask(frame.Ports[1])
+
+	case Recording:
+		frame := Frame{Commands: session.pendingCommands}
+		session.pendingCommands = 0
+		runCommands(frame.Commands)
+		frame.Ports[0] = console.JoyPad1.GetButtonMask()
+		frame.Ports[1] = console.JoyPad2.GetButtonMask()
+		session.Movie.Frames = append(session.Movie.Frames[:index], frame)
+	}
+}
+
+// requests a reset, or a power cycle, that is recorded in the movie on the next frame
+func (session *Session) Reset(power bool) {
+	if session.Mode != Recording {
+		return
+	}
+	if power {
+		session.pendingCommands |= CommandPower
+	} else {
+		session.pendingCommands |= CommandReset
+	}
+}
+
+// loads a save state during the movie, in read only mode the playback jumps
+// to the state, otherwise the movie is cut at the state and recording resumes
+func (session *Session) LoadState(state []byte) error {
+	previous := console.SaveState()
+	if err := console.LoadState(state); err != nil {
+		return err
+	}
+	if console.Frame() < session.start || session.FrameIndex() > uint(len(session.Movie.Frames)) {
+		console.LoadState(previous)
+		return ErrStateAfterEnd
+	}
+
+	if session.ReadOnly {
+		session.Mode = Playing
+		return nil
+	}
+	session.Movie.Frames = session.Movie.Frames[:session.FrameIndex()]
+	session.Movie.RerecordCount++
+	session.Mode = Recording
+	return nil
+}
+
+func runCommands(commands uint8) {
+	if commands&CommandPower != 0 {
+		console.PowerOn()
+	} else if commands&CommandReset != 0 {
+		console.Reset()
+	}
+}
+
+// fm2 guids are random uuids in upper case
+func newGuid() string {
+	var bytes [16]byte
+	rand.Read(bytes[:])
+	return fmt.Sprintf("%X-%X-%X-%X-%X", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:16])
+}
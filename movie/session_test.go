@@ -0,0 +1,129 @@
+package movie
+
+import (
+	"errors"
+	"testing"
+	"vsasakiv/nesemulator/console"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+// the buttons of the first controller on each frame recorded, a different
+// mask every frame
+func padInput(frame int) uint8 {
+	return uint8(frame * 37)
+}
+
+// records the frames from power on, with the state of the console after
+// the frame stateFrame
+func record(t *testing.T, frames int, stateFrame int) (*Session, []byte) {
+	t.Helper()
+	if err := console.LoadRom(testRom); err != nil {
+		t.Fatal(err)
+	}
+	session := StartRecording(New("nestest", console.Cartridge.Checksum()), false)
+	var state []byte
+	for frame := range frames {
+		console.JoyPad1.SetButtonMask(padInput(frame))
+		if frame == 2 {
+			session.Reset(false)
+		}
+		session.Update()
+		console.RunFrame(nil)
+		if frame == stateFrame {
+			state = console.SaveState()
+		}
+	}
+	return session, state
+}
+
+func TestRecordAndPlay(t *testing.T) {
+	session, _ := record(t, 10, 0)
+	movie := session.Movie
+	if len(movie.Frames) != 10 {
+		t.Fatalf("recorded %d frames, want 10", len(movie.Frames))
+	}
+	// the reset is recorded on the frame of the next update
+	for frame, recorded := range movie.Frames {
+		wantCommands := uint8(0)
+		if frame == 2 {
+			wantCommands = CommandReset
+		}
+		if recorded.Commands != wantCommands || recorded.Ports[0] != padInput(frame) {
+			t.Errorf("frame %d recorded %+v", frame, recorded)
+		}
+	}
+	recordedHash := console.StateHash()
+
+	playback, err := StartPlayback(movie, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame := range movie.Frames {
+		console.JoyPad1.SetButtonMask(0)
+		playback.Update()
+		if mask := console.JoyPad1.GetButtonMask(); mask != padInput(frame) {
+			t.Errorf("frame %d played %02X, want %02X", frame, mask, padInput(frame))
+		}
+		console.RunFrame(nil)
+	}
+	if console.StateHash() != recordedHash {
+		t.Error("the playback ended in another state than the recording")
+	}
+	playback.Update()
+	if playback.Mode != Finished {
+		t.Errorf("the playback is in the mode %d after the last frame, want finished", playback.Mode)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		// the frames and the rerecord count after the state is loaded
+		wantFrames   int
+		wantRerecord uint
+		wantMode     int
+	}{
+		// the movie is cut at the state and the recording resumes
+		{"read and write", false, 5, 1, Recording},
+		{"read only", true, 10, 0, Playing},
+	}
+	for _, test := range tests {
+		session, state := record(t, 10, 4)
+		session.ReadOnly = test.readOnly
+		if err := session.LoadState(state); err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Movie.Frames) != test.wantFrames || session.Movie.RerecordCount != test.wantRerecord || session.Mode != test.wantMode {
+			t.Errorf("%s left %d frames, %d rerecords and the mode %d, want %d, %d and %d", test.name,
+				len(session.Movie.Frames), session.Movie.RerecordCount, session.Mode, test.wantFrames, test.wantRerecord, test.wantMode)
+		}
+		if session.FrameIndex() != 5 {
+			t.Errorf("%s continues from the frame %d, want 5", test.name, session.FrameIndex())
+		}
+		// the next frame is played from the movie or recorded from the pad
+		console.JoyPad1.SetButtonMask(0xFF)
+		session.Update()
+		want := padInput(5)
+		if !test.readOnly {
+			want = 0xFF
+		}
+		if mask := session.Movie.Frames[5].Ports[0]; mask != want || console.JoyPad1.GetButtonMask() != want {
+			t.Errorf("%s has %02X on the frame 5, want %02X", test.name, mask, want)
+		}
+	}
+}
+
+func TestStateAfterEnd(t *testing.T) {
+	_, state := record(t, 10, 6)
+	// a new recording of 3 frames
+	session, _ := record(t, 3, 0)
+	frame := console.Frame()
+	if err := session.LoadState(state); !errors.Is(err, ErrStateAfterEnd) {
+		t.Fatalf("loading a state after the end gave %v, want ErrStateAfterEnd", err)
+	}
+	if console.Frame() != frame || len(session.Movie.Frames) != 3 || session.Movie.RerecordCount != 0 {
+		t.Errorf("the failed load left the console at the frame %d with %d frames recorded", console.Frame(), len(session.Movie.Frames))
+	}
+}
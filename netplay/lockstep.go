@@ -0,0 +1,32 @@
+package netplay
+
+import "vsasakiv/nesemulator/console"
+
+// in lockstep each frame is emulated once the inputs of both players for it
+// are known, the game stalls while the input of the other player is late
+func (session *Session) updateLockstep() error {
+	if session.frame > 0 && session.frame%session.HashInterval == 0 {
+		if err := session.sendHash(session.frame, console.StateHash()); err != nil {
+			return err
+		}
+	}
+	if err := session.sendInput(); err != nil {
+		return err
+	}
+
+	for {
+		if _, ok := session.remoteInputs[session.frame]; ok {
+			break
+		}
+		if err := session.waitMessage(); err != nil {
+			return err
+		}
+	}
+
+	session.setControllers(session.localInputs[session.frame], session.remoteInputs[session.frame])
+	delete(session.localInputs, session.frame)
+	delete(session.remoteInputs, session.frame)
+	session.frame++
+	session.confirmed = session.frame
+	return nil
+}
@@ -0,0 +1,182 @@
+package netplay
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/controller"
+	"vsasakiv/nesemulator/cpu"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+// an emulator instance of the test, the console is shared so each instance
+// keeps its own save state, which is loaded before running its frames
+type instance struct {
+	session *Session
+	state   []byte
+}
+
+// starts a host and a guest session connected over localhost, with the latency added to both directions
+func startInstances(t *testing.T, options Options, latency time.Duration) [2]*instance {
+	console.LoadRom(testRom)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type result struct {
+		session *Session
+		err     error
+	}
+	hosted := make(chan result)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			hosted <- result{nil, err}
+			return
+		}
+		session, err := NewHost(withLatency(conn, latency), options)
+		hosted <- result{session, err}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := NewGuest(withLatency(conn, latency))
+	if err != nil {
+		t.Fatal("join:", err)
+	}
+	host := <-hosted
+	if host.err != nil {
+		t.Fatal("accept:", host.err)
+	}
+	t.Cleanup(func() {
+		host.session.Close()
+		guest.Close()
+	})
+	if guest.Delay != options.Delay || guest.Rollback != options.Rollback {
+		t.Fatalf("guest settings are delay %d rollback %v, want the host ones %+v", guest.Delay, guest.Rollback, options)
+	}
+
+	state := console.SaveState()
+	return [2]*instance{{session: host.session, state: state}, {session: guest, state: state}}
+}
+
+// the buttons each player holds on a frame, different for each player so
+// swapped or lost inputs change the game
+func testInput(player int, frame uint) uint8 {
+	switch {
+	case frame%90 == 10:
+		return 1 << controller.START
+	case (frame/7)%4 == uint(player):
+		return 1 << controller.DOWN
+	case (frame/11)%3 == uint(player):
+		return 1 << controller.SELECT
+	}
+	return 0
+}
+
+// runs one frame of the instance, returns the error of the session
+func (instance *instance) runFrame(player int) error {
+	if err := console.LoadState(instance.state); err != nil {
+		return err
+	}
+	frame := instance.session.Frame()
+	console.JoyPad1.SetButtonMask(testInput(player, frame))
+	// the frames emulated again by a rollback don't reach the hooks
+	hooked := 0
+	remove := cpu.AddHook(func(access int, addr uint16, val uint8) { hooked++ })
+	err := instance.session.Update()
+	remove()
+	if err != nil {
+		return err
+	}
+	if hooked != 0 {
+		return errors.New("the hooks were called while updating the session")
+	}
+	if instance.session.Rollback {
+		// the controllers may have predicted inputs
+		instance.session.StepFrame()
+		instance.state = console.SaveState()
+		return nil
+	}
+
+	// each controller must have the input of its player for the frame
+	expected := frame - min(frame, instance.session.Delay)
+	for port, joyPad := range []*controller.JoyPad{console.JoyPad1, console.JoyPad2} {
+		want := testInput(port, expected)
+		if frame < instance.session.Delay {
+			want = 0
+		}
+		if mask := joyPad.GetButtonMask(); mask != want {
+			return errors.New("controller with the input of the wrong frame or player")
+		}
+	}
+
+	console.RunFrame(nil)
+	instance.state = console.SaveState()
+	return nil
+}
+
+func TestLockstepStaysInSync(t *testing.T) {
+	const frames = 300
+	instances := startInstances(t, Options{Delay: DefaultDelay}, 0)
+	for _, instance := range instances {
+		instance.session.HashInterval = 30
+	}
+
+	for frame := range uint(frames) {
+		for player, instance := range instances {
+			if err := instance.runFrame(player); err != nil {
+				t.Fatalf("player %d, frame %d: %v", player+1, frame, err)
+			}
+		}
+	}
+
+	var hashes [2]uint64
+	for i, instance := range instances {
+		console.LoadState(instance.state)
+		hashes[i] = console.StateHash()
+		if console.Frame() != frames {
+			t.Fatalf("player %d emulated %d frames, want %d", i+1, console.Frame(), frames)
+		}
+	}
+	if hashes[0] != hashes[1] {
+		t.Fatalf("consoles diverged after %d frames: %x != %x", frames, hashes[0], hashes[1])
+	}
+}
+
+func TestLockstepDetectsDesync(t *testing.T) {
+	instances := startInstances(t, Options{Delay: DefaultDelay}, 0)
+	for _, instance := range instances {
+		instance.session.HashInterval = 10
+	}
+
+	for frame := range uint(100) {
+		if frame == 25 {
+			// change the guest ram behind the session's back
+			console.LoadState(instances[1].state)
+			cpu.MemWrite(0x0300, cpu.MemRead(0x0300)+1)
+			instances[1].state = console.SaveState()
+		}
+		for player, instance := range instances {
+			err := instance.runFrame(player)
+			if errors.Is(err, ErrDesync) {
+				if frame < 25 {
+					t.Fatalf("desync reported at frame %d, before the consoles diverged", frame)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("player %d, frame %d: %v", player+1, frame, err)
+			}
+		}
+	}
+	t.Fatal("the desync was not detected")
+}
@@ -0,0 +1,141 @@
+package netplay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The host sends a hello with the session settings followed by its save state,
+// the guest answers with its own hello, then both send one message per frame:
+//
+//	hello:  "MNNP" | version u8 | rom checksum [16]u8 | input delay u8 | rollback u8
+//	state:  size u32 | save state
+//	input:  msgInput | frame u32 | buttons u8
+//	hash:   msgHash  | frame u32 | hash u64
+//
+// all values are little endian, as in the save states
+
+const protocolMagic = "MNNP"
+const protocolVersion = 1
+
+const (
+	msgInput = iota + 1
+	msgHash
+)
+
+// save states are a few tens of kilobytes, anything bigger is not one
+const maxStateSize = 0x1000000
+
+var ErrProtocol = errors.New("netplay: invalid message from the other player")
+var ErrVersion = errors.New("netplay: the other player runs another protocol version")
+var ErrRom = errors.New("netplay: the other player loaded another rom")
+
+type hello struct {
+	romChecksum [16]uint8
+	delay       uint8
+	rollback    bool
+}
+
+type message struct {
+	kind    uint8
+	frame   uint32
+	buttons uint8
+	hash    uint64
+}
+
+func writeHello(writer *bufio.Writer, hello hello) error {
+	writer.WriteString(protocolMagic)
+	writer.WriteByte(protocolVersion)
+	writer.Write(hello.romChecksum[:])
+	writer.WriteByte(hello.delay)
+	if hello.rollback {
+		writer.WriteByte(1)
+	} else {
+		writer.WriteByte(0)
+	}
+	return writer.Flush()
+}
+
+func readHello(reader *bufio.Reader) (hello, error) {
+	var hello hello
+	header := make([]byte, len(protocolMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return hello, err
+	}
+	if string(header[:len(protocolMagic)]) != protocolMagic {
+		return hello, ErrProtocol
+	}
+	if header[len(protocolMagic)] != protocolVersion {
+		return hello, ErrVersion
+	}
+	if _, err := io.ReadFull(reader, hello.romChecksum[:]); err != nil {
+		return hello, err
+	}
+	var settings [2]byte
+	if _, err := io.ReadFull(reader, settings[:]); err != nil {
+		return hello, err
+	}
+	hello.delay = settings[0]
+	hello.rollback = settings[1] == 1
+	return hello, nil
+}
+
+func writeState(writer *bufio.Writer, state []byte) error {
+	writer.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(state))))
+	writer.Write(state)
+	return writer.Flush()
+}
+
+func readState(reader *bufio.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(size[:])
+	if length > maxStateSize {
+		return nil, fmt.Errorf("%w: save state of %d bytes", ErrProtocol, length)
+	}
+	state := make([]byte, length)
+	_, err := io.ReadFull(reader, state)
+	return state, err
+}
+
+// messages are buffered, the caller flushes once per frame
+func writeMessage(writer *bufio.Writer, msg message) {
+	buf := make([]byte, 0, 13)
+	buf = append(buf, msg.kind)
+	buf = binary.LittleEndian.AppendUint32(buf, msg.frame)
+	switch msg.kind {
+	case msgInput:
+		buf = append(buf, msg.buttons)
+	case msgHash:
+		buf = binary.LittleEndian.AppendUint64(buf, msg.hash)
+	}
+	writer.Write(buf)
+}
+
+func readMessage(reader *bufio.Reader) (message, error) {
+	var msg message
+	var header [5]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return msg, err
+	}
+	msg.kind = header[0]
+	msg.frame = binary.LittleEndian.Uint32(header[1:])
+
+	switch msg.kind {
+	case msgInput:
+		buttons, err := reader.ReadByte()
+		msg.buttons = buttons
+		return msg, err
+	case msgHash:
+		var hash [8]byte
+		_, err := io.ReadFull(reader, hash[:])
+		msg.hash = binary.LittleEndian.Uint64(hash[:])
+		return msg, err
+	}
+	return msg, ErrProtocol
+}
@@ -0,0 +1,194 @@
+package netplay
+
+import (
+	"hash/fnv"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/hooks"
+)
+
+// In rollback the input of the other player is predicted to be the last one
+// received, and a snapshot of the console is taken on every frame. When the
+// real input arrives and differs from the prediction, the console goes back to
+// the snapshot of that frame and the frames since then are emulated again in
+// the same Update, so the game never waits while the prediction holds.
+
+type rollbackState struct {
+	// frames emulated with predicted inputs before waiting for the other player
+	maxRollback uint
+	// number of times the console was rolled back, for statistics
+	rollbacks uint
+	// last input of the other player that is known, used as the prediction
+	lastRemote uint8
+	predicted  map[uint]uint8
+	// snapshots of the console at the start of each frame not confirmed yet,
+	// taken after the controllers are set for the frame
+	snapshots map[uint][]byte
+	// buffers of old snapshots, reused to avoid allocating one every frame
+	freeSnapshots [][]byte
+	// next frame whose snapshot is compared with the other player
+	nextHash uint
+}
+
+func (session *Session) startRollback() {
+	session.rollback = rollbackState{
+		maxRollback: DefaultMaxRollback,
+		predicted:   make(map[uint]uint8),
+		snapshots:   make(map[uint][]byte),
+	}
+}
+
+// returns how many times the console was rolled back to fix a wrong prediction
+func (session *Session) Rollbacks() uint {
+	return session.rollback.rollbacks
+}
+
+// sets the maximum number of frames emulated with predicted inputs, the game
+// waits for the other player when it is further behind
+func (session *Session) SetMaxRollback(frames uint) {
+	session.rollback.maxRollback = frames
+}
+
+func (session *Session) updateRollback() error {
+	if err := session.sendInput(); err != nil {
+		return err
+	}
+
+	// handles the messages already received without waiting
+	for pending := true; pending; {
+		select {
+		case msg, ok := <-session.messages:
+			if !ok {
+				return session.waitMessage()
+			}
+			if err := session.handleMessage(msg); err != nil {
+				return err
+			}
+		default:
+			pending = false
+		}
+	}
+	// the other player is too far behind, the game waits for it
+	for session.frame >= session.confirmed+session.rollback.maxRollback {
+		if _, ok := session.remoteInputs[session.confirmed]; ok {
+			break
+		}
+		if err := session.waitMessage(); err != nil {
+			return err
+		}
+	}
+	if err := session.confirmInputs(); err != nil {
+		return err
+	}
+
+	session.runInputs(session.frame)
+	session.frame++
+	return session.checkHashes()
+}
+
+// Synchronize waits for the inputs of the other player for every emulated
+// frame and corrects the console if any prediction was wrong, afterwards the
+// console is in the same state as the one of the other player for this frame
+func (session *Session) Synchronize() error {
+	if session.err != nil {
+		return session.err
+	}
+	if !session.Rollback {
+		return nil
+	}
+	for session.confirmed < session.frame {
+		if _, ok := session.remoteInputs[session.confirmed]; ok {
+			if err := session.confirmInputs(); err != nil {
+				return session.fail(err)
+			}
+			continue
+		}
+		if err := session.waitMessage(); err != nil {
+			return session.fail(err)
+		}
+	}
+	if err := session.checkHashes(); err != nil {
+		return session.fail(err)
+	}
+	return nil
+}
+
+// confirms the received inputs of the other player, the console is rolled
+// back and the frames emulated again if a prediction was wrong
+func (session *Session) confirmInputs() error {
+	rollback := &session.rollback
+	mispredicted := false
+	var firstWrong uint
+	for {
+		remote, ok := session.remoteInputs[session.confirmed]
+		if !ok {
+			break
+		}
+		if session.confirmed < session.frame && !mispredicted && rollback.predicted[session.confirmed] != remote {
+			mispredicted = true
+			firstWrong = session.confirmed
+		}
+		delete(rollback.predicted, session.confirmed)
+		rollback.lastRemote = remote
+		session.confirmed++
+	}
+	if !mispredicted {
+		return nil
+	}
+
+	rollback.rollbacks++
+	if err := console.Restore(rollback.snapshots[firstWrong]); err != nil {
+		return err
+	}
+	// the tools hooked to the console already saw these frames
+	resume := hooks.Suspend()
+	defer resume()
+	for frame := firstWrong; frame < session.frame; frame++ {
+		session.runInputs(frame)
+		session.StepFrame()
+	}
+	return nil
+}
+
+// sets the controllers with the inputs of the frame, predicting the input of
+// the other player if it is not known, and takes the snapshot of the frame
+func (session *Session) runInputs(frame uint) {
+	rollback := &session.rollback
+	remote := session.remoteInputs[frame]
+	if frame >= session.confirmed {
+		remote = rollback.lastRemote
+		rollback.predicted[frame] = remote
+	}
+	session.setControllers(session.localInputs[frame], remote)
+
+	buf, ok := rollback.snapshots[frame]
+	if !ok && len(rollback.freeSnapshots) > 0 {
+		buf = rollback.freeSnapshots[len(rollback.freeSnapshots)-1]
+		rollback.freeSnapshots = rollback.freeSnapshots[:len(rollback.freeSnapshots)-1]
+	}
+	rollback.snapshots[frame] = console.Snapshot(buf)
+}
+
+// sends the hashes of the snapshots whose inputs are all confirmed, then
+// frees the snapshots that can no longer be rolled back to
+func (session *Session) checkHashes() error {
+	rollback := &session.rollback
+	for rollback.nextHash < session.confirmed && rollback.nextHash < session.frame {
+		hash := fnv.New64a()
+		hash.Write(rollback.snapshots[rollback.nextHash])
+		if err := session.sendHash(rollback.nextHash, hash.Sum64()); err != nil {
+			return err
+		}
+		rollback.nextHash += session.HashInterval
+	}
+
+	// a rollback goes back at most to the first frame not confirmed
+	for frame, snapshot := range rollback.snapshots {
+		if frame < session.confirmed && frame < rollback.nextHash {
+			rollback.freeSnapshots = append(rollback.freeSnapshots, snapshot)
+			delete(rollback.snapshots, frame)
+			delete(session.localInputs, frame)
+			delete(session.remoteInputs, frame)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package netplay
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// latencyConn delays everything written to the connection, as a slow network would
+type latencyConn struct {
+	net.Conn
+	latency time.Duration
+	packets chan packet
+	once    sync.Once
+}
+
+type packet struct {
+	data []byte
+	at   time.Time
+}
+
+func withLatency(conn net.Conn, latency time.Duration) net.Conn {
+	if latency == 0 {
+		return conn
+	}
+	delayed := &latencyConn{Conn: conn, latency: latency, packets: make(chan packet, 4096)}
+	go delayed.deliver()
+	return delayed
+}
+
+func (conn *latencyConn) Write(data []byte) (int, error) {
+	conn.packets <- packet{data: append([]byte(nil), data...), at: time.Now().Add(conn.latency)}
+	return len(data), nil
+}
+
+func (conn *latencyConn) deliver() {
+	for packet := range conn.packets {
+		time.Sleep(time.Until(packet.at))
+		if _, err := conn.Conn.Write(packet.data); err != nil {
+			return
+		}
+	}
+}
+
+func (conn *latencyConn) Close() error {
+	conn.once.Do(func() { close(conn.packets) })
+	return conn.Conn.Close()
+}
+
+// emulates a frame with a cheat counting the frames at $07FF, which the frames
+// emulated again by a rollback must count too
+func stepCounting() {
+	cpu.PokeMemory(0x07FF, cpu.PeekMemory(0x07FF)+1)
+	console.RunFrame(nil)
+}
+
+// runs the inputs of both players on a single console, with no network
+func runWithoutLatency(start []byte, frames uint) uint64 {
+	console.LoadState(start)
+	for frame := range frames {
+		console.JoyPad1.SetButtonMask(testInput(0, frame))
+		console.JoyPad2.SetButtonMask(testInput(1, frame))
+		stepCounting()
+	}
+	return console.StateHash()
+}
+
+func TestRollbackMatchesRunWithoutLatency(t *testing.T) {
+	const frames = 300
+	instances := startInstances(t, Options{Rollback: true}, 40*time.Millisecond)
+	start := instances[0].state
+	for _, instance := range instances {
+		instance.session.HashInterval = 30
+		instance.session.StepFrame = stepCounting
+	}
+
+	for frame := range uint(frames) {
+		for player, instance := range instances {
+			if err := instance.runFrame(player); err != nil {
+				t.Fatalf("player %d, frame %d: %v", player+1, frame, err)
+			}
+		}
+	}
+
+	var hashes [2]uint64
+	rollbacks := uint(0)
+	for i, instance := range instances {
+		console.LoadState(instance.state)
+		if err := instance.session.Synchronize(); err != nil {
+			t.Fatalf("player %d: %v", i+1, err)
+		}
+		hashes[i] = console.StateHash()
+		rollbacks += instance.session.Rollbacks()
+	}
+	if rollbacks == 0 {
+		t.Fatal("no input was mispredicted, the latency did not cause any rollback")
+	}
+
+	expected := runWithoutLatency(start, frames)
+	for i, hash := range hashes {
+		if hash != expected {
+			t.Fatalf("player %d console differs from the run without latency: %x != %x", i+1, hash, expected)
+		}
+	}
+	t.Logf("%d rollbacks in %d frames", rollbacks, frames)
+}
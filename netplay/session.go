@@ -0,0 +1,297 @@
+package netplay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/controller"
+)
+
+// Netplay sessions: both consoles start from the same state and only the
+// inputs are exchanged. The local input is sent Delay frames ahead, so the
+// other player usually has it before it is needed. In lockstep mode each frame
+// waits for the input of the other player, in rollback mode the input is
+// predicted and the frames are emulated again when the prediction was wrong.
+
+// frames of input delay, about 33ms at 60fps, enough for a local network
+const DefaultDelay = 2
+
+// frames that can be emulated with predicted inputs before waiting for the other player
+const DefaultMaxRollback = 8
+
+// frames between each comparison of the console state hashes
+const DefaultHashInterval = 60
+
+var ErrDesync = errors.New("netplay: the consoles are out of sync")
+var ErrDisconnected = errors.New("netplay: the other player disconnected")
+
+type Session struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	messages chan message
+	readErr  error
+	// controller port of the local player, the host is port 0 and the guest is port 1
+	Port         int
+	Delay        uint
+	Rollback     bool
+	HashInterval uint
+	// emulates a frame once the controllers are set, as the frontend does with
+	// its cheats and scripts, the rollback emulates its frames again with it
+	StepFrame func()
+	// frames emulated since the session started
+	frame uint
+	// first frame whose input of the other player is not known yet
+	confirmed    uint
+	localInputs  map[uint]uint8
+	remoteInputs map[uint]uint8
+	localHashes  map[uint]uint64
+	remoteHashes map[uint]uint64
+	err          error
+
+	rollback rollbackState
+}
+
+// settings of the session, chosen by the host
+type Options struct {
+	Delay    uint
+	Rollback bool
+}
+
+// waits for a player on the address and starts a session as the host
+func Host(addr string, options Options) (*Session, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	return Accept(listener, options)
+}
+
+// accepts a player from the listener and starts a session as the host
+func Accept(listener net.Listener, options Options) (*Session, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewHost(conn, options)
+}
+
+// connects to a host and starts a session as the guest
+func Join(addr string) (*Session, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewGuest(conn)
+}
+
+// starts a session as the host on a connection to the other player, the
+// console of the guest is synchronized to the current state of this console
+func NewHost(conn net.Conn, options Options) (*Session, error) {
+	session := newSession(conn, 0, options)
+	if err := session.hostHandshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	session.start()
+	return session, nil
+}
+
+// starts a session as the guest on a connection to the host, the console is
+// synchronized to the state of the host console
+func NewGuest(conn net.Conn) (*Session, error) {
+	session := newSession(conn, 1, Options{})
+	if err := session.guestHandshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	session.start()
+	return session, nil
+}
+
+func newSession(conn net.Conn, port int, options Options) *Session {
+	return &Session{
+		conn:         conn,
+		reader:       bufio.NewReader(conn),
+		writer:       bufio.NewWriter(conn),
+		messages:     make(chan message, 256),
+		Port:         port,
+		Delay:        options.Delay,
+		Rollback:     options.Rollback,
+		HashInterval: DefaultHashInterval,
+		StepFrame:    func() { console.RunFrame(nil) },
+		localInputs:  make(map[uint]uint8),
+		remoteInputs: make(map[uint]uint8),
+		localHashes:  make(map[uint]uint64),
+		remoteHashes: make(map[uint]uint64),
+	}
+}
+
+func (session *Session) hostHandshake() error {
+	err := writeHello(session.writer, hello{
+		romChecksum: console.Cartridge.Checksum(),
+		delay:       uint8(session.Delay),
+		rollback:    session.Rollback,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeState(session.writer, console.SaveState()); err != nil {
+		return err
+	}
+	guest, err := readHello(session.reader)
+	if err != nil {
+		return err
+	}
+	if guest.romChecksum != console.Cartridge.Checksum() {
+		return ErrRom
+	}
+	return nil
+}
+
+func (session *Session) guestHandshake() error {
+	host, err := readHello(session.reader)
+	if err != nil {
+		return err
+	}
+	if host.romChecksum != console.Cartridge.Checksum() {
+		return ErrRom
+	}
+	state, err := readState(session.reader)
+	if err != nil {
+		return err
+	}
+	if err := console.LoadState(state); err != nil {
+		return err
+	}
+	session.Delay = uint(host.delay)
+	session.Rollback = host.rollback
+	return writeHello(session.writer, host)
+}
+
+// the first Delay frames have no input, as nothing could be sent for them
+func (session *Session) start() {
+	for frame := range session.Delay {
+		session.localInputs[frame] = 0
+		session.remoteInputs[frame] = 0
+	}
+	if session.Rollback {
+		session.startRollback()
+	}
+	go session.receive()
+}
+
+// reads the messages of the other player until the connection is closed
+func (session *Session) receive() {
+	for {
+		msg, err := readMessage(session.reader)
+		if err != nil {
+			session.readErr = err
+			close(session.messages)
+			return
+		}
+		session.messages <- msg
+	}
+}
+
+// returns the frames emulated since the session started
+func (session *Session) Frame() uint {
+	return session.frame
+}
+
+// Update sends the local input and sets the controllers with the inputs of
+// both players for the next frame. The local player uses the controls of
+// port 0, which are read from the first controller, so it must be called
+// after the controllers are updated and before the frame is emulated
+func (session *Session) Update() error {
+	if session.err != nil {
+		return session.err
+	}
+	var err error
+	if session.Rollback {
+		err = session.updateRollback()
+	} else {
+		err = session.updateLockstep()
+	}
+	if err != nil {
+		return session.fail(err)
+	}
+	return nil
+}
+
+// sends the local input for the frame Delay frames ahead
+func (session *Session) sendInput() error {
+	target := session.frame + session.Delay
+	session.localInputs[target] = console.JoyPad1.GetButtonMask()
+	writeMessage(session.writer, message{kind: msgInput, frame: uint32(target), buttons: session.localInputs[target]})
+	return session.writer.Flush()
+}
+
+func (session *Session) sendHash(frame uint, hash uint64) error {
+	session.localHashes[frame] = hash
+	writeMessage(session.writer, message{kind: msgHash, frame: uint32(frame), hash: hash})
+	return session.compareHashes(frame)
+}
+
+// waits for the next message of the other player and handles it
+func (session *Session) waitMessage() error {
+	msg, ok := <-session.messages
+	if !ok {
+		return fmt.Errorf("%w: %w", ErrDisconnected, session.readErr)
+	}
+	return session.handleMessage(msg)
+}
+
+// sets the controller of each player with its input for the frame
+func (session *Session) setControllers(local uint8, remote uint8) {
+	joyPads := [2]*controller.JoyPad{console.JoyPad1, console.JoyPad2}
+	joyPads[session.Port].SetButtonMask(local)
+	joyPads[1-session.Port].SetButtonMask(remote)
+}
+
+func (session *Session) handleMessage(msg message) error {
+	frame := uint(msg.frame)
+	switch msg.kind {
+	case msgInput:
+		if frame < session.confirmed {
+			return ErrProtocol
+		}
+		session.remoteInputs[frame] = msg.buttons
+	case msgHash:
+		session.remoteHashes[frame] = msg.hash
+		return session.compareHashes(frame)
+	}
+	return nil
+}
+
+// compares the hashes of both consoles for the frame once both are known
+func (session *Session) compareHashes(frame uint) error {
+	local, ok := session.localHashes[frame]
+	if !ok {
+		return nil
+	}
+	remote, ok := session.remoteHashes[frame]
+	if !ok {
+		return nil
+	}
+	delete(session.localHashes, frame)
+	delete(session.remoteHashes, frame)
+	if local != remote {
+		return fmt.Errorf("%w at frame %d", ErrDesync, frame)
+	}
+	return nil
+}
+
+// ends the session with the error, the connection is closed
+func (session *Session) fail(err error) error {
+	session.err = err
+	session.conn.Close()
+	return err
+}
+
+func (session *Session) Close() error {
+	return session.conn.Close()
+}
@@ -0,0 +1,38 @@
+package ppu
+
+import "vsasakiv/nesemulator/hooks"
+
+// ----- Debugger hooks -----
+
+// kinds of the accesses seen by the hooks
+const (
+	// the cpu reads the ppu memory through PPUDATA
+	AccessRead = iota
+	// the cpu writes the ppu memory through PPUDATA
+	AccessWrite
+	// the ppu reads its memory to draw the frame
+	AccessRender
+)
+
+// Hook is called on every access to the ppu memory, with the address and the
+// value of the ppu memory
+type Hook func(access int, addr uint16, val uint8)
+
+// hooks of the attached tools, as the debugger and the code/data logger
+var debugHooks hooks.List[Hook]
+
+// AddHook attaches the hook to the ppu, the returned function detaches it
+func AddHook(hook Hook) (remove func()) {
+	return debugHooks.Add(hook)
+}
+
+func callHooks(access int, addr uint16, val uint8) {
+	for hook := range debugHooks.All() {
+		hook(access, addr, val)
+	}
+}
+
+// reads the ppu memory without calling the hooks, for debuggers and viewers
+func PeekMemory(addr uint16) uint8 {
+	return ppuMemRead(addr)
+}
@@ -0,0 +1,28 @@
+package ppu
+
+import "testing"
+
+func TestIoLatchDecay(t *testing.T) {
+	var ppu Ppu
+	ppu.WriteIoLatch(0xFF)
+	for range ioLatchDecayFrames / 2 {
+		ppu.decayIoLatch()
+	}
+	// the status read sets the high bits again
+	ppu.ppuStatus = 0x80
+	if status := ppu.ReadPpuStatusRegister(); status != 0x9F {
+		t.Fatalf("the status read %02X, want 9F", status)
+	}
+	for range ioLatchDecayFrames/2 + 1 {
+		ppu.decayIoLatch()
+	}
+	if latch := ppu.ReadIoLatch(); latch != 0x80 {
+		t.Errorf("the latch is %02X after the low bits decayed, want 80", latch)
+	}
+	for range ioLatchDecayFrames {
+		ppu.decayIoLatch()
+	}
+	if latch := ppu.ReadIoLatch(); latch != 0 {
+		t.Errorf("the latch is %02X after every bit decayed, want 00", latch)
+	}
+}
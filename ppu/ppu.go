@@ -40,11 +40,12 @@ type Ppu struct {
 	ppuBackgroundEnabled bool
 	// internal buffers
 	readBuffer uint8
+	// the latch of the ppu data bus and the frames since each of its bits was set
+	ioLatch    uint8
+	ioLatchAge [8]uint8
 	// simulation clock cycles and scanlines
 	cycles    uint
 	scanlines uint
-	// nmi interrupt signal
-	NmiInterrupt bool
 	// color palette
 	systemPalette [64][3]uint8
 	// frame control
@@ -70,6 +71,17 @@ type Ppu struct {
 
 // Initialize ppu with corret parameters, also initialize system palette
 func NewPpu() *Ppu {
+	return newPpu(GenerateDefaultPalette())
+}
+
+// position of the ppu when the console is turned on, the last dot before the
+// vblank scanline
+const (
+	PowerOnScanline = 240
+	PowerOnDot      = 340
+)
+
+func newPpu(systemPalette [64][3]uint8) *Ppu {
 	var ppu Ppu
 
 	ppu.outputBackgroundRgb = make([][3]uint8, 16)
@@ -77,9 +89,9 @@ func NewPpu() *Ppu {
 	ppu.bufferFrames[0] = NewFrame()
 	ppu.bufferFrames[1] = NewFrame()
 
-	ppu.cycles = 340
-	ppu.scanlines = 240
-	ppu.systemPalette = GenerateFromPalFile("./ppu/palettes/2C02.pal")
+	ppu.cycles = PowerOnDot
+	ppu.scanlines = PowerOnScanline
+	ppu.systemPalette = systemPalette
 	return &ppu
 }
 
@@ -157,13 +169,10 @@ func Clock() {
 	if vblank {
 		// swap front buffer
 		ppu.frontBuffer = 1 - ppu.frontBuffer
-		if ppu.getControlSetting(VBLANK_NMI_ENABLE) == 1 {
-			ppu.NmiInterrupt = true
-		}
+		ppu.decayIoLatch()
 		ppu.setVblankStatus(1)
 	}
 	if vblankEnd {
-		ppu.NmiInterrupt = false
 		ppu.clearSpriteZeroHit()
 		ppu.setVblankStatus(0)
 	}
@@ -180,20 +189,16 @@ func (ppu *Ppu) runCycle() {
 	}
 }
 
-func (ppu *Ppu) PollForNmiInterrupt() bool {
-	if ppu.NmiInterrupt {
-		ppu.NmiInterrupt = false
-		return true
-	}
-	return false
+// the nmi line is active while the vblank flag is set and the nmi is enabled,
+// the cpu takes the nmi when the line becomes active, so enabling the nmi
+// during the vblank or reading $2002 change when it happens
+func (ppu *Ppu) NmiLine() bool {
+	return ppu.ppuStatus&0x80 != 0 && ppu.ppuCtrl&0x80 != 0
 }
 
 // ----- PPUCTRL 0x2000 REGISTER -----
 
 func (ppu *Ppu) WriteToPpuControl(val uint8) {
-	if (val>>7)&0b1 == 1 && (ppu.ppuCtrl>>7)&0b1 == 0 && (ppu.ppuStatus>>7)&0b1 == 1 {
-		ppu.NmiInterrupt = true
-	}
 	ppu.ppuCtrl = val
 	// t: ...GH.. ........ <- d: ......GH
 	ppu.loopyT = SetBitToVal(ppu.loopyT, 10, val&0b1)
@@ -259,8 +264,10 @@ func (ppu *Ppu) getMaskSetting(setting string) uint8 {
 
 // ----- PPUSTATUS 0x2002 REGISTER -----
 
+// the low 5 bits are not driven and read as the io latch
 func (ppu *Ppu) ReadPpuStatusRegister() uint8 {
-	status := ppu.ppuStatus
+	ppu.setIoLatch(ppu.ppuStatus, 0xE0)
+	status := ppu.ioLatch
 	ppu.write = 0
 	ppu.setVblankStatus(0)
 	return status
@@ -296,7 +303,8 @@ func (ppu *Ppu) WriteToOamDataRegister(val uint8) {
 }
 
 func (ppu *Ppu) ReadOamDataRegister() uint8 {
-	return PpuOamRead(ppu.ppuOamAddr)
+	ppu.setIoLatch(PpuOamRead(ppu.ppuOamAddr), 0xFF)
+	return ppu.ioLatch
 }
 
 // ----- PPUSCROLL 0x2005 REGISTER -----
@@ -371,23 +379,68 @@ func (ppu *Ppu) incrementAddrRegister() {
 
 func (ppu *Ppu) ReadPpuDataRegister() uint8 {
 	// if it is pallete ram, return the value instantly
-	val := PpuMemRead(ppu.loopyV)
+	val := ppuMemRead(ppu.loopyV)
+	if debugHooks.Len() > 0 {
+		callHooks(AccessRead, ppu.loopyV%0x4000, val)
+	}
+	// the palette has 6 bits, the other 2 are the io latch
 	if ppu.loopyV%0x4000 >= 0x3F00 {
 		ppu.readBuffer = val
+		ppu.setIoLatch(val, 0x3F)
 	} else {
-		tmp := ppu.readBuffer
+		ppu.setIoLatch(ppu.readBuffer, 0xFF)
 		ppu.readBuffer = val
-		val = tmp
 	}
 	ppu.incrementAddrRegister()
-	return val
+	return ppu.ioLatch
 }
 
 func (ppu *Ppu) WriteToPpuDataRegister(val uint8) {
+	if debugHooks.Len() > 0 {
+		callHooks(AccessWrite, ppu.loopyV%0x4000, val)
+	}
 	PpuMemWrite(ppu.loopyV, val)
 	ppu.incrementAddrRegister()
 }
 
+// ----- I/O latch -----
+
+// the registers share a latch with the last value written or read, the
+// write-only registers and the bits a read doesn't drive read as it, and each
+// of its bits decays to 0 about 600ms after it was last set
+const ioLatchDecayFrames = 36
+
+// called on every cpu write to a ppu register
+func (ppu *Ppu) WriteIoLatch(val uint8) {
+	ppu.setIoLatch(val, 0xFF)
+}
+
+// the value read from the write-only registers
+func (ppu *Ppu) ReadIoLatch() uint8 {
+	return ppu.ioLatch
+}
+
+// sets the bits of the mask to the value
+func (ppu *Ppu) setIoLatch(val uint8, mask uint8) {
+	ppu.ioLatch = ppu.ioLatch&^mask | val&mask
+	for bit := range ppu.ioLatchAge {
+		if mask&(1<<bit) != 0 {
+			ppu.ioLatchAge[bit] = 0
+		}
+	}
+}
+
+// called once per frame
+func (ppu *Ppu) decayIoLatch() {
+	for bit := range ppu.ioLatchAge {
+		if ppu.ioLatchAge[bit] < ioLatchDecayFrames {
+			ppu.ioLatchAge[bit]++
+			continue
+		}
+		ppu.ioLatch &^= 1 << bit
+	}
+}
+
 // ----- Rendering -----
 
 func (ppu *Ppu) renderPixel() {
@@ -731,6 +784,11 @@ func GetPpuStatus() mappers.Status {
 
 // ----- DEBUG -----
 
+// returns the scanline and the dot being drawn
+func (ppu *Ppu) Position() (uint, uint) {
+	return ppu.scanlines, ppu.cycles
+}
+
 func (ppu *Ppu) TracePpuStatus() string {
 	return fmt.Sprintf("PPU:%03d, %03d  ADDR: %04X CTRL:%08b STATUS: %08b", ppu.scanlines, ppu.cycles, ppu.loopyV, ppu.ppuCtrl, ppu.ppuStatus)
 }
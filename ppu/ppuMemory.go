@@ -39,7 +39,16 @@ func LoadCartridge(mapper mappers.Mapper) {
 	PpuMemory.mapper = mapper
 }
 
+// reads the ppu memory for the rendering
 func PpuMemRead(addr uint16) uint8 {
+	val := ppuMemRead(addr)
+	if debugHooks.Len() > 0 {
+		callHooks(AccessRender, addr%0x4000, val)
+	}
+	return val
+}
+
+func ppuMemRead(addr uint16) uint8 {
 	addr = addr % 0x4000
 	if addr <= 0x1FFF {
 		return PpuMemory.mapper.Read(addr)
@@ -77,9 +86,15 @@ func PpuMemReadTileLine(addr uint16, fineY uint16) [2]uint8 {
 }
 
 func PpuMemReadTile(addr uint16) []uint8 {
+	return readTile(PpuMemRead, addr)
+}
+
+// reads the 16 bytes of the tile with the read function, the viewers read
+// without calling the hooks
+func readTile(read func(uint16) uint8, addr uint16) []uint8 {
 	var tile [16]uint8
 	for i := range uint8(16) {
-		tile[i] = PpuMemRead(addr + uint16(i))
+		tile[i] = read(addr + uint16(i))
 	}
 	return tile[:]
 }
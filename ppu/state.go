@@ -0,0 +1,59 @@
+package ppu
+
+import "vsasakiv/nesemulator/savestate"
+
+// saves or loads the ppu registers, the rendering state, both frame buffers
+// and the ppu memory
+func Serialize(stream *savestate.Stream) {
+	stream.Uint8(&ppu.ppuCtrl)
+	stream.Uint8(&ppu.ppuMask)
+	stream.Uint8(&ppu.ppuStatus)
+	stream.Uint8(&ppu.ppuOamAddr)
+	stream.Uint8(&ppu.ppuOamData)
+	stream.Bool(&ppu.ppuSpriteEnabled)
+	stream.Bool(&ppu.ppuBackgroundEnabled)
+	stream.Uint8(&ppu.readBuffer)
+	stream.Uint8(&ppu.ioLatch)
+	stream.Bytes(ppu.ioLatchAge[:])
+	stream.Uint(&ppu.cycles)
+	stream.Uint(&ppu.scanlines)
+
+	stream.Bytes(ppu.bufferFrames[0].PixelData[:])
+	stream.Bytes(ppu.bufferFrames[1].PixelData[:])
+	stream.Uint(&ppu.frontBuffer)
+
+	for i := range ppu.spriteLine {
+		stream.Bytes(ppu.spriteLine[i][:])
+		for j := range ppu.spritePalette[i] {
+			stream.Bytes(ppu.spritePalette[i][j][:])
+		}
+	}
+	stream.Bytes(ppu.spritePosition[:])
+	stream.Bytes(ppu.spriteNumber[:])
+	stream.Bytes(ppu.spritePriority[:])
+	stream.Uint(&ppu.spriteCount)
+
+	stream.Uint16(&ppu.loopyV)
+	stream.Uint16(&ppu.loopyT)
+	stream.Uint8(&ppu.fineX)
+	stream.Uint8(&ppu.write)
+
+	stream.Uint(&ppu.currentPixel)
+	for i := range ppu.outputBackgroundRgb {
+		stream.Bytes(ppu.outputBackgroundRgb[i][:])
+	}
+	stream.Bytes(ppu.outputBackgroundVal)
+
+	stream.Bytes(PpuMemory.vram[:])
+	stream.Bytes(PpuMemory.paletteRam[:])
+	stream.Bytes(PpuMemory.oam[:])
+}
+
+// puts the ppu and its memory in the same state as when the console is turned on,
+// the loaded cartridge and the system palette are kept
+func PowerOn() {
+	ppu = *newPpu(ppu.systemPalette)
+	PpuMemory.vram = [0x0800]uint8{}
+	PpuMemory.paletteRam = [0x0100]uint8{}
+	PpuMemory.oam = [0x0100]uint8{}
+}
@@ -2,14 +2,23 @@ package ppu
 
 import (
 	"bufio"
+	"bytes"
+	_ "embed"
 	"fmt"
 	"io"
 	"os"
 )
 
-func GenerateFromPalFile(path string) [64][3]uint8 {
-	var palette [64][3]uint8
+// palette of the 2C02 built in the binary, so the ppu does not depend on the working directory
+//
+//go:embed palettes/2C02.pal
+var defaultPalFile []byte
+
+func GenerateDefaultPalette() [64][3]uint8 {
+	return GenerateFromPal(bytes.NewReader(defaultPalFile))
+}
 
+func GenerateFromPalFile(path string) [64][3]uint8 {
 	file, err := os.Open(path)
 	if err != nil {
 		fmt.Println("Error opening file", err)
@@ -17,11 +26,17 @@ func GenerateFromPalFile(path string) [64][3]uint8 {
 	}
 
 	defer file.Close()
-	reader := bufio.NewReader(file)
+	return GenerateFromPal(file)
+}
+
+// reads a .pal palette, 64 colors of 3 bytes each
+func GenerateFromPal(palFile io.Reader) [64][3]uint8 {
+	var palette [64][3]uint8
+	reader := bufio.NewReader(palFile)
 
 	for i := range uint8(64) {
 		color := make([]byte, 3)
-		_, err = io.ReadFull(reader, color)
+		_, err := io.ReadFull(reader, color)
 		if err != nil {
 			fmt.Println("Error reading palette", err)
 			panic("Error reading from file")
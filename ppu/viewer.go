@@ -0,0 +1,218 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+)
+
+// ----- Viewers -----
+
+// the viewers draw the ppu memory as images, for the debug windows, the
+// memory is peeked so they do not disturb the hooks
+
+const (
+	// size of a pattern table image, 16x16 tiles
+	PatternTableSize = 128
+	// the four nametables are drawn in a 2x2 grid, as they are addressed
+	NametablesWidth  = 2 * XSIZE
+	NametablesHeight = 2 * YSIZE
+	// 8 palettes of 4 colors, the background ones followed by the sprite ones
+	PaletteRamSize = 0x20
+	Palettes       = 8
+)
+
+// color of the scroll region drawn over the nametables
+var ScrollOverlayColor = color.RGBA{R: 0xFF, G: 0x30, B: 0x30, A: 0xFF}
+
+// returns the color of the palette entry, as shown on the screen
+func PaletteColor(entry uint8) color.RGBA {
+	rgb := ppu.systemPalette[ppuMemRead(DEFAULT_BG_PALETTE_ADDRESS+uint16(entry%PaletteRamSize))&0x3F]
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF}
+}
+
+// returns the 32 bytes of the palette ram, the indexes of the system palette
+func PaletteRam() [PaletteRamSize]uint8 {
+	var palettes [PaletteRamSize]uint8
+	for i := range palettes {
+		palettes[i] = ppuMemRead(DEFAULT_BG_PALETTE_ADDRESS + uint16(i))
+	}
+	return palettes
+}
+
+// returns the color of the pixel value in the palette, 0 is the backdrop color
+func pixelColor(palette uint8, pixel uint8) color.RGBA {
+	if pixel == 0 {
+		return PaletteColor(0)
+	}
+	return PaletteColor(palette%Palettes*4 + pixel)
+}
+
+// returns the 2 bit value of the pixel of the tile
+func tilePixel(tile []uint8, x, y int) uint8 {
+	lsb := tile[y] >> (7 - x) & 0b1
+	msb := tile[y+8] >> (7 - x) & 0b1
+	return lsb | msb<<1
+}
+
+// draws the 8x8 tile at the pattern table address, pixels of value 0 are
+// left transparent when the backdrop is not drawn
+func drawTile(img *image.RGBA, x, y int, addr uint16, palette uint8, flipHorizontal, flipVertical, backdrop bool) {
+	tile := readTile(PeekMemory, addr)
+	for row := range 8 {
+		for col := range 8 {
+			srcRow, srcCol := row, col
+			if flipVertical {
+				srcRow = 7 - row
+			}
+			if flipHorizontal {
+				srcCol = 7 - col
+			}
+			pixel := tilePixel(tile, srcCol, srcRow)
+			if pixel == 0 && !backdrop {
+				continue
+			}
+			img.SetRGBA(x+col, y+row, pixelColor(palette, pixel))
+		}
+	}
+}
+
+// ----- Pattern tables -----
+
+// PatternTable draws the 256 tiles of the pattern table, 0 or 1, with the
+// colors of one of the 8 palettes
+func PatternTable(table uint16, palette uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, PatternTableSize, PatternTableSize))
+	base := (table & 1) * 0x1000
+	for tile := range uint16(256) {
+		x := int(tile%16) * 8
+		y := int(tile/16) * 8
+		drawTile(img, x, y, base+tile*0x10, palette, false, false, true)
+	}
+	return img
+}
+
+// ----- Nametables -----
+
+// Nametables draws the four nametables with the background pattern table
+// and their attributes, the mirrored ones show the same vram
+func Nametables() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, NametablesWidth, NametablesHeight))
+	patterns := uint16(ppu.getControlSetting(BACKGROUND_TABLE_ADDRESS)) * 0x1000
+	for nametable := range uint16(4) {
+		base := 0x2000 + nametable*0x0400
+		originX := int(nametable%2) * XSIZE
+		originY := int(nametable/2) * YSIZE
+		for row := range uint16(30) {
+			for col := range uint16(32) {
+				tile := peekVram(base + row*32 + col)
+				attribute := peekVram(base + NAMETABLE_SIZE + row/4*8 + col/4)
+				// each attribute byte has the palettes of 4 blocks of 2x2 tiles
+				shift := (row%4)/2*4 + (col%4)/2*2
+				palette := (attribute >> shift) & 0b11
+				drawTile(img, originX+int(col)*8, originY+int(row)*8, patterns+uint16(tile)*0x10, palette, false, false, true)
+			}
+		}
+	}
+	return img
+}
+
+// reads the nametable byte, through the mirroring of the cartridge
+func peekVram(addr uint16) uint8 {
+	return PpuMemory.vram[mirrorVramAddress(addr)]
+}
+
+// Scroll returns the position of the top left corner of the screen in the
+// nametables image, as set by PPUCTRL and PPUSCROLL for the next frame
+func (ppu *Ppu) Scroll() (x, y int) {
+	x = int(ppu.loopyT>>10&1)*XSIZE + int(ppu.loopyT&0x1F)*8 + int(ppu.fineX)
+	y = int(ppu.loopyT>>11&1)*YSIZE + int(ppu.loopyT>>5&0x1F)*8 + int(ppu.loopyT>>12&0b111)
+	return x, y
+}
+
+// ScrollOverlay draws the outline of the screen over the nametables image,
+// wrapping around its edges as the scrolling does
+func ScrollOverlay(img *image.RGBA) {
+	scrollX, scrollY := ppu.Scroll()
+	set := func(x, y int) {
+		img.SetRGBA((scrollX+x)%NametablesWidth, (scrollY+y)%NametablesHeight, ScrollOverlayColor)
+	}
+	for x := range XSIZE {
+		set(x, 0)
+		set(x, YSIZE-1)
+	}
+	for y := range YSIZE {
+		set(0, y)
+		set(XSIZE-1, y)
+	}
+}
+
+// ----- Sprites -----
+
+// Sprite is one of the 64 entries of the oam, as the game wrote it
+type Sprite struct {
+	Y, Tile, Attributes, X uint8
+}
+
+// returns the 64 sprites of the oam
+func Sprites() [64]Sprite {
+	var sprites [64]Sprite
+	for i := range sprites {
+		idx := uint8(i * 4)
+		sprites[i] = Sprite{
+			Y:          PpuOamRead(idx),
+			Tile:       PpuOamRead(idx + 1),
+			Attributes: PpuOamRead(idx + 2),
+			X:          PpuOamRead(idx + 3),
+		}
+	}
+	return sprites
+}
+
+// returns the sprite palette, from 4 to 7
+func (sprite Sprite) Palette() uint8 {
+	return 4 + sprite.Attributes&0b11
+}
+
+// returns whether the sprite is drawn behind the background
+func (sprite Sprite) Behind() bool {
+	return (sprite.Attributes>>5)&0b1 == 1
+}
+
+func (sprite Sprite) FlipHorizontal() bool {
+	return (sprite.Attributes>>6)&0b1 == 1
+}
+
+func (sprite Sprite) FlipVertical() bool {
+	return (sprite.Attributes>>7)&0b1 == 1
+}
+
+// returns the height of the sprites, 8 or 16 as set by PPUCTRL
+func SpriteHeight() int {
+	if ppu.getControlSetting(SPRITE_SIZE) == 1 {
+		return 16
+	}
+	return 8
+}
+
+// SpriteImage draws the sprite with its palette and flips, the transparent
+// pixels are left transparent
+func SpriteImage(sprite Sprite) *image.RGBA {
+	height := SpriteHeight()
+	img := image.NewRGBA(image.Rect(0, 0, 8, height))
+	flipHorizontal, flipVertical := sprite.FlipHorizontal(), sprite.FlipVertical()
+	if height == 8 {
+		addr := uint16(ppu.getControlSetting(SPRITE_TABLE_ADDRESS))*0x1000 + uint16(sprite.Tile)*0x10
+		drawTile(img, 0, 0, addr, sprite.Palette(), flipHorizontal, flipVertical, false)
+		return img
+	}
+	// 8x16 sprites take the pattern table from bit 0 of the tile, and the
+	// bottom tile is drawn at the top when flipped vertically
+	top := uint16(sprite.Tile&0x01)*0x1000 + uint16(sprite.Tile&0xFE)*0x10
+	bottom := top + 0x10
+	if flipVertical {
+		top, bottom = bottom, top
+	}
+	drawTile(img, 0, 0, top, sprite.Palette(), flipHorizontal, flipVertical, false)
+	drawTile(img, 0, 8, bottom, sprite.Palette(), flipHorizontal, flipVertical, false)
+	return img
+}
@@ -0,0 +1,159 @@
+package ppu
+
+import (
+	"image/color"
+	"testing"
+	"vsasakiv/nesemulator/cartridge"
+	"vsasakiv/nesemulator/mappers"
+)
+
+// loads a cartridge with chr ram, so the tests can write the pattern tables
+func loadTestCartridge(mirroring string) {
+	rom := &cartridge.Cartridge{
+		PrgRom:        make([]uint8, 0x4000),
+		PrgRomSize:    0x4000,
+		ChrRam:        make([]uint8, 0x2000),
+		ChrRamSize:    0x2000,
+		MirroringType: mirroring,
+	}
+	LoadCartridge(mappers.NewMapper2(rom))
+	ppu = *NewPpu()
+	PpuMemory.vram = [0x0800]uint8{}
+	PpuMemory.oam = [0x0100]uint8{}
+	// the colors of the palettes are the system colors $01, $02, $03 ...,
+	// the backdrop is $10, written last through its mirror at $3F10
+	for i := range uint16(PaletteRamSize) {
+		PpuMemWrite(DEFAULT_BG_PALETTE_ADDRESS+i, uint8(i))
+	}
+}
+
+// writes a tile whose pixels are 1 in the first row, 2 in the first column and
+// 3 in the pixel at both
+func writeTestTile(addr uint16) {
+	PpuMemWrite(addr, 0xFF)
+	for row := range uint16(8) {
+		PpuMemWrite(addr+8+row, 0x80)
+	}
+}
+
+func systemColor(index uint8) color.RGBA {
+	rgb := ppu.systemPalette[index]
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF}
+}
+
+func TestPatternTable(t *testing.T) {
+	loadTestCartridge(cartridge.HorizontalMirroring)
+	// tile $11 of the second pattern table
+	writeTestTile(0x1000 + 0x11*0x10)
+
+	img := PatternTable(1, 2)
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{8, 8, systemColor(2*4 + 3)},
+		{9, 8, systemColor(2*4 + 1)},
+		{8, 9, systemColor(2*4 + 2)},
+		// value 0 is the backdrop, from the first palette entry
+		{9, 9, PaletteColor(0)},
+	}
+	for _, test := range tests {
+		if got := img.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel %d,%d is %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+	if got := PatternTable(0, 2).RGBAAt(9, 8); got != PaletteColor(0) {
+		t.Errorf("the tile was drawn in the first pattern table")
+	}
+}
+
+func TestNametables(t *testing.T) {
+	loadTestCartridge(cartridge.VerticalMirroring)
+	writeTestTile(0x0005 * 0x10)
+	// tile 5 at row 2, column 3 of the first nametable, in the bottom right
+	// block of its attribute, with palette 3
+	PpuMemWrite(0x2000+2*32+3, 0x05)
+	PpuMemWrite(0x2000+NAMETABLE_SIZE, 0b11<<6)
+
+	img := Nametables()
+	want := systemColor(3*4 + 3)
+	// with vertical mirroring the nametable at $2800 is the one at $2000
+	for _, origin := range [][2]int{{0, 0}, {0, YSIZE}} {
+		if got := img.RGBAAt(origin[0]+3*8, origin[1]+2*8); got != want {
+			t.Errorf("nametable at %v drew %v, want %v", origin, got, want)
+		}
+	}
+	if got := img.RGBAAt(XSIZE+3*8, 2*8); got != PaletteColor(0) {
+		t.Errorf("the tile was drawn in the nametable at $2400")
+	}
+}
+
+func TestScrollOverlay(t *testing.T) {
+	loadTestCartridge(cartridge.VerticalMirroring)
+	// scroll to x 260, y 10, with the second nametable selected
+	ppu.WriteToPpuControl(0b01)
+	ppu.WriteToPpuScroll(4)
+	ppu.WriteToPpuScroll(10)
+	if x, y := ppu.Scroll(); x != 260 || y != 10 {
+		t.Fatalf("scroll is %d,%d, want 260,10", x, y)
+	}
+
+	img := Nametables()
+	ScrollOverlay(img)
+	for _, point := range [][2]int{{260, 10}, {NametablesWidth - 1, 10}, {3, 10}, {3, 249}, {260, 249}} {
+		if got := img.RGBAAt(point[0], point[1]); got != ScrollOverlayColor {
+			t.Errorf("the outline does not pass at %v", point)
+		}
+	}
+	if got := img.RGBAAt(100, 100); got == ScrollOverlayColor {
+		t.Errorf("the outline was drawn inside the screen")
+	}
+}
+
+func TestSprites(t *testing.T) {
+	loadTestCartridge(cartridge.HorizontalMirroring)
+	writeTestTile(0x0007 * 0x10)
+	// sprite 1 shows tile 7 with palette 5, flipped on both axes
+	for i, val := range []uint8{0x20, 0x07, 0b11000001, 0x30} {
+		PpuOamWrite(4+uint8(i), val)
+	}
+
+	sprite := Sprites()[1]
+	if sprite.X != 0x30 || sprite.Y != 0x20 || sprite.Tile != 0x07 || sprite.Palette() != 5 {
+		t.Fatalf("sprite 1 is %+v", sprite)
+	}
+	if !sprite.FlipHorizontal() || !sprite.FlipVertical() || sprite.Behind() {
+		t.Fatalf("attributes of sprite 1 decoded wrong")
+	}
+
+	img := SpriteImage(sprite)
+	if got := img.RGBAAt(7, 7); got != systemColor(5*4+3) {
+		t.Errorf("the corner pixel is %v, want it flipped to the bottom right", got)
+	}
+	if got := img.RGBAAt(0, 0); got.A != 0 {
+		t.Errorf("the transparent pixel was drawn as %v", got)
+	}
+
+	// in 8x16 mode the flip also swaps the two tiles
+	ppu.WriteToPpuControl(1 << 5)
+	img = SpriteImage(Sprite{Tile: 0x06, Attributes: 0b10000000})
+	if img.Bounds().Dy() != 16 {
+		t.Fatalf("the 8x16 sprite has %d lines", img.Bounds().Dy())
+	}
+	if got := img.RGBAAt(0, 7); got != systemColor(4*4+3) {
+		t.Errorf("the bottom tile was not drawn flipped at the top, got %v", got)
+	}
+}
+
+func TestPaletteRam(t *testing.T) {
+	loadTestCartridge(cartridge.HorizontalMirroring)
+	PpuMemWrite(0x3F10, 0x0F)
+	palettes := PaletteRam()
+	// $3F10 mirrors $3F00
+	if palettes[0] != 0x0F || palettes[0x10] != 0x0F || palettes[5] != 5 {
+		t.Errorf("palette ram is % X", palettes)
+	}
+	if PaletteColor(5) != systemColor(5) {
+		t.Errorf("palette entry 5 has the wrong color")
+	}
+}
@@ -0,0 +1,168 @@
+package savestate
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrTruncated = errors.New("savestate: state is truncated")
+
+// Stream either writes values to a save state or reads them back, this way
+// each component lists its fields only once, in the same order, for both saving and loading
+type Stream struct {
+	data    []byte
+	offset  int
+	loading bool
+	err     error
+}
+
+// creates a stream that saves values into a new state
+func NewWriter() *Stream {
+	return &Stream{data: make([]byte, 0, 0x1000)}
+}
+
+// creates a stream that saves values into buf, reusing its memory, used by
+// states that are saved every frame
+func NewWriterBuffer(buf []byte) *Stream {
+	return &Stream{data: buf[:0]}
+}
+
+// creates a stream that loads values from a previously saved state
+func NewReader(data []byte) *Stream {
+	return &Stream{data: data, loading: true}
+}
+
+func (stream *Stream) Loading() bool {
+	return stream.loading
+}
+
+// returns the saved state
+func (stream *Stream) Data() []byte {
+	return stream.data
+}
+
+// returns the first error found while loading, if any
+func (stream *Stream) Err() error {
+	return stream.err
+}
+
+// returns the next n bytes of the state when loading, nil if they do not exist
+func (stream *Stream) next(n int) []byte {
+	if stream.err != nil {
+		return nil
+	}
+	if stream.offset+n > len(stream.data) {
+		stream.err = ErrTruncated
+		return nil
+	}
+	bytes := stream.data[stream.offset : stream.offset+n]
+	stream.offset += n
+	return bytes
+}
+
+func (stream *Stream) Uint8(val *uint8) {
+	if !stream.loading {
+		stream.data = append(stream.data, *val)
+		return
+	}
+	if bytes := stream.next(1); bytes != nil {
+		*val = bytes[0]
+	}
+}
+
+func (stream *Stream) Uint16(val *uint16) {
+	if !stream.loading {
+		stream.data = binary.LittleEndian.AppendUint16(stream.data, *val)
+		return
+	}
+	if bytes := stream.next(2); bytes != nil {
+		*val = binary.LittleEndian.Uint16(bytes)
+	}
+}
+
+func (stream *Stream) Uint32(val *uint32) {
+	if !stream.loading {
+		stream.data = binary.LittleEndian.AppendUint32(stream.data, *val)
+		return
+	}
+	if bytes := stream.next(4); bytes != nil {
+		*val = binary.LittleEndian.Uint32(bytes)
+	}
+}
+
+func (stream *Stream) Uint64(val *uint64) {
+	if !stream.loading {
+		stream.data = binary.LittleEndian.AppendUint64(stream.data, *val)
+		return
+	}
+	if bytes := stream.next(8); bytes != nil {
+		*val = binary.LittleEndian.Uint64(bytes)
+	}
+}
+
+// uint and int are always saved with 64 bits, so states do not depend on the platform
+func (stream *Stream) Uint(val *uint) {
+	tmp := uint64(*val)
+	stream.Uint64(&tmp)
+	*val = uint(tmp)
+}
+
+func (stream *Stream) Int(val *int) {
+	tmp := uint64(*val)
+	stream.Uint64(&tmp)
+	*val = int(tmp)
+}
+
+func (stream *Stream) Bool(val *bool) {
+	var tmp uint8
+	if *val {
+		tmp = 1
+	}
+	stream.Uint8(&tmp)
+	*val = tmp == 1
+}
+
+func (stream *Stream) Float32(val *float32) {
+	tmp := math.Float32bits(*val)
+	stream.Uint32(&tmp)
+	*val = math.Float32frombits(tmp)
+}
+
+func (stream *Stream) Float64(val *float64) {
+	tmp := math.Float64bits(*val)
+	stream.Uint64(&tmp)
+	*val = math.Float64frombits(tmp)
+}
+
+// saves or loads a fixed size block of bytes, such as a ram
+func (stream *Stream) Bytes(val []uint8) {
+	if !stream.loading {
+		stream.data = append(stream.data, val...)
+		return
+	}
+	if bytes := stream.next(len(val)); bytes != nil {
+		copy(val, bytes)
+	}
+}
+
+// saves or loads a block of bytes whose size is stored in the state, the
+// block is reallocated on load if its size changed
+func (stream *Stream) Slice(val *[]uint8) {
+	size := uint(len(*val))
+	stream.Uint(&size)
+	if stream.loading && stream.err == nil && size != uint(len(*val)) {
+		if size > uint(len(stream.data)-stream.offset) {
+			stream.err = ErrTruncated
+			return
+		}
+		*val = make([]uint8, size)
+	}
+	stream.Bytes(*val)
+}
+
+func (stream *Stream) String(val *string) {
+	bytes := []byte(*val)
+	stream.Slice(&bytes)
+	*val = string(bytes)
+}
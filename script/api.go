@@ -0,0 +1,235 @@
+package script
+
+import (
+	"log"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/controller"
+	"vsasakiv/nesemulator/cpu"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// names of the buttons in the joypad tables, as FCEUX names them
+var buttonNames = [8]string{
+	controller.A:      "A",
+	controller.B:      "B",
+	controller.SELECT: "select",
+	controller.START:  "start",
+	controller.UP:     "up",
+	controller.DOWN:   "down",
+	controller.LEFT:   "left",
+	controller.RIGHT:  "right",
+}
+
+// registers the FCEUX libraries in the lua state
+func (script *Script) register() {
+	state := script.state
+	libraries := map[string]map[string]lua.LGFunction{
+		"emu": {
+			"frameadvance":   script.frameAdvance,
+			"framecount":     frameCount,
+			"message":        message,
+			"print":          message,
+			"softreset":      softReset,
+			"poweron":        powerOn,
+			"registerbefore": script.registerCallback(&script.before),
+			"registerafter":  script.registerCallback(&script.after),
+			"registerexit":   script.registerCallback(&script.exit),
+		},
+		"memory": {
+			"readbyte":         readByte,
+			"readbyteunsigned": readByte,
+			"readbytesigned":   readByteSigned,
+			"readword":         readWord,
+			"readwordunsigned": readWord,
+			"readwordsigned":   readWordSigned,
+			"readbyterange":    readByteRange,
+			"writebyte":        writeByte,
+			"registerwrite":    script.registerMemory(script.writes),
+			"register":         script.registerMemory(script.writes),
+			"registerexecute":  script.registerMemory(script.executes),
+			"registerexec":     script.registerMemory(script.executes),
+		},
+		"joypad": {
+			"get":   joypadGet,
+			"read":  joypadGet,
+			"set":   script.joypadSet,
+			"write": script.joypadSet,
+		},
+		"gui": {
+			"text":      script.guiText,
+			"drawtext":  script.guiText,
+			"box":       script.guiBox,
+			"drawbox":   script.guiBox,
+			"rect":      script.guiBox,
+			"pixel":     script.guiPixel,
+			"drawpixel": script.guiPixel,
+			"line":      script.guiLine,
+			"drawline":  script.guiLine,
+			"register":  script.registerCallback(&script.gui),
+		},
+		"bit": bitFunctions,
+	}
+	for name, functions := range libraries {
+		state.SetGlobal(name, state.SetFuncs(state.NewTable(), functions))
+	}
+	// the bit helpers of the old FCEUX scripts
+	for name, function := range globalBitFunctions {
+		state.SetGlobal(name, state.NewFunction(function))
+	}
+}
+
+// ----- emu -----
+
+func (script *Script) frameAdvance(state *lua.LState) int {
+	if state != script.thread {
+		state.RaiseError("emu.frameadvance can only be called by the main chunk, not by the callbacks")
+	}
+	return state.Yield()
+}
+
+func frameCount(state *lua.LState) int {
+	state.Push(lua.LNumber(console.Frame()))
+	return 1
+}
+
+func message(state *lua.LState) int {
+	log.Println("Lua:", state.ToStringMeta(state.Get(1)))
+	return 0
+}
+
+func softReset(state *lua.LState) int {
+	console.Reset()
+	return 0
+}
+
+func powerOn(state *lua.LState) int {
+	console.PowerOn()
+	return 0
+}
+
+// returns the function registering a frame callback, nil removes it
+func (script *Script) registerCallback(callback **lua.LFunction) lua.LGFunction {
+	return func(state *lua.LState) int {
+		*callback = state.OptFunction(1, nil)
+		return 0
+	}
+}
+
+// ----- memory -----
+
+// the memory is read and written without side effects, the registers of the
+// ppu and the apu are not accessed and read as 0
+func readByte(state *lua.LState) int {
+	state.Push(lua.LNumber(cpu.PeekMemory(uint16(state.CheckInt(1)))))
+	return 1
+}
+
+func readByteSigned(state *lua.LState) int {
+	state.Push(lua.LNumber(int8(cpu.PeekMemory(uint16(state.CheckInt(1))))))
+	return 1
+}
+
+// reads a little endian word, the high byte may be at another address
+func peekWord(state *lua.LState) uint16 {
+	low := uint16(state.CheckInt(1))
+	high := uint16(state.OptInt(2, int(low)+1))
+	return uint16(cpu.PeekMemory(low)) | uint16(cpu.PeekMemory(high))<<8
+}
+
+func readWord(state *lua.LState) int {
+	state.Push(lua.LNumber(peekWord(state)))
+	return 1
+}
+
+func readWordSigned(state *lua.LState) int {
+	state.Push(lua.LNumber(int16(peekWord(state))))
+	return 1
+}
+
+func readByteRange(state *lua.LState) int {
+	addr := uint16(state.CheckInt(1))
+	length := state.CheckInt(2)
+	data := make([]byte, max(length, 0))
+	for i := range data {
+		data[i] = cpu.PeekMemory(addr + uint16(i))
+	}
+	state.Push(lua.LString(data))
+	return 1
+}
+
+// as in FCEUX, the writes above the ram reach the ppu, apu and mapper
+// registers, without calling the write callbacks
+func writeByte(state *lua.LState) int {
+	cpu.PokeBus(uint16(state.CheckInt(1)), uint8(state.CheckInt(2)))
+	return 0
+}
+
+// returns the function registering a memory callback, called as
+// register(address, [size,] function), a nil function removes it
+func (script *Script) registerMemory(callbacks map[uint16]*lua.LFunction) lua.LGFunction {
+	return func(state *lua.LState) int {
+		addr := uint16(state.CheckInt(1))
+		size := 1
+		fnArg := 2
+		if state.Get(2).Type() == lua.LTNumber {
+			size = state.CheckInt(2)
+			fnArg = 3
+		}
+		registerRange(callbacks, addr, size, state.OptFunction(fnArg, nil))
+		return 0
+	}
+}
+
+// ----- joypad -----
+
+func joypadPort(state *lua.LState) *controller.JoyPad {
+	switch state.CheckInt(1) {
+	case 1:
+		return console.JoyPad1
+	case 2:
+		return console.JoyPad2
+	}
+	state.ArgError(1, "the port must be 1 or 2")
+	return nil
+}
+
+// returns a table with the pressed buttons set to true
+func joypadGet(state *lua.LState) int {
+	joyPad := joypadPort(state)
+	table := state.NewTable()
+	for button, name := range buttonNames {
+		table.RawSetString(name, lua.LBool(joyPad.GetButtonStatus(uint(button)) == 1))
+	}
+	state.Push(table)
+	return 1
+}
+
+// sets the buttons of the next frame, true presses the button, false
+// releases it and nil leaves it to the player
+func (script *Script) joypadSet(state *lua.LState) int {
+	joypadPort(state)
+	port := state.CheckInt(1) - 1
+	table := state.CheckTable(2)
+	buttons := make(map[uint]bool)
+	for button, name := range buttonNames {
+		if value := table.RawGetString(name); value != lua.LNil {
+			buttons[uint(button)] = lua.LVAsBool(value)
+		}
+	}
+	script.joypads[port] = buttons
+	return 0
+}
+
+func (script *Script) applyJoypads() {
+	for port, joyPad := range []*controller.JoyPad{console.JoyPad1, console.JoyPad2} {
+		for button, pressed := range script.joypads[port] {
+			var status uint
+			if pressed {
+				status = 1
+			}
+			joyPad.SetButtonStatus(button, status)
+		}
+		script.joypads[port] = nil
+	}
+}
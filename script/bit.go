@@ -0,0 +1,93 @@
+package script
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ----- bit -----
+
+// the bit library of LuaBitOp, on 32 bit integers, lua 5.1 has no operators for them
+var bitFunctions = map[string]lua.LGFunction{
+	"band":    bitFold(func(a, b uint32) uint32 { return a & b }),
+	"bor":     bitFold(func(a, b uint32) uint32 { return a | b }),
+	"bxor":    bitFold(func(a, b uint32) uint32 { return a ^ b }),
+	"bnot":    bitNot,
+	"lshift":  bitShift(func(a uint32, n uint) uint32 { return a << n }),
+	"rshift":  bitShift(func(a uint32, n uint) uint32 { return a >> n }),
+	"arshift": bitShift(func(a uint32, n uint) uint32 { return uint32(int32(a) >> n) }),
+	"tobit":   bitFold(func(a, b uint32) uint32 { return a }),
+	"tohex":   bitToHex,
+}
+
+// the global helpers of the FCEUX scripts
+var globalBitFunctions = map[string]lua.LGFunction{
+	"AND":   bitFunctions["band"],
+	"OR":    bitFunctions["bor"],
+	"XOR":   bitFunctions["bxor"],
+	"SHIFT": shift,
+	"BIT":   bit,
+}
+
+func checkBits(state *lua.LState, n int) uint32 {
+	return uint32(int64(state.CheckNumber(n)))
+}
+
+// pushes the result as a signed 32 bit number, as LuaBitOp does
+func pushBits(state *lua.LState, value uint32) int {
+	state.Push(lua.LNumber(int32(value)))
+	return 1
+}
+
+func bitFold(operation func(a, b uint32) uint32) lua.LGFunction {
+	return func(state *lua.LState) int {
+		result := checkBits(state, 1)
+		for i := 2; i <= state.GetTop(); i++ {
+			result = operation(result, checkBits(state, i))
+		}
+		return pushBits(state, result)
+	}
+}
+
+func bitNot(state *lua.LState) int {
+	return pushBits(state, ^checkBits(state, 1))
+}
+
+func bitShift(operation func(a uint32, n uint) uint32) lua.LGFunction {
+	return func(state *lua.LState) int {
+		return pushBits(state, operation(checkBits(state, 1), uint(state.CheckInt(2)&31)))
+	}
+}
+
+// tohex(value, [digits]) formats the lowest digits, in upper case when digits is negative
+func bitToHex(state *lua.LState) int {
+	digits := state.OptInt(2, 8)
+	format := "%0*x"
+	if digits < 0 {
+		digits = -digits
+		format = "%0*X"
+	}
+	digits = min(digits, 8)
+	value := checkBits(state, 1)
+	if digits < 8 {
+		value &= 1<<(4*uint(digits)) - 1
+	}
+	state.Push(lua.LString(fmt.Sprintf(format, digits, value)))
+	return 1
+}
+
+// SHIFT(value, n) shifts right by n, or left when n is negative
+func shift(state *lua.LState) int {
+	value := checkBits(state, 1)
+	n := state.CheckInt(2)
+	if n < 0 {
+		return pushBits(state, value<<uint(-n))
+	}
+	return pushBits(state, value>>uint(n))
+}
+
+// BIT(n) returns the number with only the bit n set
+func bit(state *lua.LState) int {
+	return pushBits(state, 1<<uint(state.CheckInt(1)))
+}
@@ -0,0 +1,199 @@
+package script
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// size of the overlay, the same of the screen
+const (
+	overlayWidth  = 256
+	overlayHeight = 240
+)
+
+// Text is a string printed by gui.text, the frontend draws it with its font
+type Text struct {
+	X, Y  int
+	Text  string
+	Color color.RGBA
+}
+
+// Overlay is what the script drew over the current frame, it is cleared
+// before every frame as in FCEUX
+type Overlay struct {
+	Image *image.RGBA
+	Texts []Text
+	// nothing was drawn since the last clear, the frontend skips the overlay
+	Empty bool
+}
+
+func NewOverlay() *Overlay {
+	return &Overlay{Image: image.NewRGBA(image.Rect(0, 0, overlayWidth, overlayHeight)), Empty: true}
+}
+
+func (overlay *Overlay) Clear() {
+	if overlay.Empty {
+		return
+	}
+	clear(overlay.Image.Pix)
+	overlay.Texts = overlay.Texts[:0]
+	overlay.Empty = true
+}
+
+// blends the color over the pixel, the pixels out of the screen are ignored
+func (overlay *Overlay) blend(x, y int, c color.RGBA) {
+	if !(image.Point{X: x, Y: y}).In(overlay.Image.Rect) || c.A == 0 {
+		return
+	}
+	overlay.Empty = false
+	draw.Draw(overlay.Image, image.Rect(x, y, x+1, y+1), image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+func (overlay *Overlay) fill(rect image.Rectangle, c color.RGBA) {
+	rect = rect.Intersect(overlay.Image.Rect)
+	if rect.Empty() || c.A == 0 {
+		return
+	}
+	overlay.Empty = false
+	draw.Draw(overlay.Image, rect, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+func (overlay *Overlay) line(x1, y1, x2, y2 int, c color.RGBA) {
+	dx := abs(x2 - x1)
+	dy := -abs(y2 - y1)
+	stepX, stepY := 1, 1
+	if x1 > x2 {
+		stepX = -1
+	}
+	if y1 > y2 {
+		stepY = -1
+	}
+	// bresenham
+	err := dx + dy
+	for {
+		overlay.blend(x1, y1, c)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		doubled := 2 * err
+		if doubled >= dy {
+			err += dy
+			x1 += stepX
+		}
+		if doubled <= dx {
+			err += dx
+			y1 += stepY
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ----- Colors -----
+
+var colorNames = map[string]color.RGBA{
+	"white":      {0xFF, 0xFF, 0xFF, 0xFF},
+	"black":      {0x00, 0x00, 0x00, 0xFF},
+	"clear":      {0x00, 0x00, 0x00, 0x00},
+	"gray":       {0x7F, 0x7F, 0x7F, 0xFF},
+	"grey":       {0x7F, 0x7F, 0x7F, 0xFF},
+	"red":        {0xFF, 0x00, 0x00, 0xFF},
+	"orange":     {0xFF, 0x7F, 0x00, 0xFF},
+	"yellow":     {0xFF, 0xFF, 0x00, 0xFF},
+	"chartreuse": {0x7F, 0xFF, 0x00, 0xFF},
+	"green":      {0x00, 0xFF, 0x00, 0xFF},
+	"teal":       {0x00, 0xFF, 0x7F, 0xFF},
+	"cyan":       {0x00, 0xFF, 0xFF, 0xFF},
+	"blue":       {0x00, 0x00, 0xFF, 0xFF},
+	"purple":     {0x7F, 0x00, 0xFF, 0xFF},
+	"magenta":    {0xFF, 0x00, 0xFF, 0xFF},
+}
+
+// returns the color of the argument, a name, "#RRGGBB", "#RRGGBBAA" or the
+// number 0xRRGGBBAA, as FCEUX takes them
+func checkColor(state *lua.LState, n int, fallback color.RGBA) color.RGBA {
+	switch value := state.Get(n); value.Type() {
+	case lua.LTNil:
+		return fallback
+	case lua.LTNumber:
+		rgba := uint32(int64(lua.LVAsNumber(value)))
+		return premultiply(color.NRGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)})
+	case lua.LTString:
+		text := strings.ToLower(value.String())
+		if c, ok := colorNames[text]; ok {
+			return c
+		}
+		hex := strings.TrimPrefix(text, "#")
+		rgba, err := strconv.ParseUint(hex, 16, 32)
+		if err == nil && len(hex) == 6 {
+			rgba = rgba<<8 | 0xFF
+		}
+		if err == nil && (len(hex) == 6 || len(hex) == 8) {
+			return premultiply(color.NRGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)})
+		}
+	}
+	state.ArgError(n, "invalid color")
+	return fallback
+}
+
+// the overlay keeps the colors with the alpha premultiplied, as the frontend draws them
+func premultiply(c color.NRGBA) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+// ----- gui -----
+
+// gui.text(x, y, text, [color])
+func (script *Script) guiText(state *lua.LState) int {
+	script.overlay.Texts = append(script.overlay.Texts, Text{
+		X:     state.CheckInt(1),
+		Y:     state.CheckInt(2),
+		Text:  state.ToStringMeta(state.Get(3)).String(),
+		Color: checkColor(state, 4, colorNames["white"]),
+	})
+	script.overlay.Empty = false
+	return 0
+}
+
+// gui.box(x1, y1, x2, y2, [fill color, [outline color]]), the fill is the
+// outline color with a quarter of its alpha when it is not given
+func (script *Script) guiBox(state *lua.LState) int {
+	x1, y1 := state.CheckInt(1), state.CheckInt(2)
+	x2, y2 := state.CheckInt(3), state.CheckInt(4)
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	outline := checkColor(state, 6, colorNames["white"])
+	fill := checkColor(state, 5, color.RGBA{R: outline.R / 4, G: outline.G / 4, B: outline.B / 4, A: outline.A / 4})
+	script.overlay.fill(image.Rect(x1+1, y1+1, x2, y2), fill)
+	script.overlay.line(x1, y1, x2, y1, outline)
+	script.overlay.line(x1, y2, x2, y2, outline)
+	script.overlay.line(x1, y1+1, x1, y2-1, outline)
+	script.overlay.line(x2, y1+1, x2, y2-1, outline)
+	return 0
+}
+
+// gui.pixel(x, y, color)
+func (script *Script) guiPixel(state *lua.LState) int {
+	script.overlay.blend(state.CheckInt(1), state.CheckInt(2), checkColor(state, 3, colorNames["white"]))
+	return 0
+}
+
+// gui.line(x1, y1, x2, y2, [color])
+func (script *Script) guiLine(state *lua.LState) int {
+	script.overlay.line(state.CheckInt(1), state.CheckInt(2), state.CheckInt(3), state.CheckInt(4), checkColor(state, 5, colorNames["white"]))
+	return 0
+}
@@ -0,0 +1,176 @@
+package script
+
+import (
+	"log"
+	"path/filepath"
+	"vsasakiv/nesemulator/cpu"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Script runs a lua script along the emulation, with the api of the FCEUX
+// scripts: the main chunk runs in a coroutine that emu.frameadvance suspends
+// until the next frame, and the callbacks run from the frame loop and the cpu
+type Script struct {
+	state  *lua.LState
+	thread *lua.LState
+	main   *lua.LFunction
+	// the main chunk returned, the callbacks keep running
+	finished bool
+	// the error that stopped the script, nil while it runs
+	err error
+
+	// callbacks of emu.registerbefore, emu.registerafter, emu.registerexit and gui.register
+	before, after, exit, gui *lua.LFunction
+	// callbacks of memory.registerwrite and memory.registerexec, by address
+	writes, executes map[uint16]*lua.LFunction
+	removeHook       func()
+
+	// buttons forced by joypad.set for the next frame, by port
+	joypads [2]map[uint]bool
+	overlay *Overlay
+}
+
+// Load compiles the script and prepares it to run, it starts on the next frame
+func Load(path string) (*Script, error) {
+	state := lua.NewState()
+	script := &Script{
+		state:    state,
+		writes:   make(map[uint16]*lua.LFunction),
+		executes: make(map[uint16]*lua.LFunction),
+		overlay:  NewOverlay(),
+	}
+	// the scripts require the modules next to them
+	packageTable := state.GetField(state.GetGlobal("package"), "path")
+	state.SetField(state.GetGlobal("package"), "path", lua.LString(filepath.Join(filepath.Dir(path), "?.lua")+";"+packageTable.String()))
+	script.register()
+
+	main, err := state.LoadFile(path)
+	if err != nil {
+		state.Close()
+		return nil, err
+	}
+	script.main = main
+	script.thread, _ = state.NewThread()
+	script.removeHook = cpu.AddHook(script.cpuAccess)
+	return script, nil
+}
+
+// Close calls the exit callback and detaches the script
+func (script *Script) Close() {
+	if script.exit != nil && script.err == nil {
+		script.call(script.exit)
+	}
+	script.removeHook()
+	script.state.Close()
+}
+
+// returns the error that stopped the script, nil while it is running
+func (script *Script) Err() error {
+	return script.err
+}
+
+// returns whether the main chunk returned or the script stopped with an error
+func (script *Script) Done() bool {
+	return script.finished || script.err != nil
+}
+
+// returns whether the script still runs something every frame
+func (script *Script) Running() bool {
+	if script.err != nil {
+		return false
+	}
+	return !script.finished || script.before != nil || script.after != nil || script.gui != nil ||
+		len(script.writes) > 0 || len(script.executes) > 0
+}
+
+func (script *Script) Overlay() *Overlay {
+	return script.overlay
+}
+
+// stops the script with the error, it keeps the emulator running
+func (script *Script) fail(err error) {
+	if script.err == nil {
+		script.err = err
+		log.Println("Lua script stopped:", err)
+	}
+}
+
+// calls a callback, the errors stop the script
+func (script *Script) call(fn *lua.LFunction, args ...lua.LValue) {
+	if script.err != nil {
+		return
+	}
+	if err := script.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...); err != nil {
+		script.fail(err)
+	}
+}
+
+// ----- Frame loop -----
+
+// BeforeFrame runs the main chunk up to its next emu.frameadvance and the
+// emu.registerbefore callback, then applies the buttons set by the script,
+// it must be called after the input of the frame is read
+func (script *Script) BeforeFrame() {
+	if script.err != nil {
+		return
+	}
+	script.overlay.Clear()
+	if !script.finished {
+		state, err, _ := script.state.Resume(script.thread, script.main)
+		switch {
+		case state == lua.ResumeError:
+			script.fail(err)
+			return
+		case state == lua.ResumeOK:
+			script.finished = true
+		}
+	}
+	if script.before != nil {
+		script.call(script.before)
+	}
+	script.applyJoypads()
+}
+
+// AfterFrame runs the emu.registerafter and gui.register callbacks
+func (script *Script) AfterFrame() {
+	script.AfterHiddenFrame()
+	if script.gui != nil {
+		script.call(script.gui)
+	}
+}
+
+// AfterHiddenFrame runs the emu.registerafter callback of a frame that is not
+// drawn, as the frames the netplay rollback emulates again
+func (script *Script) AfterHiddenFrame() {
+	if script.after != nil {
+		script.call(script.after)
+	}
+}
+
+// ----- Memory callbacks -----
+
+func (script *Script) cpuAccess(kind int, addr uint16, val uint8) {
+	var fn *lua.LFunction
+	switch kind {
+	case cpu.AccessWrite:
+		fn = script.writes[addr]
+	case cpu.AccessExecute:
+		fn = script.executes[addr]
+	}
+	if fn != nil {
+		// FCEUX passes the address, the size of the access and the value
+		script.call(fn, lua.LNumber(addr), lua.LNumber(1), lua.LNumber(val))
+	}
+}
+
+// registers the callback for size addresses from the address, a nil callback removes them
+func registerRange(callbacks map[uint16]*lua.LFunction, addr uint16, size int, fn *lua.LFunction) {
+	for i := range size {
+		if fn == nil {
+			delete(callbacks, addr+uint16(i))
+		} else {
+			callbacks[addr+uint16(i)] = fn
+		}
+	}
+}
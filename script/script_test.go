@@ -0,0 +1,276 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/controller"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/ppu"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+// writes the script to a temporary file and loads it with the test rom
+func loadScript(t *testing.T, source string) *Script {
+	t.Helper()
+	console.LoadRom(testRom)
+	path := filepath.Join(t.TempDir(), "test.lua")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(script.Close)
+	return script
+}
+
+// runs the frames as the frontend does
+func runFrames(script *Script, frames int) {
+	for range frames {
+		script.BeforeFrame()
+		console.RunFrame(nil)
+		script.AfterFrame()
+	}
+}
+
+func global(script *Script, name string) lua.LValue {
+	return script.state.GetGlobal(name)
+}
+
+func TestFrameAdvance(t *testing.T) {
+	script := loadScript(t, `
+		frames = {}
+		for i = 1, 3 do
+			frames[i] = emu.framecount()
+			emu.frameadvance()
+		end
+		done = true
+	`)
+	runFrames(script, 3)
+	if script.Done() {
+		t.Fatal("the script returned before its last frameadvance")
+	}
+	runFrames(script, 1)
+	if !script.Done() || script.Err() != nil || global(script, "done") != lua.LTrue {
+		t.Fatalf("the script did not finish, %v", script.Err())
+	}
+	frames := global(script, "frames").(*lua.LTable)
+	for i := 1; i <= 3; i++ {
+		if frame := lua.LVAsNumber(frames.RawGetInt(i)); int(frame) != i-1 {
+			t.Errorf("frame %d was counted as %v", i, frame)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	script := loadScript(t, `
+		memory.writebyte(0x0300, 0xFE)
+		memory.writebyte(0x0301, 0x12)
+		byte = memory.readbyte(0x0300)
+		signed = memory.readbytesigned(0x0300)
+		word = memory.readword(0x0300)
+		mirror = memory.readbyte(0x0B00)
+		range = memory.readbyterange(0x0300, 2)
+	`)
+	runFrames(script, 1)
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	for name, want := range map[string]lua.LValue{
+		"byte":   lua.LNumber(0xFE),
+		"signed": lua.LNumber(-2),
+		"word":   lua.LNumber(0x12FE),
+		"mirror": lua.LNumber(0xFE),
+		"range":  lua.LString("\xFE\x12"),
+	} {
+		if got := global(script, name); got != want {
+			t.Errorf("%s is %v, want %v", name, got, want)
+		}
+	}
+	if cpu.PeekMemory(0x0300) != 0xFE {
+		t.Errorf("$0300 was not written")
+	}
+}
+
+func TestWriteRegisters(t *testing.T) {
+	script := loadScript(t, `
+		writes = 0
+		memory.registerwrite(0x2006, 2, function() writes = writes + 1 end)
+		memory.writebyte(0x2006, 0x21)
+		memory.writebyte(0x2006, 0x00)
+		memory.writebyte(0x2007, 0x42)
+	`)
+	script.BeforeFrame()
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	if val := ppu.PeekMemory(0x2100); val != 0x42 {
+		t.Errorf("the nametable byte written through $2007 is %02X, want 42", val)
+	}
+	if writes := global(script, "writes"); writes != lua.LNumber(0) {
+		t.Errorf("the writes of the script called %v write callbacks, want none", writes)
+	}
+}
+
+func TestMemoryCallbacks(t *testing.T) {
+	// nestest writes $D4 a few times during its first frames
+	script := loadScript(t, `
+		writes = 0
+		executes = 0
+		memory.registerwrite(0xD4, function(addr, size, value)
+			writes = writes + 1
+			last = value
+		end)
+		memory.registerexecute(0xC004, function() executes = executes + 1 end)
+	`)
+	runFrames(script, 5)
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	if writes := lua.LVAsNumber(global(script, "writes")); writes == 0 {
+		t.Error("the write callback was not called")
+	}
+	if last := global(script, "last"); last != lua.LNumber(cpu.PeekMemory(0xD4)) {
+		t.Errorf("the last write was %v, want %02X", last, cpu.PeekMemory(0xD4))
+	}
+	// the reset code runs once, and again after a reset
+	if executes := lua.LVAsNumber(global(script, "executes")); executes != 1 {
+		t.Errorf("the execute callback was called %v times, want 1", executes)
+	}
+	console.Reset()
+	runFrames(script, 1)
+	if executes := lua.LVAsNumber(global(script, "executes")); executes != 2 {
+		t.Errorf("the execute callback was called %v times after the reset, want 2", executes)
+	}
+}
+
+func TestJoypad(t *testing.T) {
+	script := loadScript(t, `
+		while true do
+			joypad.set(1, {A = true, right = true})
+			emu.frameadvance()
+			pad = joypad.get(1)
+		end
+	`)
+	runFrames(script, 1)
+	if console.JoyPad1.GetButtonStatus(controller.A) != 1 || console.JoyPad1.GetButtonStatus(controller.RIGHT) != 1 {
+		t.Fatal("joypad.set did not press the buttons")
+	}
+	if console.JoyPad1.GetButtonStatus(controller.B) != 0 {
+		t.Fatal("joypad.set pressed a button it left out")
+	}
+	runFrames(script, 1)
+	pad := global(script, "pad").(*lua.LTable)
+	if pad.RawGetString("A") != lua.LTrue || pad.RawGetString("B") != lua.LFalse {
+		t.Errorf("joypad.get returned A=%v B=%v", pad.RawGetString("A"), pad.RawGetString("B"))
+	}
+}
+
+func TestGui(t *testing.T) {
+	script := loadScript(t, `
+		gui.register(function()
+			gui.box(10, 10, 20, 20, "red", "#00FF00")
+			gui.pixel(0, 0, 0x0000FFFF)
+			gui.line(30, 30, 40, 35)
+			gui.text(50, 60, "hello")
+		end)
+	`)
+	runFrames(script, 1)
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	overlay := script.Overlay()
+	for _, test := range []struct {
+		x, y    int
+		r, g, b uint8
+	}{
+		{10, 10, 0x00, 0xFF, 0x00},
+		{15, 15, 0xFF, 0x00, 0x00},
+		{0, 0, 0x00, 0x00, 0xFF},
+		{30, 30, 0xFF, 0xFF, 0xFF},
+		{40, 35, 0xFF, 0xFF, 0xFF},
+	} {
+		if c := overlay.Image.RGBAAt(test.x, test.y); c.R != test.r || c.G != test.g || c.B != test.b || c.A != 0xFF {
+			t.Errorf("the pixel at %d,%d is %v", test.x, test.y, c)
+		}
+	}
+	if c := overlay.Image.RGBAAt(100, 100); c.A != 0 {
+		t.Errorf("an undrawn pixel is %v", c)
+	}
+	if len(overlay.Texts) != 1 || overlay.Texts[0] != (Text{X: 50, Y: 60, Text: "hello", Color: colorNames["white"]}) {
+		t.Errorf("the texts are %+v", overlay.Texts)
+	}
+
+	// the overlay is cleared before the next frame is drawn
+	script.gui = nil
+	runFrames(script, 1)
+	if !overlay.Empty || len(overlay.Texts) != 0 || overlay.Image.RGBAAt(15, 15).A != 0 {
+		t.Error("the overlay was not cleared")
+	}
+}
+
+func TestAfterHiddenFrame(t *testing.T) {
+	script := loadScript(t, `
+		after, drawn = 0, 0
+		emu.registerafter(function() after = after + 1 end)
+		gui.register(function() drawn = drawn + 1 end)
+	`)
+	script.BeforeFrame()
+	console.RunFrame(nil)
+	script.AfterHiddenFrame()
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	if after, drawn := global(script, "after"), global(script, "drawn"); after != lua.LNumber(1) || drawn != lua.LNumber(0) {
+		t.Errorf("the hidden frame ran the after callback %v times and the gui one %v, want 1 and 0", after, drawn)
+	}
+}
+
+func TestBit(t *testing.T) {
+	script := loadScript(t, `
+		results = {
+			bit.band(0xF0, 0x3C), bit.bor(0xF0, 0x0F), bit.bxor(0xFF, 0x0F),
+			bit.lshift(1, 4), bit.rshift(0x80, 7), AND(0x0F, 0x05), OR(1, 2), BIT(3),
+		}
+		hex = bit.tohex(255, 2) .. bit.tohex(0xABCD, -4)
+	`)
+	runFrames(script, 1)
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	results := global(script, "results").(*lua.LTable)
+	for i, want := range []int{0x30, 0xFF, 0xF0, 0x10, 0x01, 0x05, 0x03, 0x08} {
+		if got := lua.LVAsNumber(results.RawGetInt(i + 1)); int(got) != want {
+			t.Errorf("result %d is %v, want %d", i+1, got, want)
+		}
+	}
+	if hex := global(script, "hex"); hex != lua.LString("ffABCD") {
+		t.Errorf("tohex returned %v", hex)
+	}
+}
+
+func TestError(t *testing.T) {
+	script := loadScript(t, `
+		emu.registerafter(function() after = (after or 0) + 1 end)
+		emu.frameadvance()
+		error("boom")
+	`)
+	runFrames(script, 1)
+	if script.Err() != nil {
+		t.Fatal(script.Err())
+	}
+	runFrames(script, 2)
+	if script.Err() == nil || !script.Done() || script.Running() {
+		t.Fatal("the error did not stop the script")
+	}
+	// the callbacks stop with the script
+	if after := lua.LVAsNumber(global(script, "after")); after != 1 {
+		t.Errorf("the after callback ran %v times, want 1", after)
+	}
+}
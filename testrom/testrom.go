@@ -0,0 +1,200 @@
+package testrom
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// frames run before a rom is given up on when the options give none, a
+// minute of emulation, the longest blargg roms take about half of it
+const DefaultMaxFrames = 3600
+
+// the blargg roms write their status at $6000 once the signature at $6001 is
+// set, the text of the result follows at $6004
+const (
+	statusAddr    = 0x6000
+	signatureAddr = 0x6001
+	textAddr      = 0x6004
+	// the test is running, or asks for the reset button to be pressed
+	statusRunning = 0x80
+	statusReset   = 0x81
+	// frames the reset button is pressed after, the roms ask for at least 100ms
+	resetDelay = 6
+)
+
+var signature = []uint8{0xDE, 0xB0, 0x61}
+
+type Options struct {
+	// frames run for each rom, DefaultMaxFrames if 0
+	MaxFrames uint
+	// hash of the last frame of the roms that only report on the screen, by
+	// the name of the rom file
+	Hashes map[string]string
+}
+
+// Result of a rom, the ones without the $6000 protocol are judged by the
+// hash of their last frame
+type Result struct {
+	Name   string
+	Passed bool
+	// the status at $6000, 0 when passed, -1 for the roms judged by their frame
+	Status int
+	// the text at $6004, the frame hash or why the rom failed to run
+	Message string
+	Frames  uint
+}
+
+// Run loads the rom and runs it without window or audio until it reports its result
+func Run(path string, options Options) (result Result) {
+	result = Result{Name: filepath.Base(path), Status: -1}
+	maxFrames := options.MaxFrames
+	if maxFrames == 0 {
+		maxFrames = DefaultMaxFrames
+	}
+	// a rom the emulator can't load or run fails instead of stopping the others
+	defer func() {
+		if err := recover(); err != nil {
+			result.Passed = false
+			result.Message = fmt.Sprintf("panic: %v", err)
+			result.Frames = console.Frame()
+		}
+	}()
+
+	if err := console.LoadRom(path); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	protocol := false
+	resetFrame := uint(0)
+	for console.Frame() < maxFrames {
+		console.RunFrame(nil)
+		if !hasSignature() {
+			continue
+		}
+		protocol = true
+		status := cpu.PeekMemory(statusAddr)
+		switch {
+		case status == statusReset && resetFrame == 0:
+			resetFrame = console.Frame() + resetDelay
+		case status == statusReset && console.Frame() >= resetFrame:
+			console.Reset()
+			resetFrame = 0
+		case status < statusRunning:
+			result.Status = int(status)
+			result.Passed = status == 0
+			result.Message = readText()
+			result.Frames = console.Frame()
+			return result
+		}
+	}
+
+	result.Frames = console.Frame()
+	if protocol {
+		result.Message = "timed out: " + readText()
+		return result
+	}
+	hash := console.FrameHash()
+	expected, ok := options.Hashes[result.Name]
+	result.Passed = ok && hash == expected
+	result.Message = "frame " + hash
+	if !ok {
+		result.Message += " (no expected hash)"
+	}
+	return result
+}
+
+func hasSignature() bool {
+	for i, val := range signature {
+		if cpu.PeekMemory(signatureAddr+uint16(i)) != val {
+			return false
+		}
+	}
+	return true
+}
+
+// reads the text at $6004 up to its terminating zero, on a single line
+func readText() string {
+	var text []byte
+	for addr := uint16(textAddr); addr <= 0x7FFF; addr++ {
+		val := cpu.PeekMemory(addr)
+		if val == 0 {
+			break
+		}
+		text = append(text, val)
+	}
+	return strings.Join(strings.Fields(string(text)), " ")
+}
+
+// RunDir runs the .nes files of the directory and its subdirectories, by name
+func RunDir(dir string, options Options) ([]Result, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".nes") {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	var results []Result
+	for _, path := range paths {
+		results = append(results, Run(path, options))
+	}
+	return results, nil
+}
+
+// ReadHashes reads the expected frame hashes, a line with the rom name and
+// the hash for each rom, the lines starting with # are comments
+func ReadHashes(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want the rom name and the frame hash", path, line)
+		}
+		hashes[fields[0]] = fields[1]
+	}
+	return hashes, scanner.Err()
+}
+
+// Table formats the results with a line for each rom and the totals
+func Table(results []Result) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ROM\tRESULT\tSTATUS\tFRAMES\tMESSAGE")
+	passed := 0
+	for _, result := range results {
+		verdict := "FAIL"
+		if result.Passed {
+			verdict = "pass"
+			passed++
+		}
+		status := "-"
+		if result.Status >= 0 {
+			status = fmt.Sprintf("$%02X", result.Status)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\n", result.Name, verdict, status, result.Frames, result.Message)
+	}
+	writer.Flush()
+	fmt.Fprintf(&builder, "%d of %d passed\n", passed, len(results))
+	return builder.String()
+}
@@ -0,0 +1,159 @@
+package testrom
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// directory of the test roms run by TestRoms, with an optional hashes.txt
+// for the roms that report on the screen, TEST_ROMS overrides it
+const defaultRomDir = "../testFiles/roms"
+
+// runs the roms in the directory and fails on each one that doesn't pass,
+// skipped when there are no roms
+func TestRoms(t *testing.T) {
+	dir := os.Getenv("TEST_ROMS")
+	if dir == "" {
+		dir = defaultRomDir
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("no test roms at %s", dir)
+	}
+	var options Options
+	hashes, err := ReadHashes(filepath.Join(dir, "hashes.txt"))
+	switch {
+	case err == nil:
+		options.Hashes = hashes
+	case !os.IsNotExist(err):
+		t.Fatal(err)
+	}
+
+	results, err := RunDir(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + Table(results))
+	for _, result := range results {
+		if !result.Passed {
+			t.Errorf("%s failed: %s", result.Name, result.Message)
+		}
+	}
+}
+
+// ----- Protocol -----
+
+// assembles the program into a 16KB nrom with the reset vector at $8000 and
+// battery backed prg ram for the protocol, and writes it to a file
+func writeRom(t *testing.T, name string, program []uint8) string {
+	t.Helper()
+	prg := make([]uint8, 0x4000)
+	copy(prg, program)
+	prg[0x3FFC] = 0x00
+	prg[0x3FFD] = 0x80
+	rom := append([]uint8{'N', 'E', 'S', 0x1A, 1, 1, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0}, prg...)
+	rom = append(rom, make([]uint8, 0x2000)...)
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, rom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// lda #val, sta addr for each byte
+func store(addr uint16, vals ...uint8) []uint8 {
+	var code []uint8
+	for i, val := range vals {
+		target := addr + uint16(i)
+		code = append(code, 0xA9, val, 0x8D, uint8(target), uint8(target>>8))
+	}
+	return code
+}
+
+// the signature and the text, then the status and a loop at the end, for
+// the program starting at base
+func reportProgram(base uint16, status uint8, text string) []uint8 {
+	program := store(0x6001, 0xDE, 0xB0, 0x61)
+	program = append(program, store(0x6004, append([]uint8(text), 0)...)...)
+	program = append(program, store(0x6000, status)...)
+	return append(program, loop(base+uint16(len(program)))...)
+}
+
+// jmp to itself
+func loop(addr uint16) []uint8 {
+	return []uint8{0x4C, uint8(addr), uint8(addr >> 8)}
+}
+
+func TestProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		passed  bool
+		status  int
+		message string
+	}{
+		{"passed.nes", reportProgram(0x8000, 0x00, "\nPassed\n"), true, 0, "Passed"},
+		{"failed.nes", reportProgram(0x8000, 0x03, "Failed #3"), false, 3, "Failed #3"},
+		{"running.nes", reportProgram(0x8000, 0x80, "Running"), false, -1, "timed out: Running"},
+	}
+	for _, test := range tests {
+		result := Run(writeRom(t, test.name, test.program), Options{MaxFrames: 10})
+		if result.Passed != test.passed || result.Status != test.status || result.Message != test.message {
+			t.Errorf("%s gave %+v", test.name, result)
+		}
+	}
+}
+
+func TestResetRequest(t *testing.T) {
+	// the first run counts itself at $6010 and asks for the reset, the run
+	// after the reset passes
+	request := []uint8{
+		// lda $6010, bne to the report, inc $6010
+		0xAD, 0x10, 0x60, 0xD0, 0x00, 0xEE, 0x10, 0x60,
+	}
+	request = append(request, store(0x6001, 0xDE, 0xB0, 0x61)...)
+	request = append(request, store(0x6000, 0x81)...)
+	request = append(request, loop(0x8000+uint16(len(request)))...)
+	request[4] = uint8(len(request) - 5)
+	program := append(request, reportProgram(0x8000+uint16(len(request)), 0x00, "Passed")...)
+
+	result := Run(writeRom(t, "reset.nes", program), Options{MaxFrames: 30})
+	if !result.Passed || result.Message != "Passed" {
+		t.Errorf("the rom asking for a reset gave %+v", result)
+	}
+}
+
+func TestScreenHash(t *testing.T) {
+	// the rom never writes the protocol, it is judged by its last frame
+	path := writeRom(t, "screen.nes", []uint8{0x4C, 0x00, 0x80})
+	result := Run(path, Options{MaxFrames: 5})
+	if result.Passed || !strings.HasPrefix(result.Message, "frame ") {
+		t.Fatalf("the rom without the protocol gave %+v", result)
+	}
+	hash := strings.Fields(result.Message)[1]
+	result = Run(path, Options{MaxFrames: 5, Hashes: map[string]string{"screen.nes": hash}})
+	if !result.Passed {
+		t.Errorf("the rom with the expected hash gave %+v", result)
+	}
+	if table := Table([]Result{result}); !strings.Contains(table, "screen.nes  pass") || !strings.HasSuffix(table, "1 of 1 passed\n") {
+		t.Errorf("table is\n%s", table)
+	}
+}
+
+func TestUnsupportedMapper(t *testing.T) {
+	path := writeRom(t, "cnrom.nes", loop(0x8000))
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mapper 3 with the battery
+	rom[6] = 0x32
+	if err := os.WriteFile(path, rom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := Run(path, Options{MaxFrames: 5})
+	if result.Passed || !strings.Contains(result.Message, "unsupported mapper 3") {
+		t.Errorf("the rom of mapper 3 gave %+v", result)
+	}
+}
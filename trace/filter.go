@@ -0,0 +1,110 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// Range is an inclusive range of cpu addresses
+type Range struct {
+	Start, End uint16
+}
+
+// Filter chooses the instructions that are traced, the empty filter traces all of them
+type Filter struct {
+	// the pc must be in one of the ranges
+	Ranges []Range
+	// the pc must be in one of the prg banks, of BankSize bytes, code out
+	// of the rom, as in the ram, is not in any bank
+	Banks    []int
+	BankSize int
+	// only the instructions run from this frame on
+	AfterFrame uint
+}
+
+func (filter *Filter) matches(pc uint16, frame uint) bool {
+	if frame < filter.AfterFrame {
+		return false
+	}
+	if len(filter.Ranges) > 0 {
+		found := false
+		for _, addressRange := range filter.Ranges {
+			if pc >= addressRange.Start && pc <= addressRange.End {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(filter.Banks) > 0 {
+		offset := cpu.MainMemory.Mapper.PrgOffset(pc)
+		if offset < 0 {
+			return false
+		}
+		bankSize := filter.BankSize
+		if bankSize == 0 {
+			bankSize = 0x4000
+		}
+		bank := offset / bankSize
+		found := false
+		for _, filterBank := range filter.Banks {
+			if bank == filterBank {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRanges parses comma separated hex addresses and ranges, as C000-C0FF,8000
+func ParseRanges(text string) ([]Range, error) {
+	var ranges []Range
+	for _, field := range strings.Split(text, ",") {
+		startText, endText, isRange := strings.Cut(strings.TrimSpace(field), "-")
+		start, err := parseHex(startText)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseHex(endText); err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("range %q ends before it starts", field)
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// ParseBanks parses comma separated bank numbers, as 0,3
+func ParseBanks(text string) ([]int, error) {
+	var banks []int
+	for _, field := range strings.Split(text, ",") {
+		bank, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || bank < 0 {
+			return nil, fmt.Errorf("invalid bank %q", field)
+		}
+		banks = append(banks, bank)
+	}
+	return banks, nil
+}
+
+func parseHex(text string) (uint16, error) {
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "$"), "0x")
+	value, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", text)
+	}
+	return uint16(value), nil
+}
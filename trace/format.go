@@ -0,0 +1,225 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"vsasakiv/nesemulator/cpu"
+	"vsasakiv/nesemulator/disasm"
+	"vsasakiv/nesemulator/ppu"
+)
+
+// formats of the trace lines, as written by other emulators
+const (
+	// nestest.log, as in
+	// C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+	FormatNestest = "nestest"
+	// FCEUX trace logger, as in
+	// f0      c7        $C000: 4C F5 C5  JMP $C5F5                          A:00 X:00 Y:00 S:FD P:nvUbdIzc V:0   H:21
+	FormatFceux = "fceux"
+	// Mesen trace logger, as in
+	// C000  JMP $C5F5                         A:00 X:00 Y:00 S:FD P:nvUbdIzc V:0   H:21  Fr:0 Cycle:7
+	FormatMesen = "mesen"
+)
+
+var Formats = []string{FormatNestest, FormatFceux, FormatMesen}
+
+// the state of the console before an instruction, what a trace line shows
+type step struct {
+	instruction    disasm.Instruction
+	a, x, y, p, sp uint8
+	scanline, dot  uint
+	cycles         uint
+	frame          uint
+}
+
+// memory operand of the instruction, the address it accesses and, for the
+// indirect modes, the pointer it was read from
+type operand struct {
+	hasAddress bool
+	addr       uint16
+	pointer    uint16
+	value      uint8
+}
+
+// resolves the address the instruction accesses, with the registers before it
+// runs, the memory is peeked so tracing has no side effects
+func resolve(step step) operand {
+	instruction := step.instruction
+	base := instruction.Operand
+	var result operand
+	switch instruction.Mode {
+	case disasm.ZeroPage, disasm.Absolute:
+		result.addr = base
+	case disasm.ZeroPageX:
+		result.addr = uint16(uint8(base) + step.x)
+	case disasm.ZeroPageY:
+		result.addr = uint16(uint8(base) + step.y)
+	case disasm.AbsoluteX:
+		result.addr = base + uint16(step.x)
+	case disasm.AbsoluteY:
+		result.addr = base + uint16(step.y)
+	case disasm.IndirectX:
+		pointer := uint8(base) + step.x
+		result.pointer = uint16(pointer)
+		result.addr = uint16(cpu.PeekMemory(uint16(pointer))) | uint16(cpu.PeekMemory(uint16(pointer+1)))<<8
+	case disasm.IndirectY:
+		pointer := uint8(base)
+		result.pointer = uint16(cpu.PeekMemory(uint16(pointer))) | uint16(cpu.PeekMemory(uint16(pointer+1)))<<8
+		result.addr = result.pointer + uint16(step.y)
+	case disasm.Indirect:
+		// the high byte is read from the start of the page when the pointer is at its end
+		high := base&0xFF00 | uint16(uint8(base)+1)
+		result.addr = uint16(cpu.PeekMemory(base)) | uint16(cpu.PeekMemory(high))<<8
+		return result
+	default:
+		return result
+	}
+	result.hasAddress = true
+	result.value = cpu.PeekMemory(result.addr)
+	return result
+}
+
+// returns whether the instruction jumps to its operand instead of accessing the memory there
+func isJump(instruction disasm.Instruction) bool {
+	return instruction.Mnemonic == cpu.JMP || instruction.Mnemonic == cpu.JSR
+}
+
+func formatLine(format string, step step) string {
+	switch format {
+	case FormatFceux:
+		return formatFceux(step)
+	case FormatMesen:
+		return formatMesen(step)
+	}
+	return formatNestest(step)
+}
+
+func formatNestest(step step) string {
+	instruction := step.instruction
+	operand := resolve(step)
+	// the apu and io registers are logged as FF in nestest.log
+	if operand.addr >= 0x4000 && operand.addr <= 0x401F {
+		operand.value = 0xFF
+	}
+	text := instruction.FormatOperand(nil)
+	switch instruction.Mode {
+	case disasm.ZeroPage, disasm.Absolute:
+		if !isJump(instruction) {
+			text += fmt.Sprintf(" = %02X", operand.value)
+		}
+	case disasm.ZeroPageX, disasm.ZeroPageY:
+		text += fmt.Sprintf(" @ %02X = %02X", operand.addr, operand.value)
+	case disasm.AbsoluteX, disasm.AbsoluteY:
+		text += fmt.Sprintf(" @ %04X = %02X", operand.addr, operand.value)
+	case disasm.Indirect:
+		text += fmt.Sprintf(" = %04X", operand.addr)
+	case disasm.IndirectX:
+		text += fmt.Sprintf(" @ %02X = %04X = %02X", operand.pointer, operand.addr, operand.value)
+	case disasm.IndirectY:
+		text += fmt.Sprintf(" = %04X @ %04X = %02X", operand.pointer, operand.addr, operand.value)
+	}
+
+	marker := " "
+	if instruction.Illegal {
+		marker = "*"
+	}
+	scanline, dot := nestestPosition(step.scanline, step.dot)
+	return fmt.Sprintf("%04X  %-9s%s%s %-28sA:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		instruction.Address, hexBytes(instruction), marker, instruction.Mnemonic, text,
+		step.a, step.x, step.y, step.p, step.sp, scanline, dot, step.cycles)
+}
+
+// nestest.log counts the ppu position from the power on of Nintendulator, at
+// the dot 0 of the scanline 0, and after the ppu clocks the last dot of the
+// cpu cycle, which here runs after the cpu
+func nestestPosition(scanline uint, dot uint) (uint, uint) {
+	const lineDots = 341
+	const frameDots = 262 * lineDots
+	powerOn := uint(ppu.PowerOnScanline*lineDots + ppu.PowerOnDot)
+	dots := (scanline*lineDots + dot + frameDots - powerOn + 1) % frameDots
+	return dots / lineDots, dots % lineDots
+}
+
+func formatFceux(step step) string {
+	instruction := step.instruction
+	operand := resolve(step)
+	text := instruction.Mnemonic
+	if operandText := instruction.FormatOperand(nil); operandText != "" {
+		text += " " + operandText
+	}
+	switch {
+	case instruction.Mode == disasm.Indirect:
+		text += fmt.Sprintf(" = $%04X", operand.addr)
+	case operand.hasAddress && !isJump(instruction):
+		if instruction.Mode != disasm.ZeroPage && instruction.Mode != disasm.Absolute {
+			text += fmt.Sprintf(" @ $%04X", operand.addr)
+		}
+		text += fmt.Sprintf(" = #$%02X", operand.value)
+	}
+
+	return fmt.Sprintf("f%-6d c%-8d $%04X: %-9s %-34s A:%02X X:%02X Y:%02X S:%02X P:%s V:%-3d H:%-3d",
+		step.frame, step.cycles, instruction.Address, hexBytes(instruction), text,
+		step.a, step.x, step.y, step.sp, flagLetters(step.p), step.scanline, step.dot)
+}
+
+func formatMesen(step step) string {
+	instruction := step.instruction
+	operand := resolve(step)
+	text := instruction.Mnemonic
+	if operandText := instruction.FormatOperand(nil); operandText != "" {
+		text += " " + operandText
+	}
+	switch {
+	case instruction.Mode == disasm.Indirect:
+		text += fmt.Sprintf(" [$%04X]", operand.addr)
+	case operand.hasAddress && !isJump(instruction):
+		if instruction.Mode != disasm.ZeroPage && instruction.Mode != disasm.Absolute {
+			text += fmt.Sprintf(" [$%04X]", operand.addr)
+		}
+		text += fmt.Sprintf(" = $%02X", operand.value)
+	}
+	return fmt.Sprintf("%04X  %-34s A:%02X X:%02X Y:%02X S:%02X P:%s V:%-3d H:%-3d Fr:%d Cycle:%d",
+		instruction.Address, text, step.a, step.x, step.y, step.sp, flagLetters(step.p),
+		step.scanline, step.dot, step.frame, step.cycles)
+}
+
+// returns the bytes of the instruction in hex, each followed by a space
+func hexBytes(instruction disasm.Instruction) string {
+	var builder strings.Builder
+	for _, b := range instruction.Bytes {
+		fmt.Fprintf(&builder, "%02X ", b)
+	}
+	return builder.String()
+}
+
+// returns the status flags as NVUBDIZC, in upper case when they are set
+func flagLetters(p uint8) string {
+	const letters = "nvubdizc"
+	var builder strings.Builder
+	for i := range 8 {
+		letter := letters[i]
+		if p&(0x80>>i) != 0 {
+			letter -= 'a' - 'A'
+		}
+		builder.WriteByte(letter)
+	}
+	return builder.String()
+}
+
+// returns the state before the instruction at the pc
+func currentStep(pc uint16, frame uint) step {
+	registers := cpu.GetCpu()
+	scanline, dot := ppu.GetPpu().Position()
+	return step{
+		instruction: disasm.Decode(cpu.PeekMemory, pc),
+		a:           registers.Acc,
+		x:           registers.Xidx,
+		y:           registers.Yidx,
+		p:           registers.Psts,
+		sp:          registers.Sptr,
+		scanline:    scanline,
+		dot:         dot,
+		cycles:      registers.Cycles(),
+		frame:       frame,
+	}
+}
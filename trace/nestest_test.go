@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+const (
+	testLog = "../testFiles/nestest.log"
+	// nestest runs its tests in less than a frame, the rest is for the failures
+	nestestFrames = 10
+)
+
+// nestest started at $C000 runs all its tests without a screen, every line of
+// its trace must be the one in nestest.log, with the ppu dot and the cycles
+func TestNestest(t *testing.T) {
+	want := readLines(t, testLog)
+	if err := console.LoadRom(testRom); err != nil {
+		t.Fatal(err)
+	}
+	// the automated mode starts after the reset at $C000, the reset vector of
+	// the 16KB rom is pointed there
+	console.Cartridge.PrgRom[0x3FFC] = 0x00
+	console.Cartridge.PrgRom[0x3FFD] = 0xC0
+	console.PowerOn()
+	var got []string
+	remove := cpu.AddHook(func(kind int, addr uint16, val uint8) {
+		if kind != cpu.AccessExecute || len(got) == len(want) {
+			return
+		}
+		got = append(got, formatNestest(currentStep(addr, console.Frame())))
+	})
+	defer remove()
+	for len(got) < len(want) && console.Frame() < nestestFrames {
+		console.RunFrame(nil)
+	}
+
+	for i := range want {
+		if i == len(got) {
+			t.Fatalf("the trace stopped after line %d of %d", len(got), len(want))
+		}
+		if got[i] != want[i] {
+			t.Fatalf("line %d differs from nestest.log\n%s", i+1, diffLine(want[i], got[i]))
+		}
+	}
+	// the codes of the failed tests, for the official and unofficial opcodes
+	if official, unofficial := cpu.PeekMemory(0x02), cpu.PeekMemory(0x03); official != 0 || unofficial != 0 {
+		t.Errorf("nestest failed with the codes $%02X and $%02X", official, unofficial)
+	}
+}
+
+// returns the expected and the traced line with the differing columns marked
+// between them
+func diffLine(want string, got string) string {
+	var marks strings.Builder
+	for i := range max(len(want), len(got)) {
+		if i < len(want) && i < len(got) && want[i] == got[i] {
+			marks.WriteByte(' ')
+		} else {
+			marks.WriteByte('^')
+		}
+	}
+	return "want " + want + "\n     " + marks.String() + "\ngot  " + got
+}
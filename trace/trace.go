@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"fmt"
+	"slices"
+	"vsasakiv/nesemulator/console"
+	"vsasakiv/nesemulator/cpu"
+)
+
+// number of rotated files kept when none is given
+const DefaultMaxFiles = 3
+
+type Options struct {
+	// one of Formats, nestest by default
+	Format string
+	Filter Filter
+	// size in bytes the file reaches before it is rotated, 0 never rotates
+	MaxSize int64
+	// rotated files kept besides the current one, 0 keeps none and the
+	// file starts again from empty
+	MaxFiles int
+}
+
+// Logger writes a line for each instruction the cpu runs, before it runs
+type Logger struct {
+	options Options
+	writer  *rotatingWriter
+	// the first error writing the file, the logger stops on it
+	err    error
+	remove func()
+}
+
+// Start traces the cpu to the file at the path
+func Start(path string, options Options) (*Logger, error) {
+	if options.Format == "" {
+		options.Format = FormatNestest
+	}
+	if !slices.Contains(Formats, options.Format) {
+		return nil, fmt.Errorf("unknown trace format %q, use one of %v", options.Format, Formats)
+	}
+	writer, err := newRotatingWriter(path, options.MaxSize, options.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	logger := &Logger{options: options, writer: writer}
+	logger.remove = cpu.AddHook(logger.cpuAccess)
+	return logger, nil
+}
+
+func (logger *Logger) cpuAccess(kind int, addr uint16, val uint8) {
+	if kind != cpu.AccessExecute || logger.err != nil {
+		return
+	}
+	frame := console.Frame()
+	if !logger.options.Filter.matches(addr, frame) {
+		return
+	}
+	if err := logger.writer.WriteLine(formatLine(logger.options.Format, currentStep(addr, frame))); err != nil {
+		logger.err = err
+		logger.remove()
+	}
+}
+
+// returns the error that stopped the trace, nil while it runs
+func (logger *Logger) Err() error {
+	return logger.err
+}
+
+// writes the buffered lines to the file
+func (logger *Logger) Flush() error {
+	if logger.err != nil {
+		return logger.err
+	}
+	return logger.writer.Flush()
+}
+
+// stops tracing and closes the file
+func (logger *Logger) Close() error {
+	logger.remove()
+	err := logger.writer.Close()
+	if logger.err != nil {
+		return logger.err
+	}
+	return err
+}
+
+// RunToFile runs the frames on the loaded console, without window or audio,
+// tracing them to the file
+func RunToFile(path string, frames uint, options Options) error {
+	logger, err := Start(path, options)
+	if err != nil {
+		return err
+	}
+	for range frames {
+		console.RunFrame(nil)
+		if logger.Err() != nil {
+			break
+		}
+	}
+	return logger.Close()
+}
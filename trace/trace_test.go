@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vsasakiv/nesemulator/console"
+)
+
+const testRom = "../testFiles/nestest.nes"
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestFormats(t *testing.T) {
+	// the reset handler of nestest starts with SEI, CLD, LDX #$FF, TXS, LDA $2002
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatNestest, []string{
+			"C004  78        SEI                             A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+			"C005  D8        CLD                             A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 27 CYC:9",
+		}},
+		{FormatFceux, []string{
+			"f0      c7        $C004: 78        SEI                                A:00 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:19 ",
+		}},
+		{FormatMesen, []string{
+			"C004  SEI                                A:00 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:19  Fr:0 Cycle:7",
+		}},
+	}
+	for _, test := range tests {
+		console.LoadRom(testRom)
+		path := filepath.Join(t.TempDir(), "trace.log")
+		if err := RunToFile(path, 1, Options{Format: test.format}); err != nil {
+			t.Fatal(err)
+		}
+		lines := readLines(t, path)
+		for i, want := range test.want {
+			if lines[i] != want {
+				t.Errorf("%s line %d is\n%q, want\n%q", test.format, i, lines[i], want)
+			}
+		}
+		if test.format == FormatNestest && !strings.HasPrefix(lines[4], "C009  AD 02 20  LDA $2002 = 00") {
+			t.Errorf("absolute operand traced as %q", lines[4])
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	console.LoadRom(testRom)
+	ranges, err := ParseRanges("C009-C00C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trace.log")
+	filter := Filter{Ranges: ranges, Banks: []int{0}}
+	if err := RunToFile(path, 3, Options{Filter: filter}); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, path)
+	if len(lines) == 0 {
+		t.Fatal("nothing traced")
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "C009") && !strings.HasPrefix(line, "C00C") {
+			t.Fatalf("traced the instruction out of the range: %q", line)
+		}
+	}
+
+	// the reset code runs only in the first frame
+	console.LoadRom(testRom)
+	filter = Filter{Ranges: ranges, AfterFrame: 1}
+	if err := RunToFile(path, 3, Options{Filter: filter}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLines(t, path); len(lines) != 0 {
+		t.Fatalf("traced %d instructions before the first frame", len(lines))
+	}
+
+	console.LoadRom(testRom)
+	if err := RunToFile(path, 3, Options{Filter: Filter{Banks: []int{1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLines(t, path); len(lines) != 0 {
+		t.Fatalf("traced %d instructions of a bank the rom does not have", len(lines))
+	}
+}
+
+func TestRotation(t *testing.T) {
+	console.LoadRom(testRom)
+	path := filepath.Join(t.TempDir(), "trace.log")
+	if err := RunToFile(path, 2, Options{MaxSize: 4096, MaxFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 4096+128 {
+			t.Errorf("%s has %d bytes, more than the maximum size", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more rotated files than the maximum")
+	}
+}
@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// size of the buffer of the trace file, a frame traces around 30000 instructions
+const bufferSize = 1 << 16
+
+// rotatingWriter writes the trace to a file and, when it reaches the
+// maximum size, renames it to path.1, the older path.1 to path.2, and so on,
+// up to the number of kept files
+type rotatingWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	file    *os.File
+	buffer  *bufio.Writer
+	written int64
+}
+
+func newRotatingWriter(path string, maxSize int64, maxFiles int) (*rotatingWriter, error) {
+	writer := &rotatingWriter{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *rotatingWriter) open() error {
+	file, err := os.Create(writer.path)
+	if err != nil {
+		return err
+	}
+	writer.file = file
+	writer.written = 0
+	if writer.buffer == nil {
+		writer.buffer = bufio.NewWriterSize(file, bufferSize)
+	} else {
+		writer.buffer.Reset(file)
+	}
+	return nil
+}
+
+func (writer *rotatingWriter) WriteLine(line string) error {
+	if writer.maxSize > 0 && writer.written >= writer.maxSize {
+		if err := writer.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := writer.buffer.WriteString(line)
+	if err == nil {
+		err = writer.buffer.WriteByte('\n')
+	}
+	writer.written += int64(n + 1)
+	return err
+}
+
+func (writer *rotatingWriter) rotate() error {
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if writer.maxFiles > 0 {
+		// the oldest file is overwritten
+		for i := writer.maxFiles - 1; i > 0; i-- {
+			os.Rename(rotatedPath(writer.path, i), rotatedPath(writer.path, i+1))
+		}
+		if err := os.Rename(writer.path, rotatedPath(writer.path, 1)); err != nil {
+			return err
+		}
+	}
+	return writer.open()
+}
+
+func rotatedPath(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+func (writer *rotatingWriter) Flush() error {
+	return writer.buffer.Flush()
+}
+
+func (writer *rotatingWriter) Close() error {
+	err := writer.buffer.Flush()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
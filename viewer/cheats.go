@@ -0,0 +1,78 @@
+package viewer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"vsasakiv/nesemulator/cheats"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// key that opens and closes the cheat list
+const CheatsKey = ebiten.KeyF6
+
+// CheatList enables and disables the cheats of the rom while it runs, the
+// changes are saved to the cheat file
+type CheatList struct {
+	open     bool
+	list     *cheats.List
+	selected int
+}
+
+func NewCheatList(list *cheats.List) *CheatList {
+	return &CheatList{list: list}
+}
+
+func (cheatList *CheatList) IsOpen() bool {
+	return cheatList.open
+}
+
+// Update handles the cheat list keys, it must be called every frame even when the list is closed
+func (cheatList *CheatList) Update() {
+	if inpututil.IsKeyJustPressed(CheatsKey) {
+		cheatList.open = !cheatList.open
+	}
+	if !cheatList.open {
+		return
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowDown):
+		cheatList.selected = min(cheatList.selected+1, max(len(cheatList.list.Cheats)-1, 0))
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowUp):
+		cheatList.selected = max(cheatList.selected-1, 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		cheatList.list.Toggle(cheatList.selected)
+		if err := cheatList.list.Save(); err != nil {
+			log.Println("Error saving the cheats:", err)
+		}
+	}
+}
+
+// Draw prints the cheat list on the screen, which must be Width x Height
+func (cheatList *CheatList) Draw(screen *ebiten.Image) {
+	if !cheatList.open {
+		return
+	}
+	screen.Fill(background)
+	var builder strings.Builder
+	builder.WriteString("CHEATS\n\n")
+	if len(cheatList.list.Cheats) == 0 {
+		builder.WriteString("NO CHEATS FOR THIS ROM, ADD THEM TO ITS .CHT FILE\n")
+	}
+	for i, cheat := range cheatList.list.Cheats {
+		cursor := " "
+		if i == cheatList.selected {
+			cursor = ">"
+		}
+		state := "OFF"
+		if cheat.Enabled {
+			state = "ON "
+		}
+		fmt.Fprintf(&builder, "%s%s %-12s %.56s\n", cursor, state, cheat.Code, cheat.Name)
+	}
+	ebitenutil.DebugPrint(screen, builder.String())
+	ebitenutil.DebugPrintAt(screen, "ENTER ENABLE/DISABLE", 4, Height-16)
+}
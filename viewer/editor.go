@@ -0,0 +1,220 @@
+package viewer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"vsasakiv/nesemulator/memory"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// key that opens and closes the memory editor
+const EditorKey = ebiten.KeyF3
+
+// keys used while the editor is open, the hex digits edit the byte at the cursor
+const (
+	nextRegionKey = ebiten.KeyTab
+	freezeKey     = ebiten.KeyEnter
+	watchKey      = ebiten.KeyW
+	unwatchKey    = ebiten.KeyBackspace
+)
+
+var hexKeys = [16]ebiten.Key{
+	ebiten.KeyDigit0, ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3,
+	ebiten.KeyDigit4, ebiten.KeyDigit5, ebiten.KeyDigit6, ebiten.KeyDigit7,
+	ebiten.KeyDigit8, ebiten.KeyDigit9, ebiten.KeyA, ebiten.KeyB,
+	ebiten.KeyC, ebiten.KeyD, ebiten.KeyE, ebiten.KeyF,
+}
+
+// layout of the editor, in lines of text
+const (
+	editorRowBytes  = 16
+	editorRows      = 16
+	editorWatchRows = 10
+)
+
+// Editor is a hex editor of the console memories, it reads the memory again
+// every frame, so the values change as the game runs, and keeps the watches
+type Editor struct {
+	open   bool
+	region int
+	cursor int
+	// first byte shown, the view scrolls to keep the cursor in it
+	top int
+	// high nibble typed, -1 until a digit is typed
+	nibble int
+	// file the watches are saved to when they change
+	watchPath string
+}
+
+// NewEditor creates the editor and loads the watches of the file
+func NewEditor(watchPath string) *Editor {
+	if err := memory.LoadWatches(watchPath); err != nil {
+		log.Println("Error loading the watches:", err)
+	}
+	return &Editor{nibble: -1, watchPath: watchPath}
+}
+
+func (editor *Editor) IsOpen() bool {
+	return editor.open
+}
+
+func (editor *Editor) currentRegion() *memory.Region {
+	return memory.Regions[editor.region]
+}
+
+// Update handles the editor keys, it must be called every frame even when the editor is closed
+func (editor *Editor) Update() {
+	if inpututil.IsKeyJustPressed(EditorKey) {
+		editor.open = !editor.open
+		editor.nibble = -1
+	}
+	if !editor.open {
+		return
+	}
+	region := editor.currentRegion()
+
+	switch {
+	case inpututil.IsKeyJustPressed(nextRegionKey):
+		editor.nextRegion()
+		return
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowRight):
+		editor.move(1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft):
+		editor.move(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowDown):
+		editor.move(editorRowBytes)
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowUp):
+		editor.move(-editorRowBytes)
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageDown):
+		editor.move(editorRowBytes * editorRows)
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageUp):
+		editor.move(-editorRowBytes * editorRows)
+	case inpututil.IsKeyJustPressed(freezeKey):
+		if _, frozen := memory.Frozen(region, editor.cursor); frozen {
+			memory.Unfreeze(region, editor.cursor)
+		} else {
+			memory.SetFreeze(region, editor.cursor, region.Read(editor.cursor))
+		}
+	case inpututil.IsKeyJustPressed(watchKey):
+		// a new watch starts as u8, watching the byte again changes its format
+		if i := memory.FindWatch(region, editor.cursor); i >= 0 {
+			memory.Watches[i].Format = memory.NextFormat(memory.Watches[i].Format)
+		} else {
+			memory.Watches = append(memory.Watches, memory.Watch{Region: region.Name, Offset: editor.cursor, Format: memory.FormatU8})
+		}
+		editor.saveWatches()
+	case inpututil.IsKeyJustPressed(unwatchKey):
+		if i := memory.FindWatch(region, editor.cursor); i >= 0 {
+			memory.Watches = append(memory.Watches[:i], memory.Watches[i+1:]...)
+			editor.saveWatches()
+		}
+	default:
+		for digit, key := range hexKeys {
+			if inpututil.IsKeyJustPressed(key) {
+				editor.typeDigit(uint8(digit))
+				break
+			}
+		}
+	}
+}
+
+// moves to the next region the cartridge has, the sram may be missing
+func (editor *Editor) nextRegion() {
+	for {
+		editor.region = (editor.region + 1) % len(memory.Regions)
+		if editor.currentRegion().Size() > 0 {
+			break
+		}
+	}
+	editor.cursor = 0
+	editor.top = 0
+	editor.nibble = -1
+}
+
+func (editor *Editor) move(delta int) {
+	size := editor.currentRegion().Size()
+	editor.cursor = min(max(editor.cursor+delta, 0), size-1)
+	editor.nibble = -1
+	// keeps the row of the cursor in the view
+	row := editor.cursor / editorRowBytes * editorRowBytes
+	if row < editor.top {
+		editor.top = row
+	}
+	if row >= editor.top+editorRows*editorRowBytes {
+		editor.top = row - (editorRows-1)*editorRowBytes
+	}
+}
+
+// the first digit is kept, the second writes the byte and moves to the next
+func (editor *Editor) typeDigit(digit uint8) {
+	if editor.nibble < 0 {
+		editor.nibble = int(digit)
+		return
+	}
+	region := editor.currentRegion()
+	value := uint8(editor.nibble)<<4 | digit
+	if _, frozen := memory.Frozen(region, editor.cursor); frozen {
+		memory.SetFreeze(region, editor.cursor, value)
+	} else {
+		region.Write(editor.cursor, value)
+	}
+	editor.move(1)
+}
+
+func (editor *Editor) saveWatches() {
+	if err := memory.SaveWatches(editor.watchPath); err != nil {
+		log.Println("Error saving the watches:", err)
+	}
+}
+
+// Draw prints the editor on the screen, which must be Width x Height
+func (editor *Editor) Draw(screen *ebiten.Image) {
+	if !editor.open {
+		return
+	}
+	screen.Fill(background)
+	region := editor.currentRegion()
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s $%04X-$%04X (TAB)  CURSOR $%04X\n\n", region.Name,
+		region.Address(0), region.Address(region.Size()-1), region.Address(editor.cursor))
+	// the cursor is marked by > and the frozen bytes by *
+	for row := editor.top; row < min(editor.top+editorRows*editorRowBytes, region.Size()); row += editorRowBytes {
+		fmt.Fprintf(&builder, "%04X:", region.Address(row))
+		for offset := row; offset < min(row+editorRowBytes, region.Size()); offset++ {
+			_, frozen := memory.Frozen(region, offset)
+			marker := " "
+			switch {
+			case offset == editor.cursor:
+				marker = ">"
+			case frozen:
+				marker = "*"
+			}
+			if offset == editor.cursor && editor.nibble >= 0 {
+				fmt.Fprintf(&builder, "%s%X_", marker, editor.nibble)
+			} else {
+				fmt.Fprintf(&builder, "%s%02X", marker, region.Read(offset))
+			}
+		}
+		builder.WriteByte('\n')
+	}
+
+	builder.WriteString("\nWATCHES\n")
+	for i, watch := range memory.Watches {
+		if i == editorWatchRows {
+			fmt.Fprintf(&builder, "... %d MORE\n", len(memory.Watches)-editorWatchRows)
+			break
+		}
+		label := watch.Label
+		if label == "" {
+			label = watch.Region
+		}
+		fmt.Fprintf(&builder, "%-12.12s $%04X %-5s %s\n", label, watch.Address(), watch.Format, watch.Value())
+	}
+	ebitenutil.DebugPrint(screen, builder.String())
+	ebitenutil.DebugPrintAt(screen, "0-F EDIT  ENTER FREEZE  W WATCH/FORMAT  BKSP UNWATCH", 4, Height-16)
+}
@@ -0,0 +1,167 @@
+package viewer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"vsasakiv/nesemulator/memory"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// key that opens and closes the cheat search
+const SearchKey = ebiten.KeyF4
+
+// keys of the filters, they compare with the typed number or, without one,
+// with the value at the last filter
+var comparisonKeys = map[ebiten.Key]int{
+	ebiten.KeyE: memory.Equal,
+	ebiten.KeyN: memory.NotEqual,
+	ebiten.KeyG: memory.Greater,
+	ebiten.KeyL: memory.Less,
+}
+
+const (
+	changedByKey   = ebiten.KeyC
+	resetSearchKey = ebiten.KeyR
+	signKey        = ebiten.KeyMinus
+)
+
+// results listed, the search must narrow them down to fit
+const searchRows = 22
+
+// Searcher finds the ram address of a game value, the game keeps running
+// while it is open, but it is usually closed to play between the filters
+type Searcher struct {
+	open     bool
+	search   *memory.Search
+	operand  string
+	selected int
+	// the last filter applied, shown so the user knows where they are
+	last string
+	// the watches added from the results are saved with the ones of the editor
+	editor *Editor
+}
+
+func NewSearcher(editor *Editor) *Searcher {
+	return &Searcher{editor: editor}
+}
+
+func (searcher *Searcher) IsOpen() bool {
+	return searcher.open
+}
+
+// Update handles the search keys, it must be called every frame even when the search is closed
+func (searcher *Searcher) Update() {
+	if inpututil.IsKeyJustPressed(SearchKey) {
+		searcher.open = !searcher.open
+		// the first search starts when it is first opened
+		if searcher.search == nil {
+			searcher.search = memory.NewSearch()
+			searcher.last = "NEW SEARCH"
+		}
+	}
+	if !searcher.open {
+		return
+	}
+
+	for key, comparison := range comparisonKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			searcher.applyComparison(comparison)
+			return
+		}
+	}
+	results := searcher.search.Results(searchRows)
+	switch {
+	case inpututil.IsKeyJustPressed(changedByKey):
+		if delta, err := strconv.Atoi(searcher.operand); err == nil {
+			searcher.search.FilterChangedBy(delta)
+			searcher.last = "CHANGED BY " + searcher.operand
+		}
+		searcher.operand = ""
+	case inpututil.IsKeyJustPressed(resetSearchKey):
+		searcher.search.Reset()
+		searcher.last = "NEW SEARCH"
+		searcher.operand = ""
+	case inpututil.IsKeyJustPressed(signKey):
+		if strings.HasPrefix(searcher.operand, "-") {
+			searcher.operand = searcher.operand[1:]
+		} else {
+			searcher.operand = "-" + searcher.operand
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && searcher.operand != "":
+		searcher.operand = searcher.operand[:len(searcher.operand)-1]
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowDown):
+		searcher.selected++
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowUp):
+		searcher.selected--
+	case inpututil.IsKeyJustPressed(freezeKey) && len(results) > 0:
+		results[searcher.selected].Freeze()
+	case inpututil.IsKeyJustPressed(watchKey) && len(results) > 0:
+		address := int(results[searcher.selected].Address)
+		if memory.FindWatch(memory.CpuRam, address) < 0 {
+			memory.Watches = append(memory.Watches, memory.Watch{Region: memory.CpuRam.Name, Offset: address, Format: memory.FormatU8})
+			searcher.editor.saveWatches()
+		}
+	default:
+		// the number typed is decimal, as the values seen in the game
+		for digit, key := range hexKeys[:10] {
+			if inpututil.IsKeyJustPressed(key) && len(searcher.operand) < 4 {
+				searcher.operand += strconv.Itoa(digit)
+			}
+		}
+	}
+	searcher.selected = min(max(searcher.selected, 0), max(len(searcher.search.Results(searchRows))-1, 0))
+}
+
+var comparisonNames = map[int]string{
+	memory.Equal:    "EQUAL",
+	memory.NotEqual: "NOT EQUAL",
+	memory.Greater:  "GREATER",
+	memory.Less:     "LESS",
+}
+
+func (searcher *Searcher) applyComparison(comparison int) {
+	if searcher.operand == "" {
+		searcher.search.FilterPrevious(comparison)
+		searcher.last = comparisonNames[comparison] + " TO PREVIOUS"
+		return
+	}
+	value, err := strconv.Atoi(searcher.operand)
+	searcher.operand = ""
+	if err != nil {
+		return
+	}
+	searcher.search.FilterValue(comparison, uint8(value))
+	searcher.last = fmt.Sprintf("%s TO %d", comparisonNames[comparison], value)
+}
+
+// Draw prints the search on the screen, which must be Width x Height
+func (searcher *Searcher) Draw(screen *ebiten.Image) {
+	if !searcher.open {
+		return
+	}
+	screen.Fill(background)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "CHEAT SEARCH  %d ADDRESSES\nLAST: %s\nNUMBER: %s_\n\n", searcher.search.Count(), searcher.last, searcher.operand)
+	builder.WriteString(" ADDR  PREV  NOW\n")
+	for i, result := range searcher.search.Results(searchRows) {
+		cursor := " "
+		if i == searcher.selected {
+			cursor = ">"
+		}
+		frozen := ""
+		if _, ok := memory.Frozen(memory.CpuRam, int(result.Address)); ok {
+			frozen = " FROZEN"
+		}
+		fmt.Fprintf(&builder, "%s$%04X  %3d  %3d%s\n", cursor, result.Address, result.Previous, result.Value, frozen)
+	}
+	if searcher.search.Count() > searchRows {
+		fmt.Fprintf(&builder, "  ... %d MORE\n", searcher.search.Count()-searchRows)
+	}
+	ebitenutil.DebugPrint(screen, builder.String())
+	ebitenutil.DebugPrintAt(screen, "E N G L COMPARE  C CHANGED BY  - SIGN  R RESET  ENTER FREEZE  W WATCH", 4, Height-16)
+}
@@ -0,0 +1,209 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"vsasakiv/nesemulator/ppu"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// key that opens and closes the ppu viewers
+const Key = ebiten.KeyF2
+
+// keys used while the viewers are open
+const (
+	nextPageKey    = ebiten.KeyTab
+	nextPaletteKey = ebiten.KeyP
+)
+
+// size of the viewers panel, the emulator window is scaled to it while it is open
+const (
+	Width  = ppu.NametablesWidth
+	Height = ppu.NametablesHeight
+)
+
+const (
+	patternsPage = iota
+	nametablesPage
+	spritesPage
+	palettesPage
+	totalPages
+)
+
+var pageNames = [totalPages]string{
+	patternsPage:   "PATTERN TABLES",
+	nametablesPage: "NAMETABLES",
+	spritesPage:    "OAM",
+	palettesPage:   "PALETTES",
+}
+
+var background = color.RGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xFF}
+
+// Viewer shows the ppu memory in a panel over the emulator screen, it is
+// drawn again every frame so it follows the game
+type Viewer struct {
+	open    bool
+	page    int
+	palette uint8
+
+	canvas *image.RGBA
+	image  *ebiten.Image
+}
+
+func New() *Viewer {
+	return &Viewer{
+		canvas: image.NewRGBA(image.Rect(0, 0, Width, Height)),
+		image:  ebiten.NewImage(Width, Height),
+	}
+}
+
+func (viewer *Viewer) IsOpen() bool {
+	return viewer.open
+}
+
+// Update handles the viewer keys, it must be called every frame even when the viewer is closed
+func (viewer *Viewer) Update() {
+	if inpututil.IsKeyJustPressed(Key) {
+		viewer.open = !viewer.open
+	}
+	if !viewer.open {
+		return
+	}
+	if inpututil.IsKeyJustPressed(nextPageKey) {
+		viewer.page = (viewer.page + 1) % totalPages
+	}
+	if inpututil.IsKeyJustPressed(nextPaletteKey) {
+		viewer.palette = (viewer.palette + 1) % ppu.Palettes
+	}
+}
+
+// Draw draws the current page on the screen, which must be Width x Height
+func (viewer *Viewer) Draw(screen *ebiten.Image) {
+	if !viewer.open {
+		return
+	}
+	draw.Draw(viewer.canvas, viewer.canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	var text string
+	switch viewer.page {
+	case patternsPage:
+		text = viewer.drawPatterns()
+	case nametablesPage:
+		text = viewer.drawNametables()
+	case spritesPage:
+		text = viewer.drawSprites()
+	case palettesPage:
+		text = viewer.drawPalettes()
+	}
+	viewer.image.WritePixels(viewer.canvas.Pix)
+	screen.DrawImage(viewer.image, nil)
+	if viewer.page == spritesPage || viewer.page == palettesPage {
+		// the labels are printed after the canvas is drawn, or it covers them
+		viewer.drawLabels(screen)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s (TAB) %s", pageNames[viewer.page], text), 4, Height-16)
+}
+
+// ----- Pages -----
+
+func (viewer *Viewer) drawPatterns() string {
+	for table := range uint16(2) {
+		drawScaled(viewer.canvas, ppu.PatternTable(table, viewer.palette), int(table)*Width/2, 0, 2)
+	}
+	// the colors of the selected palette under the tables
+	for i := range uint8(4) {
+		fillRect(viewer.canvas, int(i)*32, 2*ppu.PatternTableSize+8, 32, 32, ppu.PaletteColor(viewer.palette*4+i))
+	}
+	return fmt.Sprintf("PALETTE %d (P)", viewer.palette)
+}
+
+func (viewer *Viewer) drawNametables() string {
+	nametables := ppu.Nametables()
+	ppu.ScrollOverlay(nametables)
+	draw.Draw(viewer.canvas, nametables.Bounds(), nametables, image.Point{}, draw.Src)
+	x, y := ppu.GetPpu().Scroll()
+	return fmt.Sprintf("SCROLL %d,%d", x, y)
+}
+
+// layout of the sprites page, a grid of 8x8 cells with the sprite scaled
+// up and its attributes next to it
+const (
+	spriteCellWidth  = Width / 8
+	spriteCellHeight = (Height - 16) / 8
+	spriteScale      = 2
+)
+
+func (viewer *Viewer) drawSprites() string {
+	for i, sprite := range ppu.Sprites() {
+		x := i % 8 * spriteCellWidth
+		y := i / 8 * spriteCellHeight
+		drawScaled(viewer.canvas, ppu.SpriteImage(sprite), x+2, y+2, spriteScale)
+	}
+	return fmt.Sprintf("8x%d", ppu.SpriteHeight())
+}
+
+func (viewer *Viewer) drawPalettes() string {
+	for i := range uint8(ppu.PaletteRamSize) {
+		x, y := paletteCell(i)
+		fillRect(viewer.canvas, x, y, 28, 28, ppu.PaletteColor(i))
+	}
+	return "BACKGROUND $3F00, SPRITES $3F10"
+}
+
+// returns the position of the palette entry, a row of 4 palettes of 4 colors
+// for the background and another for the sprites
+func paletteCell(entry uint8) (int, int) {
+	return int(entry%16) * 32, int(entry/16)*80 + 32
+}
+
+func (viewer *Viewer) drawLabels(screen *ebiten.Image) {
+	switch viewer.page {
+	case spritesPage:
+		textX := 2 + 8*spriteScale + 4
+		for i, sprite := range ppu.Sprites() {
+			x := i%8*spriteCellWidth + textX
+			y := i / 8 * spriteCellHeight
+			flags := []byte("---")
+			if sprite.Behind() {
+				flags[0] = 'B'
+			}
+			if sprite.FlipHorizontal() {
+				flags[1] = 'H'
+			}
+			if sprite.FlipVertical() {
+				flags[2] = 'V'
+			}
+			label := fmt.Sprintf("%02X,%02X\nT%02X A%02X\nP%d %s", sprite.X, sprite.Y, sprite.Tile, sprite.Attributes, sprite.Palette(), flags)
+			ebitenutil.DebugPrintAt(screen, label, x, y)
+		}
+	case palettesPage:
+		for i, value := range ppu.PaletteRam() {
+			x, y := paletteCell(uint8(i))
+			ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%02X", value), x+6, y+30)
+		}
+	}
+}
+
+// ----- Drawing -----
+
+// draws the image with each pixel scaled to a square of scale pixels
+func drawScaled(dst *image.RGBA, src *image.RGBA, x, y int, scale int) {
+	bounds := src.Bounds()
+	for srcY := bounds.Min.Y; srcY < bounds.Max.Y; srcY++ {
+		for srcX := bounds.Min.X; srcX < bounds.Max.X; srcX++ {
+			pixel := src.RGBAAt(srcX, srcY)
+			if pixel.A == 0 {
+				continue
+			}
+			fillRect(dst, x+(srcX-bounds.Min.X)*scale, y+(srcY-bounds.Min.Y)*scale, scale, scale, pixel)
+		}
+	}
+}
+
+func fillRect(dst *image.RGBA, x, y, width, height int, c color.RGBA) {
+	draw.Draw(dst, image.Rect(x, y, x+width, y+height), image.NewUniform(c), image.Point{}, draw.Src)
+}